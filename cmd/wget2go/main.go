@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
@@ -13,6 +14,11 @@ func main() {
 
 	// 执行命令
 	if err := app.Execute(); err != nil {
+		// 与shell的约定一致，被SIGINT中断时以130退出
+		if errors.Is(err, cli.ErrInterrupted) {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(130)
+		}
 		fmt.Fprintf(os.Stderr, "错误: %v\n", err)
 		os.Exit(1)
 	}
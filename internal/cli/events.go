@@ -0,0 +1,84 @@
+package cli
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// 事件类型
+const (
+	EventStarted   = "started"
+	EventProgress  = "progress"
+	EventCompleted = "completed"
+	EventFailed    = "failed"
+)
+
+// Event --output-format=json模式下输出的事件，每个事件一行
+type Event struct {
+	Type          string  `json:"type"`
+	Time          string  `json:"time"`
+	URL           string  `json:"url,omitempty"`
+	Output        string  `json:"output,omitempty"`
+	Bytes         int64   `json:"bytes"`
+	Total         int64   `json:"total"`
+	Speed         int64   `json:"speed"` // 字节/秒
+	ETA           float64 `json:"eta"`   // 剩余秒数
+	ActiveThreads int     `json:"active_threads"`
+	Error         string  `json:"error,omitempty"`
+}
+
+// jsonEvents 以换行分隔的JSON输出下载事件，同时作为进度显示器使用
+type jsonEvents struct {
+	mu  sync.Mutex
+	enc *json.Encoder
+}
+
+// newJSONEvents 创建JSON事件输出
+func newJSONEvents(w io.Writer) *jsonEvents {
+	return &jsonEvents{enc: json.NewEncoder(w)}
+}
+
+// emit 输出一个事件，非JSON模式下e为nil，不输出
+func (e *jsonEvents) emit(event Event) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	event.Time = time.Now().Format(time.RFC3339Nano)
+	e.enc.Encode(event)
+}
+
+// started 文件开始下载
+func (e *jsonEvents) started(url, output string) {
+	e.emit(Event{Type: EventStarted, URL: url, Output: output})
+}
+
+// completed 文件下载完成
+func (e *jsonEvents) completed(url, output string, bytes int64) {
+	e.emit(Event{Type: EventCompleted, URL: url, Output: output, Bytes: bytes, Total: bytes})
+}
+
+// failed 文件下载失败
+func (e *jsonEvents) failed(url, output string, err error) {
+	e.emit(Event{Type: EventFailed, URL: url, Output: output, Error: err.Error()})
+}
+
+// Render 每次进度更新输出一个progress事件
+func (e *jsonEvents) Render(progress types.ProgressInfo) {
+	e.emit(Event{
+		Type:          EventProgress,
+		Bytes:         progress.Downloaded,
+		Total:         progress.TotalSize,
+		Speed:         progress.Speed,
+		ETA:           progress.RemainingTime.Seconds(),
+		ActiveThreads: progress.ActiveThreads,
+	})
+}
+
+func (e *jsonEvents) Clear()  {}
+func (e *jsonEvents) Finish() {}
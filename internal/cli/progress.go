@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// ProgressRenderer 进度显示方式
+type ProgressRenderer interface {
+	// Render 显示一次进度更新
+	Render(progress types.ProgressInfo)
+	// Clear 在输出普通消息前清理当前进度行
+	Clear()
+	// Finish 结束当前文件的进度显示
+	Finish()
+}
+
+// 输出不是终端时进度条和逐行显示的最短刷新间隔，避免日志文件被大量进度行占满
+const nonTerminalRedrawInterval = 5 * time.Second
+
+// newProgressRenderer 根据--progress的值创建进度显示器，speedUnit为--report-speed的速度单位
+// auto在标准输出为终端时使用进度条，否则使用点状显示
+func newProgressRenderer(style string, quiet bool, speedUnit string, w io.Writer) ProgressRenderer {
+	if quiet {
+		style = types.ProgressNone
+	}
+	terminal := isTerminal(w)
+	if style == types.ProgressAuto {
+		style = types.ProgressBar
+		if !terminal {
+			style = types.ProgressDot
+		}
+	}
+
+	formatSpeed := speedFormatter(speedUnit)
+	var renderer ProgressRenderer
+	switch style {
+	case types.ProgressBar:
+		renderer = &barRenderer{w: w, formatSpeed: formatSpeed}
+	case types.ProgressDot:
+		// 点状显示只在数据增加时输出，不需要限制刷新频率
+		return &dotRenderer{w: w, formatSpeed: formatSpeed}
+	case types.ProgressLine:
+		renderer = &lineRenderer{w: w, formatSpeed: formatSpeed}
+	default:
+		return noopRenderer{}
+	}
+	if !terminal {
+		renderer = &throttledRenderer{ProgressRenderer: renderer, interval: nonTerminalRedrawInterval}
+	}
+	return renderer
+}
+
+// speedFormatter 返回--report-speed对应的速度格式化函数
+func speedFormatter(unit string) func(int64) string {
+	if unit == types.ReportSpeedBits {
+		return utils.FormatBitRate
+	}
+	return utils.FormatSpeed
+}
+
+// isTerminal 检查输出是否为终端
+func isTerminal(w io.Writer) bool {
+	f, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// noopRenderer 不显示进度
+type noopRenderer struct{}
+
+func (noopRenderer) Render(types.ProgressInfo) {}
+func (noopRenderer) Clear()                    {}
+func (noopRenderer) Finish()                   {}
+
+// throttledRenderer 限制进度的刷新频率，跳过的最后一次更新在Finish时输出
+type throttledRenderer struct {
+	ProgressRenderer
+	interval time.Duration
+
+	mu      sync.Mutex
+	last    time.Time
+	skipped bool
+	latest  types.ProgressInfo
+}
+
+func (r *throttledRenderer) Render(progress types.ProgressInfo) {
+	r.mu.Lock()
+	now := time.Now()
+	if !r.last.IsZero() && now.Sub(r.last) < r.interval {
+		r.latest = progress
+		r.skipped = true
+		r.mu.Unlock()
+		return
+	}
+	r.last = now
+	r.skipped = false
+	r.mu.Unlock()
+	r.ProgressRenderer.Render(progress)
+}
+
+func (r *throttledRenderer) Finish() {
+	r.mu.Lock()
+	skipped, latest := r.skipped, r.latest
+	r.last = time.Time{}
+	r.skipped = false
+	r.mu.Unlock()
+	if skipped {
+		r.ProgressRenderer.Render(latest)
+	}
+	r.ProgressRenderer.Finish()
+}
+
+// barRenderer 单行刷新的进度条
+type barRenderer struct {
+	w           io.Writer
+	formatSpeed func(int64) string
+	mu          sync.Mutex
+	active      bool
+}
+
+func (r *barRenderer) Render(progress types.ProgressInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	barWidth := 50
+	filled := int(float64(barWidth) * progress.Percentage / 100)
+	if filled > barWidth {
+		filled = barWidth
+	} else if filled < 0 {
+		filled = 0
+	}
+	bar := strings.Repeat("█", filled) + strings.Repeat("░", barWidth-filled)
+
+	fmt.Fprintf(r.w, "\r%.1f%% [%s] %s/%s %s ETA: %s",
+		progress.Percentage, bar, utils.FormatSize(progress.Downloaded), utils.FormatSize(progress.TotalSize),
+		r.formatSpeed(progress.Speed), utils.FormatDuration(progress.RemainingTime))
+	r.active = true
+}
+
+func (r *barRenderer) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active {
+		fmt.Fprint(r.w, "\r\033[K")
+		r.active = false
+	}
+}
+
+func (r *barRenderer) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.active {
+		fmt.Fprintln(r.w)
+		r.active = false
+	}
+}
+
+// dotRenderer 点状进度显示，适合日志文件和不支持Unicode的终端
+// 与wget的dot:mega样式一致：每个点64K，每组8个点，每行48个点（3M）
+type dotRenderer struct {
+	w           io.Writer
+	formatSpeed func(int64) string
+	mu          sync.Mutex
+	dots        int64
+	midLine     bool
+}
+
+const (
+	dotSize      = 64 * 1024
+	dotsPerGroup = 8
+	dotsPerLine  = 48
+)
+
+func (r *dotRenderer) Render(progress types.ProgressInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	target := progress.Downloaded / dotSize
+	if target < r.dots {
+		// 新文件开始
+		r.finish()
+	}
+
+	for r.dots < target {
+		if !r.midLine {
+			fmt.Fprintf(r.w, "%7dK", r.dots*dotSize/1024)
+			r.midLine = true
+		}
+		if r.dots%dotsPerGroup == 0 {
+			fmt.Fprint(r.w, " ")
+		}
+		fmt.Fprint(r.w, ".")
+		r.dots++
+
+		if r.dots%dotsPerLine == 0 {
+			fmt.Fprintf(r.w, " %s\n", r.lineSummary(progress))
+			r.midLine = false
+		}
+	}
+}
+
+func (r *dotRenderer) Clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.endLine()
+}
+
+func (r *dotRenderer) Finish() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finish()
+}
+
+func (r *dotRenderer) finish() {
+	r.endLine()
+	r.dots = 0
+}
+
+// endLine 结束未满的一行，之后的点从新行继续
+func (r *dotRenderer) endLine() {
+	if r.midLine {
+		fmt.Fprintln(r.w)
+		r.midLine = false
+	}
+}
+
+// lineSummary 点状显示每行末尾的百分比和速度
+func (r *dotRenderer) lineSummary(progress types.ProgressInfo) string {
+	if progress.TotalSize > 0 {
+		return fmt.Sprintf("%3.0f%% %s", progress.Percentage, r.formatSpeed(progress.Speed))
+	}
+	return r.formatSpeed(progress.Speed)
+}
+
+// lineRenderer 每次更新输出一行，适合日志文件
+type lineRenderer struct {
+	w           io.Writer
+	formatSpeed func(int64) string
+	mu          sync.Mutex
+}
+
+func (r *lineRenderer) Render(progress types.ProgressInfo) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	fmt.Fprintf(r.w, "进度: %.1f%% %s/%s %s ETA: %s\n",
+		progress.Percentage, utils.FormatSize(progress.Downloaded), utils.FormatSize(progress.TotalSize),
+		r.formatSpeed(progress.Speed), utils.FormatDuration(progress.RemainingTime))
+}
+
+func (r *lineRenderer) Clear()  {}
+func (r *lineRenderer) Finish() {}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"fmt"
+
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// verifyHashManifest 按校验和清单校验本地文件，有不匹配或缺失的文件时返回错误
+func (cli *CLI) verifyHashManifest(manifestPath string) error {
+	results, err := utils.VerifyChecksumManifest(manifestPath)
+	if err != nil {
+		return err
+	}
+
+	var passed, mismatched, missing, unreadable int
+	for _, result := range results {
+		switch {
+		case result.OK():
+			passed++
+			if cli.config.Verbose {
+				fmt.Fprintf(cli.out, "✓ %s\n", result.Path)
+			}
+		case result.Missing():
+			missing++
+			fmt.Fprintf(cli.out, "✗ 缺失: %s\n", result.Path)
+		case result.Err != nil:
+			unreadable++
+			fmt.Fprintf(cli.out, "✗ 读取失败: %s: %v\n", result.Path, result.Err)
+		default:
+			mismatched++
+			fmt.Fprintf(cli.out, "✗ 不匹配: %s (%s 期望 %s, 实际 %s)\n", result.Path, result.Algorithm, result.Expected, result.Actual)
+		}
+	}
+
+	fmt.Fprintf(cli.out, "\n已校验 %d 个文件: 通过 %d, 不匹配 %d, 缺失 %d, 读取失败 %d\n", len(results), passed, mismatched, missing, unreadable)
+	if passed != len(results) {
+		return fmt.Errorf("校验失败: %d 个文件未通过校验", len(results)-passed)
+	}
+	return nil
+}
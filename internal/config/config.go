@@ -1,11 +1,18 @@
 package config
 
 import (
+	"crypto/sha256"
+	"encoding/base64"
 	"fmt"
+	"net"
 	"os"
 	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 
+	tlsCore "github.com/example/wget2go/internal/core/tls"
 	"github.com/example/wget2go/internal/core/types"
 	"github.com/example/wget2go/internal/core/utils"
 	"github.com/spf13/viper"
@@ -13,8 +20,9 @@ import (
 
 // ConfigManager 配置管理器
 type ConfigManager struct {
-	config *types.Config
-	viper  *viper.Viper
+	config  *types.Config
+	viper   *viper.Viper
+	cliKeys map[string]bool // 命令行中显式指定的选项（viper键名）
 }
 
 // NewConfigManager 创建配置管理器
@@ -41,24 +49,91 @@ func (cm *ConfigManager) GetViper() *viper.Viper {
 	return cm.viper
 }
 
+// SetCommandLineKeys 记录命令行中显式指定的选项，这些选项不会被配置文件hosts中的主机设置覆盖
+func (cm *ConfigManager) SetCommandLineKeys(keys []string) {
+	cm.cliKeys = make(map[string]bool, len(keys))
+	for _, key := range keys {
+		cm.cliKeys[key] = true
+	}
+}
+
 // setDefaults 设置默认值
 func setDefaults(v *viper.Viper) {
 	v.SetDefault("output_file", "")
 	v.SetDefault("output_document", "")
 	v.SetDefault("continue", false)
+	v.SetDefault("temp_dir", "")
+	v.SetDefault("preallocate", false)
+	v.SetDefault("timestamping", false)
+	v.SetDefault("no_use_server_timestamps", false)
 	v.SetDefault("chunk_size", "1M")
-	v.SetDefault("max_threads", 5)
+	v.SetDefault("expected_size", "0")
+	v.SetDefault("max_filesize", "0")
+	v.SetDefault("quota", "0")
+	v.SetDefault("max_threads", "5")
+	v.SetDefault("max_connections_per_host", 4)
+	v.SetDefault("max_concurrent_downloads", 4)
 	v.SetDefault("limit_rate", "0")
 	v.SetDefault("timeout", "30s")
+	v.SetDefault("connect_timeout", "")
+	v.SetDefault("read_timeout", "")
+	v.SetDefault("max_retry_wait", "60s")
+	v.SetDefault("wait_retry", "")
+	v.SetDefault("max_retries_total", 0)
+	v.SetDefault("tries", 20)
+	v.SetDefault("retry_on_empty", 0)
+	v.SetDefault("max_header_size", "1M")
+	v.SetDefault("max_headers", 500)
+	v.SetDefault("compression", "identity")
+	v.SetDefault("bind_address", "")
+	v.SetDefault("unix_socket", "")
+	v.SetDefault("inet4_only", false)
+	v.SetDefault("inet6_only", false)
+	v.SetDefault("http11_only", false)
+	v.SetDefault("http2", false)
+	v.SetDefault("dns_cache", false)
+	v.SetDefault("dns_cache_ttl", "1m")
+	v.SetDefault("dns_servers", "")
 	v.SetDefault("user_agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36")
 	v.SetDefault("referer", "")
+	v.SetDefault("post_data", "")
+	v.SetDefault("post_file", "")
+	v.SetDefault("input_file", "")
+	v.SetDefault("base", "")
+	v.SetDefault("expand", false)
+	v.SetDefault("downloaded_log", "")
+	v.SetDefault("input_file_continue", false)
+	v.SetDefault("content_disposition", false)
+	v.SetDefault("trust_server_names", false)
+	v.SetDefault("restrict_file_names", "")
 	v.SetDefault("recursive", false)
 	v.SetDefault("recursive_level", 5)
+	v.SetDefault("mirror", false)
+	v.SetDefault("traversal", types.TraversalBFS)
 	v.SetDefault("convert_links", false)
+	v.SetDefault("extract_data_uris", false)
+	v.SetDefault("data_uri_min_size", "1K")
 	v.SetDefault("page_requisites", false)
+	v.SetDefault("no_parent", false)
+	v.SetDefault("accept_regex", "")
+	v.SetDefault("reject_regex", "")
+	v.SetDefault("adjust_extension", false)
+	v.SetDefault("no_host_directories", false)
+	v.SetDefault("cut_dirs", 0)
+	v.SetDefault("dir_timestamps", false)
+	v.SetDefault("cache", false)
+	v.SetDefault("manifest", "")
 	v.SetDefault("max_redirects", 10)
 	v.SetDefault("follow_redirects", true)
+	v.SetDefault("post_redirect_strip_auth", true)
 	v.SetDefault("insecure", false)
+	v.SetDefault("no_check_certificate", "")
+	v.SetDefault("certificate", "")
+	v.SetDefault("private_key", "")
+	v.SetDefault("ca_certificate", "")
+	v.SetDefault("pinnedpubkey", "")
+	v.SetDefault("check_ocsp", false)
+	v.SetDefault("ocsp_soft_fail", false)
 	v.SetDefault("proxy_url", "")
 	v.SetDefault("http_proxy", "")
 	v.SetDefault("https_proxy", "")
@@ -66,10 +141,25 @@ func setDefaults(v *viper.Viper) {
 	v.SetDefault("proxy_enabled", true)
 	v.SetDefault("proxy_username", "")
 	v.SetDefault("proxy_password", "")
+	v.SetDefault("proxy_rotation", types.ProxyRotationSticky)
+	v.SetDefault("ftp_user", "")
+	v.SetDefault("ftp_password", "")
 	v.SetDefault("quiet", false)
 	v.SetDefault("verbose", false)
-	v.SetDefault("progress", true)
+	v.SetDefault("progress", types.ProgressAuto)
+	v.SetDefault("output_format", types.OutputFormatText)
+	v.SetDefault("progress_interval", "1s")
+	v.SetDefault("report_speed", types.ReportSpeedBytes)
 	v.SetDefault("metalink", false)
+	v.SetDefault("keep_bad_hash", false)
+	v.SetDefault("checksum", "")
+	v.SetDefault("checksum_manifest", "")
+	v.SetDefault("verify_digest", false)
+	v.SetDefault("hash_manifest_verify", "")
+	v.SetDefault("spider", false)
+	v.SetDefault("privacy_report", false)
+	v.SetDefault("no_iri", false)
+	v.SetDefault("no_canonicalize", false)
 	v.SetDefault("robots_txt", true)
 }
 
@@ -91,7 +181,7 @@ func loadConfigFile(v *viper.Viper) {
 	if err := v.ReadInConfig(); err != nil {
 		// 配置文件不存在是正常的
 		if _, ok := err.(viper.ConfigFileNotFoundError); !ok {
-			fmt.Printf("警告: 读取配置文件失败: %v\n", err)
+			fmt.Fprintf(os.Stderr, "警告: 读取配置文件失败: %v\n", err)
 		}
 	}
 }
@@ -121,6 +211,34 @@ func (cm *ConfigManager) Parse() (*types.Config, error) {
 		return nil, fmt.Errorf("解析chunk_size失败: %w", err)
 	}
 
+	// 解析期望的文件大小
+	expectedSize, err := parseSize(cm.viper.GetString("expected_size"))
+	if err != nil {
+		return nil, fmt.Errorf("解析expected_size失败: %w", err)
+	}
+
+	// 解析单个文件大小上限和总下载配额
+	maxFileSize, err := parseSize(cm.viper.GetString("max_filesize"))
+	if err != nil {
+		return nil, fmt.Errorf("解析max_filesize失败: %w", err)
+	}
+	quota, err := parseSize(cm.viper.GetString("quota"))
+	if err != nil {
+		return nil, fmt.Errorf("解析quota失败: %w", err)
+	}
+
+	// 解析保持内联的data: URL大小
+	dataURIMinSize, err := parseSize(cm.viper.GetString("data_uri_min_size"))
+	if err != nil {
+		return nil, fmt.Errorf("解析data_uri_min_size失败: %w", err)
+	}
+
+	// 解析最大线程数，auto按CPU数量确定上限
+	maxThreads, autoThreads, err := parseMaxThreads(cm.viper.GetString("max_threads"))
+	if err != nil {
+		return nil, fmt.Errorf("解析max_threads失败: %w", err)
+	}
+
 	// 解析限速
 	limitRateStr := cm.viper.GetString("limit_rate")
 	limitRate, err := parseSize(limitRateStr)
@@ -135,31 +253,331 @@ func (cm *ConfigManager) Parse() (*types.Config, error) {
 		return nil, fmt.Errorf("解析timeout失败: %w", err)
 	}
 
+	// 解析进度刷新间隔
+	progressInterval, err := time.ParseDuration(cm.viper.GetString("progress_interval"))
+	if err != nil {
+		return nil, fmt.Errorf("解析progress_interval失败: %w", err)
+	}
+	if progressInterval <= 0 {
+		return nil, fmt.Errorf("progress_interval必须大于0")
+	}
+
+	// 解析响应头大小限制
+	maxHeaderSize, err := parseSize(cm.viper.GetString("max_header_size"))
+	if err != nil {
+		return nil, fmt.Errorf("解析max_header_size失败: %w", err)
+	}
+
+	// 解析连接和读取超时，未设置时使用timeout
+	connectTimeout, err := parseOptionalDuration(cm.viper.GetString("connect_timeout"))
+	if err != nil {
+		return nil, fmt.Errorf("解析connect_timeout失败: %w", err)
+	}
+	readTimeout, err := parseOptionalDuration(cm.viper.GetString("read_timeout"))
+	if err != nil {
+		return nil, fmt.Errorf("解析read_timeout失败: %w", err)
+	}
+
+	// 解析重试最长等待时间
+	maxRetryWait, err := time.ParseDuration(cm.viper.GetString("max_retry_wait"))
+	if err != nil {
+		return nil, fmt.Errorf("解析max_retry_wait失败: %w", err)
+	}
+	waitRetry, err := parseOptionalDuration(cm.viper.GetString("wait_retry"))
+	if err != nil {
+		return nil, fmt.Errorf("解析wait_retry失败: %w", err)
+	}
+	if waitRetry < 0 {
+		return nil, fmt.Errorf("wait_retry不能为负数")
+	}
+
+	// 检查重试总次数
+	maxRetriesTotal := cm.viper.GetInt("max_retries_total")
+	if maxRetriesTotal < 0 {
+		return nil, fmt.Errorf("max_retries_total不能为负数")
+	}
+
+	// 检查分片的尝试次数
+	tries := cm.viper.GetInt("tries")
+	if tries < 1 {
+		return nil, fmt.Errorf("tries必须大于0")
+	}
+
+	// 解析压缩格式
+	compression, err := parseCompression(cm.viper.GetString("compression"))
+	if err != nil {
+		return nil, fmt.Errorf("解析compression失败: %w", err)
+	}
+
+	// 检查绑定的本地地址
+	bindAddress := strings.TrimSpace(cm.viper.GetString("bind_address"))
+	if bindAddress != "" && net.ParseIP(bindAddress) == nil {
+		return nil, fmt.Errorf("无效的bind_address: %s", bindAddress)
+	}
+	unixSocket := cm.viper.GetString("unix_socket")
+	if unixSocket != "" && bindAddress != "" {
+		return nil, fmt.Errorf("unix_socket和bind_address不能同时使用")
+	}
+	if cm.viper.GetString("post_data") != "" && cm.viper.GetString("post_file") != "" {
+		return nil, fmt.Errorf("post_data和post_file不能同时使用")
+	}
+	if cm.viper.GetBool("inet4_only") && cm.viper.GetBool("inet6_only") {
+		return nil, fmt.Errorf("inet4_only和inet6_only不能同时使用")
+	}
+	if cm.viper.GetBool("http11_only") && cm.viper.GetBool("http2") {
+		return nil, fmt.Errorf("http11_only和http2不能同时使用")
+	}
+
+	// 解析DNS缓存有效期和DNS服务器
+	dnsCacheTTL, err := time.ParseDuration(cm.viper.GetString("dns_cache_ttl"))
+	if err != nil {
+		return nil, fmt.Errorf("解析dns_cache_ttl失败: %w", err)
+	}
+	if dnsCacheTTL <= 0 {
+		return nil, fmt.Errorf("dns_cache_ttl必须大于0")
+	}
+	dnsServers, err := parseDNSServers(cm.viper.GetString("dns_servers"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 检查递归遍历顺序
+	traversal := strings.ToLower(strings.TrimSpace(cm.viper.GetString("traversal")))
+	if traversal != types.TraversalBFS && traversal != types.TraversalDFS {
+		return nil, fmt.Errorf("无效的traversal值: %s（可选: bfs, dfs）", traversal)
+	}
+
+	// 解析进度显示方式
+	progressStyle, err := parseProgressStyle(cm.viper.GetString("progress"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析速度单位
+	reportSpeed := strings.ToLower(strings.TrimSpace(cm.viper.GetString("report_speed")))
+	if reportSpeed != types.ReportSpeedBytes && reportSpeed != types.ReportSpeedBits {
+		return nil, fmt.Errorf("无效的report_speed值: %s（可选: bytes, bits）", reportSpeed)
+	}
+
+	// 解析输出格式
+	outputFormat := strings.ToLower(strings.TrimSpace(cm.viper.GetString("output_format")))
+	switch outputFormat {
+	case "":
+		outputFormat = types.OutputFormatText
+	case types.OutputFormatText, types.OutputFormatJSON:
+	default:
+		return nil, fmt.Errorf("无效的output_format值: %s（可选: text, json）", outputFormat)
+	}
+
+	// 校验和格式为 算法:值
+	if checksum := cm.viper.GetString("checksum"); checksum != "" {
+		if _, _, err := utils.ParseChecksum(checksum); err != nil {
+			return nil, fmt.Errorf("无效的checksum值: %w", err)
+		}
+	}
+
+	// --input-file-continue依赖下载日志
+	if cm.viper.GetBool("input_file_continue") && cm.viper.GetString("downloaded_log") == "" {
+		return nil, fmt.Errorf("input_file_continue需要同时设置downloaded_log")
+	}
+
+	// 解析链接改写规则，在此校验正则表达式
+	rewrites, err := parseRewrites(cm.viper.GetStringSlice("rewrite"))
+	if err != nil {
+		return nil, err
+	}
+	if len(rewrites) > 0 && !cm.viper.GetBool("convert_links") {
+		return nil, fmt.Errorf("rewrite需要同时设置convert_links")
+	}
+
+	// 解析递归下载的URL过滤正则表达式，在此报告语法错误
+	acceptRegex, err := parseOptionalRegex("accept_regex", cm.viper.GetString("accept_regex"))
+	if err != nil {
+		return nil, err
+	}
+	rejectRegex, err := parseOptionalRegex("reject_regex", cm.viper.GetString("reject_regex"))
+	if err != nil {
+		return nil, err
+	}
+
+	// data: URL在转换链接时解码
+	if cm.viper.GetBool("extract_data_uris") && !cm.viper.GetBool("convert_links") {
+		return nil, fmt.Errorf("extract_data_uris需要同时设置convert_links")
+	}
+
+	// 解析代理选择方式
+	proxyRotation := strings.ToLower(strings.TrimSpace(cm.viper.GetString("proxy_rotation")))
+	switch proxyRotation {
+	case "":
+		proxyRotation = types.ProxyRotationSticky
+	case types.ProxyRotationSticky, types.ProxyRotationRoundRobin:
+	default:
+		return nil, fmt.Errorf("无效的proxy_rotation值: %s（可选: sticky, round-robin）", proxyRotation)
+	}
+
+	// 检查文件名限制模式
+	if err := utils.ValidateRestrictFileNames(cm.viper.GetString("restrict_file_names")); err != nil {
+		return nil, fmt.Errorf("无效的restrict_file_names值: %w", err)
+	}
+
+	// 检查每个主机的连接数限制
+	maxConnectionsPerHost := cm.viper.GetInt("max_connections_per_host")
+	if maxConnectionsPerHost < 0 {
+		return nil, fmt.Errorf("max_connections_per_host不能为负数")
+	}
+
+	// 检查同时下载的文件数
+	maxConcurrentDownloads := cm.viper.GetInt("max_concurrent_downloads")
+	if maxConcurrentDownloads < 1 {
+		return nil, fmt.Errorf("max_concurrent_downloads必须大于0")
+	}
+
+	// 解析去除的目录级数
+	cutDirs := cm.viper.GetInt("cut_dirs")
+	if cutDirs < 0 {
+		return nil, fmt.Errorf("cut_dirs不能为负数")
+	}
+
+	if cm.viper.GetString("private_key") != "" && cm.viper.GetString("certificate") == "" {
+		return nil, fmt.Errorf("private_key需要同时设置certificate")
+	}
+
+	if cm.viper.GetBool("ocsp_soft_fail") && !cm.viper.GetBool("check_ocsp") {
+		return nil, fmt.Errorf("ocsp_soft_fail需要同时设置check_ocsp")
+	}
+
+	// --mirror等同于-r -N -l inf，并保留服务器时间戳；命令行显式指定的-l和--no-use-server-timestamps优先
+	if cm.viper.GetBool("mirror") {
+		cm.viper.Set("recursive", true)
+		cm.viper.Set("timestamping", true)
+		if !cm.cliKeys["recursive_level"] {
+			cm.viper.Set("recursive_level", 0)
+		}
+		if !cm.cliKeys["no_use_server_timestamps"] {
+			cm.viper.Set("no_use_server_timestamps", false)
+		}
+	}
+
+	// 解析跳过的证书检查，all与--insecure相同
+	insecure := cm.viper.GetBool("insecure")
+	skipCertExpiry, skipCertHostname, skipAll, err := parseNoCheckCertificate(cm.viper.GetString("no_check_certificate"))
+	if err != nil {
+		return nil, err
+	}
+	insecure = insecure || skipAll
+
+	// 解析服务器公钥固定
+	pinnedPubKeys, err := parsePinnedPubKeys(cm.viper.GetString("pinnedpubkey"))
+	if err != nil {
+		return nil, err
+	}
+
+	// 解析配置文件中按主机的设置
+	hosts, err := cm.parseHosts()
+	if err != nil {
+		return nil, err
+	}
+
 	// 构建配置
 	cm.config = &types.Config{
 		OutputFile:      cm.viper.GetString("output_file"),
 		OutputDocument:  cm.viper.GetString("output_document"),
 		Continue:        cm.viper.GetBool("continue"),
+		TempDir:         cm.viper.GetString("temp_dir"),
+		Preallocate:     cm.viper.GetBool("preallocate"),
+		Timestamping:    cm.viper.GetBool("timestamping"),
+		NoUseServerTimestamps: cm.viper.GetBool("no_use_server_timestamps"),
 		ChunkSize:       chunkSize,
-		MaxThreads:      cm.viper.GetInt("max_threads"),
+		ExpectedSize:    expectedSize,
+		MaxFileSize:     maxFileSize,
+		Quota:           quota,
+		MaxThreads:      maxThreads,
+		AutoThreads:     autoThreads,
+		MaxConnectionsPerHost: maxConnectionsPerHost,
+		MaxConcurrentDownloads: maxConcurrentDownloads,
 		LimitRate:       limitRate,
 		Timeout:         timeout,
+		ConnectTimeout:  connectTimeout,
+		ReadTimeout:     readTimeout,
+		MaxRetryWait:    maxRetryWait,
+		WaitRetry:       waitRetry,
+		MaxRetriesTotal: maxRetriesTotal,
+		Tries:           tries,
+		RetryOnEmpty:    max(cm.viper.GetInt("retry_on_empty"), 0),
+		MaxResponseHeaderBytes: maxHeaderSize,
+		MaxResponseHeaders:     cm.viper.GetInt("max_headers"),
+		Compression:     compression,
+		BindAddress:     bindAddress,
+		UnixSocket:      unixSocket,
+		Inet4Only:       cm.viper.GetBool("inet4_only"),
+		Inet6Only:       cm.viper.GetBool("inet6_only"),
+		HTTP11Only:      cm.viper.GetBool("http11_only"),
+		HTTP2:           cm.viper.GetBool("http2"),
+		DNSCache:        cm.viper.GetBool("dns_cache"),
+		DNSCacheTTL:     dnsCacheTTL,
+		DNSServers:      dnsServers,
 		UserAgent:       cm.viper.GetString("user_agent"),
 		Referer:         cm.viper.GetString("referer"),
+		PostData:        cm.viper.GetString("post_data"),
+		PostFile:        cm.viper.GetString("post_file"),
 		Headers:         parseHeaders(cm.viper.GetStringSlice("header")),
 		Cookies:         parseCookies(cm.viper.GetString("cookie")),
+		InputFile:       cm.viper.GetString("input_file"),
+		Base:            cm.viper.GetString("base"),
+		Expand:          cm.viper.GetBool("expand"),
+		DownloadedLog:   cm.viper.GetString("downloaded_log"),
+		InputFileContinue: cm.viper.GetBool("input_file_continue"),
+		ContentDisposition: cm.viper.GetBool("content_disposition"),
+		TrustServerNames: cm.viper.GetBool("trust_server_names"),
+		RestrictFileNames: cm.viper.GetString("restrict_file_names"),
 		Recursive:       cm.viper.GetBool("recursive"),
 		RecursiveLevel:  cm.viper.GetInt("recursive_level"),
+		Traversal:       traversal,
 		ConvertLinks:    cm.viper.GetBool("convert_links"),
+		Rewrites:        rewrites,
+		ExtractDataURIs: cm.viper.GetBool("extract_data_uris"),
+		DataURIMinSize:  dataURIMinSize,
 		PageRequisites:  cm.viper.GetBool("page_requisites"),
+		NoParent:        cm.viper.GetBool("no_parent"),
+		AcceptRegex:     acceptRegex,
+		RejectRegex:     rejectRegex,
+		AdjustExtension: cm.viper.GetBool("adjust_extension"),
+		NoHostDirectories: cm.viper.GetBool("no_host_directories"),
+		CutDirs:         cutDirs,
+		DirTimestamps:   cm.viper.GetBool("dir_timestamps"),
+		Cache:           cm.viper.GetBool("cache"),
+		Manifest:        cm.viper.GetString("manifest"),
 		MaxRedirects:    cm.viper.GetInt("max_redirects"),
 		FollowRedirects: cm.viper.GetBool("follow_redirects"),
-		Insecure:        cm.viper.GetBool("insecure"),
+		RedirectKeepAuth: !cm.viper.GetBool("post_redirect_strip_auth"),
+		Insecure:        insecure,
+		SkipCertExpiry:  skipCertExpiry,
+		SkipCertHostname: skipCertHostname,
+		Certificate:     cm.viper.GetString("certificate"),
+		PrivateKey:      cm.viper.GetString("private_key"),
+		CACertificate:   cm.viper.GetString("ca_certificate"),
+		PinnedPubKeys:   pinnedPubKeys,
+		CheckOCSP:       cm.viper.GetBool("check_ocsp"),
+		OCSPSoftFail:    cm.viper.GetBool("ocsp_soft_fail"),
 		Quiet:           cm.viper.GetBool("quiet"),
 		Verbose:         cm.viper.GetBool("verbose"),
-		Progress:        cm.viper.GetBool("progress"),
+		Progress:        progressStyle != types.ProgressNone,
+		ProgressStyle:   progressStyle,
+		ReportSpeed:     reportSpeed,
+		OutputFormat:    outputFormat,
+		ProgressInterval: progressInterval,
 		Metalink:        cm.viper.GetBool("metalink"),
+		KeepBadHash:     cm.viper.GetBool("keep_bad_hash"),
+		Checksum:        cm.viper.GetString("checksum"),
+		ChecksumManifest: cm.viper.GetString("checksum_manifest"),
+		VerifyDigest:    cm.viper.GetBool("verify_digest"),
+		HashManifestVerify: cm.viper.GetString("hash_manifest_verify"),
+		Spider:          cm.viper.GetBool("spider"),
+		PrivacyReport:   cm.viper.GetBool("privacy_report"),
+		NoIRI:           cm.viper.GetBool("no_iri"),
+		NoCanonicalize:  cm.viper.GetBool("no_canonicalize"),
 		RobotsTxt:       cm.viper.GetBool("robots_txt"),
+		Hosts:           hosts,
 		// Proxy 配置
 		HTTPProxy:       cm.viper.GetString("http_proxy"),
 		HTTPSProxy:      cm.viper.GetString("https_proxy"),
@@ -167,30 +585,301 @@ func (cm *ConfigManager) Parse() (*types.Config, error) {
 		ProxyEnabled:    cm.viper.GetBool("proxy_enabled"),
 		ProxyUsername:   cm.viper.GetString("proxy_username"),
 		ProxyPassword:   cm.viper.GetString("proxy_password"),
+		ProxyRotation:   proxyRotation,
+		// FTP 配置
+		FTPUser:         cm.viper.GetString("ftp_user"),
+		FTPPassword:     cm.viper.GetString("ftp_password"),
+	}
+
+	// 提前加载客户端证书和CA证书，文件错误时直接报告而不是在连接时失败
+	if _, err := tlsCore.NewCertManager(cm.config).GetTLSConfig(); err != nil {
+		return nil, err
 	}
 
 	return cm.config, nil
 }
 
+// parseHosts 解析配置文件中的hosts，键为主机名（以.开头时匹配所有子域名），值覆盖该主机的全局设置
+// 支持user_agent、referer、limit_rate、header、proxy（同时设置http_proxy和https_proxy）、http_proxy和https_proxy；
+// 优先级为 命令行 > 主机设置 > 全局配置 > 默认值，命令行中显式指定的选项在此处丢弃
+func (cm *ConfigManager) parseHosts() (map[string]*types.HostConfig, error) {
+	raw := cm.viper.GetStringMap("hosts")
+	if len(raw) == 0 {
+		return nil, nil
+	}
+
+	cliHeaders := make(map[string]bool)
+	if cm.cliKeys["header"] {
+		for _, header := range parseHeaders(cm.viper.GetStringSlice("header")) {
+			cliHeaders[strings.ToLower(header.Key)] = true
+		}
+	}
+
+	hosts := make(map[string]*types.HostConfig, len(raw))
+	for name, value := range raw {
+		host := strings.ToLower(strings.TrimSuffix(strings.TrimSpace(name), "."))
+		if host == "" || host == "." {
+			return nil, fmt.Errorf("hosts中的主机名不能为空")
+		}
+		settings, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("hosts.%s必须是键值对", host)
+		}
+
+		hostConfig := &types.HostConfig{}
+		for key, v := range settings {
+			key = strings.ToLower(key)
+			switch key {
+			case "user_agent", "referer", "limit_rate", "proxy", "http_proxy", "https_proxy":
+				if !isScalar(v) {
+					return nil, fmt.Errorf("hosts.%s.%s必须是字符串", host, key)
+				}
+			}
+			str := strings.TrimSpace(fmt.Sprint(v))
+
+			switch key {
+			case "user_agent":
+				if !cm.cliKeys["user_agent"] {
+					hostConfig.UserAgent = &str
+				}
+			case "referer":
+				if !cm.cliKeys["referer"] {
+					hostConfig.Referer = &str
+				}
+			case "limit_rate":
+				rate, err := parseSize(str)
+				if err != nil {
+					return nil, fmt.Errorf("解析hosts.%s.limit_rate失败: %w", host, err)
+				}
+				if !cm.cliKeys["limit_rate"] {
+					hostConfig.LimitRate = &rate
+				}
+			case "proxy":
+				// 单独设置的http_proxy/https_proxy优先于proxy
+				if !cm.cliKeys["http_proxy"] && settings["http_proxy"] == nil {
+					hostConfig.HTTPProxy = &str
+				}
+				if !cm.cliKeys["https_proxy"] && settings["https_proxy"] == nil {
+					hostConfig.HTTPSProxy = &str
+				}
+			case "http_proxy":
+				if !cm.cliKeys["http_proxy"] {
+					hostConfig.HTTPProxy = &str
+				}
+			case "https_proxy":
+				if !cm.cliKeys["https_proxy"] {
+					hostConfig.HTTPSProxy = &str
+				}
+			case "header":
+				headerStrs, ok := toStringSlice(v)
+				if !ok {
+					return nil, fmt.Errorf("hosts.%s.header必须是字符串或字符串列表", host)
+				}
+				for _, header := range parseHeaders(headerStrs) {
+					if !cliHeaders[strings.ToLower(header.Key)] {
+						hostConfig.Headers = append(hostConfig.Headers, header)
+					}
+				}
+			default:
+				return nil, fmt.Errorf("hosts.%s中不支持的选项: %s", host, key)
+			}
+		}
+		hosts[host] = hostConfig
+	}
+	return hosts, nil
+}
+
+// isScalar 判断配置值是否为字符串、数字或布尔值
+func isScalar(v interface{}) bool {
+	switch v.(type) {
+	case string, int, int64, uint64, float64, bool:
+		return true
+	}
+	return false
+}
+
+// toStringSlice 将配置中的字符串或字符串列表转换为[]string
+func toStringSlice(v interface{}) ([]string, bool) {
+	switch v := v.(type) {
+	case string:
+		return []string{v}, true
+	case []string:
+		return v, true
+	case []interface{}:
+		strs := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			strs = append(strs, str)
+		}
+		return strs, true
+	}
+	return nil, false
+}
+
+// parseProgressStyle 解析进度显示方式，兼容旧的布尔值写法
+func parseProgressStyle(value string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "", "true", types.ProgressAuto:
+		return types.ProgressAuto, nil
+	case "false", types.ProgressNone:
+		return types.ProgressNone, nil
+	case types.ProgressBar:
+		return types.ProgressBar, nil
+	case types.ProgressDot:
+		return types.ProgressDot, nil
+	case types.ProgressLine:
+		return types.ProgressLine, nil
+	}
+	return "", fmt.Errorf("无效的progress值: %s（可选: bar, dot, line, none）", value)
+}
+
 // parseSize 解析大小字符串
 func parseSize(sizeStr string) (int64, error) {
 	return utils.ParseSize(sizeStr)
 }
 
-// parseHeaders 解析HTTP头部
-func parseHeaders(headerStrs []string) map[string]string {
-	headers := make(map[string]string)
+// parseOptionalDuration 解析可选的时间间隔，空字符串返回0
+func parseOptionalDuration(durationStr string) (time.Duration, error) {
+	if durationStr == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(durationStr)
+}
+
+// parseDNSServers 解析逗号分隔的DNS服务器列表，未指定端口时使用53
+func parseDNSServers(serversStr string) ([]string, error) {
+	var servers []string
+	for _, server := range strings.Split(serversStr, ",") {
+		server = strings.TrimSpace(server)
+		if server == "" {
+			continue
+		}
+		if ip := net.ParseIP(strings.Trim(server, "[]")); ip != nil {
+			servers = append(servers, net.JoinHostPort(ip.String(), "53"))
+			continue
+		}
+		host, port, err := net.SplitHostPort(server)
+		if err != nil || net.ParseIP(host) == nil || port == "" {
+			return nil, fmt.Errorf("无效的dns_servers值: %s（应为IP或IP:端口）", server)
+		}
+		servers = append(servers, server)
+	}
+	return servers, nil
+}
+
+// parseMaxThreads 解析最大线程数，auto时返回按CPU数量计算的上限
+func parseMaxThreads(value string) (int, bool, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+	if value == "auto" {
+		return utils.AutoMaxThreads(), true, nil
+	}
+	threads, err := strconv.Atoi(value)
+	if err != nil || threads < 1 {
+		return 0, false, fmt.Errorf("无效的线程数: %s（应为正整数或auto）", value)
+	}
+	return threads, false, nil
+}
+
+// parseCompression 解析压缩格式列表，返回Accept-Encoding头的值
+// identity或空表示不压缩，返回空字符串
+func parseCompression(compressionStr string) (string, error) {
+	var encodings []string
+	for _, part := range splitBy(compressionStr, ',') {
+		switch encoding := strings.ToLower(part); encoding {
+		case "identity", "none":
+			continue
+		case "gzip", "deflate", "br":
+			encodings = append(encodings, encoding)
+		default:
+			return "", fmt.Errorf("不支持的压缩格式: %s", part)
+		}
+	}
+	return strings.Join(encodings, ", "), nil
+}
+
+// parseHeaders 解析HTTP头部，保留顺序和重复的头部名
+func parseHeaders(headerStrs []string) []types.HeaderField {
+	headers := make([]types.HeaderField, 0, len(headerStrs))
 	
 	for _, headerStr := range headerStrs {
 		parts := splitHeader(headerStr)
 		if len(parts) == 2 {
-			headers[parts[0]] = parts[1]
+			headers = append(headers, types.HeaderField{Key: parts[0], Value: parts[1]})
 		}
 	}
 	
 	return headers
 }
 
+// parseRewrites 解析FROM=>TO格式的链接改写规则，FROM为正则表达式
+func parseRewrites(ruleStrs []string) ([]types.RewriteRule, error) {
+	var rules []types.RewriteRule
+	for _, ruleStr := range ruleStrs {
+		from, to, ok := strings.Cut(ruleStr, "=>")
+		if !ok || from == "" {
+			return nil, fmt.Errorf("无效的rewrite规则（格式应为FROM=>TO）: %s", ruleStr)
+		}
+		pattern, err := regexp.Compile(from)
+		if err != nil {
+			return nil, fmt.Errorf("无效的rewrite正则表达式 %q: %w", from, err)
+		}
+		rules = append(rules, types.RewriteRule{Pattern: pattern, Replacement: to})
+	}
+	return rules, nil
+}
+
+// parseOptionalRegex 编译可选的正则表达式，空字符串返回nil
+func parseOptionalRegex(name, pattern string) (*regexp.Regexp, error) {
+	if pattern == "" {
+		return nil, nil
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("无效的%s正则表达式 %q: %w", name, pattern, err)
+	}
+	return re, nil
+}
+
+// parseNoCheckCertificate 解析逗号分隔的跳过的证书检查: expiry、hostname或all
+func parseNoCheckCertificate(value string) (expiry, hostname, all bool, err error) {
+	for _, check := range splitBy(value, ',') {
+		switch strings.ToLower(check) {
+		case "expiry":
+			expiry = true
+		case "hostname":
+			hostname = true
+		case "all":
+			all = true
+		default:
+			return false, false, false, fmt.Errorf("无效的no_check_certificate值: %s（可选: expiry, hostname, all）", check)
+		}
+	}
+	return expiry, hostname, all, nil
+}
+
+// parsePinnedPubKeys 解析与curl兼容的sha256//base64格式的公钥哈希，多个哈希用;分隔
+func parsePinnedPubKeys(value string) ([]string, error) {
+	var pins []string
+	for _, pin := range strings.Split(value, ";") {
+		pin = strings.TrimSpace(pin)
+		if pin == "" {
+			continue
+		}
+		hash, ok := strings.CutPrefix(pin, "sha256//")
+		if !ok {
+			return nil, fmt.Errorf("无效的pinnedpubkey（格式应为sha256//base64）: %s", pin)
+		}
+		if sum, err := base64.StdEncoding.DecodeString(hash); err != nil || len(sum) != sha256.Size {
+			return nil, fmt.Errorf("无效的pinnedpubkey哈希（应为base64编码的SHA-256）: %s", pin)
+		}
+		pins = append(pins, hash)
+	}
+	return pins, nil
+}
+
 // parseCookies 解析Cookie
 func parseCookies(cookieStr string) map[string]string {
 	cookies := make(map[string]string)
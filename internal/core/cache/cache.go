@@ -0,0 +1,128 @@
+package cache
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// FileName 缓存文件名，保存在输出目录中
+const FileName = ".wget2go-cache.json"
+
+// Entry 一个URL的缓存验证信息
+type Entry struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	ContentType  string `json:"content_type,omitempty"` // 304响应通常不带Content-Type，重新解析本地文件时使用
+}
+
+// Cache 按URL记录ETag和Last-Modified的磁盘缓存，用于重复镜像时发送条件请求
+// nil表示未启用缓存，所有方法都可以在nil上调用
+type Cache struct {
+	path    string
+	mu      sync.Mutex
+	entries map[string]Entry
+	dirty   bool
+}
+
+// Load 从输出目录加载缓存，缓存文件不存在时返回空缓存
+func Load(outputDir string) (*Cache, error) {
+	c := &Cache{
+		path:    filepath.Join(outputDir, FileName),
+		entries: make(map[string]Entry),
+	}
+
+	data, err := os.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存文件失败: %w", err)
+	}
+	if err := json.Unmarshal(data, &c.entries); err != nil {
+		return nil, fmt.Errorf("解析缓存文件失败: %w", err)
+	}
+	return c, nil
+}
+
+// Get 获取URL的缓存信息
+func (c *Cache) Get(urlStr string) (Entry, bool) {
+	if c == nil {
+		return Entry{}, false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[urlStr]
+	return entry, ok
+}
+
+// Update 按响应头更新URL的缓存信息，响应既没有ETag也没有Last-Modified时删除记录
+func (c *Cache) Update(urlStr string, header http.Header) {
+	if c == nil {
+		return
+	}
+	entry := Entry{
+		ETag:         header.Get("ETag"),
+		LastModified: header.Get("Last-Modified"),
+		ContentType:  header.Get("Content-Type"),
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if entry.ETag == "" && entry.LastModified == "" {
+		if _, ok := c.entries[urlStr]; ok {
+			delete(c.entries, urlStr)
+			c.dirty = true
+		}
+		return
+	}
+	c.entries[urlStr] = entry
+	c.dirty = true
+}
+
+// ConditionalHeader 返回URL的条件请求头（If-None-Match和If-Modified-Since），没有缓存时返回nil
+func (c *Cache) ConditionalHeader(urlStr string) http.Header {
+	entry, ok := c.Get(urlStr)
+	if !ok {
+		return nil
+	}
+	header := make(http.Header)
+	if entry.ETag != "" {
+		header.Set("If-None-Match", entry.ETag)
+	}
+	if entry.LastModified != "" {
+		header.Set("If-Modified-Since", entry.LastModified)
+	}
+	return header
+}
+
+// Save 将缓存写回磁盘，没有变化时不写入
+func (c *Cache) Save() error {
+	if c == nil {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.dirty {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(c.entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码缓存失败: %w", err)
+	}
+	// 先写入临时文件再重命名，中断时不会留下损坏的缓存
+	tmpPath := c.path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %w", err)
+	}
+	if err := os.Rename(tmpPath, c.path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("写入缓存文件失败: %w", err)
+	}
+	c.dirty = false
+	return nil
+}
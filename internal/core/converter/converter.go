@@ -4,18 +4,30 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 )
 
 // Converter 链接转换器
 type Converter struct {
-	conversions map[string]*types.Conversion
-	baseDir     string
-	backup      bool
+	conversions    map[string]*types.Conversion
+	baseDir        string
+	pathFunc       func(urlStr string) string
+	downloadedFunc func(localPath string) bool
+	parentRoot     *url.URL // --no-parent的根目录，其上级的链接不会被下载，保持为绝对URL
+	backup         bool
+	rewrites       []types.RewriteRule // --rewrite规则，匹配的已下载目标改写为规则的结果而不是相对路径
+	extractDataURIs bool  // 将data: URL解码保存为文件
+	dataURIMinSize  int64 // 解码后小于该字节数的data: URL保持内联
+	mutex          sync.RWMutex
 }
 
 // NewConverter 创建链接转换器
@@ -29,6 +41,8 @@ func NewConverter(baseDir string, backup bool) *Converter {
 
 // AddConversion 添加待转换的文件
 func (c *Converter) AddConversion(filename, baseURL string, result *types.ParsedResult) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.conversions[filename] = &types.Conversion{
 		Filename: filename,
 		BaseURL:  baseURL,
@@ -38,6 +52,8 @@ func (c *Converter) AddConversion(filename, baseURL string, result *types.Parsed
 
 // ConvertAll 转换所有文件中的链接
 func (c *Converter) ConvertAll() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	for filename, conversion := range c.conversions {
 		if err := c.ConvertFile(filename, conversion); err != nil {
 			return fmt.Errorf("转换文件 %s 失败: %w", filename, err)
@@ -74,36 +90,137 @@ func (c *Converter) ConvertFile(filename string, conversion *types.Conversion) e
 	return nil
 }
 
-// convertLinks 转换链接
+// convertLinks 转换链接，只有已下载的目标才改写为相对路径，
+// 未下载的链接（外部站点、被拒绝或跳过的URL）改写为绝对URL
 func (c *Converter) convertLinks(data []byte, filename string, conversion *types.Conversion) []byte {
-	var buf bytes.Buffer
-	lastPos := 0
+	return replaceLinks(data, conversion.Result.URLs, func(parsedURL *types.ParsedURL) string {
+		if IsDataURI(parsedURL.URL) {
+			return c.extractDataURI(filename, parsedURL.URL)
+		}
+		// --no-parent根目录之外的链接没有下载，保持绝对URL
+		if c.IsAboveParent(parsedURL.URL) {
+			return parsedURL.URL
+		}
+		targetPath := c.getURLPath(parsedURL.URL)
+		if targetPath == "" || !c.isDownloaded(targetPath) {
+			return parsedURL.URL
+		}
+		if rewritten, ok := c.rewrite(parsedURL.URL); ok {
+			return rewritten
+		}
+		return c.getRelativePath(filename, parsedURL.URL)
+	})
+}
 
-	for _, parsedURL := range conversion.Result.URLs {
-		// 在原始数据中查找URL的位置
-		pos := bytes.Index(data[lastPos:], []byte(parsedURL.URL))
-		if pos == -1 {
-			continue
+// rewrite 对链接依次应用--rewrite规则，没有规则匹配时返回false
+func (c *Converter) rewrite(link string) (string, bool) {
+	matched := false
+	for _, rule := range c.rewrites {
+		if rule.Pattern.MatchString(link) {
+			link = rule.Pattern.ReplaceAllString(link, rule.Replacement)
+			matched = true
 		}
+	}
+	return link, matched
+}
 
-		// 写入URL之前的内容
-		buf.Write(data[lastPos : lastPos+pos])
+// isDownloaded 检查本地文件是否已下载，未设置检查函数时视为已下载
+func (c *Converter) isDownloaded(localPath string) bool {
+	if c.downloadedFunc == nil {
+		return true
+	}
+	return c.downloadedFunc(localPath)
+}
 
-		// 计算相对路径
-		relPath := c.getRelativePath(filename, parsedURL.URL)
+// linkSpan 文档中待替换的一段链接文本
+type linkSpan struct {
+	start, end  int
+	replacement string
+}
 
-		// 写入转换后的URL
-		buf.WriteString(relPath)
+// replaceLinks 按原始URL文本在文档中定位链接并替换
+// 只匹配完整的属性值或url()参数（前后为引号、括号、空白等分隔符），
+// 避免一个URL是另一个URL的前缀时替换错误的子串
+func replaceLinks(data []byte, urls []*types.ParsedURL, replace func(*types.ParsedURL) string) []byte {
+	var spans []linkSpan
+	seen := make(map[string]bool)
+
+	for _, parsedURL := range urls {
+		raw := parsedURL.Raw
+		if raw == "" {
+			raw = parsedURL.URL
+		}
+		// 同一原始文本在同一文档中解析为相同的URL，只需处理一次
+		if seen[raw] {
+			continue
+		}
+		seen[raw] = true
 
-		lastPos += pos + len(parsedURL.URL)
+		replacement := replace(parsedURL)
+		spans = append(spans, findLinkSpans(data, raw, replacement)...)
+		// HTML属性值中的&可能写为&amp;，替换后的URL同样需要转义
+		if escaped := strings.ReplaceAll(raw, "&", "&amp;"); escaped != raw {
+			spans = append(spans, findLinkSpans(data, escaped, strings.ReplaceAll(replacement, "&", "&amp;"))...)
+		}
 	}
 
-	// 写入剩余内容
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].start != spans[j].start {
+			return spans[i].start < spans[j].start
+		}
+		return spans[i].end > spans[j].end
+	})
+
+	var buf bytes.Buffer
+	lastPos := 0
+	for _, span := range spans {
+		// 跳过与已替换部分重叠的匹配
+		if span.start < lastPos {
+			continue
+		}
+		buf.Write(data[lastPos:span.start])
+		buf.WriteString(span.replacement)
+		lastPos = span.end
+	}
 	buf.Write(data[lastPos:])
 
 	return buf.Bytes()
 }
 
+// findLinkSpans 查找needle作为完整链接出现的所有位置
+func findLinkSpans(data []byte, needle, replacement string) []linkSpan {
+	var spans []linkSpan
+	for offset := 0; offset < len(data); {
+		pos := bytes.Index(data[offset:], []byte(needle))
+		if pos == -1 {
+			break
+		}
+		start := offset + pos
+		end := start + len(needle)
+		if isLinkBoundary(data, start-1, true) && isLinkBoundary(data, end, false) {
+			spans = append(spans, linkSpan{start: start, end: end, replacement: replacement})
+		}
+		offset = start + 1
+	}
+	return spans
+}
+
+// isLinkBoundary 检查链接文本前（before）或后的字符是否为分隔符
+func isLinkBoundary(data []byte, i int, before bool) bool {
+	if i < 0 || i >= len(data) {
+		return true
+	}
+	switch ch := data[i]; ch {
+	case '"', '\'', ' ', '\t', '\n', '\r', '\f', ',':
+		return true
+	case '(', '=':
+		return before
+	case ')', '>':
+		return !before
+	}
+	return false
+}
+
 // getRelativePath 计算相对路径
 func (c *Converter) getRelativePath(fromFile, targetURL string) string {
 	// 解析目标URL获取路径
@@ -129,6 +246,10 @@ func (c *Converter) getRelativePath(fromFile, targetURL string) string {
 
 // getURLPath 从URL获取本地文件路径
 func (c *Converter) getURLPath(urlStr string) string {
+	if c.pathFunc != nil {
+		return c.pathFunc(urlStr)
+	}
+
 	// 移除协议部分
 	if idx := strings.Index(urlStr, "://"); idx != -1 {
 		urlStr = urlStr[idx+3:]
@@ -147,9 +268,16 @@ func (c *Converter) getURLPath(urlStr string) string {
 		urlStr = urlStr[:idx]
 	}
 
-	// 拼接baseDir
+	// 规范化重复斜杠和点段
+	urlStr = path.Clean("/" + urlStr)
+
+	// 拼接baseDir，超出基础目录的路径不转换
 	if c.baseDir != "" {
-		return filepath.Join(c.baseDir, filepath.FromSlash(urlStr))
+		localPath := filepath.Join(c.baseDir, filepath.FromSlash(urlStr))
+		if !utils.IsWithinDir(c.baseDir, localPath) {
+			return ""
+		}
+		return localPath
 	}
 
 	return filepath.FromSlash(urlStr)
@@ -188,59 +316,53 @@ func (c *Converter) ConvertLinksFileOnly(filename string, conversion *types.Conv
 	return nil
 }
 
-// convertLinksFileOnly 仅转换文件名
+// convertLinksFileOnly 仅转换文件名，未下载的链接改写为绝对URL
 func (c *Converter) convertLinksFileOnly(data []byte, conversion *types.Conversion) []byte {
-	var buf bytes.Buffer
-	lastPos := 0
-
-	for _, parsedURL := range conversion.Result.URLs {
-		// 在原始数据中查找URL的位置
-		pos := bytes.Index(data[lastPos:], []byte(parsedURL.URL))
-		if pos == -1 {
-			continue
+	return replaceLinks(data, conversion.Result.URLs, func(parsedURL *types.ParsedURL) string {
+		targetPath := c.getURLPath(parsedURL.URL)
+		if targetPath == "" || !c.isDownloaded(targetPath) {
+			return parsedURL.URL
 		}
-
-		// 写入URL之前的内容
-		buf.Write(data[lastPos : lastPos+pos])
-
-		// 仅提取文件名
-		filename := filepath.Base(c.getURLPath(parsedURL.URL))
-
-		// 写入转换后的文件名
-		buf.WriteString(filename)
-
-		lastPos += pos + len(parsedURL.URL)
-	}
-
-	// 写入剩余内容
-	buf.Write(data[lastPos:])
-
-	return buf.Bytes()
+		if rewritten, ok := c.rewrite(parsedURL.URL); ok {
+			return rewritten
+		}
+		return filepath.Base(targetPath)
+	})
 }
 
 // GetConversionCount 获取待转换文件数量
 func (c *Converter) GetConversionCount() int {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	return len(c.conversions)
 }
 
 // Clear 清空转换列表
 func (c *Converter) Clear() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	c.conversions = make(map[string]*types.Conversion)
 }
 
 // HasConversion 检查是否有待转换的文件
 func (c *Converter) HasConversion(filename string) bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	_, ok := c.conversions[filename]
 	return ok
 }
 
 // GetConversion 获取转换信息
 func (c *Converter) GetConversion(filename string) *types.Conversion {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	return c.conversions[filename]
 }
 
 // RemoveConversion 移除转换任务
 func (c *Converter) RemoveConversion(filename string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
 	delete(c.conversions, filename)
 }
 
@@ -249,6 +371,67 @@ func (c *Converter) SetBaseDir(dir string) {
 	c.baseDir = dir
 }
 
+// SetPathFunc 设置URL到本地文件路径的映射函数，使转换后的链接与下载时的目录布局一致
+func (c *Converter) SetPathFunc(pathFunc func(urlStr string) string) {
+	c.pathFunc = pathFunc
+}
+
+// SetDownloadedFunc 设置检查本地文件是否已下载的函数，未下载的目标转换时保持为绝对URL
+func (c *Converter) SetDownloadedFunc(downloadedFunc func(localPath string) bool) {
+	c.downloadedFunc = downloadedFunc
+}
+
+// SetNoParent 设置--no-parent的根URL，根URL所在目录之上的链接转换时保持为绝对URL
+// rootURL为空时取消限制
+func (c *Converter) SetNoParent(rootURL string) {
+	c.parentRoot = nil
+	if rootURL == "" {
+		return
+	}
+	root, err := url.Parse(rootURL)
+	if err != nil {
+		return
+	}
+	// 根目录为路径中最后一个/之前的部分
+	dir := root.Path
+	if idx := strings.LastIndex(dir, "/"); idx >= 0 {
+		dir = dir[:idx+1]
+	} else {
+		dir = "/"
+	}
+	c.parentRoot = &url.URL{Scheme: root.Scheme, Host: root.Host, Path: dir}
+}
+
+// IsAboveParent 检查链接是否指向--no-parent根目录之外（同一主机上的上级目录）
+// 其他主机的链接不受--no-parent影响
+func (c *Converter) IsAboveParent(link string) bool {
+	if c.parentRoot == nil {
+		return false
+	}
+	u, err := url.Parse(link)
+	if err != nil || !strings.EqualFold(u.Host, c.parentRoot.Host) {
+		return false
+	}
+	linkPath := path.Clean("/" + u.Path)
+	if strings.HasSuffix(u.Path, "/") && linkPath != "/" {
+		linkPath += "/"
+	}
+	// 根目录本身（不带结尾的/）也在范围内
+	return !strings.HasPrefix(linkPath, c.parentRoot.Path) && linkPath+"/" != c.parentRoot.Path
+}
+
+// SetRewrites 设置--rewrite规则，转换时已下载目标的URL匹配规则则改写为替换结果
+func (c *Converter) SetRewrites(rules []types.RewriteRule) {
+	c.rewrites = rules
+}
+
+// SetExtractDataURIs 设置转换时是否将data: URL解码保存到基础目录的DataURIDir中，
+// 解码后小于minSize字节的data: URL保持内联
+func (c *Converter) SetExtractDataURIs(extract bool, minSize int64) {
+	c.extractDataURIs = extract
+	c.dataURIMinSize = minSize
+}
+
 // GetBaseDir 获取基础目录
 func (c *Converter) GetBaseDir() string {
 	return c.baseDir
@@ -285,6 +468,8 @@ func (c *Converter) AddConversionFromReader(filename, baseURL string, reader io.
 
 // GetUnconvertedFiles 获取未转换的文件列表
 func (c *Converter) GetUnconvertedFiles() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	var files []string
 	for filename, conversion := range c.conversions {
 		if !conversion.Converted {
@@ -296,6 +481,8 @@ func (c *Converter) GetUnconvertedFiles() []string {
 
 // GetConvertedFiles 获取已转换的文件列表
 func (c *Converter) GetConvertedFiles() []string {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
 	var files []string
 	for filename, conversion := range c.conversions {
 		if conversion.Converted {
@@ -0,0 +1,113 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// DataURIDir 解码后的data: URL保存在输出目录下的该目录中
+const DataURIDir = "data-uris"
+
+// IsDataURI 检查链接是否为data: URL
+func IsDataURI(link string) bool {
+	return len(link) >= 5 && strings.EqualFold(link[:5], "data:")
+}
+
+// decodeDataURI 解码data: URL，返回媒体类型和内容
+// 格式为data:[<媒体类型>][;参数][;base64],<数据>，没有媒体类型时为text/plain
+func decodeDataURI(link string) (string, []byte, error) {
+	if !IsDataURI(link) {
+		return "", nil, fmt.Errorf("不是data URL")
+	}
+	header, payload, ok := strings.Cut(link[5:], ",")
+	if !ok {
+		return "", nil, fmt.Errorf("data URL缺少逗号")
+	}
+
+	params := strings.Split(header, ";")
+	mediaType := strings.ToLower(strings.TrimSpace(params[0]))
+	if mediaType == "" {
+		mediaType = "text/plain"
+	}
+	isBase64 := strings.EqualFold(strings.TrimSpace(params[len(params)-1]), "base64")
+
+	if !isBase64 {
+		data, err := url.PathUnescape(payload)
+		if err != nil {
+			return "", nil, fmt.Errorf("解码data URL失败: %w", err)
+		}
+		return mediaType, []byte(data), nil
+	}
+
+	// 属性值中可能有换行等空白，也可能省略了填充
+	payload = strings.Join(strings.Fields(payload), "")
+	if unescaped, err := url.PathUnescape(payload); err == nil {
+		payload = unescaped
+	}
+	data, err := base64.StdEncoding.DecodeString(payload)
+	if err != nil {
+		data, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(payload, "="))
+	}
+	if err != nil {
+		return "", nil, fmt.Errorf("解码data URL失败: %w", err)
+	}
+	return mediaType, data, nil
+}
+
+// dataURIExtension 根据媒体类型确定文件扩展名，如image/png为.png、image/svg+xml为.svg
+func dataURIExtension(mediaType string) string {
+	_, subtype, _ := strings.Cut(mediaType, "/")
+	subtype, _, _ = strings.Cut(subtype, "+")
+	switch subtype {
+	case "jpeg":
+		return ".jpg"
+	case "plain":
+		return ".txt"
+	case "":
+		return ".bin"
+	}
+	for _, r := range subtype {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return ".bin"
+		}
+	}
+	return "." + subtype
+}
+
+// extractDataURI 将data: URL解码保存到输出目录的DataURIDir中，返回从fromFile到该文件的相对路径
+// 未启用--extract-data-uris、解码失败或内容小于阈值时保持原样
+// 文件按内容的哈希命名，相同内容只保存一次
+func (c *Converter) extractDataURI(fromFile, link string) string {
+	if !c.extractDataURIs {
+		return link
+	}
+	mediaType, data, err := decodeDataURI(link)
+	if err != nil || int64(len(data)) < c.dataURIMinSize {
+		return link
+	}
+
+	sum := sha256.Sum256(data)
+	name := hex.EncodeToString(sum[:8]) + dataURIExtension(mediaType)
+	targetPath := filepath.Join(c.baseDir, DataURIDir, name)
+
+	if _, err := os.Stat(targetPath); os.IsNotExist(err) {
+		if err := os.MkdirAll(filepath.Dir(targetPath), 0755); err != nil {
+			return link
+		}
+		if err := os.WriteFile(targetPath, data, 0644); err != nil {
+			return link
+		}
+	}
+
+	relPath, err := filepath.Rel(filepath.Dir(fromFile), targetPath)
+	if err != nil {
+		return link
+	}
+	return filepath.ToSlash(relPath)
+}
@@ -9,11 +9,13 @@ import (
 	"strings"
 
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 )
 
 // Parser CSS解析器
 type Parser struct {
-	baseURL string
+	baseURL  string
+	DataURIs bool // 将data: URL原样加入结果（用于--extract-data-uris），默认跳过
 }
 
 // NewParser 创建CSS解析器
@@ -58,6 +60,7 @@ func (p *Parser) parseImportRules(cssData []byte, result *types.ParsedResult) {
 
 			parsedURL := &types.ParsedURL{
 				URL:  normalizedURL,
+				Raw:  urlStr,
 				Attr: "@import",
 				Tag:  "@import",
 			}
@@ -67,30 +70,150 @@ func (p *Parser) parseImportRules(cssData []byte, result *types.ParsedResult) {
 	}
 }
 
-// parseURLFunctions 解析url()函数
+// parseURLFunctions 解析url()函数和image-set()函数
 func (p *Parser) parseURLFunctions(cssData []byte, result *types.ParsedResult) {
 	// 匹配url()函数
-	// 格式: url('image.png') 或 url("image.png") 或 url(image.png)
-	re := regexp.MustCompile(`url\(['"]?([^'")\s]+)['"]?\)`)
+	// 格式: url('image.png') 或 url("image.png") 或 url(image.png)，括号内允许空白
+	re := regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^'"()\s]+))\s*\)`)
 	matches := re.FindAllSubmatch(cssData, -1)
 
 	for _, match := range matches {
-		if len(match) > 1 {
-			urlStr := string(match[1])
-			normalizedURL, err := p.normalizeURL(urlStr)
-			if err != nil {
-				continue
+		urlStr := strings.TrimSpace(string(match[1]) + string(match[2]) + string(match[3]))
+		p.addURL(urlStr, "url()", result)
+	}
+
+	p.parseImageSets(cssData, result)
+}
+
+// parseImageSets 解析image-set()和-webkit-image-set()中以字符串给出的图片
+// 其中url()形式的图片已由parseURLFunctions提取
+func (p *Parser) parseImageSets(cssData []byte, result *types.ParsedResult) {
+	re := regexp.MustCompile(`(?i)(?:-webkit-)?image-set\(`)
+
+	for _, loc := range re.FindAllIndex(cssData, -1) {
+		args := enclosedArgs(cssData, loc[1])
+		for _, urlStr := range topLevelStrings(args) {
+			p.addURL(strings.TrimSpace(urlStr), "image-set()", result)
+		}
+	}
+}
+
+// topLevelStrings 返回不在嵌套函数（如type()）内的引号字符串
+func topLevelStrings(data []byte) []string {
+	var strs []string
+	depth := 0
+
+	for i := 0; i < len(data); i++ {
+		switch ch := data[i]; {
+		case ch == '"' || ch == '\'':
+			end := i + 1
+			for end < len(data) && data[end] != ch {
+				if data[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if depth == 0 {
+				strs = append(strs, string(data[i+1:min(end, len(data))]))
 			}
+			i = end
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
 
-			parsedURL := &types.ParsedURL{
-				URL:  normalizedURL,
-				Attr: "url()",
-				Tag:  "css",
+	return strs
+}
+
+// addURL 标准化URL并添加到结果中
+func (p *Parser) addURL(urlStr, attr string, result *types.ParsedResult) {
+	// data: URL不需要下载，启用DataURIs时原样加入，转换链接时解码保存为文件
+	if p.DataURIs && strings.HasPrefix(strings.ToLower(urlStr), "data:") {
+		result.URLs = append(result.URLs, &types.ParsedURL{
+			URL:  urlStr,
+			Raw:  urlStr,
+			Attr: attr,
+			Tag:  "css",
+		})
+		return
+	}
+
+	normalizedURL, err := p.normalizeURL(urlStr)
+	if err != nil {
+		return
+	}
+
+	parsedURL := &types.ParsedURL{
+		URL:  normalizedURL,
+		Raw:  urlStr,
+		Attr: attr,
+		Tag:  "css",
+	}
+	result.URLs = append(result.URLs, parsedURL)
+	result.Links[urlStr] = normalizedURL
+}
+
+// enclosedArgs 返回从start开始到匹配的右括号之前的内容，跳过引号内的括号
+func enclosedArgs(data []byte, start int) []byte {
+	depth := 1
+	var quote byte
+
+	for i := start; i < len(data); i++ {
+		ch := data[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
 			}
-			result.URLs = append(result.URLs, parsedURL)
-			result.Links[urlStr] = normalizedURL
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			depth--
+			if depth == 0 {
+				return data[start:i]
+			}
+		}
+	}
+
+	return data[start:]
+}
+
+// declarationValue 返回从start开始的声明值，直到顶层的分号或右花括号
+func declarationValue(data []byte, start int) []byte {
+	depth := 0
+	var quote byte
+
+	for i := start; i < len(data); i++ {
+		ch := data[i]
+		switch {
+		case quote != 0:
+			if ch == '\\' {
+				i++
+			} else if ch == quote {
+				quote = 0
+			}
+		case ch == '"' || ch == '\'':
+			quote = ch
+		case ch == '(':
+			depth++
+		case ch == ')':
+			if depth > 0 {
+				depth--
+			}
+		case (ch == ';' || ch == '}') && depth == 0:
+			return data[start:i]
 		}
 	}
+
+	return data[start:]
 }
 
 // normalizeURL 标准化URL
@@ -104,8 +227,8 @@ func (p *Parser) normalizeURL(urlStr string) (string, error) {
 		return "", fmt.Errorf("跳过data URL")
 	}
 
-	// 解析URL
-	u, err := url.Parse(urlStr)
+	// 解析URL，先编码空格等不安全字符
+	u, err := url.Parse(utils.EscapeURL(urlStr))
 	if err != nil {
 		return "", err
 	}
@@ -167,15 +290,11 @@ func (p *Parser) ExtractBackgroundURLs(cssData []byte, baseURL string) ([]string
 
 	p.baseURL = baseURL
 
-	// 匹配background和background-image属性
-	re := regexp.MustCompile(`(?:background|background-image)\s*:\s*([^;]+);`)
-	matches := re.FindAllSubmatch(cssData, -1)
-
-	for _, match := range matches {
-		if len(match) > 1 {
-			value := string(match[1])
-			p.parseURLFunctions([]byte(value), result)
-		}
+	// 匹配background和background-image属性，值可以是多层背景或image-set()
+	re := regexp.MustCompile(`(?i)(?:^|[\s{;])background(?:-image)?\s*:`)
+	for _, loc := range re.FindAllIndex(cssData, -1) {
+		value := declarationValue(cssData, loc[1])
+		p.parseURLFunctions(value, result)
 	}
 
 	urls := make([]string, 0, len(result.URLs))
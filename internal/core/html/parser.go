@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 	"golang.org/x/net/html"
 )
 
@@ -16,17 +17,19 @@ import (
 type Parser struct {
 	FollowTags []string
 	IgnoreTags []string
+	DataURIs   bool // 将data: URL原样加入结果（用于--extract-data-uris），默认跳过
 }
 
 // NewParser 创建HTML解析器
 func NewParser() *Parser {
 	return &Parser{
-		FollowTags: []string{"a", "link", "img", "script", "iframe", "frame", "embed", "object", "area", "base", "body", "input", "form", "meta"},
+		FollowTags: []string{"a", "link", "img", "script", "iframe", "frame", "embed", "object", "area", "base", "body", "input", "form", "meta", "source", "video", "audio"},
 		IgnoreTags: []string{},
 	}
 }
 
 // Parse 解析HTML并提取URL
+// 文档中第一个带href的<base>元素会取代baseURL，作为其后相对URL的解析基础
 func (p *Parser) Parse(htmlData []byte, baseURL string) (*types.ParsedResult, error) {
 	result := &types.ParsedResult{
 		URLs:     make([]*types.ParsedURL, 0),
@@ -48,6 +51,7 @@ func (p *Parser) Parse(htmlData []byte, baseURL string) (*types.ParsedResult, er
 	}
 
 	// 遍历DOM树
+	baseSeen := false
 	var traverse func(*html.Node)
 	traverse = func(n *html.Node) {
 		if n.Type == html.ElementNode {
@@ -63,6 +67,16 @@ func (p *Parser) Parse(htmlData []byte, baseURL string) (*types.ParsedResult, er
 
 			// 提取URL
 			p.extractURLs(n, baseURL, result)
+
+			// 只有第一个<base href>生效
+			if !baseSeen && strings.ToLower(n.Data) == "base" {
+				if href := baseHref(n); href != "" {
+					baseSeen = true
+					if resolved, err := normalizeURL(href, baseURL); err == nil {
+						baseURL = resolved
+					}
+				}
+			}
 		}
 
 		// 递归遍历子节点
@@ -99,6 +113,26 @@ func (p *Parser) processMetaTag(n *html.Node, result *types.ParsedResult) {
 	}
 }
 
+// baseHref 返回<base>元素的href属性
+func baseHref(n *html.Node) string {
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, "href") {
+			return strings.TrimSpace(attr.Val)
+		}
+	}
+	return ""
+}
+
+// containsString 检查列表中是否包含s
+func containsString(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
 // shouldIgnoreTag 检查是否应该忽略该标签
 func (p *Parser) shouldIgnoreTag(tag string) bool {
 	for _, ignoreTag := range p.IgnoreTags {
@@ -111,68 +145,77 @@ func (p *Parser) shouldIgnoreTag(tag string) bool {
 
 // extractURLs 从节点中提取URL
 func (p *Parser) extractURLs(n *html.Node, baseURL string, result *types.ParsedResult) {
-	// 定义需要提取URL的属性
-	urlAttrs := map[string]string{
-		"a":       "href",
-		"link":    "href",
-		"img":     "src",
-		"script":  "src",
-		"iframe":  "src",
-		"frame":   "src",
-		"embed":   "src",
-		"object":  "data",
-		"area":    "href",
-		"base":    "href",
-		"body":    "background",
-		"input":   "src",
-		"form":    "action",
-		"blockquote": "cite",
-		"q":       "cite",
-		"ins":     "cite",
-		"del":     "cite",
+	// 定义需要提取URL的属性，srcset单独处理
+	urlAttrs := map[string][]string{
+		"a":       {"href"},
+		"link":    {"href"},
+		"img":     {"src"},
+		"script":  {"src"},
+		"iframe":  {"src"},
+		"frame":   {"src"},
+		"embed":   {"src"},
+		"object":  {"data"},
+		"area":    {"href"},
+		"base":    {"href"},
+		"body":    {"background"},
+		"input":   {"src"},
+		"form":    {"action"},
+		"source":  {"src"},
+		"video":   {"src", "poster"},
+		"audio":   {"src"},
+		"blockquote": {"cite"},
+		"q":       {"cite"},
+		"ins":     {"cite"},
+		"del":     {"cite"},
 	}
 
 	tag := strings.ToLower(n.Data)
-	attrName, ok := urlAttrs[tag]
+	attrNames, ok := urlAttrs[tag]
 	if !ok {
 		return
 	}
 
 	// 获取属性值
 	for _, attr := range n.Attr {
-		if strings.EqualFold(attr.Key, attrName) {
-			urlStr := strings.TrimSpace(attr.Val)
-			if urlStr == "" || urlStr == "#" || strings.HasPrefix(urlStr, "javascript:") || strings.HasPrefix(urlStr, "data:") {
-				continue
-			}
+		attrName := strings.ToLower(attr.Key)
+		if !containsString(attrNames, attrName) {
+			continue
+		}
+		urlStr := strings.TrimSpace(attr.Val)
+		if urlStr == "" || urlStr == "#" || strings.HasPrefix(urlStr, "javascript:") {
+			continue
+		}
+		if p.addDataURI(urlStr, attrName, tag, result) {
+			continue
+		}
 
-			// 跳过action和formaction属性（这些不是要下载的链接）
-			if attrName == "action" || attrName == "formaction" {
-				continue
-			}
+		// 跳过action和formaction属性（这些不是要下载的链接）
+		if attrName == "action" || attrName == "formaction" {
+			continue
+		}
 
-			// 标准化URL
-			normalizedURL, err := normalizeURL(urlStr, baseURL)
-			if err != nil {
-				continue
-			}
+		// 标准化URL
+		normalizedURL, err := normalizeURL(urlStr, baseURL)
+		if err != nil {
+			continue
+		}
 
-			// 添加到结果
-			parsedURL := &types.ParsedURL{
-				URL:      normalizedURL,
-				Attr:     attrName,
-				Tag:      tag,
-			}
-			result.URLs = append(result.URLs, parsedURL)
-			result.Links[urlStr] = normalizedURL
+		// 添加到结果
+		parsedURL := &types.ParsedURL{
+			URL:      normalizedURL,
+			Raw:      urlStr,
+			Attr:     attrName,
+			Tag:      tag,
 		}
+		result.URLs = append(result.URLs, parsedURL)
+		result.Links[urlStr] = normalizedURL
 	}
 
-	// 处理srcset属性（用于img标签）
-	if tag == "img" {
+	// 处理srcset属性（用于img标签和<picture>中的source标签）
+	if tag == "img" || tag == "source" {
 		for _, attr := range n.Attr {
 			if strings.EqualFold(attr.Key, "srcset") {
-				p.processSrcSet(attr.Val, baseURL, result)
+				p.processSrcSet(attr.Val, tag, baseURL, result)
 			}
 		}
 	}
@@ -185,17 +228,34 @@ func (p *Parser) extractURLs(n *html.Node, baseURL string, result *types.ParsedR
 	}
 }
 
-// processSrcSet 处理srcset属性
-func (p *Parser) processSrcSet(srcset, baseURL string, result *types.ParsedResult) {
+// addDataURI 处理data: URL，启用DataURIs时原样加入结果，返回urlStr是否为data: URL
+// data: URL不需要下载，只在转换链接时解码保存为文件
+func (p *Parser) addDataURI(urlStr, attr, tag string, result *types.ParsedResult) bool {
+	if !strings.HasPrefix(strings.ToLower(urlStr), "data:") {
+		return false
+	}
+	if p.DataURIs {
+		result.URLs = append(result.URLs, &types.ParsedURL{
+			URL:  urlStr,
+			Raw:  urlStr,
+			Attr: attr,
+			Tag:  tag,
+		})
+	}
+	return true
+}
+
+// processSrcSet 处理tag元素的srcset属性
+func (p *Parser) processSrcSet(srcset, tag, baseURL string, result *types.ParsedResult) {
 	// srcset格式: "image1.jpg 1x, image2.jpg 2x"
 	parts := strings.Split(srcset, ",")
 	for _, part := range parts {
 		// 提取URL（移除描述符）
-		urlPart := strings.Fields(part)[0]
-		urlStr := strings.TrimSpace(urlPart)
-		if urlStr == "" {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
 			continue
 		}
+		urlStr := fields[0]
 
 		normalizedURL, err := normalizeURL(urlStr, baseURL)
 		if err != nil {
@@ -204,8 +264,9 @@ func (p *Parser) processSrcSet(srcset, baseURL string, result *types.ParsedResul
 
 		parsedURL := &types.ParsedURL{
 			URL:  normalizedURL,
+			Raw:  urlStr,
 			Attr: "srcset",
-			Tag:  "img",
+			Tag:  tag,
 		}
 		result.URLs = append(result.URLs, parsedURL)
 		result.Links[urlStr] = normalizedURL
@@ -221,6 +282,9 @@ func (p *Parser) processStyleURLs(style, baseURL string, result *types.ParsedRes
 	for _, match := range matches {
 		if len(match) > 1 {
 			urlStr := match[1]
+			if p.addDataURI(urlStr, "style", "*", result) {
+				continue
+			}
 			normalizedURL, err := normalizeURL(urlStr, baseURL)
 			if err != nil {
 				continue
@@ -228,6 +292,7 @@ func (p *Parser) processStyleURLs(style, baseURL string, result *types.ParsedRes
 
 			parsedURL := &types.ParsedURL{
 				URL:  normalizedURL,
+				Raw:  urlStr,
 				Attr: "style",
 				Tag:  "*",
 			}
@@ -243,8 +308,8 @@ func normalizeURL(urlStr, baseURL string) (string, error) {
 		return "", fmt.Errorf("空URL")
 	}
 
-	// 解析URL
-	u, err := url.Parse(urlStr)
+	// 解析URL，先编码空格等不安全字符
+	u, err := url.Parse(utils.EscapeURL(urlStr))
 	if err != nil {
 		return "", err
 	}
@@ -284,7 +349,8 @@ func (p *Parser) GetInlineURLs(htmlData []byte, baseURL string) ([]string, error
 	var urls []string
 	for _, parsed := range result.URLs {
 		// 内联资源通常在img、script、link等标签中
-		if parsed.Tag == "img" || parsed.Tag == "script" || parsed.Tag == "link" {
+		switch parsed.Tag {
+		case "img", "script", "link", "source", "video", "audio":
 			urls = append(urls, parsed.URL)
 		}
 	}
@@ -1,19 +1,29 @@
 package http
 
 import (
+	"bytes"
 	"context"
 	"crypto/tls"
+	"errors"
 	"fmt"
 	"io"
+	"math"
+	"mime"
+	"net"
 	"net/http"
 	"net/url"
+	"os"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
 	"golang.org/x/net/http2"
 
+	"github.com/example/wget2go/internal/core/ratelimit"
+	tlsCore "github.com/example/wget2go/internal/core/tls"
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 )
 
 // Client HTTP客户端
@@ -22,6 +32,13 @@ type Client struct {
 	config       *types.Config
 	userAgent    string
 	proxyManager *ProxyManager
+	retryBudget  *retryBudget
+	privacy      *PrivacyReport
+	transport    http.RoundTripper  // NewClientWithTransport注入的传输层，主机客户端同样使用；默认为nil
+	hosts        *hostClients       // 配置文件hosts中各主机的客户端，没有主机设置时为nil
+	hostConfig   *types.HostConfig  // 主机客户端合并的主机设置
+	limiter      *ratelimit.Limiter // 主机设置了limit_rate时该主机的限速器
+	out          io.Writer          // 详细输出（重试、切换代理）的目标，默认为标准输出
 }
 
 // NewClient 创建新的HTTP客户端
@@ -30,54 +47,197 @@ func NewClient(config *types.Config) *Client {
 	var proxyManager *ProxyManager
 	var err error
 
-	if config.ProxyEnabled || config.HTTPProxy != "" || config.HTTPSProxy != "" {
+	// --unix-socket时所有连接都发往本地套接字，不使用代理
+	if config.UnixSocket == "" && (config.ProxyEnabled || config.HTTPProxy != "" || config.HTTPSProxy != "") {
 		proxyManager, err = NewProxyManager(config)
 		if err != nil {
 			// 代理配置错误，记录警告但不阻止程序运行
 			if config.Verbose {
-				fmt.Printf("警告: 创建代理管理器失败: %v\n", err)
+				fmt.Fprintf(os.Stderr, "警告: 创建代理管理器失败: %v\n", err)
 			}
 		}
 	}
 
+	// TLS配置（协议版本、加密套件、曲线、CA证书、客户端证书、--insecure）由证书管理器统一生成
+	certManager := tlsCore.NewCertManager(config)
+	tlsConfig, err := certManager.GetTLSConfig()
+	if err != nil {
+		// 证书在解析配置时已检查过，库调用方直接传入的配置仍可能无效；
+		// 不能退回到默认设置，否则--pinnedpubkey、--check-ocsp和--ca-certificate会被静默忽略
+		tlsConfig = failClosedTLSConfig(err)
+	}
+
 	// 创建传输层配置
 	var transport *http.Transport
 	if proxyManager != nil {
-		transport = NewProxyTransport(proxyManager, config.Insecure, config.Timeout)
+		transport = NewProxyTransport(proxyManager, tlsConfig, config.Timeout)
 	} else {
 		transport = &http.Transport{
 			MaxIdleConns:        100,
 			IdleConnTimeout:     90 * time.Second,
 			TLSHandshakeTimeout: 10 * time.Second,
 			DisableCompression:  true, // 禁用自动解压，避免文件大小计算问题
+			TLSClientConfig:     tlsConfig,
 		}
+	}
 
-		// 如果允许不安全的SSL连接
-		if config.Insecure {
-			transport.TLSClientConfig = &tls.Config{
-				InsecureSkipVerify: true,
-			}
+	// 连接超时和等待响应头的超时，直连和连接代理都使用同一个Dialer
+	dialer := &net.Dialer{
+		Timeout:   connectTimeout(config),
+		KeepAlive: 30 * time.Second,
+	}
+	if config.BindAddress != "" {
+		// 绑定出站连接的本地地址
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(config.BindAddress)}
+	}
+	network := DialNetwork(config)
+	resolver := newDNSResolver(config)
+	dialTCP := func(ctx context.Context, _, addr string) (net.Conn, error) {
+		if resolver != nil {
+			return resolver.dial(ctx, dialer, network, addr)
+		}
+		return dialer.DialContext(ctx, network, addr)
+	}
+	transport.DialContext = dialTCP
+	if config.UnixSocket != "" {
+		// 与curl的--unix-socket一致，URL中的主机只用于Host头和TLS的SNI
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return dialer.DialContext(ctx, "unix", config.UnixSocket)
 		}
 	}
+	if proxyFunc := transport.Proxy; proxyFunc != nil {
+		// 记录每个请求实际使用的代理，用于错误信息
+		transport.Proxy = func(req *http.Request) (*url.URL, error) {
+			proxyURL, err := proxyFunc(req)
+			recordProxy(req, proxyURL)
+			return proxyURL, err
+		}
+	}
+	if readTimeout := readTimeout(config); readTimeout > 0 {
+		transport.ResponseHeaderTimeout = readTimeout
+	}
 
-	// 启用HTTP/2
-	http2.ConfigureTransport(transport)
+	// 限制响应头大小，防止恶意服务器发送超大响应头
+	if config.MaxResponseHeaderBytes > 0 {
+		transport.MaxResponseHeaderBytes = config.MaxResponseHeaderBytes
+	}
+
+	// OCSP查询与下载使用相同的拨号、DNS和代理设置，在配置HTTP/2之前复制传输层
+	if config.CheckOCSP {
+		certManager.SetOCSPClient(newOCSPClient(config, transport, dialTCP))
+	}
+
+	// 选择HTTP协议版本
+	configureProtocols(transport, config)
+
+	c := newClient(config, transport)
+	c.proxyManager = proxyManager
+	return c
+}
+
+// failClosedTLSConfig 返回所有握手都以TLSConfigError失败的TLS配置，直连和经代理的连接都不能建立
+func failClosedTLSConfig(err error) *tls.Config {
+	configErr := &TLSConfigError{Err: err}
+	return &tls.Config{
+		// 跳过标准验证，保证握手报告的是配置错误；VerifyConnection总是失败，不会接受任何证书
+		InsecureSkipVerify: true,
+		VerifyConnection: func(tls.ConnectionState) error {
+			return configErr
+		},
+	}
+}
 
+// NewClientWithTransport 创建使用指定传输层的HTTP客户端，用于测试时注入httptest或伪造的RoundTripper
+// 连接相关的配置（代理、TLS、超时、DNS、--unix-socket等）由transport负责，不再生效
+func NewClientWithTransport(config *types.Config, transport http.RoundTripper) *Client {
+	c := newClient(config, transport)
+	c.transport = transport
+	return c
+}
+
+// newClient 使用已配置好的传输层创建客户端，处理重定向策略、重试和按主机的设置
+func newClient(config *types.Config, transport http.RoundTripper) *Client {
+	var c *Client
 	client := &http.Client{
 		Transport: transport,
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			if !config.FollowRedirects || len(via) >= config.MaxRedirects {
 				return http.ErrUseLastResponse
 			}
+			applyRedirectAuthPolicy(req, via[0], config.RedirectKeepAuth)
+			if config.Referer == types.RefererSelf {
+				// 重定向后的请求同样以自身URL作为Referer
+				req.Header.Set("Referer", req.URL.String())
+			}
+			c.privacy.record(req)
 			return nil
 		},
 	}
 
-	return &Client{
-		httpClient:   client,
-		config:       config,
-		userAgent:    getUserAgent(config),
-		proxyManager: proxyManager,
+	c = &Client{
+		httpClient:  client,
+		config:      config,
+		userAgent:   getUserAgent(config),
+		retryBudget: newRetryBudget(config.MaxRetriesTotal),
+		out:         os.Stdout,
+	}
+	if len(config.Hosts) > 0 {
+		c.hosts = &hostClients{clients: make(map[*types.HostConfig]*Client)}
+	}
+	return c
+}
+
+// SetOutput 设置详细输出的目标，默认为标准输出
+func (c *Client) SetOutput(w io.Writer) {
+	c.out = w
+}
+
+// SetPrivacyReport 设置隐私报告，之后发送的每个请求按主机记录，需在开始下载前设置
+func (c *Client) SetPrivacyReport(report *PrivacyReport) {
+	c.privacy = report
+}
+
+// applyRedirectAuthPolicy 处理重定向请求上的认证信息
+// 默认在跨源（协议、主机或端口不同）重定向时移除Authorization和Cookie头；
+// keepAuth为true时则从原始请求恢复这些头（net/http可能已按域名规则移除）
+func applyRedirectAuthPolicy(req, initial *http.Request, keepAuth bool) {
+	sensitiveHeaders := []string{"Authorization", "Cookie"}
+
+	if keepAuth {
+		for _, key := range sensitiveHeaders {
+			if values := initial.Header.Values(key); len(values) > 0 && req.Header.Get(key) == "" {
+				req.Header[key] = append([]string(nil), values...)
+			}
+		}
+		return
+	}
+
+	if !sameOrigin(initial.URL, req.URL) {
+		for _, key := range sensitiveHeaders {
+			req.Header.Del(key)
+		}
+	}
+}
+
+// sameOrigin 判断两个URL是否同源
+func sameOrigin(a, b *url.URL) bool {
+	return strings.EqualFold(a.Scheme, b.Scheme) &&
+		strings.EqualFold(a.Hostname(), b.Hostname()) &&
+		portOrDefault(a) == portOrDefault(b)
+}
+
+// portOrDefault 获取URL端口，未指定时返回协议默认端口
+func portOrDefault(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return "443"
+	case "ftp":
+		return "21"
+	default:
+		return "80"
 	}
 }
 
@@ -89,74 +249,377 @@ func getUserAgent(config *types.Config) string {
 	return "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/143.0.0.0 Safari/537.36"
 }
 
+// requestURL 返回实际请求的URL，编码不安全字符并将国际化域名转换为punycode形式
+func (c *Client) requestURL(urlStr string) string {
+	urlStr = utils.EscapeURL(urlStr)
+	if c.config.NoIRI {
+		return urlStr
+	}
+	return utils.ToASCIIURL(urlStr)
+}
+
 // Head 发送HEAD请求获取文件信息
 func (c *Client) Head(ctx context.Context, urlStr string) (*types.HTTPResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, "HEAD", urlStr, nil)
+	c = c.forURL(urlStr)
+	req, err := http.NewRequestWithContext(ctx, "HEAD", c.requestURL(urlStr), nil)
 	if err != nil {
 		return nil, fmt.Errorf("创建HEAD请求失败: %w", err)
 	}
 
 	c.setHeaders(req)
+	c.privacy.record(req)
 
-	resp, err := c.httpClient.Do(req)
+	req, trace := withRequestTrace(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
-		return nil, fmt.Errorf("执行HEAD请求失败: %w", err)
+		return nil, trace.newRequestError(req, err)
 	}
 	defer resp.Body.Close()
 
+	if err := c.checkResponseHeaders(resp); err != nil {
+		return nil, err
+	}
+
+	if err := checkRedirectLocation(resp); err != nil {
+		return nil, err
+	}
+
 	return c.parseResponse(resp), nil
 }
 
 // Get 发送GET请求下载文件
 func (c *Client) Get(ctx context.Context, urlStr string, rangeHeader string) (*http.Response, error) {
-	req, err := http.NewRequestWithContext(ctx, "GET", urlStr, nil)
+	header := make(http.Header)
+	if rangeHeader != "" {
+		header.Set("Range", rangeHeader)
+	}
+	return c.get(ctx, urlStr, header)
+}
+
+// Post 发送POST请求下载文件，请求体按application/x-www-form-urlencoded发送
+// 重定向与wget/curl一致：303（以及301/302）改为GET，307/308保留方法和请求体
+func (c *Client) Post(ctx context.Context, urlStr string, body []byte) (*http.Response, error) {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return c.send(ctx, http.MethodPost, urlStr, header, body)
+}
+
+// GetIfModifiedSince 发送带If-Modified-Since的条件GET请求，调用方需处理200和304两种响应
+// 部分服务器会错误地为304附带响应体，请求不复用连接，避免残留数据影响后续请求
+func (c *Client) GetIfModifiedSince(ctx context.Context, urlStr string, since time.Time) (*http.Response, error) {
+	header := make(http.Header)
+	header.Set("If-Modified-Since", since.UTC().Format(http.TimeFormat))
+	header.Set("Connection", "close")
+	return c.get(ctx, urlStr, header)
+}
+
+// GetConditional 发送带条件请求头（If-None-Match、If-Modified-Since等）的GET请求，调用方需处理200和304两种响应
+// 与GetIfModifiedSince相同，请求不复用连接
+func (c *Client) GetConditional(ctx context.Context, urlStr string, conditions http.Header) (*http.Response, error) {
+	header := conditions.Clone()
+	header.Set("Connection", "close")
+	return c.get(ctx, urlStr, header)
+}
+
+// get 发送带额外请求头的GET请求
+func (c *Client) get(ctx context.Context, urlStr string, header http.Header) (*http.Response, error) {
+	return c.send(ctx, http.MethodGet, urlStr, header, nil)
+}
+
+// send 发送带额外请求头和请求体的请求
+func (c *Client) send(ctx context.Context, method, urlStr string, header http.Header, body []byte) (*http.Response, error) {
+	c = c.forURL(urlStr)
+
+	// 读取超时时取消该请求，响应体关闭后释放
+	reqCtx, cancel := context.WithCancel(ctx)
+
+	// 使用bytes.Reader时请求带有GetBody，重试和307/308重定向时可以重新发送请求体
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	req, err := http.NewRequestWithContext(reqCtx, method, c.requestURL(urlStr), bodyReader)
 	if err != nil {
-		return nil, fmt.Errorf("创建GET请求失败: %w", err)
+		cancel()
+		return nil, fmt.Errorf("创建%s请求失败: %w", method, err)
 	}
 
 	c.setHeaders(req)
 
-	if rangeHeader != "" {
-		req.Header.Set("Range", rangeHeader)
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if req.Header.Get("Range") == "" && c.config.Compression != "" {
+		// 仅对完整下载请求压缩，范围请求必须保持identity编码
+		req.Header.Set("Accept-Encoding", c.config.Compression)
 	}
+	c.privacy.record(req)
 
-	resp, err := c.httpClient.Do(req)
+	req, trace := withRequestTrace(req)
+	resp, err := c.doWithRetry(req)
 	if err != nil {
-		return nil, fmt.Errorf("执行GET请求失败: %w", err)
+		cancel()
+		return nil, trace.newRequestError(req, err)
+	}
+	resp.Body = trace.newBodyErrorReader(resp, newIdleTimeoutReader(resp.Body, readTimeout(c.config), cancel))
+
+	if err := c.checkResponseHeaders(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	if err := checkRedirectLocation(resp); err != nil {
+		resp.Body.Close()
+		return nil, err
 	}
 
 	return resp, nil
 }
 
+// configureProtocols 按--http1.1-only/--http2配置传输层使用的HTTP协议版本
+func configureProtocols(transport *http.Transport, config *types.Config) {
+	if config.HTTP11Only {
+		// 非nil的空TLSNextProto禁用HTTP/2，TLS握手只协商http/1.1
+		transport.ForceAttemptHTTP2 = false
+		transport.TLSNextProto = map[string]func(string, *tls.Conn) http.RoundTripper{}
+		return
+	}
+
+	// 启用HTTP/2，HTTPS连接通过ALPN协商
+	http2.ConfigureTransport(transport)
+
+	// --http2时明文HTTP也直接使用HTTP/2（h2c prior knowledge），经过代理时不使用
+	if config.HTTP2 && transport.Proxy == nil {
+		h2c := &http2.Transport{
+			AllowHTTP: true,
+			DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+				return transport.DialContext(ctx, network, addr)
+			},
+		}
+		if config.MaxResponseHeaderBytes > 0 {
+			h2c.MaxHeaderListSize = uint32(min(config.MaxResponseHeaderBytes, math.MaxUint32))
+		}
+		transport.RegisterProtocol("http", h2c)
+	}
+}
+
+// refererKey 请求上下文中Referer的键
+type refererKey struct{}
+
+// WithReferer 返回附带Referer的上下文，--referer=auto时使用该上下文发送的请求以referer作为Referer
+func WithReferer(ctx context.Context, referer string) context.Context {
+	return context.WithValue(ctx, refererKey{}, referer)
+}
+
+// refererFromContext 获取上下文中的Referer，与浏览器一致，从HTTPS页面请求HTTP资源时不发送
+func refererFromContext(ctx context.Context, target *url.URL) string {
+	referer, _ := ctx.Value(refererKey{}).(string)
+	if referer == "" {
+		return ""
+	}
+	if u, err := url.Parse(referer); err == nil && strings.EqualFold(u.Scheme, "https") && strings.EqualFold(target.Scheme, "http") {
+		return ""
+	}
+	return referer
+}
+
+// DialNetwork 根据--inet4-only/--inet6-only返回建立连接使用的网络
+func DialNetwork(config *types.Config) string {
+	switch {
+	case config.Inet4Only:
+		return "tcp4"
+	case config.Inet6Only:
+		return "tcp6"
+	default:
+		return "tcp"
+	}
+}
+
+// connectTimeout 获取建立连接的超时时间，未配置时使用总超时时间
+func connectTimeout(config *types.Config) time.Duration {
+	if config.ConnectTimeout > 0 {
+		return config.ConnectTimeout
+	}
+	return config.Timeout
+}
+
+// newOCSPClient 创建查询OCSP响应服务器的客户端，复制下载的传输层（代理、绑定地址、DNS、-4/-6和超时）
+// 响应服务器不是--unix-socket的目标，总是通过TCP连接；连接响应服务器时不再检查OCSP，避免递归
+func newOCSPClient(config *types.Config, transport *http.Transport, dialTCP func(ctx context.Context, network, addr string) (net.Conn, error)) *http.Client {
+	ocspTransport := transport.Clone()
+	ocspTransport.DialContext = dialTCP
+	ocspConfig := *config
+	ocspConfig.CheckOCSP = false
+	if tlsConfig, err := tlsCore.NewCertManager(&ocspConfig).GetTLSConfig(); err == nil {
+		ocspTransport.TLSClientConfig = tlsConfig
+	}
+	return &http.Client{Transport: ocspTransport}
+}
+
+// readTimeout 获取读取数据的空闲超时时间，未配置时使用总超时时间
+func readTimeout(config *types.Config) time.Duration {
+	if config.ReadTimeout > 0 {
+		return config.ReadTimeout
+	}
+	return config.Timeout
+}
+
+// headerLimitError 将响应头超过大小限制的传输层错误转换为HeaderLimitError
+// net/http没有导出该错误的类型，只能按其错误信息识别
+func (c *Client) headerLimitError(err error) error {
+	if c.config.MaxResponseHeaderBytes > 0 && strings.Contains(err.Error(), "response headers exceeded") {
+		return &HeaderLimitError{Limit: c.config.MaxResponseHeaderBytes, Err: err}
+	}
+	return err
+}
+
+// checkResponseHeaders 检查响应头数量是否超过限制
+func (c *Client) checkResponseHeaders(resp *http.Response) error {
+	if c.config.MaxResponseHeaders <= 0 {
+		return nil
+	}
+
+	count := 0
+	for _, values := range resp.Header {
+		count += len(values)
+	}
+	if count > c.config.MaxResponseHeaders {
+		return &HeaderLimitError{Limit: int64(c.config.MaxResponseHeaders), Count: count}
+	}
+	return nil
+}
+
+// ErrRemoteFileChanged 远程文件在断点续传期间已改变（If-Range条件不满足）
+var ErrRemoteFileChanged = errors.New("远程文件已改变")
+
+// IfRangeValidator 根据响应生成If-Range的值，优先使用强ETag，否则使用Last-Modified
+// 弱ETag不能用于If-Range，两者都不可用时返回空字符串
+func IfRangeValidator(info *types.HTTPResponse) string {
+	if info.ETag != "" && !strings.HasPrefix(info.ETag, "W/") {
+		return info.ETag
+	}
+	if !info.LastModified.IsZero() {
+		return info.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return ""
+}
+
+// checkRedirectLocation 检查重定向响应是否带有可用的Location头
+// 部分服务器返回3xx却不提供Location，net/http会直接返回该响应，
+// 这里将其视为错误，避免把重定向页面当作下载内容保存
+func checkRedirectLocation(resp *http.Response) error {
+	if resp.StatusCode < 300 || resp.StatusCode >= 400 || resp.StatusCode == http.StatusNotModified {
+		return nil
+	}
+
+	location := strings.TrimSpace(resp.Header.Get("Location"))
+	if location == "" {
+		return fmt.Errorf("服务器返回重定向状态码 %d 但缺少Location头: %s", resp.StatusCode, resp.Request.URL)
+	}
+
+	if _, err := url.Parse(location); err != nil {
+		return fmt.Errorf("服务器返回重定向状态码 %d 但Location头无效 (%q): %w", resp.StatusCode, location, err)
+	}
+
+	return nil
+}
+
 // DownloadRange 下载指定范围的数据
 func (c *Client) DownloadRange(ctx context.Context, urlStr string, start, end int64) (io.ReadCloser, int64, error) {
-	rangeHeader := fmt.Sprintf("bytes=%d-%d", start, end)
-	resp, err := c.Get(ctx, urlStr, rangeHeader)
+	return c.DownloadRangeIf(ctx, urlStr, start, end, "")
+}
+
+// DownloadRangeIf 带If-Range条件下载指定范围的数据，ifRange为ETag或HTTP日期
+// 服务器返回完整内容（200）表示文件已改变，返回ErrRemoteFileChanged
+func (c *Client) DownloadRangeIf(ctx context.Context, urlStr string, start, end int64, ifRange string) (io.ReadCloser, int64, error) {
+	header := make(http.Header)
+	header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, end))
+	if ifRange != "" {
+		header.Set("If-Range", ifRange)
+	}
+
+	resp, err := c.get(ctx, urlStr, header)
 	if err != nil {
 		return nil, 0, err
 	}
 
+	if ifRange != "" && resp.StatusCode == http.StatusOK {
+		resp.Body.Close()
+		return nil, 0, ErrRemoteFileChanged
+	}
+
 	if resp.StatusCode != http.StatusPartialContent {
 		resp.Body.Close()
-		return nil, 0, fmt.Errorf("服务器不支持范围请求，状态码: %d", resp.StatusCode)
+		return nil, 0, rangeError(resp.StatusCode)
 	}
 
 	return resp.Body, resp.ContentLength, nil
 }
 
+// rangeError 范围请求没有返回206时的错误，200和416表示不支持范围请求，其他状态码为HTTP错误
+func rangeError(statusCode int) error {
+	if statusCode == http.StatusOK || statusCode == http.StatusRequestedRangeNotSatisfiable {
+		return &RangeNotSupportedError{StatusCode: statusCode}
+	}
+	return &HTTPError{StatusCode: statusCode}
+}
+
+// ProbeSize 发送Range: bytes=0-0的GET请求，从Content-Range（如bytes 0-0/12345）获取文件总大小
+// 用于HEAD响应没有Content-Length的服务器；服务器不支持范围请求或总大小未知时返回错误
+func (c *Client) ProbeSize(ctx context.Context, urlStr string) (int64, error) {
+	header := make(http.Header)
+	header.Set("Range", "bytes=0-0")
+
+	resp, err := c.get(ctx, urlStr, header)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusPartialContent {
+		return 0, rangeError(resp.StatusCode)
+	}
+
+	total, ok := parseContentRangeTotal(resp.Header.Get("Content-Range"))
+	if !ok {
+		return 0, fmt.Errorf("无法从Content-Range获取文件大小: %q", resp.Header.Get("Content-Range"))
+	}
+	return total, nil
+}
+
+// parseContentRangeTotal 解析Content-Range中的总大小，总大小为*时返回false
+func parseContentRangeTotal(contentRange string) (int64, bool) {
+	unit, rest, found := strings.Cut(strings.TrimSpace(contentRange), " ")
+	if !found || !strings.EqualFold(unit, "bytes") {
+		return 0, false
+	}
+	_, totalStr, found := strings.Cut(rest, "/")
+	if !found {
+		return 0, false
+	}
+	total, err := strconv.ParseInt(strings.TrimSpace(totalStr), 10, 64)
+	if err != nil || total <= 0 {
+		return 0, false
+	}
+	return total, true
+}
+
 // setHeaders 设置请求头
 func (c *Client) setHeaders(req *http.Request) {
 	req.Header.Set("User-Agent", c.userAgent)
 	
-	if c.config.Referer != "" {
+	switch c.config.Referer {
+	case "":
+	case types.RefererSelf:
+		req.Header.Set("Referer", req.URL.String())
+	case types.RefererAuto:
+		if referer := refererFromContext(req.Context(), req.URL); referer != "" {
+			req.Header.Set("Referer", referer)
+		}
+	default:
 		req.Header.Set("Referer", c.config.Referer)
 	}
 
-	// 设置自定义头部
-	for key, value := range c.config.Headers {
-		req.Header.Set(key, value)
-	}
-
 	// 设置Cookie
 	if len(c.config.Cookies) > 0 {
 		var cookies []string
@@ -166,17 +629,42 @@ func (c *Client) setHeaders(req *http.Request) {
 		req.Header.Set("Cookie", strings.Join(cookies, "; "))
 	}
 
-	// 添加代理认证头（如果配置了代理认证）
-	if c.proxyManager != nil && (c.config.ProxyUsername != "" || c.config.ProxyPassword != "") {
-		proxyAuth := c.proxyManager.GetProxyAuthHeader()
-		if proxyAuth != "" {
-			req.Header.Set("Proxy-Authorization", proxyAuth)
-		}
-	}
-
 	// 对于下载请求，总是要求不压缩，避免文件大小计算问题
 	// 同时支持断点续传（identity编码确保范围请求正常工作）
 	req.Header.Set("Accept-Encoding", "identity")
+
+	// 请求服务器返回文件的摘要，用于下载后校验
+	if c.config.VerifyDigest {
+		req.Header.Set("Want-Digest", "sha-256, sha-512;q=0.5, md5;q=0.1")
+	}
+
+	c.applyCustomHeaders(req)
+}
+
+// applyCustomHeaders 应用--header指定的头部，在默认头部之后设置：
+// 同名头部第一次出现时覆盖默认值，之后追加；值为空时移除该头部（与wget一致）
+func (c *Client) applyCustomHeaders(req *http.Request) {
+	seen := make(map[string]bool)
+	for _, header := range c.config.Headers {
+		key := http.CanonicalHeaderKey(header.Key)
+		if header.Value == "" {
+			if key == "User-Agent" {
+				// 没有User-Agent时net/http会发送默认值，空值表示不发送
+				req.Header[key] = []string{""}
+			} else {
+				req.Header.Del(key)
+			}
+			seen[key] = false
+			continue
+		}
+
+		if seen[key] {
+			req.Header.Add(key, header.Value)
+		} else {
+			req.Header.Set(key, header.Value)
+			seen[key] = true
+		}
+	}
 }
 
 // parseResponse 解析HTTP响应
@@ -190,6 +678,11 @@ func (c *Client) parseResponse(resp *http.Response) *types.HTTPResponse {
 
 	acceptRanges := resp.Header.Get("Accept-Ranges") == "bytes"
 
+	var finalURL string
+	if resp.Request != nil && resp.Request.URL != nil {
+		finalURL = resp.Request.URL.String()
+	}
+
 	return &types.HTTPResponse{
 		StatusCode:    resp.StatusCode,
 		ContentLength: contentLength,
@@ -197,6 +690,11 @@ func (c *Client) parseResponse(resp *http.Response) *types.HTTPResponse {
 		LastModified:  lastModified,
 		ETag:          resp.Header.Get("ETag"),
 		AcceptRanges:  acceptRanges,
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+		Digest:        resp.Header.Get("Digest"),
+		FinalURL:      finalURL,
+		ProtoMajor:    resp.ProtoMajor,
+		ProtoMinor:    resp.ProtoMinor,
 	}
 }
 
@@ -226,5 +724,40 @@ func (c *Client) GetFileNameFromURL(urlStr string) string {
 		return "index.html"
 	}
 
-	return filename
-}
\ No newline at end of file
+	return utils.RestrictFileName(filename, c.config.RestrictFileNames)
+}
+
+// GetFileNameFromContentDisposition 从Content-Disposition头中提取文件名
+// 支持filename=和RFC 5987编码的filename*=，优先使用后者；
+// 返回值只保留最后一个路径分量并经过清理，无法得到安全文件名时返回空字符串
+func (c *Client) GetFileNameFromContentDisposition(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	// mime.ParseMediaType会解码filename*=UTF-8''...形式并存入"filename"
+	_, params, err := mime.ParseMediaType(header)
+	if err != nil {
+		return ""
+	}
+
+	filename := params["filename"]
+	if filename == "" {
+		return ""
+	}
+
+	// 防止路径穿越：统一分隔符后只取最后一部分
+	filename = strings.ReplaceAll(filename, "\\", "/")
+	filename = path.Base(filename)
+	filename = strings.TrimSpace(filename)
+	if filename == "." || filename == ".." || filename == "/" || filename == "" {
+		return ""
+	}
+
+	filename = utils.SafeFileName(filename)
+	if strings.Trim(filename, ".") == "" {
+		return ""
+	}
+
+	return utils.RestrictFileName(filename, c.config.RestrictFileNames)
+}
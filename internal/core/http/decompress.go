@@ -0,0 +1,73 @@
+package http
+
+import (
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// ParseContentEncodings 解析响应的Content-Encoding（可能有多个值或多个头部），
+// 按服务器应用的顺序返回，忽略identity；包含不支持的编码时返回错误
+func ParseContentEncodings(header http.Header) ([]string, error) {
+	var encodings []string
+	for _, value := range header.Values("Content-Encoding") {
+		for _, encoding := range strings.Split(value, ",") {
+			encoding = strings.ToLower(strings.TrimSpace(encoding))
+			switch encoding {
+			case "", "identity":
+				continue
+			case "gzip", "x-gzip", "deflate", "br":
+				encodings = append(encodings, encoding)
+			default:
+				return nil, fmt.Errorf("不支持的Content-Encoding: %s（完整值: %s）", encoding, strings.Join(header.Values("Content-Encoding"), ", "))
+			}
+		}
+	}
+	return encodings, nil
+}
+
+// NewContentDecoder 按与应用顺序相反的顺序依次解码，如"br, gzip"先解gzip再解br
+func NewContentDecoder(body io.Reader, encodings []string) (io.ReadCloser, error) {
+	decoder := &contentDecoder{Reader: body}
+	for i := len(encodings) - 1; i >= 0; i-- {
+		switch encodings[i] {
+		case "gzip", "x-gzip":
+			gzipReader, err := gzip.NewReader(decoder.Reader)
+			if err != nil {
+				decoder.Close()
+				return nil, fmt.Errorf("创建gzip解压器失败: %w", err)
+			}
+			decoder.Reader = gzipReader
+			decoder.closers = append(decoder.closers, gzipReader)
+		case "deflate":
+			zlibReader, err := zlib.NewReader(decoder.Reader)
+			if err != nil {
+				decoder.Close()
+				return nil, fmt.Errorf("创建zlib解压器失败: %w", err)
+			}
+			decoder.Reader = zlibReader
+			decoder.closers = append(decoder.closers, zlibReader)
+		case "br":
+			decoder.Reader = brotli.NewReader(decoder.Reader)
+		}
+	}
+	return decoder, nil
+}
+
+// contentDecoder 多层解码器，关闭时释放所有层
+type contentDecoder struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (d *contentDecoder) Close() error {
+	for i := len(d.closers) - 1; i >= 0; i-- {
+		d.closers[i].Close()
+	}
+	return nil
+}
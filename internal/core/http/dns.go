@@ -0,0 +1,132 @@
+package http
+
+import (
+	"context"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// dnsResolver 解析连接的主机名，可以使用--dns-servers指定的DNS服务器，
+// 并按--dns-cache在进程内缓存解析结果，递归下载时同一主机不再重复解析
+type dnsResolver struct {
+	resolver *net.Resolver
+	ttl      time.Duration // 缓存有效期，0表示不缓存
+
+	mu      sync.Mutex
+	entries map[string]dnsEntry
+	now     func() time.Time
+}
+
+// dnsEntry 一个主机的缓存结果，包含所有A和AAAA记录
+type dnsEntry struct {
+	ips     []net.IP
+	expires time.Time
+}
+
+// newDNSResolver 按配置创建解析器，既不缓存也不指定DNS服务器时返回nil（由net.Dialer使用系统解析）
+func newDNSResolver(config *types.Config) *dnsResolver {
+	var ttl time.Duration
+	if config.DNSCache {
+		ttl = config.DNSCacheTTL
+	}
+	if ttl <= 0 && len(config.DNSServers) == 0 {
+		return nil
+	}
+
+	resolver := net.DefaultResolver
+	if servers := config.DNSServers; len(servers) > 0 {
+		// 每次查询依次使用下一个服务器，某个服务器无响应时Go解析器的重试会转到下一个
+		var next atomic.Uint32
+		dialer := &net.Dialer{Timeout: connectTimeout(config)}
+		resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				server := servers[int(next.Add(1)-1)%len(servers)]
+				return dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+
+	return &dnsResolver{
+		resolver: resolver,
+		ttl:      ttl,
+		entries:  make(map[string]dnsEntry),
+		now:      time.Now,
+	}
+}
+
+// lookup 解析主机名的所有地址，缓存未过期时直接返回缓存的结果
+func (r *dnsResolver) lookup(ctx context.Context, host string) ([]net.IP, error) {
+	if r.ttl > 0 {
+		r.mu.Lock()
+		entry, ok := r.entries[host]
+		r.mu.Unlock()
+		if ok && r.now().Before(entry.expires) {
+			return entry.ips, nil
+		}
+	}
+
+	addrs, err := r.resolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, 0, len(addrs))
+	for _, addr := range addrs {
+		ips = append(ips, addr.IP)
+	}
+
+	if r.ttl > 0 {
+		r.mu.Lock()
+		r.entries[host] = dnsEntry{ips: ips, expires: r.now().Add(r.ttl)}
+		r.mu.Unlock()
+	}
+	return ips, nil
+}
+
+// dial 解析addr中的主机名后按顺序尝试每个地址，直到连接成功
+// network为tcp4或tcp6（--inet4-only/--inet6-only）时只使用对应协议的地址
+func (r *dnsResolver) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	ips, err := r.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for _, ip := range filterIPs(ips, network) {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = &net.DNSError{Err: "没有" + network + "可用的地址", Name: host, IsNotFound: true}
+	}
+	return nil, lastErr
+}
+
+// filterIPs 按网络类型筛选地址，tcp时保留所有地址
+func filterIPs(ips []net.IP, network string) []net.IP {
+	if network != "tcp4" && network != "tcp6" {
+		return ips
+	}
+	var filtered []net.IP
+	for _, ip := range ips {
+		if (ip.To4() != nil) == (network == "tcp4") {
+			filtered = append(filtered, ip)
+		}
+	}
+	return filtered
+}
@@ -0,0 +1,273 @@
+package http
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"sync"
+
+	tlsCore "github.com/example/wget2go/internal/core/tls"
+)
+
+// 请求失败的阶段
+const (
+	PhaseDial    = "dial"    // 建立TCP连接（包括连接代理）
+	PhaseTLS     = "tls"     // TLS握手
+	PhaseHeaders = "headers" // 发送请求或等待响应头
+	PhaseBody    = "body"    // 读取响应体
+)
+
+// RequestError 请求失败的错误，附带目标主机、使用的代理和失败的阶段，便于排查批量下载日志
+type RequestError struct {
+	Method string
+	Host   string
+	Proxy  string // 已去除认证信息，未使用代理时为空
+	Phase  string
+	Err    error
+}
+
+func (e *RequestError) Error() string {
+	proxy := e.Proxy
+	if proxy == "" {
+		proxy = "无"
+	}
+	action := fmt.Sprintf("执行%s请求失败", e.Method)
+	if e.Phase == PhaseBody {
+		action = fmt.Sprintf("读取%s响应体失败", e.Method)
+	}
+	return fmt.Sprintf("%s [主机: %s, 代理: %s, 阶段: %s]: %v", action, e.Host, proxy, e.Phase, e.Err)
+}
+
+func (e *RequestError) Unwrap() error {
+	return e.Err
+}
+
+// HTTPError 服务器返回了不能作为下载内容的状态码
+type HTTPError struct {
+	StatusCode int
+}
+
+func (e *HTTPError) Error() string {
+	return fmt.Sprintf("HTTP错误: %d", e.StatusCode)
+}
+
+// RangeNotSupportedError 服务器没有对范围请求返回206，需要改用单线程下载
+type RangeNotSupportedError struct {
+	StatusCode int
+}
+
+func (e *RangeNotSupportedError) Error() string {
+	return fmt.Sprintf("服务器不支持范围请求，状态码: %d", e.StatusCode)
+}
+
+// HeaderLimitError 响应头超过--max-response-header-bytes的大小限制或--max-response-headers的数量限制
+type HeaderLimitError struct {
+	Limit int64 // 超过的限制：超过大小限制时为字节数，否则为响应头数量
+	Count int   // 响应头数量，超过大小限制时为0
+	Err   error // 超过大小限制时传输层返回的错误
+}
+
+func (e *HeaderLimitError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("响应头超过大小限制 (%d 字节): %v", e.Limit, e.Err)
+	}
+	return fmt.Sprintf("响应头数量超过限制: %d > %d", e.Count, e.Limit)
+}
+
+func (e *HeaderLimitError) Unwrap() error {
+	return e.Err
+}
+
+// TLSConfigError 无法按配置生成TLS设置（如CA证书或客户端证书无法加载），使用该配置的HTTPS请求都以此失败
+type TLSConfigError struct {
+	Err error
+}
+
+func (e *TLSConfigError) Error() string {
+	return fmt.Sprintf("TLS配置无效: %v", e.Err)
+}
+
+func (e *TLSConfigError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable 判断错误是否为暂时性错误：网络错误、408、429和5xx可以重试，
+// 其他4xx、证书错误、取消和远程文件改变等错误重试也不会成功
+func IsRetryable(err error) bool {
+	var httpErr *HTTPError
+	if errors.As(err, &httpErr) {
+		return isTransientStatus(httpErr.StatusCode)
+	}
+	var reqErr *RequestError
+	if errors.As(err, &reqErr) {
+		return isRetryableError(reqErr.Err)
+	}
+	return false
+}
+
+// isTransientStatus 检查状态码是否表示暂时性错误
+func isTransientStatus(statusCode int) bool {
+	return statusCode == http.StatusRequestTimeout ||
+		statusCode == http.StatusTooManyRequests ||
+		statusCode >= 500
+}
+
+// isRetryableError 检查传输层错误是否可以重试
+func isRetryableError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	// 同一服务器的响应头不会变小，重试也不会成功
+	var headerErr *HeaderLimitError
+	if errors.As(err, &headerErr) {
+		return false
+	}
+	// --pinnedpubkey、--check-ocsp和--no-check-certificate=…的检查失败时crypto/tls原样返回错误
+	var verifyErr *tlsCore.VerificationError
+	var configErr *TLSConfigError
+	if errors.As(err, &verifyErr) || errors.As(err, &configErr) {
+		return false
+	}
+	var certErr *tls.CertificateVerificationError
+	var hostnameErr x509.HostnameError
+	var authorityErr x509.UnknownAuthorityError
+	var invalidErr x509.CertificateInvalidError
+	return !errors.As(err, &certErr) && !errors.As(err, &hostnameErr) &&
+		!errors.As(err, &authorityErr) && !errors.As(err, &invalidErr)
+}
+
+// requestTrace 记录单个请求使用的代理和已完成的连接阶段
+type requestTrace struct {
+	mu         sync.Mutex
+	proxy      string
+	connected  bool
+	tlsStarted bool
+	tlsDone    bool
+}
+
+// requestTraceKey 请求上下文中requestTrace的键
+type requestTraceKey struct{}
+
+// withRequestTrace 为请求附加连接阶段跟踪
+func withRequestTrace(req *http.Request) (*http.Request, *requestTrace) {
+	trace := &requestTrace{}
+	ctx := context.WithValue(req.Context(), requestTraceKey{}, trace)
+	ctx = httptrace.WithClientTrace(ctx, &httptrace.ClientTrace{
+		TLSHandshakeStart: func() {
+			trace.mu.Lock()
+			trace.tlsStarted = true
+			trace.mu.Unlock()
+		},
+		TLSHandshakeDone: func(_ tls.ConnectionState, err error) {
+			trace.mu.Lock()
+			trace.tlsDone = err == nil
+			trace.mu.Unlock()
+		},
+		GotConn: func(httptrace.GotConnInfo) {
+			trace.mu.Lock()
+			trace.connected = true
+			trace.mu.Unlock()
+		},
+	})
+	return req.WithContext(ctx), trace
+}
+
+// recordProxy 记录请求实际使用的代理，由传输层的代理函数调用
+func recordProxy(req *http.Request, proxyURL *url.URL) {
+	trace, ok := req.Context().Value(requestTraceKey{}).(*requestTrace)
+	if !ok {
+		return
+	}
+	trace.mu.Lock()
+	trace.proxy = redactProxy(proxyURL)
+	trace.mu.Unlock()
+}
+
+// usedProxy 返回最近一次请求使用的代理，未使用代理时为空
+func (t *requestTrace) usedProxy() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.proxy
+}
+
+// resetPhases 清除已完成的连接阶段，重新发送请求前调用
+func (t *requestTrace) resetPhases() {
+	t.mu.Lock()
+	t.connected, t.tlsStarted, t.tlsDone = false, false, false
+	t.mu.Unlock()
+}
+
+// phase 根据已完成的阶段判断请求在哪个阶段失败
+func (t *requestTrace) phase() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	switch {
+	case t.connected:
+		return PhaseHeaders
+	case t.tlsStarted && !t.tlsDone:
+		return PhaseTLS
+	default:
+		return PhaseDial
+	}
+}
+
+// newRequestError 包装请求失败的错误，重定向后失败时使用实际失败的URL的主机
+func (t *requestTrace) newRequestError(req *http.Request, err error) *RequestError {
+	host := req.URL.Host
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		if u, parseErr := url.Parse(urlErr.URL); parseErr == nil && u.Host != "" {
+			host = u.Host
+		}
+	}
+
+	t.mu.Lock()
+	proxy := t.proxy
+	t.mu.Unlock()
+
+	return &RequestError{
+		Method: req.Method,
+		Host:   host,
+		Proxy:  proxy,
+		Phase:  t.phase(),
+		Err:    err,
+	}
+}
+
+// redactProxy 返回不含认证信息的代理地址
+func redactProxy(proxyURL *url.URL) string {
+	if proxyURL == nil {
+		return ""
+	}
+	return (&url.URL{Scheme: proxyURL.Scheme, Host: proxyURL.Host}).String()
+}
+
+// bodyErrorReader 为读取响应体时的错误附加主机和代理信息
+type bodyErrorReader struct {
+	io.ReadCloser
+	method string
+	host   string
+	proxy  string
+}
+
+func (r *bodyErrorReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	if err != nil && err != io.EOF {
+		err = &RequestError{Method: r.method, Host: r.host, Proxy: r.proxy, Phase: PhaseBody, Err: err}
+	}
+	return n, err
+}
+
+// newBodyErrorReader 包装响应体
+func (t *requestTrace) newBodyErrorReader(resp *http.Response, body io.ReadCloser) io.ReadCloser {
+	t.mu.Lock()
+	proxy := t.proxy
+	t.mu.Unlock()
+	return &bodyErrorReader{ReadCloser: body, method: resp.Request.Method, host: resp.Request.URL.Host, proxy: proxy}
+}
@@ -0,0 +1,67 @@
+package http
+
+import (
+	"net/url"
+	"sync"
+
+	"github.com/example/wget2go/internal/core/ratelimit"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// hostClients 配置文件hosts中各主机设置对应的客户端，首次请求该主机时创建
+// 同一主机设置（包括.域名后缀匹配的多个主机）共享一个客户端和限速器
+type hostClients struct {
+	mu      sync.Mutex
+	clients map[*types.HostConfig]*Client
+}
+
+// forURL 返回请求urlStr使用的客户端：主机有单独设置时为合并该设置后的客户端，否则为c本身
+// 重定向到其他主机的请求仍使用初始URL的主机设置
+func (c *Client) forURL(urlStr string) *Client {
+	if c.hosts == nil {
+		return c
+	}
+	u, err := url.Parse(urlStr)
+	if err != nil {
+		return c
+	}
+	hostConfig := c.config.HostConfigFor(u.Hostname())
+	if hostConfig == nil {
+		return c
+	}
+
+	c.hosts.mu.Lock()
+	defer c.hosts.mu.Unlock()
+	if client, ok := c.hosts.clients[hostConfig]; ok {
+		return client
+	}
+
+	config := *c.config
+	config.Hosts = nil
+	hostConfig.Apply(&config)
+	var client *Client
+	if c.transport != nil {
+		client = NewClientWithTransport(&config, c.transport)
+	} else {
+		client = NewClient(&config)
+	}
+	client.retryBudget = c.retryBudget
+	client.privacy = c.privacy
+	client.out = c.out
+	client.hostConfig = hostConfig
+	if hostConfig.LimitRate != nil {
+		client.limiter = ratelimit.NewLimiter(*hostConfig.LimitRate)
+	}
+	c.hosts.clients[hostConfig] = client
+	return client
+}
+
+// HostLimiter 返回配置文件hosts中为urlStr的主机设置的限速器，所有下载器共享
+// 主机设置了limit_rate时ok为true（limit_rate为0时限速器为nil，表示不限速），否则调用方使用全局限速器
+func (c *Client) HostLimiter(urlStr string) (limiter *ratelimit.Limiter, ok bool) {
+	client := c.forURL(urlStr)
+	if client.hostConfig == nil || client.hostConfig.LimitRate == nil {
+		return nil, false
+	}
+	return client.limiter, true
+}
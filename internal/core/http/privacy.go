@@ -0,0 +1,89 @@
+package http
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// HostPrivacy 发送到同一主机的请求中携带的Cookie和Referer次数
+type HostPrivacy struct {
+	Host     string
+	Requests int
+	Cookies  int // 携带Cookie头的请求数
+	Referers int // 携带Referer头的请求数
+}
+
+// PrivacyReport 按主机汇总请求中发送的Cookie和Referer，用于审计跨源信息泄露
+type PrivacyReport struct {
+	mu    sync.Mutex
+	hosts map[string]*HostPrivacy
+}
+
+// NewPrivacyReport 创建隐私报告
+func NewPrivacyReport() *PrivacyReport {
+	return &PrivacyReport{hosts: make(map[string]*HostPrivacy)}
+}
+
+// record 记录一个即将发送的请求（包括重定向后的请求）
+func (r *PrivacyReport) record(req *http.Request) {
+	if r == nil {
+		return
+	}
+	host := strings.ToLower(req.URL.Host)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	h, ok := r.hosts[host]
+	if !ok {
+		h = &HostPrivacy{Host: host}
+		r.hosts[host] = h
+	}
+	h.Requests++
+	if req.Header.Get("Cookie") != "" {
+		h.Cookies++
+	}
+	if req.Header.Get("Referer") != "" {
+		h.Referers++
+	}
+}
+
+// Hosts 返回按主机名排序的统计
+func (r *PrivacyReport) Hosts() []HostPrivacy {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	hosts := make([]HostPrivacy, 0, len(r.hosts))
+	for _, h := range r.hosts {
+		hosts = append(hosts, *h)
+	}
+	sort.Slice(hosts, func(i, j int) bool { return hosts[i].Host < hosts[j].Host })
+	return hosts
+}
+
+// ThirdParty 返回firstParty（主机[:端口]）之外的主机的统计
+func (r *PrivacyReport) ThirdParty(firstParty string) []HostPrivacy {
+	var hosts []HostPrivacy
+	for _, h := range r.Hosts() {
+		if !strings.EqualFold(h.Host, firstParty) {
+			hosts = append(hosts, h)
+		}
+	}
+	return hosts
+}
+
+// Write 输出第三方主机收到的请求、Cookie和Referer
+func (r *PrivacyReport) Write(w io.Writer, firstParty string) {
+	hosts := r.ThirdParty(firstParty)
+	fmt.Fprintln(w, "\n=== 隐私报告 ===")
+	if len(hosts) == 0 {
+		fmt.Fprintf(w, "没有向 %s 以外的主机发送请求\n", firstParty)
+		return
+	}
+	fmt.Fprintf(w, "第三方主机: %d\n", len(hosts))
+	for _, h := range hosts {
+		fmt.Fprintf(w, "  %s: %d 个请求, 发送Cookie %d 次, 发送Referer %d 次\n", h.Host, h.Requests, h.Cookies, h.Referers)
+	}
+}
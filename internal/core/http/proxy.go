@@ -1,11 +1,12 @@
 package http
 
 import (
-	"bufio"
 	"context"
 	"crypto/tls"
 	"encoding/base64"
 	"fmt"
+	"hash/fnv"
+	"io"
 	"net"
 	"net/http"
 	"net/url"
@@ -36,6 +37,20 @@ type ProxyManager struct {
 	httpsIndex  int
 	httpProxies []*url.URL
 	httpsProxies []*url.URL
+	roundRobin  bool // 轮换代理；默认同一目标主机固定使用一个代理
+	health      map[string]*proxyHealth // 按代理地址记录的连续失败次数
+}
+
+// 代理连续失败proxyFailureThreshold次后暂停使用proxyDeadCooldown
+const (
+	proxyFailureThreshold = 3
+	proxyDeadCooldown     = time.Minute
+)
+
+// proxyHealth 单个代理的健康状态
+type proxyHealth struct {
+	failures  int       // 连续失败次数
+	deadUntil time.Time // 暂停使用的截止时间
 }
 
 // NewProxyManager 创建代理管理器
@@ -68,6 +83,8 @@ func NewProxyManager(cfg *types.Config) (*ProxyManager, error) {
 		config:        pm,
 		httpProxies:   httpProxies,
 		httpsProxies:  httpsProxies,
+		roundRobin:    cfg.ProxyRotation == types.ProxyRotationRoundRobin,
+		health:        make(map[string]*proxyHealth),
 	}, nil
 }
 
@@ -123,6 +140,20 @@ func parseNoProxyList(noProxyStr string) []string {
 
 // GetProxyForURL 获取指定URL的代理
 func (pm *ProxyManager) GetProxyForURL(targetURL *url.URL) (*url.URL, error) {
+	return pm.selectProxy(targetURL, nil), nil
+}
+
+// selectProxy 为目标URL选择代理，跳过excluded中本次请求已失败的代理
+func (pm *ProxyManager) selectProxy(targetURL *url.URL, excluded map[string]bool) *url.URL {
+	proxies, index := pm.proxiesFor(targetURL)
+	if len(proxies) == 0 {
+		return nil
+	}
+	return pm.pickProxy(pm.usableProxies(proxies, excluded), index, targetURL)
+}
+
+// proxiesFor 返回目标URL可用的代理列表，不使用代理时返回nil
+func (pm *ProxyManager) proxiesFor(targetURL *url.URL) ([]*url.URL, *int) {
 	if pm.config == nil {
 		return nil, nil
 	}
@@ -132,31 +163,181 @@ func (pm *ProxyManager) GetProxyForURL(targetURL *url.URL) (*url.URL, error) {
 		return nil, nil
 	}
 
+	// 根据协议选择代理，HTTPS如果没有专门的代理，使用HTTP代理
+	if targetURL.Scheme == "https" && len(pm.httpsProxies) > 0 {
+		return pm.httpsProxies, &pm.httpsIndex
+	}
+	if len(pm.httpProxies) > 0 {
+		return pm.httpProxies, &pm.httpIndex
+	}
+
+	return nil, nil
+}
+
+// usableProxies 过滤掉本次请求已失败和暂停使用中的代理
+// 全部被暂停时仍使用未失败的代理，全部失败时返回原列表，由调用方决定是否继续重试
+func (pm *ProxyManager) usableProxies(proxies []*url.URL, excluded map[string]bool) []*url.URL {
+	now := time.Now()
+	var alive, untried []*url.URL
+
+	pm.proxyMutex.RLock()
+	for _, proxy := range proxies {
+		key := redactProxy(proxy)
+		if excluded[key] {
+			continue
+		}
+		untried = append(untried, proxy)
+		if h := pm.health[key]; h == nil || !now.Before(h.deadUntil) {
+			alive = append(alive, proxy)
+		}
+	}
+	pm.proxyMutex.RUnlock()
+
+	switch {
+	case len(alive) > 0:
+		return alive
+	case len(untried) > 0:
+		return untried
+	default:
+		return proxies
+	}
+}
+
+// hasUntriedProxy 检查目标URL是否还有本次请求没有尝试过的代理
+func (pm *ProxyManager) hasUntriedProxy(targetURL *url.URL, excluded map[string]bool) bool {
+	proxies, _ := pm.proxiesFor(targetURL)
+	for _, proxy := range proxies {
+		if !excluded[redactProxy(proxy)] {
+			return true
+		}
+	}
+	return false
+}
+
+// reportFailure 记录代理失败，连续失败达到阈值时暂停使用该代理，返回是否刚被暂停
+func (pm *ProxyManager) reportFailure(proxy string) bool {
 	pm.proxyMutex.Lock()
 	defer pm.proxyMutex.Unlock()
 
-	// 根据协议选择代理
-	if targetURL.Scheme == "https" {
-		if len(pm.httpsProxies) > 0 {
-			proxy := pm.httpsProxies[pm.httpsIndex%len(pm.httpsProxies)]
-			pm.httpsIndex++
-			return proxy, nil
+	h := pm.health[proxy]
+	if h == nil {
+		h = &proxyHealth{}
+		pm.health[proxy] = h
+	}
+	h.failures++
+	if h.failures < proxyFailureThreshold {
+		return false
+	}
+	h.failures = 0
+	h.deadUntil = time.Now().Add(proxyDeadCooldown)
+	return true
+}
+
+// reportSuccess 代理成功完成请求，清除失败记录
+func (pm *ProxyManager) reportSuccess(proxy string) {
+	pm.proxyMutex.RLock()
+	_, failed := pm.health[proxy]
+	pm.proxyMutex.RUnlock()
+	if !failed {
+		return
+	}
+
+	pm.proxyMutex.Lock()
+	delete(pm.health, proxy)
+	pm.proxyMutex.Unlock()
+}
+
+// excludedProxiesKey 请求上下文中本次请求已失败的代理集合的键
+type excludedProxiesKey struct{}
+
+// excludedProxies 返回请求上下文中已失败的代理
+func excludedProxies(ctx context.Context) map[string]bool {
+	excluded, _ := ctx.Value(excludedProxiesKey{}).(map[string]bool)
+	return excluded
+}
+
+// doWithProxyFailover 发送请求，代理不可用时（无法连接代理、CONNECT失败、
+// 代理对HTTP请求返回502/504）记录失败并改用列表中的下一个代理重试
+func (c *Client) doWithProxyFailover(req *http.Request) (*http.Response, error) {
+	trace, _ := req.Context().Value(requestTraceKey{}).(*requestTrace)
+	if c.proxyManager == nil || trace == nil {
+		return c.httpClient.Do(req)
+	}
+
+	for {
+		trace.resetPhases()
+		resp, err := c.httpClient.Do(req)
+		proxy := trace.usedProxy()
+		if proxy == "" {
+			return resp, err
+		}
+		if !isProxyFailure(req, resp, err, trace) {
+			c.proxyManager.reportSuccess(proxy)
+			return resp, err
+		}
+
+		if c.proxyManager.reportFailure(proxy) && c.config.Verbose {
+			fmt.Fprintf(c.out, "代理 %s 连续失败 %d 次，暂停使用 %v\n", proxy, proxyFailureThreshold, proxyDeadCooldown)
+		}
+
+		excluded := map[string]bool{proxy: true}
+		for key := range excludedProxies(req.Context()) {
+			excluded[key] = true
 		}
-		// HTTPS如果没有专门的代理，使用HTTP代理
-		if len(pm.httpProxies) > 0 {
-			proxy := pm.httpProxies[pm.httpIndex%len(pm.httpProxies)]
-			pm.httpIndex++
-			return proxy, nil
+		if !c.proxyManager.hasUntriedProxy(req.URL, excluded) {
+			return resp, err
 		}
-	} else {
-		if len(pm.httpProxies) > 0 {
-			proxy := pm.httpProxies[pm.httpIndex%len(pm.httpProxies)]
-			pm.httpIndex++
-			return proxy, nil
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if c.config.Verbose {
+			reason := fmt.Sprint(err)
+			if resp != nil {
+				reason = resp.Status
+			}
+			fmt.Fprintf(c.out, "代理 %s 失败（%s），改用下一个代理: %s\n", proxy, reason, req.URL)
+		}
+
+		ctx := context.WithValue(req.Context(), excludedProxiesKey{}, excluded)
+		if req, err = cloneRequest(req, ctx); err != nil {
+			return nil, err
 		}
 	}
+}
 
-	return nil, nil
+// isProxyFailure 判断请求是否因代理本身失败：连接代理或建立CONNECT隧道时出错，
+// 或代理对明文HTTP请求返回502/504（HTTPS请求经隧道发送，响应来自目标服务器）
+func isProxyFailure(req *http.Request, resp *http.Response, err error, trace *requestTrace) bool {
+	if err != nil {
+		return req.Context().Err() == nil && trace.phase() == PhaseDial
+	}
+	if resp.Request.URL.Scheme != "http" {
+		return false
+	}
+	return resp.StatusCode == http.StatusBadGateway || resp.StatusCode == http.StatusGatewayTimeout
+}
+
+// pickProxy 从代理列表中选择一个代理
+// 默认按目标主机的哈希选择，同一主机的所有请求（包括重试和分片请求）使用同一个代理，
+// 保证CONNECT隧道和会话Cookie的一致性；轮换模式下每个请求依次使用下一个代理
+func (pm *ProxyManager) pickProxy(proxies []*url.URL, index *int, targetURL *url.URL) *url.URL {
+	if len(proxies) == 1 {
+		return proxies[0]
+	}
+
+	if !pm.roundRobin {
+		h := fnv.New32a()
+		h.Write([]byte(strings.ToLower(targetURL.Hostname())))
+		return proxies[h.Sum32()%uint32(len(proxies))]
+	}
+
+	pm.proxyMutex.Lock()
+	defer pm.proxyMutex.Unlock()
+	proxy := proxies[*index%len(proxies)]
+	*index++
+	return proxy
 }
 
 // isNoProxy 检查主机是否在no_proxy列表中
@@ -260,82 +441,40 @@ func (pm *ProxyManager) GetProxyAuthHeader() string {
 	return "Basic " + base64.StdEncoding.EncodeToString([]byte(auth))
 }
 
-// NewProxyTransport 创建支持代理的Transport
-func NewProxyTransport(pm *ProxyManager, insecure bool, timeout time.Duration) *http.Transport {
+// NewProxyTransport 创建支持代理的Transport，tlsConfig为证书管理器生成的TLS配置
+func NewProxyTransport(pm *ProxyManager, tlsConfig *tls.Config, timeout time.Duration) *http.Transport {
 	transport := &http.Transport{
 		MaxIdleConns:        100,
 		IdleConnTimeout:     90 * time.Second,
 		TLSHandshakeTimeout: 10 * time.Second,
 		DisableCompression:  true,
+		TLSClientConfig:     tlsConfig,
 	}
 
-	// 如果允许不安全的SSL连接
-	if insecure {
-		transport.TLSClientConfig = &tls.Config{
-			InsecureSkipVerify: true,
-		}
-	}
-
-	// 设置代理函数
+	// 设置代理函数，代理认证信息附加在代理URL上，由Transport在CONNECT请求
+	// 和经代理发送的HTTP请求中添加Proxy-Authorization，不会发送给目标服务器
 	if pm != nil {
 		transport.Proxy = func(req *http.Request) (*url.URL, error) {
-			return pm.GetProxyForURL(req.URL)
+			proxyURL := pm.selectProxy(req.URL, excludedProxies(req.Context()))
+			return pm.withProxyAuth(proxyURL), nil
 		}
 	}
 
 	return transport
 }
 
-// EstablishConnectForHTTPS 为HTTPS建立CONNECT隧道
-func EstablishConnectForHTTPS(ctx context.Context, proxyURL, targetURL *url.URL, proxyAuth string, timeout time.Duration) (net.Conn, error) {
-	// 连接到代理服务器
-	dialer := &net.Dialer{
-		Timeout: timeout,
-	}
-
-	conn, err := dialer.DialContext(ctx, "tcp", proxyURL.Host)
-	if err != nil {
-		return nil, fmt.Errorf("连接代理服务器失败: %w", err)
-	}
-
-	// 发送CONNECT请求
-	connectReq := &http.Request{
-		Method: http.MethodConnect,
-		URL:    &url.URL{Opaque: targetURL.Host},
-		Host:   targetURL.Host,
-		Header: make(http.Header),
-	}
-
-	if proxyAuth != "" {
-		connectReq.Header.Set("Proxy-Authorization", proxyAuth)
+// withProxyAuth 为代理URL附加--proxy-user/--proxy-password，
+// 代理URL中已包含认证信息时保持不变
+func (pm *ProxyManager) withProxyAuth(proxyURL *url.URL) *url.URL {
+	if proxyURL == nil || proxyURL.User != nil ||
+		(pm.config.ProxyUsername == "" && pm.config.ProxyPassword == "") {
+		return proxyURL
 	}
-
-	// 写入CONNECT请求
-	if err := connectReq.Write(conn); err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("发送CONNECT请求失败: %w", err)
-	}
-
-	// 读取响应
-	reader := bufio.NewReader(conn)
-	resp, err := http.ReadResponse(reader, nil)
-	if err != nil {
-		conn.Close()
-		return nil, fmt.Errorf("读取代理响应失败: %w", err)
-	}
-	resp.Body.Close()
-
-	// 检查响应状态码
-	if resp.StatusCode != http.StatusOK {
-		conn.Close()
-		return nil, fmt.Errorf("代理CONNECT失败，状态码: %d", resp.StatusCode)
-	}
-
-	return conn, nil
+	withAuth := *proxyURL
+	withAuth.User = url.UserPassword(pm.config.ProxyUsername, pm.config.ProxyPassword)
+	return &withAuth
 }
 
-
-
 // ParseProxyResponse 解析代理响应状态
 func ParseProxyResponse(resp string) (int, string, error) {
 	lines := strings.Split(resp, "\r\n")
@@ -550,4 +689,4 @@ func (pm *ProxyManager) GetProxyInfo() string {
 	}
 
 	return strings.Join(info, "\n")
-}
\ No newline at end of file
+}
@@ -0,0 +1,185 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// 没有Retry-After头时指数退避的初始等待时间
+const initialRetryBackoff = time.Second
+
+// 未设置--tries时一个请求的最大尝试次数（包括第一次请求）
+const defaultRetryAttempts = 20
+
+// doWithRetry 执行请求，遇到429和503时按Retry-After等待后重试；设置了--wait-retry时
+// 网络错误、408和其他5xx也重试。累计等待时间不超过MaxRetryWait、尝试次数不超过--tries，
+// 超出时返回最后一次的结果由调用方处理
+func (c *Client) doWithRetry(req *http.Request) (*http.Response, error) {
+	var waited time.Duration
+	maxAttempts := c.config.Tries
+	if maxAttempts <= 0 {
+		maxAttempts = defaultRetryAttempts
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.doWithProxyFailover(req)
+		if err != nil {
+			err = c.headerLimitError(err)
+			if c.config.WaitRetry <= 0 || req.Context().Err() != nil || !isRetryableError(err) {
+				return nil, err
+			}
+		} else if !c.isRetryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+
+		var wait time.Duration
+		ok := false
+		if resp != nil {
+			wait, ok = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+		}
+		if !ok {
+			wait = c.retryBackoff(attempt)
+		}
+
+		reason := fmt.Sprint(err)
+		if resp != nil {
+			reason = fmt.Sprintf("服务器返回 %d", resp.StatusCode)
+		}
+
+		if waited+wait > c.config.MaxRetryWait || attempt+1 >= maxAttempts {
+			return resp, err
+		}
+
+		// 整个运行的重试次数用完后不再重试
+		if !c.retryBudget.take() {
+			if c.config.Verbose {
+				fmt.Fprintf(c.out, "%s，重试总次数已用完: %s\n", reason, req.URL)
+			}
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		if c.config.Verbose {
+			fmt.Fprintf(c.out, "%s，%v 后重试: %s\n", reason, wait, req.URL)
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+		waited += wait
+
+		var cloneErr error
+		if req, cloneErr = cloneRequest(req, req.Context()); cloneErr != nil {
+			return nil, cloneErr
+		}
+	}
+}
+
+// cloneRequest 复制请求用于重试，请求体已在上一次请求中读取，重新获取
+func cloneRequest(req *http.Request, ctx context.Context) (*http.Request, error) {
+	req = req.Clone(ctx)
+	if req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	return req, nil
+}
+
+// retryBudget 同一客户端的所有下载共享的重试次数预算
+type retryBudget struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// newRetryBudget 创建重试次数预算，limit不大于0时不限制（返回nil）
+func newRetryBudget(limit int) *retryBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &retryBudget{limit: int64(limit)}
+}
+
+// take 消耗一次重试，预算已用完时返回false
+func (b *retryBudget) take() bool {
+	if b == nil {
+		return true
+	}
+	return b.used.Add(1) <= b.limit
+}
+
+// isRetryableStatus 检查状态码是否需要重试，默认只重试429和503，设置了--wait-retry时重试所有暂时性错误
+func (c *Client) isRetryableStatus(statusCode int) bool {
+	if c.config.WaitRetry > 0 {
+		return isTransientStatus(statusCode)
+	}
+	return statusCode == http.StatusTooManyRequests || statusCode == http.StatusServiceUnavailable
+}
+
+// retryBackoff 没有Retry-After时第attempt次重试前的等待时间，从1秒开始加倍，
+// 设置了--wait-retry时不超过该值
+func (c *Client) retryBackoff(attempt int) time.Duration {
+	if c.config.WaitRetry <= 0 {
+		return initialRetryBackoff << attempt
+	}
+	wait := min(initialRetryBackoff, c.config.WaitRetry)
+	for i := 0; i < attempt && wait < c.config.WaitRetry; i++ {
+		wait *= 2
+	}
+	return min(wait, c.config.WaitRetry)
+}
+
+// RetryDelay 返回下载中途失败后第attempt次重试前的等待时间，waited为已等待的总时间
+// 未设置--wait-retry、累计等待超过MaxRetryWait或重试总次数用完时返回false
+func (c *Client) RetryDelay(attempt int, waited time.Duration) (time.Duration, bool) {
+	if c.config.WaitRetry <= 0 {
+		return 0, false
+	}
+	wait := c.retryBackoff(attempt)
+	if waited+wait > c.config.MaxRetryWait || !c.retryBudget.take() {
+		return 0, false
+	}
+	return wait, true
+}
+
+// parseRetryAfter 解析Retry-After头，支持秒数和HTTP日期两种格式
+// 等待时间不大于0（如Retry-After: 0或已过去的日期）时返回false，由调用方按指数退避等待，避免立即重试
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds <= 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		wait := date.Sub(now)
+		if wait <= 0 {
+			return 0, false
+		}
+		return wait, true
+	}
+
+	return 0, false
+}
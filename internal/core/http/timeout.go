@@ -0,0 +1,67 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+// idleTimeoutReader 包装响应体，在超过指定时间没有收到数据时取消请求
+// 每次读取到数据都会重置计时器，因此持续有数据的慢速下载不会超时
+type idleTimeoutReader struct {
+	body     io.ReadCloser
+	timeout  time.Duration
+	cancel   context.CancelFunc
+	timer    *time.Timer
+	mu       sync.Mutex
+	timedOut bool
+}
+
+// newIdleTimeoutReader 创建空闲超时读取器，timeout<=0时只在关闭时取消请求
+func newIdleTimeoutReader(body io.ReadCloser, timeout time.Duration, cancel context.CancelFunc) *idleTimeoutReader {
+	r := &idleTimeoutReader{
+		body:    body,
+		timeout: timeout,
+		cancel:  cancel,
+	}
+
+	if timeout > 0 {
+		r.timer = time.AfterFunc(timeout, func() {
+			r.mu.Lock()
+			r.timedOut = true
+			r.mu.Unlock()
+			cancel()
+		})
+	}
+
+	return r
+}
+
+func (r *idleTimeoutReader) Read(p []byte) (int, error) {
+	n, err := r.body.Read(p)
+	if n > 0 && r.timer != nil {
+		r.timer.Reset(r.timeout)
+	}
+
+	if err != nil && err != io.EOF {
+		r.mu.Lock()
+		timedOut := r.timedOut
+		r.mu.Unlock()
+		if timedOut {
+			return n, fmt.Errorf("读取超时: %v内没有收到数据", r.timeout)
+		}
+	}
+
+	return n, err
+}
+
+func (r *idleTimeoutReader) Close() error {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	err := r.body.Close()
+	r.cancel()
+	return err
+}
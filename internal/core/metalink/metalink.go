@@ -0,0 +1,176 @@
+package metalink
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// ContentType Metalink 4文档的MIME类型
+const ContentType = "application/metalink4+xml"
+
+// Metalink Metalink 4文档（RFC 5854）
+type Metalink struct {
+	XMLName xml.Name `xml:"metalink"`
+	Files   []*File  `xml:"file"`
+}
+
+// File Metalink中描述的单个文件
+type File struct {
+	Name   string `xml:"name,attr"`
+	Size   int64  `xml:"size"`
+	Hashes []Hash `xml:"hash"`
+	URLs   []URL  `xml:"url"`
+}
+
+// Hash 文件哈希值
+type Hash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+// URL 文件的下载镜像
+type URL struct {
+	Priority int    `xml:"priority,attr"`
+	Location string `xml:"location,attr"`
+	Value    string `xml:",chardata"`
+}
+
+// Parse 解析Metalink 4文档
+func Parse(data []byte) (*Metalink, error) {
+	var ml Metalink
+	if err := xml.NewDecoder(bytes.NewReader(data)).Decode(&ml); err != nil {
+		return nil, fmt.Errorf("解析Metalink失败: %w", err)
+	}
+
+	if len(ml.Files) == 0 {
+		return nil, fmt.Errorf("Metalink中没有文件")
+	}
+
+	for _, file := range ml.Files {
+		if file.Name == "" {
+			return nil, fmt.Errorf("Metalink文件缺少name属性")
+		}
+		if len(file.Mirrors()) == 0 {
+			return nil, fmt.Errorf("Metalink文件 %s 没有可用的URL", file.Name)
+		}
+	}
+
+	return &ml, nil
+}
+
+// ParseReader 从io.Reader解析Metalink文档
+func ParseReader(r io.Reader) (*Metalink, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("读取Metalink失败: %w", err)
+	}
+	return Parse(data)
+}
+
+// ParseFile 解析Metalink文件
+func ParseFile(filename string) (*Metalink, error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, fmt.Errorf("读取Metalink文件失败: %w", err)
+	}
+	return Parse(data)
+}
+
+// IsMetalink 根据Content-Type或URL扩展名判断是否为Metalink文档
+func IsMetalink(contentType, urlStr string) bool {
+	if strings.HasPrefix(strings.ToLower(contentType), ContentType) {
+		return true
+	}
+
+	if idx := strings.IndexAny(urlStr, "?#"); idx != -1 {
+		urlStr = urlStr[:idx]
+	}
+	ext := strings.ToLower(path.Ext(urlStr))
+	return ext == ".meta4" || ext == ".metalink"
+}
+
+// Mirrors 获取按优先级排序的镜像URL列表（priority越小越优先，未指定的排在最后）
+func (f *File) Mirrors() []string {
+	urls := make([]URL, 0, len(f.URLs))
+	for _, u := range f.URLs {
+		u.Value = strings.TrimSpace(u.Value)
+		if u.Value != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	sort.SliceStable(urls, func(i, j int) bool {
+		return priorityKey(urls[i].Priority) < priorityKey(urls[j].Priority)
+	})
+
+	mirrors := make([]string, len(urls))
+	for i, u := range urls {
+		mirrors[i] = u.Value
+	}
+	return mirrors
+}
+
+// priorityKey 未指定优先级时排在最后
+func priorityKey(priority int) int {
+	if priority <= 0 {
+		return 1 << 30
+	}
+	return priority
+}
+
+// SafeName 获取可安全用作本地文件名的文件名
+func (f *File) SafeName() string {
+	name := path.Base(strings.ReplaceAll(f.Name, "\\", "/"))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	return utils.SafeFileName(name)
+}
+
+// Hash 获取指定类型的哈希值（类型不区分大小写）
+func (f *File) Hash(hashType string) string {
+	for _, h := range f.Hashes {
+		if strings.EqualFold(h.Type, hashType) {
+			return strings.ToLower(strings.TrimSpace(h.Value))
+		}
+	}
+	return ""
+}
+
+// Verify 使用最强的可用哈希校验文件，没有支持的哈希时返回nil
+func (f *File) Verify(filename string) error {
+	checks := []struct {
+		hashType  string
+		calculate func(string) (string, error)
+	}{
+		{"sha-256", utils.CalculateSHA256},
+		{"sha-1", utils.CalculateSHA1},
+		{"md5", utils.CalculateMD5},
+	}
+
+	for _, check := range checks {
+		expected := f.Hash(check.hashType)
+		if expected == "" {
+			continue
+		}
+
+		actual, err := check.calculate(filename)
+		if err != nil {
+			return fmt.Errorf("计算%s哈希失败: %w", check.hashType, err)
+		}
+		if actual != expected {
+			return fmt.Errorf("%s哈希不匹配: 期望 %s, 实际 %s", check.hashType, expected, actual)
+		}
+		return nil
+	}
+
+	return nil
+}
@@ -6,15 +6,18 @@ import (
 	"strings"
 	"sync"
 
+	"github.com/example/wget2go/internal/core/robots"
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 )
 
-// Manager URL队列管理器
+// Manager URL队列管理器，队列、黑名单、已访问列表和robots.txt解析器都由mutex保护
 type Manager struct {
 	queue      *types.URLQueue
 	blacklist  map[string]bool // URL黑名单
 	visited    map[string]bool // 已访问的URL
 	hostMap    map[string]*types.RobotsParser // 每个主机的robots.txt解析器
+	lifo       bool                           // 深度优先遍历
 	mutex      sync.RWMutex
 }
 
@@ -51,23 +54,39 @@ func (m *Manager) Add(job *types.Job) error {
 	return nil
 }
 
-// Pop 从队列中取出一个URL
+// SetTraversal 设置遍历顺序：bfs按加入顺序取出，dfs先取出最近加入的URL
+func (m *Manager) SetTraversal(traversal string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lifo = traversal == types.TraversalDFS
+	m.queue.LIFO = m.lifo
+}
+
+// Pop 从队列中取出一个URL，与Add持有同一把锁
 func (m *Manager) Pop() *types.Job {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	return m.queue.Pop()
 }
 
 // Contains 检查URL是否在队列中
 func (m *Manager) Contains(url string) bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	return m.queue.Contains(url)
 }
 
 // Size 获取队列大小
 func (m *Manager) Size() int {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	return m.queue.Size()
 }
 
 // IsEmpty 检查队列是否为空
 func (m *Manager) IsEmpty() bool {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
 	return m.queue.IsEmpty()
 }
 
@@ -99,13 +118,13 @@ func (m *Manager) IsVisited(url string) bool {
 	return m.visited[url]
 }
 
-// GetHost 获取URL的主机名
+// GetHost 获取URL的主机名（国际化域名统一为punycode形式）
 func (m *Manager) GetHost(urlStr string) (string, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
 		return "", err
 	}
-	return u.Hostname(), nil
+	return utils.ToASCIIHost(strings.ToLower(u.Hostname())), nil
 }
 
 // SetRobotsParser 设置主机的robots.txt解析器
@@ -134,22 +153,12 @@ func (m *Manager) IsAllowedByRobots(urlStr, userAgent string) bool {
 		return true // 没有robots.txt，默认允许
 	}
 
-	// 解析URL获取路径
-	u, err := url.Parse(urlStr)
-	if err != nil {
-		return true // URL解析失败，默认允许
-	}
-
-	// 检查是否被禁止
+	// 与robots.Parser使用相同的user-agent选择和规则匹配
+	checker := robots.NewParser()
 	for _, rule := range parser.Rules {
-		for _, disallow := range rule.Disallow {
-			if strings.HasPrefix(u.Path, disallow) {
-				return false // 被禁止
-			}
-		}
+		checker.AddRule(rule)
 	}
-
-	return true // 允许访问
+	return checker.IsAllowed(urlStr, userAgent)
 }
 
 // Clear 清空队列和黑名单
@@ -158,6 +167,7 @@ func (m *Manager) Clear() {
 	defer m.mutex.Unlock()
 
 	m.queue = types.NewURLQueue()
+	m.queue.LIFO = m.lifo
 	m.blacklist = make(map[string]bool)
 	m.visited = make(map[string]bool)
 	m.hostMap = make(map[string]*types.RobotsParser)
@@ -204,16 +214,11 @@ func (m *Manager) AddBatch(jobs []*types.Job) error {
 	return nil
 }
 
-// Peek 查看队列中的第一个URL（不移除）
+// Peek 查看下一个将被取出的URL（不移除）
 func (m *Manager) Peek() *types.Job {
-	m.mutex.Lock()
-	defer m.mutex.Unlock()
-
-	if m.queue.IsEmpty() {
-		return nil
-	}
-
-	return m.queue.Jobs[0]
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+	return m.queue.Peek()
 }
 
 // Remove 从队列中移除URL
@@ -221,20 +226,7 @@ func (m *Manager) Remove(url string) bool {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
-	if !m.queue.Contains(url) {
-		return false
-	}
-
-	// 查找并移除
-	for i, job := range m.queue.Jobs {
-		if job.URL == url {
-			m.queue.Jobs = append(m.queue.Jobs[:i], m.queue.Jobs[i+1:]...)
-			delete(m.queue.Index, url)
-			return true
-		}
-	}
-
-	return false
+	return m.queue.Remove(url)
 }
 
 // GetPendingJobs 获取所有待处理的任务
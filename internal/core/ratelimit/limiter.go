@@ -0,0 +1,181 @@
+package ratelimit
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+const (
+	// minBurst 最小突发字节数，空闲后的第一次读取不会被延迟
+	minBurst = 4 * 1024
+	// rateWindow 计算当前实际速率的时间窗口
+	rateWindow = 2 * time.Second
+)
+
+// Limiter 全局限速器（令牌桶）
+// 所有连接共享同一预算并按到达顺序预留令牌，活动连接越少每个连接分到的份额越大，
+// 总吞吐量始终接近限速值
+type Limiter struct {
+	rate    float64 // 字节/秒
+	burst   int64
+	tokens  float64
+	last    time.Time
+	start   time.Time
+	samples []sample
+	mu      sync.Mutex
+}
+
+// sample 一次预留的字节数和时间，用于计算当前速率
+type sample struct {
+	at    time.Time
+	bytes int
+}
+
+// NewLimiter 创建限速器，rate<=0表示不限速并返回nil
+func NewLimiter(rate int64) *Limiter {
+	if rate <= 0 {
+		return nil
+	}
+
+	burst := rate / 8
+	if burst < minBurst {
+		burst = minBurst
+	}
+
+	now := time.Now()
+	return &Limiter{
+		rate:   float64(rate),
+		burst:  burst,
+		tokens: float64(burst),
+		last:   now,
+		start:  now,
+	}
+}
+
+// WaitN 预留n个字节的令牌，令牌不足时等待
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+	l.tokens -= float64(n)
+
+	var wait time.Duration
+	if l.tokens < 0 {
+		wait = time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	l.record(now.Add(wait), n)
+	l.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// refill 按经过的时间补充令牌，最多补充到突发上限（调用方需持有锁）
+func (l *Limiter) refill(now time.Time) {
+	elapsed := now.Sub(l.last).Seconds()
+	if elapsed <= 0 {
+		return
+	}
+	l.last = now
+
+	l.tokens += elapsed * l.rate
+	if l.tokens > float64(l.burst) {
+		l.tokens = float64(l.burst)
+	}
+}
+
+// record 记录预留的字节，并丢弃窗口外的样本（调用方需持有锁）
+func (l *Limiter) record(at time.Time, n int) {
+	l.samples = append(l.samples, sample{at: at, bytes: n})
+
+	cutoff := time.Now().Add(-rateWindow)
+	i := 0
+	for i < len(l.samples) && l.samples[i].at.Before(cutoff) {
+		i++
+	}
+	l.samples = l.samples[i:]
+}
+
+// Rate 获取最近时间窗口内经过限速器的实际速率（字节/秒）
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	window := rateWindow
+	if elapsed := now.Sub(l.start); elapsed < window {
+		window = elapsed
+	}
+	if window <= 0 {
+		return 0
+	}
+
+	cutoff := now.Add(-window)
+	var total int
+	for _, s := range l.samples {
+		if !s.at.Before(cutoff) && !s.at.After(now) {
+			total += s.bytes
+		}
+	}
+
+	return int64(float64(total) / window.Seconds())
+}
+
+// Limit 获取限速值（字节/秒）
+func (l *Limiter) Limit() int64 {
+	if l == nil {
+		return 0
+	}
+	return int64(l.rate)
+}
+
+// Reader 包装io.Reader，使读取受限速器约束
+// 单次读取不超过突发上限，避免一个连接一次占用全部预算
+func (l *Limiter) Reader(ctx context.Context, r io.Reader) io.Reader {
+	if l == nil {
+		return r
+	}
+	return &limitedReader{ctx: ctx, reader: r, limiter: l}
+}
+
+// limitedReader 受限速器约束的Reader
+type limitedReader struct {
+	ctx     context.Context
+	reader  io.Reader
+	limiter *Limiter
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.limiter.burst {
+		p = p[:r.limiter.burst]
+	}
+
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if waitErr := r.limiter.WaitN(r.ctx, n); waitErr != nil {
+			return n, waitErr
+		}
+	}
+	return n, err
+}
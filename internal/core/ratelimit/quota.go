@@ -0,0 +1,50 @@
+package ratelimit
+
+import "sync/atomic"
+
+// Quota 下载总量配额，多个下载共享
+// 配额只在开始下一个文件前检查，超出配额时正在下载的文件仍会完成
+type Quota struct {
+	limit int64
+	used  atomic.Int64
+}
+
+// NewQuota 创建下载配额，limit<=0表示不限制并返回nil
+func NewQuota(limit int64) *Quota {
+	if limit <= 0 {
+		return nil
+	}
+	return &Quota{limit: limit}
+}
+
+// Add 累加已下载的字节数
+func (q *Quota) Add(n int64) {
+	if q == nil || n <= 0 {
+		return
+	}
+	q.used.Add(n)
+}
+
+// Exceeded 检查已下载的字节数是否达到配额
+func (q *Quota) Exceeded() bool {
+	if q == nil {
+		return false
+	}
+	return q.used.Load() >= q.limit
+}
+
+// Used 返回已下载的字节数
+func (q *Quota) Used() int64 {
+	if q == nil {
+		return 0
+	}
+	return q.used.Load()
+}
+
+// Limit 返回配额字节数
+func (q *Quota) Limit() int64 {
+	if q == nil {
+		return 0
+	}
+	return q.limit
+}
@@ -28,11 +28,13 @@ func NewParser() *Parser {
 }
 
 // Parse 解析robots.txt内容
+// 连续的多个User-agent行属于同一条记录，其后的Allow、Disallow和Crawl-delay对这些user-agent都生效
 func (p *Parser) Parse(data []byte, userAgent string) error {
 	scanner := bufio.NewScanner(bytes.NewReader(data))
 
-	var currentRule *types.RobotsRules
-	var inRecord bool
+	// group为当前记录的所有user-agent规则，agentsOpen表示仍在读取记录开头的User-agent行
+	var group []*types.RobotsRules
+	var agentsOpen bool
 
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
@@ -53,48 +55,47 @@ func (p *Parser) Parse(data []byte, userAgent string) error {
 
 		switch key {
 		case "user-agent":
-			// 开始新的规则记录
-			value = strings.ToLower(value)
-			if value == "*" {
+			// 规则行之后的User-agent开始新的记录
+			if !agentsOpen {
+				group = nil
+				agentsOpen = true
+			}
+			rule := &types.RobotsRules{
+				UserAgent: strings.ToLower(value),
+				Disallow:  make([]string, 0),
+				Allow:     make([]string, 0),
+			}
+			if rule.UserAgent == "*" {
 				// 默认规则
-				currentRule = &types.RobotsRules{
-					UserAgent: "*",
-					Disallow:  make([]string, 0),
-					Allow:     make([]string, 0),
-				}
-				p.defaults = currentRule
-			} else {
-				// 特定user-agent的规则
-				currentRule = &types.RobotsRules{
-					UserAgent: value,
-					Disallow:  make([]string, 0),
-					Allow:     make([]string, 0),
-				}
+				p.defaults = rule
 			}
-			inRecord = true
-			p.rules = append(p.rules, currentRule)
+			group = append(group, rule)
+			p.rules = append(p.rules, rule)
 
 		case "disallow":
-			if inRecord && currentRule != nil {
-				if value == "" {
-					// 空值表示允许所有
-					currentRule.Disallow = make([]string, 0)
-				} else {
-					currentRule.Disallow = append(currentRule.Disallow, value)
+			agentsOpen = false
+			// 空值不禁止任何路径，不需要记录
+			if value != "" {
+				for _, rule := range group {
+					rule.Disallow = append(rule.Disallow, value)
 				}
 			}
 
 		case "allow":
-			if inRecord && currentRule != nil {
-				currentRule.Allow = append(currentRule.Allow, value)
+			agentsOpen = false
+			if value != "" {
+				for _, rule := range group {
+					rule.Allow = append(rule.Allow, value)
+				}
 			}
 
 		case "crawl-delay":
-			if inRecord && currentRule != nil {
-				// 解析延迟时间（秒）
-				var delay int
-				fmt.Sscanf(value, "%d", &delay)
-				currentRule.CrawlDelay = delay
+			agentsOpen = false
+			// 解析延迟时间（秒）
+			var delay int
+			fmt.Sscanf(value, "%d", &delay)
+			for _, rule := range group {
+				rule.CrawlDelay = delay
 			}
 
 		case "sitemap":
@@ -115,68 +116,79 @@ func (p *Parser) ParseReader(r io.Reader, userAgent string) error {
 	return p.Parse(data, userAgent)
 }
 
-// IsAllowed 检查URL是否被允许
+// IsAllowed 检查URL是否被允许，匹配的是URL的路径和查询参数
 func (p *Parser) IsAllowed(urlStr, userAgent string) bool {
-	// 获取适用的规则
-	rule := p.getRule(userAgent)
-	if rule == nil {
-		return true // 没有规则，默认允许
-	}
-
 	// 解析URL路径
 	parsedURL, err := url.Parse(urlStr)
 	if err != nil {
 		return true // URL解析失败，默认允许
 	}
 
-	path := parsedURL.Path
-
-	// 检查Allow规则
-	for _, allow := range rule.Allow {
-		if p.matchPath(path, allow) {
-			return true
-		}
+	path := parsedURL.EscapedPath()
+	if path == "" {
+		path = "/"
 	}
-
-	// 检查Disallow规则
-	for _, disallow := range rule.Disallow {
-		if p.matchPath(path, disallow) {
-			return false
-		}
+	if parsedURL.RawQuery != "" {
+		path += "?" + parsedURL.RawQuery
 	}
-
-	return true // 没有匹配的规则，默认允许
+	return p.IsPathAllowed(path, userAgent)
 }
 
-// getRule 获取适用的规则
+// getRule 获取适用的规则，选择最具体的user-agent组：
+// 与爬虫产品名完全相同的组优先，其次是产品名以其开头的最长的组，都没有时使用*组
 func (p *Parser) getRule(userAgent string) *types.RobotsRules {
-	userAgent = strings.ToLower(userAgent)
+	token := productToken(userAgent)
 
-	// 首先查找匹配的user-agent规则
+	var best *types.RobotsRules
 	for _, rule := range p.rules {
-		if rule.UserAgent == "*" {
-			continue // 跳过默认规则
+		name := productToken(rule.UserAgent)
+		if name == "*" || name == "" || !strings.HasPrefix(token, name) {
+			continue
 		}
-		if strings.Contains(userAgent, rule.UserAgent) {
+		if name == token {
 			return rule
 		}
+		if best == nil || len(name) > len(productToken(best.UserAgent)) {
+			best = rule
+		}
+	}
+	if best != nil {
+		return best
 	}
 
 	// 没有匹配的规则，使用默认规则
 	return p.defaults
 }
 
-// matchPath 检查路径是否匹配规则
+// productToken 返回User-Agent的产品名（第一个/或空白之前的部分），不区分大小写
+// 例如"Wget2go/1.0 (linux)"的产品名为"wget2go"
+func productToken(userAgent string) string {
+	userAgent = strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(userAgent, "/ \t"); i >= 0 {
+		userAgent = userAgent[:i]
+	}
+	return userAgent
+}
+
+// matchPath 检查路径是否匹配规则，规则从路径开头匹配
+// * 匹配任意字符序列，结尾的$表示路径必须在此结束，其他字符按字面匹配
 func (p *Parser) matchPath(path, pattern string) bool {
-	// 转换为正则表达式
-	// * 匹配任意字符
-	// $ 匹配路径结束
-	pattern = strings.ReplaceAll(pattern, "*", ".*")
-	if !strings.HasSuffix(pattern, "$") {
-		pattern += ".*"
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+	expr := "^" + strings.Join(parts, ".*")
+	if anchored {
+		expr += "$"
 	}
 
-	re := regexp.MustCompile("^" + pattern + "$")
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return false
+	}
 	return re.MatchString(path)
 }
 
@@ -254,27 +266,24 @@ func (p *Parser) GetDefaultRule() *types.RobotsRules {
 }
 
 // IsPathAllowed 检查路径是否被允许
+// 与规则的先后顺序无关，匹配的Allow和Disallow中最长（最具体）的规则生效，长度相同时Allow优先
 func (p *Parser) IsPathAllowed(path, userAgent string) bool {
 	rule := p.getRule(userAgent)
 	if rule == nil {
-		return true
-	}
-
-	// 检查Allow规则
-	for _, allow := range rule.Allow {
-		if p.matchPath(path, allow) {
-			return true
-		}
+		return true // 没有规则，默认允许
 	}
 
-	// 检查Disallow规则
-	for _, disallow := range rule.Disallow {
-		if p.matchPath(path, disallow) {
-			return false
+	longest := func(patterns []string) int {
+		matched := -1
+		for _, pattern := range patterns {
+			if len(pattern) > matched && p.matchPath(path, pattern) {
+				matched = len(pattern)
+			}
 		}
+		return matched
 	}
 
-	return true
+	return longest(rule.Allow) >= longest(rule.Disallow)
 }
 
 // GetRuleForUserAgent 获取特定user-agent的规则
@@ -295,16 +304,13 @@ func (p *Parser) AddSitemap(sitemapURL string) {
 	p.sitemaps = append(p.sitemaps, sitemapURL)
 }
 
-// MatchUserAgent 检查user-agent是否匹配规则
+// MatchUserAgent 检查user-agent是否匹配规则，规则的产品名与user-agent的产品名相同或是其前缀时匹配
 func (p *Parser) MatchUserAgent(userAgent, ruleUserAgent string) bool {
-	userAgent = strings.ToLower(userAgent)
-	ruleUserAgent = strings.ToLower(ruleUserAgent)
-	
-	if ruleUserAgent == "*" {
+	name := productToken(ruleUserAgent)
+	if name == "*" {
 		return true
 	}
-	
-	return strings.Contains(userAgent, ruleUserAgent)
+	return name != "" && strings.HasPrefix(productToken(userAgent), name)
 }
 
 // ParseBuffer 解析robots.txt缓冲区
@@ -0,0 +1,200 @@
+package tls
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"golang.org/x/crypto/ocsp"
+)
+
+// defaultOCSPTimeout 未设置--connect-timeout和--timeout时查询OCSP响应服务器的超时时间
+const defaultOCSPTimeout = 10 * time.Second
+
+// maxOCSPResponseSize OCSP响应的最大大小
+const maxOCSPResponseSize = 1 << 20
+
+// errOCSPUnavailable 无法确定证书状态（响应服务器不可达、响应无效或状态未知），
+// 是否放行由--ocsp-soft-fail决定
+var errOCSPUnavailable = errors.New("无法获取OCSP状态")
+
+// verifyOCSP 在TLS握手后检查服务器证书的吊销状态，优先使用服务器装订的OCSP响应
+// 装订的响应只能从连接状态中取得，因此使用VerifyConnection而不是VerifyPeerCertificate
+func (m *CertManager) verifyOCSP(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return nil
+	}
+	leaf := cs.PeerCertificates[0]
+	issuer := findIssuer(cs)
+	if issuer == nil {
+		if len(cs.OCSPResponse) == 0 && len(leaf.OCSPServer) == 0 {
+			return nil
+		}
+		return m.ocspSoftFail(fmt.Errorf("%w: 找不到 %s 的签发者证书", errOCSPUnavailable, leaf.Subject))
+	}
+
+	good, err := m.CheckOCSP(leaf, issuer, cs.OCSPResponse)
+	if err != nil {
+		return m.ocspSoftFail(err)
+	}
+	if !good {
+		return verificationError("证书已被吊销: %s", leaf.Subject)
+	}
+	return nil
+}
+
+// ocspSoftFail 无法确定证书状态时，--ocsp-soft-fail放行连接，否则返回错误
+func (m *CertManager) ocspSoftFail(err error) error {
+	if m.config.OCSPSoftFail {
+		if m.config.Verbose {
+			fmt.Fprintf(os.Stderr, "警告: %v，继续连接\n", err)
+		}
+		return nil
+	}
+	return err
+}
+
+// findIssuer 从服务器发送的证书链或验证后的证书链中找到叶子证书的签发者
+func findIssuer(cs tls.ConnectionState) *x509.Certificate {
+	leaf := cs.PeerCertificates[0]
+	for _, chain := range cs.VerifiedChains {
+		if len(chain) > 1 {
+			return chain[1]
+		}
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		if leaf.CheckSignatureFrom(cert) == nil {
+			return cert
+		}
+	}
+	return nil
+}
+
+// SetOCSPClient 设置查询OCSP响应服务器使用的客户端，应与下载使用相同的代理、拨号和DNS设置
+// 未设置时使用不经过代理的默认传输层
+func (m *CertManager) SetOCSPClient(client *http.Client) {
+	m.ocspClient = client
+}
+
+// CheckOCSP 检查证书的OCSP状态，返回证书是否有效（未被吊销）
+// stapled为服务器装订的OCSP响应，为空时向证书中的OCSP响应服务器查询；
+// 证书没有OCSP响应服务器时无法检查，视为有效
+func (m *CertManager) CheckOCSP(cert, issuer *x509.Certificate, stapled []byte) (bool, error) {
+	var resp *ocsp.Response
+	if len(stapled) > 0 {
+		parsed, err := ocsp.ParseResponseForCert(stapled, cert, issuer)
+		if err != nil {
+			return false, fmt.Errorf("%w: 解析OCSP响应失败: %v", errOCSPUnavailable, err)
+		}
+		resp = parsed
+	} else {
+		if len(cert.OCSPServer) == 0 {
+			return true, nil
+		}
+		queried, err := m.queryOCSP(cert, issuer)
+		if err != nil {
+			return false, err
+		}
+		resp = queried
+	}
+
+	if !resp.NextUpdate.IsZero() && time.Now().After(resp.NextUpdate) {
+		return false, fmt.Errorf("%w: OCSP响应已过期", errOCSPUnavailable)
+	}
+	switch resp.Status {
+	case ocsp.Good:
+		return true, nil
+	case ocsp.Revoked:
+		return false, nil
+	default:
+		return false, fmt.Errorf("%w: 响应服务器不认识该证书", errOCSPUnavailable)
+	}
+}
+
+// queryOCSP 向响应服务器查询证书状态，响应按签发者和序列号缓存到NextUpdate为止，
+// 同一证书的多个连接（如各个分片）只查询一次；没有NextUpdate或状态未知的响应不缓存
+func (m *CertManager) queryOCSP(cert, issuer *x509.Certificate) (*ocsp.Response, error) {
+	key := string(cert.RawIssuer) + "/" + cert.SerialNumber.String()
+
+	// 查询期间持有锁，同时建立的连接等待第一个查询的结果
+	m.ocspMu.Lock()
+	defer m.ocspMu.Unlock()
+	if resp, ok := m.ocspResponses[key]; ok && time.Now().Before(resp.NextUpdate) {
+		return resp, nil
+	}
+
+	raw, err := m.fetchOCSP(cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errOCSPUnavailable, err)
+	}
+	resp, err := ocsp.ParseResponseForCert(raw, cert, issuer)
+	if err != nil {
+		return nil, fmt.Errorf("%w: 解析OCSP响应失败: %v", errOCSPUnavailable, err)
+	}
+	if !resp.NextUpdate.IsZero() && resp.Status != ocsp.Unknown {
+		m.ocspResponses[key] = resp
+	}
+	return resp, nil
+}
+
+// ocspTimeout 查询OCSP响应服务器的超时时间，与建立连接的超时相同
+func (m *CertManager) ocspTimeout() time.Duration {
+	if m.config.ConnectTimeout > 0 {
+		return m.config.ConnectTimeout
+	}
+	if m.config.Timeout > 0 {
+		return m.config.Timeout
+	}
+	return defaultOCSPTimeout
+}
+
+// fetchOCSP 向证书中的OCSP响应服务器发送查询，依次尝试每个服务器
+func (m *CertManager) fetchOCSP(cert, issuer *x509.Certificate) ([]byte, error) {
+	req, err := ocsp.CreateRequest(cert, issuer, nil)
+	if err != nil {
+		return nil, fmt.Errorf("创建OCSP请求失败: %w", err)
+	}
+
+	client := m.ocspClient
+	if client == nil {
+		client = &http.Client{Transport: &http.Transport{}}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), m.ocspTimeout())
+	defer cancel()
+
+	var lastErr error
+	for _, server := range cert.OCSPServer {
+		httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, server, bytes.NewReader(req))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		httpReq.Header.Set("Content-Type", "application/ocsp-request")
+		httpReq.Header.Set("Accept", "application/ocsp-response")
+
+		resp, err := client.Do(httpReq)
+		if err != nil {
+			lastErr = fmt.Errorf("查询OCSP响应服务器失败: %w", err)
+			continue
+		}
+		body, err := io.ReadAll(io.LimitReader(resp.Body, maxOCSPResponseSize))
+		resp.Body.Close()
+		if err != nil {
+			lastErr = fmt.Errorf("读取OCSP响应失败: %w", err)
+			continue
+		}
+		if resp.StatusCode != http.StatusOK {
+			lastErr = fmt.Errorf("OCSP响应服务器返回 %s", resp.Status)
+			continue
+		}
+		return body, nil
+	}
+	return nil, lastErr
+}
@@ -1,35 +1,149 @@
 package types
 
 import (
-	"sync"
+	"fmt"
+	"regexp"
+	"strings"
 	"time"
 )
 
+// DefaultProgressInterval 未配置时的进度刷新间隔
+const DefaultProgressInterval = time.Second
+
+// --progress的显示方式
+const (
+	ProgressAuto = "auto" // 终端中显示进度条，否则使用点状显示
+	ProgressBar  = "bar"
+	ProgressDot  = "dot"
+	ProgressLine = "line" // 每次更新输出一行
+	ProgressNone = "none"
+)
+
+// --report-speed的速度单位
+const (
+	ReportSpeedBytes = "bytes" // 以字节每秒显示，如MB/s
+	ReportSpeedBits  = "bits"  // 与wget一致，以比特每秒显示，如Mb/s
+)
+
+// --output-format的输出格式
+const (
+	OutputFormatText = "text"
+	OutputFormatJSON = "json" // 在标准输出上输出换行分隔的JSON事件，其他信息输出到标准错误
+)
+
+// --proxy-rotation的代理选择方式
+const (
+	ProxyRotationSticky     = "sticky"      // 按目标主机固定使用一个代理
+	ProxyRotationRoundRobin = "round-robin" // 每个请求依次使用下一个代理
+)
+
+// --restrict-file-names的模式，可以用逗号组合，如"windows,ascii"
+const (
+	RestrictFileNamesUnix      = "unix"      // 转义/和控制字符（非Windows系统的默认值）
+	RestrictFileNamesWindows   = "windows"   // 另外转义\|:?"*<>、结尾的点和空格，并避开保留设备名（Windows上的默认值）
+	RestrictFileNamesASCII     = "ascii"     // 转义所有非ASCII字符
+	RestrictFileNamesNoControl = "nocontrol" // 不转义控制字符
+)
+
+// 递归下载的遍历顺序
+const (
+	TraversalBFS = "bfs" // 广度优先：先下载较浅层的URL（默认）
+	TraversalDFS = "dfs" // 深度优先：先下载最近发现的URL
+)
+
+// --referer的特殊值
+const (
+	RefererSelf = "self" // 以每个请求自身的URL作为Referer
+	RefererAuto = "auto" // 递归下载时以链接到该URL的页面作为Referer
+)
+
 // Config 全局配置
 type Config struct {
 	// 下载选项
 	OutputFile      string
 	OutputDocument  string
 	Continue        bool
+	TempDir         string // 分片下载的临时文件和状态文件所在目录，为空时与输出文件在同一目录
+	Preallocate     bool   // 分片下载前预先分配临时文件的全部磁盘空间
+	Timestamping    bool // 本地文件已存在时，仅在远程文件更新后重新下载
+	NoUseServerTimestamps bool // 不将下载文件的修改时间设置为服务器的Last-Modified
 	ChunkSize       int64
+	ExpectedSize    int64
+	MaxFileSize     int64 // 单个文件的最大大小，0表示不限制；先按HEAD返回的Content-Length检查，传输中也通过utils.NewMaxSizeReader限制实际写入的字节数
+	Quota           int64 // 递归或多文件下载的总下载量配额，0表示不限制
 	MaxThreads      int
+	AutoThreads     bool // --max-threads=auto，按文件大小和CPU数量确定每个文件的并发数
+	MaxConnectionsPerHost int // 递归下载时同一主机的最大并发连接数，0表示不限制
+	MaxConcurrentDownloads int // 批量下载时同时下载的最大文件数
 	LimitRate       int64
 	Timeout         time.Duration
+	ConnectTimeout  time.Duration
+	ReadTimeout     time.Duration
+	MaxRetryWait    time.Duration
+	WaitRetry       time.Duration // 暂时性错误重试之间的最长等待时间，0表示只重试429/503
+	MaxRetriesTotal int // 整个运行期间所有下载累计的最大重试次数，0表示不限制
+	Tries           int // 分片大小不符或响应被截断时下载该分片的最大尝试次数，不大于1时不重新下载
+	RetryOnEmpty    int // 服务器声明文件非空却返回空内容时的重试次数，0表示不重试
+	ProgressInterval time.Duration
+	MaxResponseHeaderBytes int64
+	MaxResponseHeaders     int
+	Compression     string // 请求的Accept-Encoding（如"gzip, br"），空表示identity
+	BindAddress     string // 出站连接绑定的本地IP地址
+	UnixSocket      string // 所有HTTP连接改为连接该Unix域套接字，不使用代理
+	Inet4Only       bool   // 只通过IPv4连接
+	Inet6Only       bool   // 只通过IPv6连接
+	HTTP11Only      bool   // 只使用HTTP/1.1
+	HTTP2           bool   // 明文HTTP也使用HTTP/2（h2c），HTTPS默认已通过ALPN协商HTTP/2
+	DNSCache        bool   // 在进程内缓存DNS解析结果
+	DNSCacheTTL     time.Duration // DNS缓存的有效期
+	DNSServers      []string // 解析主机名使用的DNS服务器（host:port），空表示使用系统配置
 	UserAgent       string
 	Referer         string
-	Headers         map[string]string
+	PostData        string // 非空时使用POST请求发送的数据
+	PostFile        string // 非空时使用POST请求发送该文件的内容
+	Headers         []HeaderField // 按命令行顺序保存，允许重复的头部名
 	Cookies         map[string]string
+	InputFile       string // URL列表文件（-表示标准输入）
+	ContentDisposition bool // 使用Content-Disposition头中的文件名
+	TrustServerNames bool // 重定向后按最终URL确定文件名
+	RestrictFileNames string // 文件名中需要转义的字符，见RestrictFileNames*常量，空表示按当前系统
+	Base            string // 解析输入文件中相对URL的基础URL
+	Expand          bool   // 展开URL中的花括号表达式
+	DownloadedLog   string // 记录下载成功的URL的日志文件
+	InputFileContinue bool // 跳过下载日志中已记录的URL
 	
 	// 递归下载选项
 	Recursive       bool
 	RecursiveLevel  int
+	Traversal       string // 递归下载的遍历顺序（bfs或dfs）
 	ConvertLinks    bool
+	Rewrites        []RewriteRule // 转换链接时对已下载目标的URL依次应用的正则替换
+	ExtractDataURIs bool  // 转换链接时将data: URL解码保存为文件
+	DataURIMinSize  int64 // 解码后小于该字节数的data: URL保持内联
 	PageRequisites  bool
+	NoParent        bool // 递归下载时不进入起始URL所在目录的上级目录
+	AcceptRegex     *regexp.Regexp // 递归下载时只加入完整URL匹配的链接，nil表示不限制
+	RejectRegex     *regexp.Regexp // 递归下载时不加入完整URL匹配的链接，优先于AcceptRegex
+	AdjustExtension bool // 按Content-Type为HTML和CSS文件追加缺少的.html/.css扩展名
+	NoHostDirectories bool // 不创建以主机名命名的目录
+	CutDirs         int  // 去除URL路径中前N级目录
+	DirTimestamps   bool // 递归下载结束后将目录的修改时间设为其中最新文件的Last-Modified
+	Cache           bool // 在输出目录中缓存ETag/Last-Modified，再次运行时发送条件请求
+	Manifest        string // 递归下载结束后写入已下载文件清单（JSON）的路径，为空时不写入
 	
 	// HTTP选项
 	MaxRedirects    int
 	FollowRedirects bool
+	RedirectKeepAuth bool // 跨源重定向时保留Authorization/Cookie头（默认移除）
 	Insecure        bool
+	SkipCertExpiry  bool // 不检查服务器证书的有效期，仍然验证证书链和主机名
+	SkipCertHostname bool // 不检查服务器证书的主机名，仍然验证证书链和有效期
+	Certificate     string // 客户端证书文件（PEM），用于双向TLS认证
+	PrivateKey      string // 客户端证书的私钥文件（PEM），为空时从Certificate文件中读取
+	CACertificate   string // 附加的CA证书文件（PEM），与系统证书一起用于验证服务器
+	PinnedPubKeys   []string // 允许的服务器公钥（SPKI）SHA-256哈希，base64编码，为空时不检查
+	CheckOCSP       bool // 通过OCSP检查服务器证书是否已被吊销
+	OCSPSoftFail    bool // 无法获取OCSP状态时仍然允许连接（默认拒绝）
 	ProxyURL        string
 	
 	// Proxy选项
@@ -39,15 +153,111 @@ type Config struct {
 	ProxyEnabled    bool
 	ProxyUsername   string
 	ProxyPassword   string
+	ProxyRotation   string // 多个代理时的选择方式，见ProxyRotation*常量
+	
+	// FTP选项
+	FTPUser         string
+	FTPPassword     string
 	
 	// 输出选项
 	Quiet           bool
 	Verbose         bool
 	Progress        bool
+	ProgressStyle   string // 进度显示方式，见Progress*常量
+	ReportSpeed     string // 进度和汇总中的速度单位，见ReportSpeed*常量
+	OutputFormat    string // 输出格式，见OutputFormat*常量
 	
 	// 其他选项
 	Metalink        bool
+	KeepBadHash     bool // 哈希校验失败时将文件保留为.bad而不是删除
+	Checksum        string // 下载完成后校验的哈希，格式为 算法:值
+	VerifyDigest    bool   // 按服务器返回的Digest头校验下载的文件
+	ChecksumManifest string // 按sha256sum格式记录下载文件哈希的清单文件
+	HashManifestVerify string // 校验该清单中列出的本地文件后退出，不下载
+	Spider          bool
+	PrivacyReport   bool // 递归下载结束后列出收到请求、Cookie或Referer的第三方主机
+	NoIRI           bool
+	NoCanonicalize  bool // 递归下载时按原始URL去重，不排序查询参数、不去除默认端口等
 	RobotsTxt       bool
+
+	// 配置文件hosts中按主机名（小写）的设置，以.开头的键匹配所有子域名
+	Hosts           map[string]*HostConfig
+}
+
+// HostConfig 配置文件hosts中单个主机的设置，覆盖发往该主机的请求的全局配置
+// 为nil的字段未设置；命令行中显式指定的选项不会被主机设置覆盖
+type HostConfig struct {
+	UserAgent  *string
+	Referer    *string
+	LimitRate  *int64
+	HTTPProxy  *string
+	HTTPSProxy *string
+	Headers    []HeaderField // 与全局--header同名的头部被替换，其他头部追加在后面
+}
+
+// Apply 将主机设置应用到cfg，cfg应为全局配置的副本
+func (h *HostConfig) Apply(cfg *Config) {
+	if h.UserAgent != nil {
+		cfg.UserAgent = *h.UserAgent
+	}
+	if h.Referer != nil {
+		cfg.Referer = *h.Referer
+	}
+	if h.LimitRate != nil {
+		cfg.LimitRate = *h.LimitRate
+	}
+	if h.HTTPProxy != nil {
+		cfg.HTTPProxy = *h.HTTPProxy
+	}
+	if h.HTTPSProxy != nil {
+		cfg.HTTPSProxy = *h.HTTPSProxy
+	}
+	if len(h.Headers) > 0 {
+		replaced := make(map[string]bool)
+		for _, header := range h.Headers {
+			replaced[strings.ToLower(header.Key)] = true
+		}
+		headers := make([]HeaderField, 0, len(cfg.Headers)+len(h.Headers))
+		for _, header := range cfg.Headers {
+			if !replaced[strings.ToLower(header.Key)] {
+				headers = append(headers, header)
+			}
+		}
+		cfg.Headers = append(headers, h.Headers...)
+	}
+}
+
+// HostConfigFor 返回主机名匹配的主机设置，精确匹配优先，其次是最长的.域名后缀，没有时返回nil
+func (c *Config) HostConfigFor(host string) *HostConfig {
+	if len(c.Hosts) == 0 {
+		return nil
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if h, ok := c.Hosts[host]; ok {
+		return h
+	}
+	for domain := host; ; {
+		i := strings.Index(domain, ".")
+		if i < 0 {
+			return nil
+		}
+		domain = domain[i+1:]
+		if h, ok := c.Hosts["."+domain]; ok {
+			return h
+		}
+	}
+}
+
+// HeaderField HTTP头部字段
+type HeaderField struct {
+	Key   string
+	Value string
+}
+
+// RewriteRule --rewrite的链接改写规则，转换链接时将匹配Pattern的部分替换为Replacement（可使用$1等分组引用）
+type RewriteRule struct {
+	Pattern     *regexp.Regexp
+	Replacement string
 }
 
 // DownloadTask 下载任务
@@ -92,6 +302,24 @@ type HTTPResponse struct {
 	LastModified  time.Time
 	ETag          string
 	AcceptRanges  bool
+	ContentDisposition string
+	Digest        string // RFC 3230的Digest头
+	FinalURL      string // 跟随重定向后的最终URL
+	ProtoMajor    int // 响应的HTTP协议版本，如HTTP/1.0为1和0
+	ProtoMinor    int
+}
+
+// IsHTTP10 检查响应是否来自HTTP/1.0服务器
+func (r *HTTPResponse) IsHTTP10() bool {
+	return r.ProtoMajor == 1 && r.ProtoMinor == 0
+}
+
+// Protocol 返回协商的协议版本，如"HTTP/1.1"、"HTTP/2"
+func (r *HTTPResponse) Protocol() string {
+	if r.ProtoMajor >= 2 {
+		return fmt.Sprintf("HTTP/%d", r.ProtoMajor)
+	}
+	return fmt.Sprintf("HTTP/%d.%d", r.ProtoMajor, r.ProtoMinor)
 }
 
 // ProgressInfo 进度信息
@@ -104,10 +332,37 @@ type ProgressInfo struct {
 	ActiveThreads int
 }
 
+// DownloadSummary 下载汇总，运行结束时报告下载的文件数、字节数和平均速度
+type DownloadSummary struct {
+	Files   int           // 成功下载的文件数
+	Skipped int           // 跳过的文件数（远程文件未修改、下载日志中已记录、超出配额等）
+	Failed  int           // 下载失败的文件数
+	Bytes   int64         // 从网络接收的字节数（断点续传前已有的部分不计入）
+	Elapsed time.Duration // 下载耗时
+}
+
+// Add 累加另一个汇总
+func (s *DownloadSummary) Add(other DownloadSummary) {
+	s.Files += other.Files
+	s.Skipped += other.Skipped
+	s.Failed += other.Failed
+	s.Bytes += other.Bytes
+	s.Elapsed += other.Elapsed
+}
+
+// AverageSpeed 返回平均速度（字节/秒）
+func (s DownloadSummary) AverageSpeed() int64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(s.Bytes) / s.Elapsed.Seconds())
+}
+
 // Job 下载任务（用于递归下载）
 type Job struct {
 	ID              uint64
 	ParentID        uint64
+	ParentURL       string       // 链接到该URL的页面，用于--referer=auto
 	URL             string
 	OutputPath      string
 	Level           int          // 递归深度级别
@@ -137,6 +392,7 @@ const (
 // ParsedURL 解析出的URL信息
 type ParsedURL struct {
 	URL      string
+	Raw      string // 文档中出现的原始URL文本（标准化之前），用于链接转换时定位
 	Attr     string // HTML属性名（如href、src）
 	Tag      string // HTML标签名
 	Position int    // 在文档中的位置
@@ -175,11 +431,12 @@ type RobotsParser struct {
 	Sitemaps []string
 }
 
-// URLQueue URL队列
+// URLQueue URL队列，默认先进先出（广度优先），LIFO为true时后进先出（深度优先）
+// URLQueue本身不加锁，并发访问时由持有它的queue.Manager统一加锁
 type URLQueue struct {
 	Jobs    []*Job
 	Index   map[string]bool // URL黑名单，防止重复下载
-	Mutex   sync.RWMutex
+	LIFO    bool
 }
 
 // NewURLQueue 创建URL队列
@@ -192,9 +449,6 @@ func NewURLQueue() *URLQueue {
 
 // Add 添加URL到队列
 func (q *URLQueue) Add(job *Job) bool {
-	q.Mutex.Lock()
-	defer q.Mutex.Unlock()
-
 	if q.Index[job.URL] {
 		return false // 已存在
 	}
@@ -206,35 +460,61 @@ func (q *URLQueue) Add(job *Job) bool {
 
 // Pop 从队列中取出一个URL
 func (q *URLQueue) Pop() *Job {
-	q.Mutex.Lock()
-	defer q.Mutex.Unlock()
-
 	if len(q.Jobs) == 0 {
 		return nil
 	}
 
+	if q.LIFO {
+		last := len(q.Jobs) - 1
+		job := q.Jobs[last]
+		q.Jobs[last] = nil
+		q.Jobs = q.Jobs[:last]
+		return job
+	}
+
 	job := q.Jobs[0]
+	q.Jobs[0] = nil
 	q.Jobs = q.Jobs[1:]
 	return job
 }
 
+// Peek 查看下一个将被取出的URL（不移除）
+func (q *URLQueue) Peek() *Job {
+	if len(q.Jobs) == 0 {
+		return nil
+	}
+	if q.LIFO {
+		return q.Jobs[len(q.Jobs)-1]
+	}
+	return q.Jobs[0]
+}
+
+// Remove 从队列中移除URL，保持其余URL的顺序
+func (q *URLQueue) Remove(url string) bool {
+	if !q.Index[url] {
+		return false
+	}
+	for i, job := range q.Jobs {
+		if job.URL == url {
+			q.Jobs = append(q.Jobs[:i], q.Jobs[i+1:]...)
+			delete(q.Index, url)
+			return true
+		}
+	}
+	return false
+}
+
 // Contains 检查URL是否在队列中
 func (q *URLQueue) Contains(url string) bool {
-	q.Mutex.RLock()
-	defer q.Mutex.RUnlock()
 	return q.Index[url]
 }
 
 // Size 获取队列大小
 func (q *URLQueue) Size() int {
-	q.Mutex.RLock()
-	defer q.Mutex.RUnlock()
 	return len(q.Jobs)
 }
 
 // IsEmpty 检查队列是否为空
 func (q *URLQueue) IsEmpty() bool {
-	q.Mutex.RLock()
-	defer q.Mutex.RUnlock()
 	return len(q.Jobs) == 0
 }
\ No newline at end of file
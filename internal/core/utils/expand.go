@@ -0,0 +1,183 @@
+package utils
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// MaxExpandedURLs 花括号展开最多生成的URL数量，防止写错范围时生成海量URL
+const MaxExpandedURLs = 10000
+
+// ExpandURLs 对URL列表做花括号展开（--expand），生成的URL总数超过上限时返回错误
+func ExpandURLs(urls []string) ([]string, error) {
+	var expanded []string
+	for _, u := range urls {
+		results, err := expandBraces(u, MaxExpandedURLs-len(expanded))
+		if err != nil {
+			return nil, err
+		}
+		expanded = append(expanded, results...)
+	}
+	return expanded, nil
+}
+
+// expandBraces 展开字符串中的花括号表达式，支持：
+//   - 数字范围 {1..10}、{10..1}，边界带前导零时补零到相同宽度，如 {001..050}
+//   - 字母范围 {a..e}
+//   - 逗号分隔的集合 {a,b,c}
+//
+// 多个表达式按笛卡尔积展开，不支持嵌套；不符合以上格式的花括号原样保留
+func expandBraces(s string, limit int) ([]string, error) {
+	results := []string{""}
+	rest := s
+
+	for {
+		start, end, alternatives, err := nextBraceGroup(rest, limit)
+		if err != nil {
+			return nil, fmt.Errorf("展开URL失败: %s: %w", s, err)
+		}
+		if start < 0 {
+			break
+		}
+
+		if len(results)*len(alternatives) > limit {
+			return nil, fmt.Errorf("展开URL失败: %s: 生成的URL超过上限 %d 个", s, MaxExpandedURLs)
+		}
+
+		prefix := rest[:start]
+		next := make([]string, 0, len(results)*len(alternatives))
+		for _, r := range results {
+			for _, alt := range alternatives {
+				next = append(next, r+prefix+alt)
+			}
+		}
+		results = next
+		rest = rest[end+1:]
+	}
+
+	for i := range results {
+		results[i] += rest
+	}
+	if len(results) > limit {
+		return nil, fmt.Errorf("展开URL失败: %s: 生成的URL超过上限 %d 个", s, MaxExpandedURLs)
+	}
+	return results, nil
+}
+
+// nextBraceGroup 查找下一个可展开的花括号表达式，返回其起止位置和展开结果
+// 没有可展开的表达式时start为-1
+func nextBraceGroup(s string, limit int) (start, end int, alternatives []string, err error) {
+	offset := 0
+	for {
+		open := strings.IndexByte(s[offset:], '{')
+		if open < 0 {
+			return -1, -1, nil, nil
+		}
+		open += offset
+
+		closing := strings.IndexByte(s[open+1:], '}')
+		if closing < 0 {
+			return -1, -1, nil, nil
+		}
+		closing += open + 1
+
+		body := s[open+1 : closing]
+		// 不支持嵌套，从内层的花括号重新查找
+		if inner := strings.LastIndexByte(body, '{'); inner >= 0 {
+			offset = open + 1 + inner
+			continue
+		}
+
+		alternatives, ok, err := expandBraceBody(body, limit)
+		if err != nil {
+			return -1, -1, nil, err
+		}
+		if ok {
+			return open, closing, alternatives, nil
+		}
+		offset = closing + 1
+	}
+}
+
+// expandBraceBody 展开花括号内的内容，ok为false表示不是可展开的表达式
+func expandBraceBody(body string, limit int) ([]string, bool, error) {
+	if from, to, found := strings.Cut(body, ".."); found {
+		return expandRange(from, to, limit)
+	}
+	if strings.Contains(body, ",") {
+		return strings.Split(body, ","), true, nil
+	}
+	return nil, false, nil
+}
+
+// expandRange 展开数字或字母范围
+func expandRange(from, to string, limit int) ([]string, bool, error) {
+	// 字母范围
+	if len(from) == 1 && len(to) == 1 && isLetter(from[0]) && isLetter(to[0]) {
+		var values []string
+		step := 1
+		if from[0] > to[0] {
+			step = -1
+		}
+		for c := int(from[0]); ; c += step {
+			values = append(values, string(rune(c)))
+			if c == int(to[0]) {
+				break
+			}
+		}
+		return values, true, nil
+	}
+
+	start, err1 := strconv.ParseInt(from, 10, 64)
+	end, err2 := strconv.ParseInt(to, 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, false, nil
+	}
+
+	// 按无符号数计算跨度，{-9223372036854775808..9223372036854775807}等范围不会溢出
+	step := int64(1)
+	span := uint64(end) - uint64(start)
+	if start > end {
+		step = -1
+		span = uint64(start) - uint64(end)
+	}
+	if span >= uint64(limit) {
+		return nil, false, fmt.Errorf("范围 {%s..%s} 超过上限 %d 个", from, to, MaxExpandedURLs)
+	}
+
+	// 任一边界带前导零时补零到相同宽度
+	width := 0
+	if hasLeadingZero(from) || hasLeadingZero(to) {
+		width = max(len(strings.TrimPrefix(from, "-")), len(strings.TrimPrefix(to, "-")))
+	}
+
+	values := make([]string, 0, span+1)
+	for n := start; ; n += step {
+		values = append(values, formatPadded(n, width))
+		if n == end {
+			break
+		}
+	}
+	return values, true, nil
+}
+
+// hasLeadingZero 检查数字字符串是否带前导零
+func hasLeadingZero(s string) bool {
+	s = strings.TrimPrefix(s, "-")
+	return len(s) > 1 && s[0] == '0'
+}
+
+// formatPadded 格式化数字并补零到指定宽度
+func formatPadded(n int64, width int) string {
+	if n < 0 {
+		// 转为无符号数取绝对值，最小的int64也能正确格式化
+		return "-" + fmt.Sprintf("%0*d", width, uint64(-n))
+	}
+	return fmt.Sprintf("%0*d", width, n)
+}
+
+// isLetter 检查是否为ASCII字母
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
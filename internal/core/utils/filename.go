@@ -0,0 +1,154 @@
+package utils
+
+import (
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// fileNameRestriction 解析后的--restrict-file-names模式
+type fileNameRestriction struct {
+	windows   bool
+	ascii     bool
+	noControl bool
+}
+
+// parseRestrictFileNames 解析逗号分隔的模式，unix和windows都未指定时按当前系统选择
+func parseRestrictFileNames(modes string) (fileNameRestriction, error) {
+	r := fileNameRestriction{windows: runtime.GOOS == "windows"}
+	osMode := ""
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.ToLower(strings.TrimSpace(mode))
+		switch mode {
+		case "":
+		case types.RestrictFileNamesUnix, types.RestrictFileNamesWindows:
+			if osMode != "" && osMode != mode {
+				return r, fmt.Errorf("unix和windows不能同时使用")
+			}
+			osMode = mode
+			r.windows = mode == types.RestrictFileNamesWindows
+		case types.RestrictFileNamesASCII:
+			r.ascii = true
+		case types.RestrictFileNamesNoControl:
+			r.noControl = true
+		default:
+			return r, fmt.Errorf("未知的模式: %s（可选: unix, windows, ascii, nocontrol）", mode)
+		}
+	}
+	return r, nil
+}
+
+// ValidateRestrictFileNames 检查--restrict-file-names的值是否有效
+func ValidateRestrictFileNames(modes string) error {
+	_, err := parseRestrictFileNames(modes)
+	return err
+}
+
+// windowsReservedNames Windows保留的设备名，带扩展名时同样不能使用
+var windowsReservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true,
+	"COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true,
+	"LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// RestrictFileName 按--restrict-file-names模式转义单个路径分量中的字符，
+// 不安全的字符以%XX形式保留，modes为空时使用当前系统的默认模式；
+// 模式无效时按默认模式处理（配置解析时已校验）
+func RestrictFileName(name, modes string) string {
+	r, err := parseRestrictFileNames(modes)
+	if err != nil {
+		r, _ = parseRestrictFileNames("")
+	}
+
+	var b strings.Builder
+	for _, c := range name {
+		if r.shouldEscape(c) {
+			var buf [utf8.UTFMax]byte
+			n := utf8.EncodeRune(buf[:], c)
+			for _, octet := range buf[:n] {
+				fmt.Fprintf(&b, "%%%02X", octet)
+			}
+			continue
+		}
+		b.WriteRune(c)
+	}
+	name = b.String()
+
+	if r.windows {
+		name = restrictWindowsName(name)
+	}
+	return name
+}
+
+// shouldEscape 检查字符在当前模式下是否需要转义
+func (r fileNameRestriction) shouldEscape(c rune) bool {
+	switch {
+	case c == '/':
+		return true
+	case isControlRune(c):
+		return !r.noControl
+	case r.ascii && c > 127:
+		return true
+	case r.windows:
+		return strings.ContainsRune(`\|:?"*<>`, c)
+	}
+	return false
+}
+
+// isControlRune 检查是否为C0/C1控制字符（按字符判断，不会转义UTF-8的多字节序列）
+func isControlRune(c rune) bool {
+	return c < 32 || (c >= 127 && c < 160)
+}
+
+// restrictWindowsName 处理Windows不允许的文件名：结尾的点和空格会被系统去掉，
+// 保留设备名（如CON、com1.txt）无法创建普通文件
+func restrictWindowsName(name string) string {
+	trimmed := strings.TrimRight(name, ". ")
+	if trimmed != name {
+		var b strings.Builder
+		b.WriteString(trimmed)
+		for _, c := range name[len(trimmed):] {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+		name = b.String()
+	}
+
+	base, ext, hasExt := strings.Cut(name, ".")
+	if windowsReservedNames[strings.ToUpper(base)] {
+		name = base + "_"
+		if hasExt {
+			name += "." + ext
+		}
+	}
+	return name
+}
+
+// AdjustExtension 按Content-Type为缺少对应扩展名的文件名追加扩展名（-E）：
+// HTML为.html，CSS为.css；已有对应的扩展名（不区分大小写，HTML也接受.htm）时保持不变
+func AdjustExtension(filename, contentType string) string {
+	mediaType, _, _ := strings.Cut(strings.ToLower(contentType), ";")
+	var ext string
+	var accepted []string
+	switch strings.TrimSpace(mediaType) {
+	case "text/html", "application/xhtml+xml":
+		ext, accepted = ".html", []string{".html", ".htm"}
+	case "text/css":
+		ext, accepted = ".css", []string{".css"}
+	default:
+		return filename
+	}
+
+	current := strings.ToLower(filepath.Ext(filename))
+	for _, a := range accepted {
+		if current == a {
+			return filename
+		}
+	}
+	return filename + ext
+}
@@ -0,0 +1,86 @@
+package utils
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// ManifestResult 校验和清单中一个文件的校验结果
+type ManifestResult struct {
+	Path      string
+	Algorithm string
+	Expected  string
+	Actual    string // 文件缺失或无法读取时为空
+	Err       error  // 文件缺失或无法读取的原因
+}
+
+// OK 文件存在且哈希一致
+func (r ManifestResult) OK() bool {
+	return r.Err == nil && r.Actual == r.Expected
+}
+
+// Missing 文件不存在
+func (r ManifestResult) Missing() bool {
+	return r.Err != nil && os.IsNotExist(r.Err)
+}
+
+// manifestAlgorithms 按十六进制哈希的长度判断算法，兼容md5sum、sha1sum和sha256sum的输出
+var manifestAlgorithms = map[int]string{
+	32: "md5",
+	40: "sha1",
+	64: "sha256",
+}
+
+// VerifyChecksumManifest 读取sha256sum格式（"哈希  路径"或"哈希 *路径"）的校验和清单，
+// 逐个校验其中列出的文件；相对路径相对于当前目录，与sha256sum -c一致
+// 清单本身无法读取或格式错误时返回错误，文件缺失或不匹配记录在结果中
+func VerifyChecksumManifest(manifestPath string) ([]ManifestResult, error) {
+	file, err := os.Open(manifestPath)
+	if err != nil {
+		return nil, fmt.Errorf("打开校验和清单失败: %w", err)
+	}
+	defer file.Close()
+
+	var results []ManifestResult
+	scanner := bufio.NewScanner(file)
+	lineNum := 0
+	for scanner.Scan() {
+		lineNum++
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		sum, path, found := strings.Cut(line, " ")
+		algorithm := manifestAlgorithms[len(sum)]
+		if !found || algorithm == "" {
+			return nil, fmt.Errorf("校验和清单第%d行格式错误: %s", lineNum, line)
+		}
+		// 第二个字段前的空格表示文本模式，*表示二进制模式，两者的哈希相同
+		path = strings.TrimPrefix(path, " ")
+		path = strings.TrimPrefix(path, "*")
+		if path == "" {
+			return nil, fmt.Errorf("校验和清单第%d行缺少文件路径", lineNum)
+		}
+
+		result := ManifestResult{
+			Path:      path,
+			Algorithm: algorithm,
+			Expected:  strings.ToLower(sum),
+		}
+		sums, err := HashFile(path, algorithm)
+		if err != nil {
+			result.Err = err
+		} else {
+			result.Actual = sums[algorithm]
+		}
+		results = append(results, result)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取校验和清单失败: %w", err)
+	}
+
+	return results, nil
+}
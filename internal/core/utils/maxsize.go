@@ -0,0 +1,39 @@
+package utils
+
+import (
+	"errors"
+	"io"
+)
+
+// ErrFileTooLarge 文件大小超过--max-filesize设置的上限
+var ErrFileTooLarge = errors.New("文件大小超过上限")
+
+// maxSizeReader 最多读取limit字节，之后还有数据时返回ErrFileTooLarge
+type maxSizeReader struct {
+	reader    io.Reader
+	remaining int64
+}
+
+// NewMaxSizeReader 返回最多读取limit字节的Reader，用于服务器未声明大小时在传输中检查文件大小上限
+func NewMaxSizeReader(r io.Reader, limit int64) io.Reader {
+	if limit < 0 {
+		limit = 0
+	}
+	return &maxSizeReader{reader: r, remaining: limit}
+}
+
+// Read 读取数据，超出上限的部分不返回
+func (m *maxSizeReader) Read(p []byte) (int, error) {
+	// 多读一个字节以区分恰好达到上限和超出上限
+	if int64(len(p)) > m.remaining+1 {
+		p = p[:m.remaining+1]
+	}
+	n, err := m.reader.Read(p)
+	if int64(n) > m.remaining {
+		n = int(m.remaining)
+		m.remaining = 0
+		return n, ErrFileTooLarge
+	}
+	m.remaining -= int64(n)
+	return n, err
+}
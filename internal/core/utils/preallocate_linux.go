@@ -0,0 +1,28 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+// Preallocate 为文件预先分配size字节的磁盘空间，磁盘空间不足时立即返回错误
+// 文件系统不支持fallocate时退回到扩展文件大小（稀疏文件，不保证空间）
+func Preallocate(file *os.File, size int64) error {
+	for {
+		err := syscall.Fallocate(int(file.Fd()), 0, 0, size)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, syscall.EINTR):
+			continue
+		case errors.Is(err, syscall.ENOSPC):
+			return fmt.Errorf("磁盘空间不足，无法分配 %d 字节: %w", size, err)
+		case errors.Is(err, syscall.EOPNOTSUPP), errors.Is(err, syscall.ENOSYS):
+			return extendFile(file, size)
+		default:
+			return err
+		}
+	}
+}
@@ -0,0 +1,10 @@
+//go:build !linux
+
+package utils
+
+import "os"
+
+// Preallocate 将文件扩展到size字节，非Linux平台上不保证实际分配磁盘空间
+func Preallocate(file *os.File, size int64) error {
+	return extendFile(file, size)
+}
@@ -0,0 +1,47 @@
+package utils
+
+import "time"
+
+// DefaultSpeedWindow 计算当前速度使用的时间窗口
+const DefaultSpeedWindow = 5 * time.Second
+
+// SpeedWindow 按最近一段时间内的下载量计算速度（滑动窗口），反映当前吞吐量而不是整体平均值
+// 不是并发安全的，由报告进度的协程单独使用
+type SpeedWindow struct {
+	window  time.Duration
+	samples []speedSample
+}
+
+// speedSample 某一时刻的累计下载量
+type speedSample struct {
+	at    time.Time
+	bytes int64
+}
+
+// NewSpeedWindow 创建滑动窗口，start和downloaded为开始时间和开始时已有的字节数（断点续传时不计入速度）
+func NewSpeedWindow(window time.Duration, start time.Time, downloaded int64) *SpeedWindow {
+	return &SpeedWindow{
+		window:  window,
+		samples: []speedSample{{at: start, bytes: downloaded}},
+	}
+}
+
+// Update 记录at时刻的累计下载量，返回窗口内的平均速度（字节/秒）
+func (w *SpeedWindow) Update(at time.Time, downloaded int64) int64 {
+	w.samples = append(w.samples, speedSample{at: at, bytes: downloaded})
+
+	// 保留窗口开始前的最后一个样本作为基准，窗口总是覆盖完整的时长
+	cutoff := at.Add(-w.window)
+	drop := 0
+	for drop < len(w.samples)-2 && !w.samples[drop+1].at.After(cutoff) {
+		drop++
+	}
+	w.samples = w.samples[drop:]
+
+	first := w.samples[0]
+	elapsed := at.Sub(first.at).Seconds()
+	if elapsed <= 0 {
+		return 0
+	}
+	return int64(float64(downloaded-first.bytes) / elapsed)
+}
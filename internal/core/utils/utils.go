@@ -4,15 +4,25 @@ import (
 	"crypto/md5"
 	"crypto/sha1"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
 	"fmt"
+	"hash"
 	"io"
+	"net"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
 	"regexp"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
+
+	"golang.org/x/net/idna"
 )
 
 // FileExists 检查文件是否存在
@@ -107,6 +117,21 @@ func FormatSpeed(bytesPerSecond int64) string {
 	return FormatSize(bytesPerSecond) + "/s"
 }
 
+// FormatBitRate 以比特每秒格式化速度，与wget的--report-speed=bits一致使用1000进制
+func FormatBitRate(bytesPerSecond int64) string {
+	bits := float64(bytesPerSecond) * 8
+	if bits < 1000 {
+		return fmt.Sprintf("%.0f b/s", bits)
+	}
+
+	units := []string{"Kb/s", "Mb/s", "Gb/s", "Tb/s", "Pb/s", "Eb/s"}
+	exp := 0
+	for bits /= 1000; bits >= 1000 && exp < len(units)-1; bits /= 1000 {
+		exp++
+	}
+	return fmt.Sprintf("%.1f %s", bits, units[exp])
+}
+
 // FormatDuration 格式化持续时间
 func FormatDuration(d time.Duration) string {
 	if d < time.Second {
@@ -128,6 +153,11 @@ func FormatDuration(d time.Duration) string {
 	return fmt.Sprintf("%dh%dm", hours, minutes)
 }
 
+// AutoMaxThreads --max-threads=auto时的并发上限：每个CPU两个连接，最少2个，最多16个
+func AutoMaxThreads() int {
+	return min(max(2*runtime.NumCPU(), 2), 16)
+}
+
 // CalculateETA 计算预计完成时间
 func CalculateETA(total, downloaded, speed int64) time.Duration {
 	if speed <= 0 {
@@ -187,6 +217,145 @@ func CalculateSHA256(filename string) (string, error) {
 	return hex.EncodeToString(hash.Sum(nil)), nil
 }
 
+// NormalizeHashAlgorithm 规范化哈希算法名称（不区分大小写，sha-256与sha256等价）
+// 不支持的算法返回空字符串
+func NormalizeHashAlgorithm(algorithm string) string {
+	switch strings.ReplaceAll(strings.ToLower(strings.TrimSpace(algorithm)), "-", "") {
+	case "md5":
+		return "md5"
+	case "sha1":
+		return "sha1"
+	case "sha256":
+		return "sha256"
+	case "sha512":
+		return "sha512"
+	}
+	return ""
+}
+
+// ParseChecksum 解析"算法:十六进制值"格式的校验和，如 sha256:e3b0c442...
+func ParseChecksum(checksum string) (algorithm, value string, err error) {
+	name, value, found := strings.Cut(checksum, ":")
+	if !found {
+		return "", "", fmt.Errorf("校验和格式应为 算法:值: %s", checksum)
+	}
+	algorithm = NormalizeHashAlgorithm(name)
+	if algorithm == "" {
+		return "", "", fmt.Errorf("不支持的哈希算法: %s", name)
+	}
+	value = strings.ToLower(strings.TrimSpace(value))
+	if _, err := hex.DecodeString(value); err != nil || len(value) != hex.EncodedLen(newHash(algorithm).Size()) {
+		return "", "", fmt.Errorf("无效的%s校验和: %s", algorithm, value)
+	}
+	return algorithm, value, nil
+}
+
+// ParseDigestHeader 解析RFC 3230的Digest头（如"sha-256=base64值, md5=base64值"），
+// 返回规范化的算法名到十六进制哈希的映射；只保留sha-256、sha-512和md5，忽略无法解析的值
+func ParseDigestHeader(value string) map[string]string {
+	digests := make(map[string]string)
+	for _, item := range strings.Split(value, ",") {
+		name, encoded, found := strings.Cut(strings.TrimSpace(item), "=")
+		if !found {
+			continue
+		}
+		algorithm := ""
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "sha-256":
+			algorithm = "sha256"
+		case "sha-512":
+			algorithm = "sha512"
+		case "md5":
+			algorithm = "md5"
+		default:
+			continue
+		}
+		sum, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encoded))
+		if err != nil || len(sum) != newHash(algorithm).Size() {
+			continue
+		}
+		digests[algorithm] = hex.EncodeToString(sum)
+	}
+	return digests
+}
+
+// newHash 创建指定算法的哈希，算法名需已规范化
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "md5":
+		return md5.New()
+	case "sha1":
+		return sha1.New()
+	case "sha512":
+		return sha512.New()
+	default:
+		return sha256.New()
+	}
+}
+
+// MultiHasher 一次读取同时计算多种哈希
+type MultiHasher struct {
+	hashes map[string]hash.Hash
+	writer io.Writer
+}
+
+// NewMultiHasher 创建多哈希计算器，重复的算法只计算一次
+func NewMultiHasher(algorithms ...string) (*MultiHasher, error) {
+	m := &MultiHasher{hashes: make(map[string]hash.Hash)}
+	var writers []io.Writer
+	for _, name := range algorithms {
+		algorithm := NormalizeHashAlgorithm(name)
+		if algorithm == "" {
+			return nil, fmt.Errorf("不支持的哈希算法: %s", name)
+		}
+		if _, ok := m.hashes[algorithm]; ok {
+			continue
+		}
+		h := newHash(algorithm)
+		m.hashes[algorithm] = h
+		writers = append(writers, h)
+	}
+	m.writer = io.MultiWriter(writers...)
+	return m, nil
+}
+
+// Write 将数据写入所有哈希
+func (m *MultiHasher) Write(p []byte) (int, error) {
+	return m.writer.Write(p)
+}
+
+// Sums 返回各算法的十六进制哈希值，键为规范化的算法名
+func (m *MultiHasher) Sums() map[string]string {
+	sums := make(map[string]string, len(m.hashes))
+	for algorithm, h := range m.hashes {
+		sums[algorithm] = hex.EncodeToString(h.Sum(nil))
+	}
+	return sums
+}
+
+// HashReader 读取一遍r，同时计算所有指定算法的哈希
+func HashReader(r io.Reader, algorithms ...string) (map[string]string, error) {
+	m, err := NewMultiHasher(algorithms...)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(m, r); err != nil {
+		return nil, err
+	}
+	return m.Sums(), nil
+}
+
+// HashFile 读取一遍文件，同时计算所有指定算法的哈希
+func HashFile(filename string, algorithms ...string) (map[string]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return HashReader(file, algorithms...)
+}
+
 // SafeFileName 创建安全的文件名
 func SafeFileName(filename string) string {
 	// 移除非法字符
@@ -218,6 +387,15 @@ func GetUniqueFileName(filename string) string {
 	}
 }
 
+// IsWithinDir 检查路径是否位于目录内（用于防止路径穿越）
+func IsWithinDir(dir, target string) bool {
+	rel, err := filepath.Rel(dir, target)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) && !filepath.IsAbs(rel)
+}
+
 // CopyFile 复制文件
 func CopyFile(src, dst string) error {
 	source, err := os.Open(src)
@@ -272,4 +450,206 @@ func HumanReadableTime(t time.Time) string {
 	default:
 		return t.Format("2006-01-02")
 	}
-}
\ No newline at end of file
+}
+
+// ToASCIIHost 将国际化域名转换为punycode形式（xn--），转换失败时返回原主机名
+func ToASCIIHost(host string) string {
+	if isASCII(host) {
+		return host
+	}
+	ascii, err := idna.Lookup.ToASCII(host)
+	if err != nil {
+		return host
+	}
+	return ascii
+}
+
+// ToUnicodeHost 将punycode主机名转换为可读形式，用于本地保存路径
+func ToUnicodeHost(host string) string {
+	unicode, err := idna.Display.ToUnicode(host)
+	if err != nil {
+		return host
+	}
+	return unicode
+}
+
+// ToASCIIURL 将URL中的国际化域名转换为punycode形式，用于DNS解析和发送请求
+func ToASCIIURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || isASCII(u.Host) {
+		return rawURL
+	}
+
+	host := ToASCIIHost(u.Hostname())
+	if port := u.Port(); port != "" {
+		host = net.JoinHostPort(host, port)
+	}
+	u.Host = host
+	return u.String()
+}
+
+// URLHostDir 获取URL主机名的可读形式，用作本地保存目录
+func URLHostDir(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return ToUnicodeHost(u.Hostname())
+}
+
+// CanonicalURL 返回用于去重的规范URL：去除锚点，协议和主机名转换为小写，去除默认端口，
+// 解析路径中的.和..（保留结尾的/，空路径为/），查询参数按名称排序（同名参数保持原有顺序）
+// 百分号编码保持不变；无法解析或没有主机的URL原样返回
+func CanonicalURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Opaque != "" || u.Host == "" {
+		return rawURL
+	}
+
+	scheme := strings.ToLower(u.Scheme)
+	host := strings.ToLower(u.Hostname())
+	if port := u.Port(); port != "" && !(scheme == "http" && port == "80") && !(scheme == "https" && port == "443") {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+
+	urlPath := u.EscapedPath()
+	if urlPath == "" {
+		urlPath = "/"
+	} else {
+		cleaned := path.Clean(urlPath)
+		if strings.HasSuffix(urlPath, "/") && cleaned != "/" {
+			cleaned += "/"
+		}
+		urlPath = cleaned
+	}
+
+	var b strings.Builder
+	b.WriteString(scheme)
+	b.WriteString("://")
+	if u.User != nil {
+		b.WriteString(u.User.String())
+		b.WriteByte('@')
+	}
+	b.WriteString(host)
+	b.WriteString(urlPath)
+	if u.RawQuery != "" {
+		params := strings.Split(u.RawQuery, "&")
+		sort.SliceStable(params, func(i, j int) bool {
+			nameI, _, _ := strings.Cut(params[i], "=")
+			nameJ, _, _ := strings.Cut(params[j], "=")
+			return nameI < nameJ
+		})
+		b.WriteByte('?')
+		b.WriteString(strings.Join(params, "&"))
+	}
+	return b.String()
+}
+
+// EscapeURL 对URL中不安全的字符（空格、控制字符、非ASCII字符等）进行百分号编码
+// 已有的合法编码保持不变，不完整的%转义编码为%25；主机部分不做处理，由IDN转换负责
+func EscapeURL(rawURL string) string {
+	// 与浏览器一致，去除首尾空白以及URL中的换行和制表符
+	s := strings.Map(func(r rune) rune {
+		if r == '\t' || r == '\n' || r == '\r' {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(rawURL))
+
+	prefix, rest := splitAuthority(s)
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	inFragment := false
+	for i := 0; i < len(rest); i++ {
+		c := rest[i]
+		switch {
+		case c == '%' && i+2 < len(rest) && isHex(rest[i+1]) && isHex(rest[i+2]):
+			b.WriteByte(c)
+		case c == '#' && !inFragment:
+			inFragment = true
+			b.WriteByte(c)
+		case shouldEscapeURLByte(c, inFragment):
+			fmt.Fprintf(&b, "%%%02X", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// splitAuthority 将URL分为scheme和主机部分（原样保留）以及其后的路径、查询和片段
+func splitAuthority(s string) (string, string) {
+	start := -1
+	if idx := strings.Index(s, "://"); idx > 0 && isScheme(s[:idx]) {
+		start = idx + 3
+	} else if strings.HasPrefix(s, "//") {
+		start = 2
+	}
+	if start == -1 {
+		return "", s
+	}
+
+	end := strings.IndexAny(s[start:], "/?#")
+	if end == -1 {
+		return s, ""
+	}
+	return s[:start+end], s[start+end:]
+}
+
+// isScheme 检查字符串是否为合法的URL scheme
+func isScheme(s string) bool {
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z':
+		case i > 0 && ('0' <= c && c <= '9' || c == '+' || c == '-' || c == '.'):
+		default:
+			return false
+		}
+	}
+	return s != ""
+}
+
+// shouldEscapeURLByte 检查字节在路径、查询或片段中是否需要编码
+func shouldEscapeURLByte(c byte, inFragment bool) bool {
+	if c <= ' ' || c >= 0x7f {
+		return true
+	}
+	switch c {
+	case '"', '<', '>', '\\', '^', '`', '{', '|', '}', '%':
+		return true
+	case '#':
+		return inFragment
+	}
+	return false
+}
+
+// isHex 检查字节是否为十六进制数字
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+// isASCII 检查字符串是否只包含ASCII字符
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
+
+// extendFile 将文件扩展到size字节，文件已经更大时保持不变
+func extendFile(file *os.File, size int64) error {
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() >= size {
+		return nil
+	}
+	return file.Truncate(size)
+}
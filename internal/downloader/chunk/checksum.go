@@ -0,0 +1,199 @@
+package chunk
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// ChecksumManifest 校验和清单，每个下载完成的文件按sha256sum格式追加一行
+type ChecksumManifest struct {
+	file *os.File
+	mu   sync.Mutex
+}
+
+// OpenChecksumManifest 打开校验和清单，新的记录追加到文件末尾
+func OpenChecksumManifest(path string) (*ChecksumManifest, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开校验和清单失败: %w", err)
+	}
+	return &ChecksumManifest{file: file}, nil
+}
+
+// Record 记录文件的sha256哈希
+func (m *ChecksumManifest) Record(path, sha256 string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := fmt.Fprintf(m.file, "%s  %s\n", sha256, path); err != nil {
+		return fmt.Errorf("写入校验和清单失败: %w", err)
+	}
+	return nil
+}
+
+// Close 关闭校验和清单
+func (m *ChecksumManifest) Close() error {
+	return m.file.Close()
+}
+
+// SetChecksumManifest 设置校验和清单，下载完成的文件记录到清单中
+func (cd *ChunkDownloader) SetChecksumManifest(manifest *ChecksumManifest) {
+	cd.manifest = manifest
+}
+
+// digestAlgorithms 返回下载完成后需要计算的哈希算法
+func (cd *ChunkDownloader) digestAlgorithms() []string {
+	seen := make(map[string]bool)
+	if cd.config.Checksum != "" {
+		if algorithm, _, err := utils.ParseChecksum(cd.config.Checksum); err == nil {
+			seen[algorithm] = true
+		}
+	}
+	if cd.manifest != nil {
+		seen["sha256"] = true
+	}
+	for algorithm := range cd.serverDigests() {
+		seen[algorithm] = true
+	}
+
+	algorithms := make([]string, 0, len(seen))
+	for algorithm := range seen {
+		algorithms = append(algorithms, algorithm)
+	}
+	sort.Strings(algorithms)
+	return algorithms
+}
+
+// streamDigestAlgorithms 返回写入时需要计算的哈希算法；服务器的Digest可能在读完响应体后的trailer中才出现，
+// 启用--verify-digest时同时计算Digest支持的全部算法
+func (cd *ChunkDownloader) streamDigestAlgorithms() []string {
+	algorithms := cd.digestAlgorithms()
+	if cd.config.VerifyDigest {
+		algorithms = append(algorithms, "md5", "sha256", "sha512")
+	}
+	return algorithms
+}
+
+// Digests 返回最近一次下载的文件的哈希，键为规范化的算法名；未计算哈希时返回nil
+func (cd *ChunkDownloader) Digests() map[string]string {
+	return cd.digests
+}
+
+// serverDigests 返回--verify-digest需要校验的服务器摘要
+func (cd *ChunkDownloader) serverDigests() map[string]string {
+	if !cd.config.VerifyDigest || cd.serverDigest == "" {
+		return nil
+	}
+	return utils.ParseDigestHeader(cd.serverDigest)
+}
+
+// verifyServerDigests 按服务器的Digest头校验文件，服务器未提供可用的摘要时跳过
+func (cd *ChunkDownloader) verifyServerDigests(path string, sums map[string]string) error {
+	digests := cd.serverDigests()
+	if len(digests) == 0 {
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "服务器未提供可校验的Digest，跳过校验: %s\n", path)
+		}
+		return nil
+	}
+	for _, algorithm := range sortedKeys(digests) {
+		if expected, actual := digests[algorithm], sums[algorithm]; actual != expected {
+			return cd.discardBadFile(path, fmt.Errorf("Digest校验失败: %s期望 %s, 实际 %s", algorithm, expected, actual))
+		}
+	}
+	if cd.config.Verbose {
+		fmt.Fprintf(cd.out, "Digest校验通过: %s\n", path)
+	}
+	return nil
+}
+
+// sortedKeys 返回按字母排序的键
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// verifyDigests 取得校验和、服务器Digest与清单所需的全部哈希，然后校验--checksum和--verify-digest并记录到清单
+// 单线程从头下载时使用写入时计算的哈希；分片乱序写入、断点续传只接收了部分内容或跳过下载时，
+// 写入的数据不是完整的文件，需要再读取一遍文件
+func (cd *ChunkDownloader) verifyDigests(path string) error {
+	algorithms := cd.digestAlgorithms()
+	if len(algorithms) == 0 {
+		if cd.config.VerifyDigest && cd.config.Verbose {
+			fmt.Fprintf(cd.out, "服务器未提供可校验的Digest，跳过校验: %s\n", path)
+		}
+		return nil
+	}
+
+	sums := cd.digests
+	if !hasDigests(sums, algorithms) {
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "计算哈希 (%s): %s\n", strings.Join(algorithms, ", "), path)
+		}
+		var err error
+		sums, err = utils.HashFile(path, algorithms...)
+		if err != nil {
+			return fmt.Errorf("计算哈希失败: %w", err)
+		}
+		cd.digests = sums
+	}
+
+	if cd.config.Checksum != "" {
+		algorithm, expected, err := utils.ParseChecksum(cd.config.Checksum)
+		if err != nil {
+			return err
+		}
+		if actual := sums[algorithm]; actual != expected {
+			return cd.discardBadFile(path, fmt.Errorf("%s哈希不匹配: 期望 %s, 实际 %s", algorithm, expected, actual))
+		}
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "%s校验通过: %s\n", algorithm, path)
+		}
+	}
+
+	if cd.config.VerifyDigest {
+		if err := cd.verifyServerDigests(path, sums); err != nil {
+			return err
+		}
+	}
+
+	if cd.manifest != nil {
+		if err := cd.manifest.Record(path, sums["sha256"]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// hasDigests 检查sums是否包含所有指定算法的哈希
+func hasDigests(sums map[string]string, algorithms []string) bool {
+	for _, algorithm := range algorithms {
+		if _, ok := sums[algorithm]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// discardBadFile 删除哈希校验失败的文件，设置了--keep-bad-hash时保留为.bad
+func (cd *ChunkDownloader) discardBadFile(path string, err error) error {
+	if cd.config.KeepBadHash {
+		// 保留校验失败的文件以便排查
+		badPath := path + ".bad"
+		if renameErr := os.Rename(path, badPath); renameErr != nil {
+			return fmt.Errorf("%w (保留文件失败: %v)", err, renameErr)
+		}
+		return fmt.Errorf("%w (文件已保留为 %s)", err, badPath)
+	}
+	os.Remove(path)
+	return err
+}
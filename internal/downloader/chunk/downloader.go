@@ -1,31 +1,45 @@
 package chunk
 
 import (
-	"compress/gzip"
-	"compress/zlib"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
 	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
 
 	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/metalink"
+	"github.com/example/wget2go/internal/core/ratelimit"
 	"github.com/example/wget2go/internal/core/types"
 	"github.com/example/wget2go/internal/core/utils"
 )
 
 // ChunkDownloader 分片下载器
 type ChunkDownloader struct {
-	client      *httpCore.Client
-	config      *types.Config
-	progressCh  chan types.ProgressInfo
-	errorCh     chan error
-	stopCh      chan struct{}
+	client       *httpCore.Client
+	config       *types.Config
+	progressCh   chan types.ProgressInfo
+	errorCh      chan error
+	stopCh       chan struct{}
+	limiter      *ratelimit.Limiter
+	manifest     *ChecksumManifest
+	serverDigest string            // 当前下载的服务器Digest头，用于--verify-digest
+	digests      map[string]string // 当前下载的文件的哈希，单线程完整写入时在写入的同时计算
+	notModified  bool              // 当前下载因远程文件未修改或本地文件已完整而跳过
+	out          io.Writer         // 文本输出的目标，默认为标准输出
+
+	received  atomic.Int64 // 从网络接收的字节数
+	summaryMu sync.Mutex
+	summary   types.DownloadSummary
 }
 
 // NewChunkDownloader 创建分片下载器
@@ -36,74 +50,198 @@ func NewChunkDownloader(client *httpCore.Client, config *types.Config) *ChunkDow
 		progressCh: make(chan types.ProgressInfo, 100),
 		errorCh:    make(chan error, 100),
 		stopCh:     make(chan struct{}),
+		limiter:    ratelimit.NewLimiter(config.LimitRate),
+		out:        os.Stdout,
+	}
+}
+
+// SetOutput 设置文本输出的目标，默认为标准输出
+func (cd *ChunkDownloader) SetOutput(w io.Writer) {
+	cd.out = w
+}
+
+// SetLimiter 设置限速器，多个下载器共享同一限速器时总速度受同一限制
+func (cd *ChunkDownloader) SetLimiter(limiter *ratelimit.Limiter) {
+	cd.limiter = limiter
+}
+
+// limiterFor 返回下载url使用的限速器，配置文件hosts中为该主机设置了limit_rate时使用主机的限速器
+func (cd *ChunkDownloader) limiterFor(url string) *ratelimit.Limiter {
+	if limiter, ok := cd.client.HostLimiter(url); ok {
+		return limiter
+	}
+	return cd.limiter
+}
+
+// initialURL 返回响应对应的最初请求（重定向之前）的URL
+func initialURL(resp *http.Response) string {
+	req := resp.Request
+	if req == nil {
+		return ""
+	}
+	for req.Response != nil && req.Response.Request != nil {
+		req = req.Response.Request
 	}
+	return req.URL.String()
 }
 
-// Download 下载文件
+// Download 下载文件，结果计入GetSummary的汇总
 func (cd *ChunkDownloader) Download(ctx context.Context, url, outputPath string) error {
+	start := time.Now()
+	received := cd.received.Load()
+	cd.notModified = false
+
+	err := cd.downloadAndVerify(ctx, url, outputPath)
+	cd.recordSummary(start, received, err)
+	return err
+}
+
+// recordSummary 将一次下载的结果计入汇总，received为下载开始时已接收的字节数
+func (cd *ChunkDownloader) recordSummary(start time.Time, received int64, err error) {
+	cd.summaryMu.Lock()
+	defer cd.summaryMu.Unlock()
+	switch {
+	case err != nil:
+		cd.summary.Failed++
+	case cd.notModified:
+		cd.summary.Skipped++
+	default:
+		cd.summary.Files++
+	}
+	cd.summary.Bytes += cd.received.Load() - received
+	cd.summary.Elapsed += time.Since(start)
+}
+
+// GetSummary 返回该下载器所有Download调用的汇总，耗时为各次下载的时间之和
+func (cd *ChunkDownloader) GetSummary() types.DownloadSummary {
+	cd.summaryMu.Lock()
+	defer cd.summaryMu.Unlock()
+	return cd.summary
+}
+
+// downloadAndVerify 下载文件并校验哈希
+func (cd *ChunkDownloader) downloadAndVerify(ctx context.Context, url, outputPath string) error {
+	finalOutputPath, err := cd.download(ctx, url, outputPath)
+	if err != nil || finalOutputPath == "" {
+		return err
+	}
+	// 写入管道或设备的内容无法重新读取，不能计算哈希
+	if !isRegularOutput(finalOutputPath) {
+		return nil
+	}
+	return cd.verifyDigests(finalOutputPath)
+}
+
+// download 下载文件，返回实际保存的路径（Metalink文档由其自身的哈希校验，返回空路径）
+func (cd *ChunkDownloader) download(ctx context.Context, url, outputPath string) (string, error) {
+	cd.serverDigest = ""
+	cd.digests = nil
+
+	// POST请求不支持范围请求和条件请求，直接单线程下载
+	if cd.config.PostData != "" || cd.config.PostFile != "" {
+		return cd.downloadPost(ctx, url, outputPath)
+	}
+
+	// 时间戳模式：本地文件已存在时只在远程文件更新后重新下载（断点续传时不适用）
+	if cd.config.Timestamping && !cd.config.Continue {
+		if info, err := os.Stat(outputPath); err == nil && info.Mode().IsRegular() {
+			return outputPath, cd.downloadIfModified(ctx, url, outputPath, info.ModTime())
+		}
+	}
+
 	// 获取文件信息
 	fileInfo, err := cd.getFileInfo(ctx, url)
 	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
+		return "", fmt.Errorf("获取文件信息失败: %w", err)
+	}
+	cd.serverDigest = fileInfo.Digest
+
+	// Metalink文档：从其中列出的镜像下载实际文件
+	if cd.config.Metalink && metalink.IsMetalink(fileInfo.ContentType, url) {
+		return "", cd.downloadMetalink(ctx, url, outputPath)
+	}
+
+	// 在传输前检查文件大小是否与期望一致
+	if err := cd.checkExpectedSize(fileInfo); err != nil {
+		return "", err
 	}
 
 	// 打印文件信息和服务器支持状态
-	fmt.Printf("文件大小: %d bytes\n", fileInfo.ContentLength)
-	fmt.Printf("服务器范围请求支持: %v\n", fileInfo.AcceptRanges)
+	if fileInfo.ContentLength >= 0 {
+		fmt.Fprintf(cd.out, "文件大小: %d bytes\n", fileInfo.ContentLength)
+	} else {
+		fmt.Fprintln(cd.out, "文件大小: 未知")
+	}
+	fmt.Fprintf(cd.out, "服务器范围请求支持: %v\n", fileInfo.AcceptRanges)
+	if cd.config.Verbose {
+		fmt.Fprintf(cd.out, "协议: %s\n", fileInfo.Protocol())
+	}
 
 	// 确定输出路径
 	finalOutputPath := cd.getOutputPath(outputPath, url, fileInfo)
 
+	// 管道、设备等特殊文件不支持随机写入，使用单线程顺序写入
+	if !isRegularOutput(finalOutputPath) {
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "输出目标不是普通文件，使用单线程顺序写入: %s\n", finalOutputPath)
+		}
+		return finalOutputPath, cd.downloadSingle(ctx, url, finalOutputPath, fileInfo.ContentLength)
+	}
+
 	// 检查是否需要分片下载
 	if cd.shouldUseChunks(fileInfo) {
 		// 测试服务器是否真正支持范围请求
 		if cd.config != nil && cd.config.Verbose {
-			fmt.Println("测试服务器分片下载支持...")
+			fmt.Fprintln(cd.out, "测试服务器分片下载支持...")
 		}
 		// 尝试下载0-0字节来测试Range支持
 		reader, _, rangeErr := cd.client.DownloadRange(ctx, url, 0, 0)
 		if rangeErr != nil {
 			if isRangeNotSupportedError(rangeErr) {
-				fmt.Println("服务器不支持分片下载，使用单线程下载")
-				return cd.downloadSingle(ctx, url, finalOutputPath)
+				fmt.Fprintln(cd.out, "服务器不支持分片下载，使用单线程下载")
+				return finalOutputPath, cd.downloadSingleChecked(ctx, url, finalOutputPath, fileInfo.ContentLength)
 			}
 			// 其他错误（如网络问题），仍尝试分片下载
-			fmt.Println("范围请求测试失败（网络问题），仍尝试分片下载")
+			fmt.Fprintln(cd.out, "范围请求测试失败（网络问题），仍尝试分片下载")
 		} else {
 			reader.Close()
 			if cd.config != nil && cd.config.Verbose {
-				fmt.Println("服务器支持分片下载，开始分片下载")
+				fmt.Fprintln(cd.out, "服务器支持分片下载，开始分片下载")
 			}
 		}
 		
 		// 尝试分片下载
-		err := cd.downloadWithChunks(ctx, url, finalOutputPath, fileInfo)
+		err := cd.downloadWithChunks(ctx, []string{url}, finalOutputPath, fileInfo)
 		if err != nil {
 			// 检查是否是服务器不支持范围请求的错误
 			if isRangeNotSupportedError(err) {
 				// 服务器不支持分片下载，回退到单线程
-				fmt.Println("服务器不支持分片下载，回退到单线程下载")
-				return cd.downloadSingle(ctx, url, finalOutputPath)
+				fmt.Fprintln(cd.out, "服务器不支持分片下载，回退到单线程下载")
+				return finalOutputPath, cd.downloadSingleChecked(ctx, url, finalOutputPath, fileInfo.ContentLength)
 			}
 			// 其他错误，直接返回
-			return err
+			return "", err
 		}
 		// 分片下载成功
-		return nil
+		return finalOutputPath, nil
 	}
 
 	// 单线程下载，打印原因（仅在详细模式下显示）
 	if cd.config != nil && cd.config.Verbose {
-		fmt.Println("使用单线程下载:")
+		fmt.Fprintln(cd.out, "使用单线程下载:")
 		if cd.config.ChunkSize <= 0 {
-			fmt.Println("  - 未配置分片大小")
+			fmt.Fprintln(cd.out, "  - 未配置分片大小")
+		} else if fileInfo.ContentLength < 0 {
+			fmt.Fprintln(cd.out, "  - 无法获取文件大小")
 		} else if fileInfo.ContentLength <= cd.config.ChunkSize {
-			fmt.Printf("  - 文件大小 (%d bytes) 小于分片大小 (%d bytes)\n", fileInfo.ContentLength, cd.config.ChunkSize)
+			fmt.Fprintf(cd.out, "  - 文件大小 (%d bytes) 小于分片大小 (%d bytes)\n", fileInfo.ContentLength, cd.config.ChunkSize)
 		} else if !fileInfo.AcceptRanges {
-			fmt.Println("  - 服务器不支持范围请求")
+			fmt.Fprintln(cd.out, "  - 服务器不支持范围请求")
+		} else if fileInfo.IsHTTP10() {
+			fmt.Fprintln(cd.out, "  - HTTP/1.0服务器，不使用分片下载")
 		}
 	}
-	return cd.downloadSingle(ctx, url, finalOutputPath)
+	return finalOutputPath, cd.downloadSingleChecked(ctx, url, finalOutputPath, fileInfo.ContentLength)
 }
 
 // getFileInfo 获取文件信息
@@ -114,20 +252,71 @@ func (cd *ChunkDownloader) getFileInfo(ctx context.Context, url string) (*types.
 	}
 
 	if resp.StatusCode != 200 {
-		return nil, fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+		return nil, &httpCore.HTTPError{StatusCode: resp.StatusCode}
 	}
 
+	// HEAD响应没有Content-Length时，通过范围请求的Content-Range获取总大小
+	// 仍无法获取时ContentLength为-1，使用单线程流式下载
 	if resp.ContentLength <= 0 {
-		return nil, fmt.Errorf("无法获取文件大小")
+		total, err := cd.client.ProbeSize(ctx, url)
+		if err != nil {
+			if cd.config.Verbose {
+				fmt.Fprintf(cd.out, "无法获取文件大小（%v），使用单线程下载\n", err)
+			}
+			resp.ContentLength = -1
+		} else {
+			resp.ContentLength = total
+			resp.AcceptRanges = true
+		}
 	}
 
 	return resp, nil
 }
 
+// checkExpectedSize 检查文件大小是否与--expected-size一致且不超过--max-filesize，避免下载错误或过大的文件
+func (cd *ChunkDownloader) checkExpectedSize(fileInfo *types.HTTPResponse) error {
+	// 大小未知时无法在传输前检查，由copyResponse在传输中和传输后检查
+	if fileInfo.ContentLength < 0 {
+		return nil
+	}
+	if cd.config.ExpectedSize > 0 && fileInfo.ContentLength != cd.config.ExpectedSize {
+		return fmt.Errorf("文件大小与期望不符: 期望 %d 字节, 服务器返回 %d 字节", cd.config.ExpectedSize, fileInfo.ContentLength)
+	}
+	if cd.config.MaxFileSize > 0 && fileInfo.ContentLength > cd.config.MaxFileSize {
+		return fmt.Errorf("%w: 服务器返回 %d 字节, 上限 %d 字节", utils.ErrFileTooLarge, fileInfo.ContentLength, cd.config.MaxFileSize)
+	}
+	return nil
+}
+
 // getOutputPath 确定输出路径
 func (cd *ChunkDownloader) getOutputPath(outputPath, url string, fileInfo *types.HTTPResponse) string {
+	// 用户未指定输出文件时，优先使用Content-Disposition中的文件名
+	if cd.config.ContentDisposition && cd.config.OutputFile == "" && cd.config.OutputDocument == "" {
+		if name := cd.client.GetFileNameFromContentDisposition(fileInfo.ContentDisposition); name != "" {
+			if outputPath != "" {
+				name = filepath.Join(filepath.Dir(outputPath), name)
+			}
+			fmt.Fprintf(cd.out, "根据Content-Disposition保存为: %s\n", name)
+			return name
+		}
+	}
+
+	// 重定向后按最终URL命名，如/latest重定向到/app-1.2.3.dmg时保存为app-1.2.3.dmg
+	if cd.config.TrustServerNames && cd.config.OutputFile == "" && cd.config.OutputDocument == "" &&
+		fileInfo.FinalURL != "" && fileInfo.FinalURL != url {
+		name := cd.client.GetFileNameFromURL(fileInfo.FinalURL)
+		if outputPath != "" {
+			name = filepath.Join(filepath.Dir(outputPath), name)
+		}
+		name = cd.adjustExtension(name, fileInfo)
+		if name != outputPath {
+			fmt.Fprintf(cd.out, "根据重定向后的URL保存为: %s\n", name)
+		}
+		return name
+	}
+
 	if outputPath != "" {
-		return outputPath
+		return cd.adjustExtension(outputPath, fileInfo)
 	}
 
 	if cd.config.OutputFile != "" {
@@ -140,7 +329,15 @@ func (cd *ChunkDownloader) getOutputPath(outputPath, url string, fileInfo *types
 
 	// 从URL提取文件名
 	filename := cd.client.GetFileNameFromURL(url)
-	return filename
+	return cd.adjustExtension(filename, fileInfo)
+}
+
+// adjustExtension 启用-E且用户未用-o/-O指定文件名时，按Content-Type追加缺少的扩展名
+func (cd *ChunkDownloader) adjustExtension(filename string, fileInfo *types.HTTPResponse) string {
+	if !cd.config.AdjustExtension || cd.config.OutputFile != "" || cd.config.OutputDocument != "" {
+		return filename
+	}
+	return utils.AdjustExtension(filename, fileInfo.ContentType)
 }
 
 // shouldUseChunks 判断是否需要分片下载
@@ -149,32 +346,38 @@ func (cd *ChunkDownloader) shouldUseChunks(fileInfo *types.HTTPResponse) bool {
 	// 1. 配置了chunk size
 	// 2. 文件大小大于chunk size
 	// 3. 服务器支持范围请求
+	// 4. 不是HTTP/1.0服务器（通常忽略Range并对每个分片返回完整内容）
 	return cd.config.ChunkSize > 0 &&
 		fileInfo.ContentLength > cd.config.ChunkSize &&
-		fileInfo.AcceptRanges
+		fileInfo.AcceptRanges &&
+		!fileInfo.IsHTTP10()
 }
 
-// downloadWithChunks 使用分片下载
-func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPath string, fileInfo *types.HTTPResponse) error {
-	// 计算分片数量
-	numChunks := calculateNumChunks(fileInfo.ContentLength, cd.config.ChunkSize)
-	
-	// 限制最大线程数
-	if numChunks > cd.config.MaxThreads {
-		numChunks = cd.config.MaxThreads
+// downloadWithChunks 使用分片下载，urls为同一文件的一个或多个镜像
+// 断点续传时如果远程文件已改变，丢弃已下载的数据重新下载
+func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, urls []string, outputPath string, fileInfo *types.HTTPResponse) error {
+	err := cd.downloadChunked(ctx, urls, outputPath, fileInfo, cd.config.Continue)
+	if cd.config.Continue && errors.Is(err, httpCore.ErrRemoteFileChanged) {
+		fmt.Fprintln(cd.out, "远程文件已改变，丢弃已下载的数据并重新下载")
+		return cd.downloadChunked(ctx, urls, outputPath, fileInfo, false)
 	}
+	return err
+}
 
-	// 计算每个分片的大小
-	chunkSize := fileInfo.ContentLength / int64(numChunks)
-	lastChunkSize := fileInfo.ContentLength - chunkSize*(int64(numChunks)-1)
+// planChunks 按chunk size划分分片，max threads只限制同时下载的分片数
+func (cd *ChunkDownloader) planChunks(contentLength int64) []*types.Chunk {
+	chunkSize := cd.config.ChunkSize
+	numChunks := calculateNumChunks(contentLength, chunkSize)
+	lastChunkSize := contentLength - chunkSize*(int64(numChunks)-1)
 
 	// 打印分片计划（仅在详细模式下显示）
 	if cd.config != nil && cd.config.Verbose {
-		fmt.Printf("分片下载计划:\n")
-		fmt.Printf("  文件总大小: %d 字节\n", fileInfo.ContentLength)
-		fmt.Printf("  分片数量: %d\n", numChunks)
-		fmt.Printf("  分片大小: %d 字节\n", chunkSize)
-		fmt.Printf("  最后一个分片大小: %d 字节\n", lastChunkSize)
+		fmt.Fprintf(cd.out, "分片下载计划:\n")
+		fmt.Fprintf(cd.out, "  文件总大小: %d 字节\n", contentLength)
+		fmt.Fprintf(cd.out, "  分片数量: %d\n", numChunks)
+		fmt.Fprintf(cd.out, "  分片大小: %d 字节\n", chunkSize)
+		fmt.Fprintf(cd.out, "  最后一个分片大小: %d 字节\n", lastChunkSize)
+		fmt.Fprintf(cd.out, "  并发数: %d\n", ThreadCount(cd.config, contentLength))
 	}
 
 	// 创建分片任务
@@ -195,26 +398,45 @@ func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPa
 			Status:   types.TaskPending,
 		}
 		if cd.config != nil && cd.config.Verbose {
-			fmt.Printf("  分片 %d: 字节范围 %d-%d (大小: %d)\n", i, start, end, end-start+1)
+			fmt.Fprintf(cd.out, "  分片 %d: 字节范围 %d-%d (大小: %d)\n", i, start, end, end-start+1)
 		}
 	}
+	return chunks
+}
 
-	// 临时文件路径
-	tempPath := outputPath + ".tmp"
+// downloadChunked 执行分片下载，resume为true时从状态文件恢复进度
+func (cd *ChunkDownloader) downloadChunked(ctx context.Context, urls []string, outputPath string, fileInfo *types.HTTPResponse, resume bool) error {
+	chunks := cd.planChunks(fileInfo.ContentLength)
+
+	// 临时文件路径，状态文件与临时文件在同一位置
+	tempPath := cd.tempPath(outputPath)
+	if err := os.MkdirAll(filepath.Dir(tempPath), 0755); err != nil {
+		return fmt.Errorf("创建临时目录失败: %w", err)
+	}
 	var tempFile *os.File
 	var err error
 
 	// 检查是否需要断点续传
-	if cd.config.Continue && utils.FileExists(tempPath) {
+	if resume && utils.FileExists(tempPath) {
 		// 尝试加载状态
-		stateLoaded, err := loadDownloadState(outputPath, chunks)
+		state, err := loadDownloadState(tempPath, chunks)
 		if err != nil {
 			return fmt.Errorf("加载下载状态失败: %w", err)
 		}
+
+		if state != nil && state.changedSince(fileInfo) {
+			// 远程文件的ETag或Last-Modified与上次下载时不同，已下载的数据不可用
+			fmt.Fprintln(cd.out, "远程文件已改变，丢弃已下载的数据并重新下载")
+			for _, chunk := range chunks {
+				chunk.Completed = 0
+				chunk.Status = types.TaskPending
+			}
+			state = nil
+		}
 		
-		if stateLoaded {
-			// 状态加载成功，以追加模式打开临时文件
-			tempFile, err = os.OpenFile(tempPath, os.O_WRONLY|os.O_APPEND, 0644)
+		if state != nil {
+			// 状态加载成功，打开临时文件（分片使用WriteAt写入，不能使用追加模式）
+			tempFile, err = os.OpenFile(tempPath, os.O_WRONLY, 0644)
 			if err != nil {
 				return fmt.Errorf("打开临时文件失败: %w", err)
 			}
@@ -232,18 +454,19 @@ func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPa
 				expectedSize += chunk.Completed
 			}
 			
-			if actualSize != expectedSize {
+			// 使用--preallocate时临时文件始终为完整大小
+			if actualSize != expectedSize && actualSize != fileInfo.ContentLength {
 				// 文件大小不匹配，可能需要重新下载
 				// 这里我们选择继续下载，但记录警告
 				if cd.config != nil && cd.config.Verbose {
-					fmt.Printf("警告: 临时文件大小与状态不匹配: 文件 %d 字节, 状态 %d 字节\n", actualSize, expectedSize)
+					fmt.Fprintf(cd.out, "警告: 临时文件大小与状态不匹配: 文件 %d 字节, 状态 %d 字节\n", actualSize, expectedSize)
 				}
 			}
 		} else {
 			// 没有状态文件，但临时文件存在，可能需要重新下载
 			// 删除临时文件重新开始
 			os.Remove(tempPath)
-			deleteStateFile(outputPath)
+			deleteStateFile(tempPath)
 			tempFile, err = os.Create(tempPath)
 			if err != nil {
 				return fmt.Errorf("创建临时文件失败: %w", err)
@@ -252,7 +475,7 @@ func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPa
 	} else {
 		// 不是断点续传或临时文件不存在，创建新文件
 		// 确保删除可能存在的旧状态文件
-		deleteStateFile(outputPath)
+		deleteStateFile(tempPath)
 		tempFile, err = os.Create(tempPath)
 		if err != nil {
 			return fmt.Errorf("创建临时文件失败: %w", err)
@@ -260,8 +483,15 @@ func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPa
 	}
 	defer tempFile.Close()
 
+	// 预先分配全部空间，磁盘空间不足时在开始下载前报错
+	if cd.config.Preallocate {
+		if err := utils.Preallocate(tempFile, fileInfo.ContentLength); err != nil {
+			return fmt.Errorf("预分配磁盘空间失败: %w", err)
+		}
+	}
+
 	// 启动下载
-	err = cd.downloadChunks(ctx, url, tempFile, chunks, outputPath)
+	err = cd.downloadChunks(ctx, urls, tempFile, chunks, tempPath, fileInfo)
 	if err != nil {
 		return err
 	}
@@ -280,78 +510,118 @@ func (cd *ChunkDownloader) downloadWithChunks(ctx context.Context, url, outputPa
 	}
 	
 	// 删除状态文件
-	deleteStateFile(outputPath)
+	deleteStateFile(tempPath)
 	
-	// 重命名临时文件为最终文件
-	if err := os.Rename(tempPath, outputPath); err != nil {
+	// 重命名临时文件为最终文件，临时目录在其他设备上时复制后删除
+	tempFile.Close()
+	if err := utils.MoveFile(tempPath, outputPath); err != nil {
 		return fmt.Errorf("重命名文件失败: %w", err)
 	}
+	cd.setServerTimestamp(outputPath, fileInfo.LastModified)
 	
 	if cd.config != nil && cd.config.Verbose {
-		fmt.Printf("文件验证通过: %d 字节\n", actualSize)
+		fmt.Fprintf(cd.out, "文件验证通过: %d 字节\n", actualSize)
 	}
 	return nil
 }
 
-// downloadChunks 下载所有分片
-func (cd *ChunkDownloader) downloadChunks(ctx context.Context, url string, file *os.File, chunks []*types.Chunk, outputPath string) error {
+// downloadChunks 下载所有分片，多个镜像时分片轮流分配到各镜像
+// 同时下载的分片数不超过max threads，某个分片失败后不再开始新的分片
+// tempPath为空时（写入调用方的WriterAt）不保存断点续传状态
+func (cd *ChunkDownloader) downloadChunks(ctx context.Context, urls []string, file io.WriterAt, chunks []*types.Chunk, tempPath string, fileInfo *types.HTTPResponse) error {
+	// 单一来源时使用If-Range，文件在下载期间改变时服务器返回完整内容而不是错误的片段
+	// 多个镜像的ETag各不相同，不能使用
+	var ifRange string
+	if len(urls) == 1 {
+		ifRange = httpCore.IfRangeValidator(fileInfo)
+	}
+
 	var wg sync.WaitGroup
-	semaphore := make(chan struct{}, cd.config.MaxThreads)
+	semaphore := make(chan struct{}, ThreadCount(cd.config, fileInfo.ContentLength))
 	
 	var mu sync.Mutex
-	totalDownloaded := int64(0)
+	var firstErr error
 	startTime := time.Now()
+	lastSave := startTime
 
-	// 启动进度报告
-	go cd.reportProgress(ctx, len(chunks), chunks, &mu, startTime)
+	// 启动进度报告，所有分片结束后停止，DownloadTo返回后不再发送进度
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	defer cancelProgress()
+	go cd.reportProgress(progressCtx, len(chunks), chunks, &mu, startTime)
 
 	// 下载每个分片
+dispatch:
 	for _, chunk := range chunks {
+		if chunk.Status == types.TaskCompleted {
+			continue
+		}
+
+		// 获取信号量后再启动协程，避免分片很多时创建大量等待的协程
+		select {
+		case semaphore <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+
+		mu.Lock()
+		failed := firstErr != nil
+		mu.Unlock()
+		if failed {
+			<-semaphore
+			break
+		}
+
 		wg.Add(1)
-		
 		go func(chunk *types.Chunk) {
 			defer wg.Done()
-			
-			// 获取信号量
-			semaphore <- struct{}{}
 			defer func() { <-semaphore }()
 			
 			// 记录分片开始下载（仅在详细模式下显示）
 			if cd.config != nil && cd.config.Verbose {
 				mu.Lock()
-				fmt.Printf("分片 %d 开始下载: 字节范围 %d-%d (大小: %d)\n", 
+				fmt.Fprintf(cd.out, "分片 %d 开始下载: 字节范围 %d-%d (大小: %d)\n", 
 					chunk.Index, chunk.Start, chunk.End, chunk.Size)
 				mu.Unlock()
 			}
 			
 			// 下载分片
-			if err := cd.downloadChunk(ctx, url, file, chunk); err != nil {
-				cd.errorCh <- fmt.Errorf("分片 %d 下载失败: %w", chunk.Index, err)
+			if err := cd.downloadChunkWithRetry(ctx, urls, file, chunk, ifRange); err != nil {
+				err = fmt.Errorf("分片 %d 下载失败: %w", chunk.Index, err)
+
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
 				chunk.Status = types.TaskFailed
 				chunk.Error = err
-				
 				if cd.config != nil && cd.config.Verbose {
-					mu.Lock()
-					fmt.Printf("分片 %d 下载失败: %v\n", chunk.Index, err)
-					mu.Unlock()
+					fmt.Fprintf(cd.out, "%v\n", err)
+				}
+				mu.Unlock()
+
+				// 没有消费者时不阻塞
+				select {
+				case cd.errorCh <- err:
+				default:
 				}
 				return
 			}
 			
 			// 更新统计并保存状态
 			mu.Lock()
-			// 使用实际完成的字节数（chunk.Completed）而不是预期大小（chunk.Size）
-			totalDownloaded += chunk.Completed
 			chunk.Status = types.TaskCompleted
 			if cd.config != nil && cd.config.Verbose {
-				fmt.Printf("分片 %d 下载完成: 已下载 %d 字节 (总计: %d/%d)\n", 
-					chunk.Index, chunk.Completed, totalDownloaded, calculateTotalSize(chunks))
+				fmt.Fprintf(cd.out, "分片 %d 下载完成: 已下载 %d 字节 (总计: %d/%d)\n", 
+					chunk.Index, chunk.Completed, calculateDownloaded(chunks), calculateTotalSize(chunks))
 			}
-			// 保存状态
-			if err := saveDownloadState(outputPath, chunks); err != nil {
-				// 状态保存失败不影响下载，只记录警告
-				if cd.config != nil && cd.config.Verbose {
-					fmt.Printf("警告: 保存分片 %d 状态失败: %v\n", chunk.Index, err)
+			// 分片很多时限制状态文件的写入频率
+			if tempPath != "" && time.Since(lastSave) >= time.Second {
+				lastSave = time.Now()
+				if err := saveDownloadState(tempPath, fileInfo, chunks); err != nil {
+					// 状态保存失败不影响下载，只记录警告
+					if cd.config != nil && cd.config.Verbose {
+						fmt.Fprintf(cd.out, "警告: 保存分片 %d 状态失败: %v\n", chunk.Index, err)
+					}
 				}
 			}
 			mu.Unlock()
@@ -360,28 +630,21 @@ func (cd *ChunkDownloader) downloadChunks(ctx context.Context, url string, file
 
 	// 等待所有分片完成
 	wg.Wait()
-	
-	// 检查是否有错误
-	var firstError error
-	// 读取所有错误
-	for len(cd.errorCh) > 0 {
-		select {
-		case err := <-cd.errorCh:
-			if firstError == nil {
-				firstError = err
-			}
-		default:
-			break
-		}
+
+	if firstErr == nil {
+		firstErr = ctx.Err()
 	}
-	if firstError != nil {
-		return firstError
+	if firstErr != nil && tempPath != "" {
+		// 保存最终状态以便断点续传
+		if err := saveDownloadState(tempPath, fileInfo, chunks); err != nil && cd.config != nil && cd.config.Verbose {
+			fmt.Fprintf(cd.out, "警告: 保存下载状态失败: %v\n", err)
+		}
 	}
-	return nil
+	return firstErr
 }
 
-// downloadChunk 下载单个分片
-func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file *os.File, chunk *types.Chunk) error {
+// downloadChunk 下载单个分片，ifRange非空时作为If-Range条件发送
+func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file io.WriterAt, chunk *types.Chunk, ifRange string) error {
 	// 如果分片已经完成，直接返回
 	if chunk.Status == types.TaskCompleted {
 		return nil
@@ -398,7 +661,7 @@ func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file *
 	}
 	
 	// 下载数据
-	reader, contentLength, err := cd.client.DownloadRange(ctx, url, start, end)
+	reader, contentLength, err := cd.client.DownloadRangeIf(ctx, url, start, end, ifRange)
 	if err != nil {
 		return err
 	}
@@ -407,7 +670,7 @@ func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file *
 	// 验证内容长度
 	expectedSize := end - start + 1
 	if contentLength != expectedSize {
-		return fmt.Errorf("分片大小不匹配: 期望 %d, 实际 %d", expectedSize, contentLength)
+		return &chunkSizeError{Expected: expectedSize, Actual: contentLength}
 	}
 
 	// 使用WriteAt在指定偏移量处写入，避免并发Seek导致的文件指针竞争
@@ -417,13 +680,14 @@ func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file *
 		chunk:  chunk,
 	}
 	
-	if _, err := io.Copy(writer, reader); err != nil {
+	if _, err := io.Copy(writer, cd.limiterFor(url).Reader(ctx, cd.countReceived(reader))); err != nil {
 		return fmt.Errorf("写入文件失败: %w", err)
 	}
 
-	// 验证实际写入的字节数
+	// 验证实际写入的字节数，不符时本次写入的数据不可信，重新下载时从本次的起始位置开始
 	if writer.written != expectedSize {
-		return fmt.Errorf("分片写入大小不匹配: 期望 %d, 实际写入 %d", expectedSize, writer.written)
+		atomic.AddInt64(&chunk.Completed, -writer.written)
+		return &chunkSizeError{Expected: expectedSize, Actual: writer.written, Written: true}
 	}
 
 	// 更新分片状态
@@ -431,9 +695,97 @@ func (cd *ChunkDownloader) downloadChunk(ctx context.Context, url string, file *
 	return nil
 }
 
+// chunkSizeError 分片响应的大小与请求的范围不符
+type chunkSizeError struct {
+	Expected int64
+	Actual   int64
+	Written  bool // 为true时为实际写入的字节数不符，否则为响应的Content-Length不符
+}
+
+func (e *chunkSizeError) Error() string {
+	if e.Written {
+		return fmt.Sprintf("分片写入大小不匹配: 期望 %d, 实际写入 %d", e.Expected, e.Actual)
+	}
+	return fmt.Sprintf("分片大小不匹配: 期望 %d, 实际 %d", e.Expected, e.Actual)
+}
+
+// isTruncatedChunk 检查错误是否为分片大小不符或响应体在Content-Length之前结束
+func isTruncatedChunk(err error) bool {
+	var sizeErr *chunkSizeError
+	return errors.As(err, &sizeErr) || errors.Is(err, io.ErrUnexpectedEOF)
+}
+
+// downloadChunkWithRetry 下载分片，设置了--wait-retry时传输中途断开的分片等待后从已完成的位置继续；
+// 分片大小不符或响应被截断时立即重新下载，最多尝试--tries次
+// 请求阶段的暂时性错误已由客户端重试，这里只处理响应的错误
+func (cd *ChunkDownloader) downloadChunkWithRetry(ctx context.Context, urls []string, file io.WriterAt, chunk *types.Chunk, ifRange string) error {
+	var waited time.Duration
+	tries := 1
+	for attempt := 0; ; attempt++ {
+		err := cd.downloadChunkFromMirrors(ctx, urls, file, chunk, ifRange)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+
+		wait, ok := time.Duration(0), false
+		if isInterruptedTransfer(err) {
+			wait, ok = cd.client.RetryDelay(attempt, waited)
+		}
+		if !ok {
+			if !isTruncatedChunk(err) || tries >= cd.config.Tries {
+				return err
+			}
+			tries++
+			if cd.config.Verbose {
+				fmt.Fprintf(cd.out, "分片 %d 不完整: %v，从第 %d 字节重新下载（第 %d/%d 次尝试）\n", chunk.Index, err, chunk.Start+atomic.LoadInt64(&chunk.Completed), tries, cd.config.Tries)
+			}
+			continue
+		}
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "分片 %d 传输中断: %v，%v 后从第 %d 字节继续\n", chunk.Index, err, wait, chunk.Start+atomic.LoadInt64(&chunk.Completed))
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		waited += wait
+	}
+}
+
+// isInterruptedTransfer 检查错误是否为读取响应体时的暂时性错误（连接断开、读取超时）
+func isInterruptedTransfer(err error) bool {
+	var reqErr *httpCore.RequestError
+	return errors.As(err, &reqErr) && reqErr.Phase == httpCore.PhaseBody && httpCore.IsRetryable(err)
+}
+
+// downloadChunkFromMirrors 从镜像下载分片，某个镜像失败时从已完成的位置切换到下一个镜像继续
+func (cd *ChunkDownloader) downloadChunkFromMirrors(ctx context.Context, urls []string, file io.WriterAt, chunk *types.Chunk, ifRange string) error {
+	var lastErr error
+	for i := 0; i < len(urls); i++ {
+		url := urls[(chunk.Index+i)%len(urls)]
+		err := cd.downloadChunk(ctx, url, file, chunk, ifRange)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil || errors.Is(err, httpCore.ErrRemoteFileChanged) {
+			return err
+		}
+
+		lastErr = err
+		if len(urls) > 1 && cd.config != nil && cd.config.Verbose {
+			fmt.Fprintf(cd.out, "分片 %d 从镜像 %s 下载失败: %v，尝试下一个镜像\n", chunk.Index, url, err)
+		}
+	}
+	return lastErr
+}
+
 // writeAtWriter 使用WriteAt在指定偏移量处写入，支持并发写入
 type writeAtWriter struct {
-	file   *os.File
+	file   io.WriterAt
 	offset int64
 	chunk  *types.Chunk
 	written int64 // 实际写入的字节数
@@ -463,10 +815,60 @@ func (w *chunkTrackingWriter) Write(p []byte) (int, error) {
 	return n, err
 }
 
-// downloadSingle 单线程下载
-func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath string) error {
+// receivedReader 统计从网络接收的字节数（解压之前）
+type receivedReader struct {
+	reader   io.Reader
+	received *atomic.Int64
+}
+
+func (r *receivedReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	r.received.Add(int64(n))
+	return n, err
+}
+
+// countReceived 包装响应体，读取的字节计入汇总
+func (cd *ChunkDownloader) countReceived(r io.Reader) io.Reader {
+	return &receivedReader{reader: r, received: &cd.received}
+}
+
+// 空内容重试的初始等待时间，之后每次加倍
+const emptyRetryBackoff = 500 * time.Millisecond
+
+// downloadSingleChecked 单线程下载；设置了--retry-on-empty且服务器声明文件非空时，
+// 成功的响应却没有内容视为服务器暂时错误，等待后重试
+func (cd *ChunkDownloader) downloadSingleChecked(ctx context.Context, url, outputPath string, expectedSize int64) error {
+	for attempt := 0; ; attempt++ {
+		if err := cd.downloadSingle(ctx, url, outputPath, expectedSize); err != nil {
+			return err
+		}
+		if cd.config.RetryOnEmpty <= 0 || expectedSize <= 0 {
+			return nil
+		}
+		if info, err := os.Stat(outputPath); err != nil || !info.Mode().IsRegular() || info.Size() > 0 {
+			return nil
+		}
+
+		if attempt >= cd.config.RetryOnEmpty {
+			os.Remove(outputPath)
+			return fmt.Errorf("服务器返回空内容（期望 %d 字节），已重试 %d 次", expectedSize, attempt)
+		}
+		wait := emptyRetryBackoff << attempt
+		fmt.Fprintf(cd.out, "服务器返回空内容（期望 %d 字节），%v 后重试 (%d/%d)\n", expectedSize, wait, attempt+1, cd.config.RetryOnEmpty)
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// downloadSingle 单线程下载，totalSize为HEAD获取的远程文件大小（未知时为-1）
+func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath string, totalSize int64) error {
 	var rangeHeader string
-	var file *os.File
 	var err error
 	var fileSize int64
 	
@@ -477,6 +879,19 @@ func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath s
 		if err != nil {
 			return fmt.Errorf("获取文件大小失败: %w", err)
 		}
+
+		// 已知远程文件大小时先与本地文件比较，避免发送无效的范围请求
+		switch {
+		case totalSize < 0 || fileSize == 0:
+		case fileSize == totalSize:
+			fmt.Fprintf(cd.out, "文件已完整下载，跳过: %s\n", outputPath)
+			cd.notModified = true
+			return nil
+		case fileSize > totalSize:
+			// 远程文件变小了，本地内容不能作为其前缀续传
+			fmt.Fprintf(cd.out, "本地文件 (%d 字节) 大于远程文件 (%d 字节)，重新下载: %s\n", fileSize, totalSize, outputPath)
+			fileSize = 0
+		}
 		
 		if fileSize > 0 {
 			// 设置Range头，从断点处继续下载
@@ -503,15 +918,69 @@ func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath s
 			rangeHeader = ""
 		} else {
 			// 其他错误状态码
-			return fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+			return &httpCore.HTTPError{StatusCode: resp.StatusCode}
 		}
 	} else {
 		// 没有发送Range头，期望200 OK
 		if resp.StatusCode != http.StatusOK {
-			return fmt.Errorf("HTTP错误: %d", resp.StatusCode)
+			return &httpCore.HTTPError{StatusCode: resp.StatusCode}
 		}
 	}
 	
+	return cd.saveResponse(ctx, resp, outputPath, fileSize)
+}
+
+// downloadPost 发送--post-data或--post-file指定的POST请求并保存响应
+func (cd *ChunkDownloader) downloadPost(ctx context.Context, url, outputPath string) (string, error) {
+	body := []byte(cd.config.PostData)
+	if cd.config.PostFile != "" {
+		data, err := os.ReadFile(cd.config.PostFile)
+		if err != nil {
+			return "", fmt.Errorf("读取POST文件失败: %w", err)
+		}
+		body = data
+	}
+
+	if cd.config.Verbose {
+		fmt.Fprintf(cd.out, "使用POST请求下载（%d 字节），不使用分片下载\n", len(body))
+	}
+	resp, err := cd.client.Post(ctx, url, body)
+	if err != nil {
+		return "", fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", &httpCore.HTTPError{StatusCode: resp.StatusCode}
+	}
+
+	fileInfo := &types.HTTPResponse{
+		StatusCode:         resp.StatusCode,
+		ContentLength:      resp.ContentLength,
+		ContentDisposition: resp.Header.Get("Content-Disposition"),
+		Digest:             resp.Header.Get("Digest"),
+		FinalURL:           resp.Request.URL.String(),
+	}
+	if err := cd.checkExpectedSize(fileInfo); err != nil {
+		return "", err
+	}
+
+	finalOutputPath := cd.getOutputPath(outputPath, url, fileInfo)
+	return finalOutputPath, cd.saveResponse(ctx, resp, finalOutputPath, 0)
+}
+
+// saveResponse 将响应体保存到文件，offset大于0时追加到已有内容之后
+func (cd *ChunkDownloader) saveResponse(ctx context.Context, resp *http.Response, outputPath string, offset int64) error {
+	var file *os.File
+	var err error
+	fileSize := offset
+
+	// 在创建文件前检查编码，不支持的编码不写入任何内容
+	encodings, err := httpCore.ParseContentEncodings(resp.Header)
+	if err != nil {
+		return err
+	}
+
 	// 打开或创建文件
 	if fileSize > 0 {
 		// 断点续传：以追加模式打开文件
@@ -527,44 +996,92 @@ func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath s
 		}
 	}
 	defer file.Close()
-	
-	// 处理可能的压缩内容
-	bodyReader := resp.Body
-	contentEncoding := resp.Header.Get("Content-Encoding")
-	isCompressed := false
-	
-	// 根据Content-Encoding进行解压
-	switch strings.ToLower(contentEncoding) {
-	case "gzip", "x-gzip":
-		gzipReader, err := gzip.NewReader(bodyReader)
-		if err != nil {
-			return fmt.Errorf("创建gzip解压器失败: %w", err)
+
+	// 从头写入整个文件时在写入的同时计算哈希，校验和清单不必再读取一遍文件
+	var w io.Writer = file
+	var hasher *utils.MultiHasher
+	if fileSize == 0 {
+		if algorithms := cd.streamDigestAlgorithms(); len(algorithms) > 0 {
+			if hasher, err = utils.NewMultiHasher(algorithms...); err != nil {
+				return err
+			}
+			w = io.MultiWriter(file, hasher)
 		}
-		defer gzipReader.Close()
-		bodyReader = gzipReader
-		isCompressed = true
-	case "deflate":
-		zlibReader, err := zlib.NewReader(bodyReader)
-		if err != nil {
-			return fmt.Errorf("创建zlib解压器失败: %w", err)
+	}
+
+	if _, err := cd.copyResponse(ctx, resp, w, encodings, fileSize); err != nil {
+		// 超出大小上限的文件不保留
+		if errors.Is(err, utils.ErrFileTooLarge) {
+			file.Close()
+			os.Remove(outputPath)
 		}
-		defer zlibReader.Close()
-		bodyReader = zlibReader
-		isCompressed = true
-	case "identity", "":
-		// 无压缩，使用原始body
-	default:
-		// 未知编码，但继续下载，可能服务器使用了我们不支持的压缩算法
-		// 记录警告但继续
-		if cd.config != nil && cd.config.Verbose {
-			fmt.Printf("警告: 未知的Content-Encoding: %s，按原始数据下载\n", contentEncoding)
+		return err
+	}
+	if hasher != nil {
+		cd.digests = hasher.Sums()
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		cd.setServerTimestamp(outputPath, lastModified)
+	}
+	return nil
+}
+
+// copyResponse 解码响应体并写入w，返回写入的字节数
+// offset为断点续传时已有的字节数，只用于计算进度
+func (cd *ChunkDownloader) copyResponse(ctx context.Context, resp *http.Response, w io.Writer, encodings []string, offset int64) (int64, error) {
+	fileSize := offset
+
+	// 已知总大小时报告单线程下载进度（按原始响应字节计算）
+	if resp.ContentLength > 0 {
+		progress := &types.Chunk{
+			Index:     0,
+			Start:     0,
+			End:       fileSize + resp.ContentLength - 1,
+			Size:      fileSize + resp.ContentLength,
+			Completed: fileSize,
+			Status:    types.TaskDownloading,
 		}
+		resp.Body = io.NopCloser(io.TeeReader(resp.Body, &chunkTrackingWriter{writer: io.Discard, chunk: progress}))
+
+		progressCtx, cancelProgress := context.WithCancel(ctx)
+		defer cancelProgress()
+		var mu sync.Mutex
+		go cd.reportProgress(progressCtx, 1, []*types.Chunk{progress}, &mu, time.Now())
+	}
+
+	// 处理可能的压缩内容，多个编码按相反顺序解码
+	bodyReader, err := httpCore.NewContentDecoder(cd.limiterFor(initialURL(resp)).Reader(ctx, cd.countReceived(resp.Body)), encodings)
+	if err != nil {
+		return 0, err
+	}
+	defer bodyReader.Close()
+	isCompressed := len(encodings) > 0
+
+	// 服务器未声明大小或内容经过压缩时，在传输中检查文件大小上限
+	var reader io.Reader = bodyReader
+	if cd.config.MaxFileSize > 0 {
+		reader = utils.NewMaxSizeReader(bodyReader, cd.config.MaxFileSize-offset)
 	}
 	
 	// 复制数据
-	copied, err := io.Copy(file, bodyReader)
+	copied, err := io.Copy(w, reader)
+	if errors.Is(err, utils.ErrFileTooLarge) {
+		return copied, fmt.Errorf("%w: 已接收超过 %d 字节", err, cd.config.MaxFileSize)
+	}
 	if err != nil {
-		return fmt.Errorf("写入文件失败: %w", err)
+		return copied, fmt.Errorf("写入文件失败: %w", err)
+	}
+
+	// Digest可能在响应头或读完响应体后的trailer中；压缩传输时Digest针对压缩后的内容，无法校验
+	if cd.config.VerifyDigest {
+		if isCompressed {
+			cd.serverDigest = ""
+		} else if digest := resp.Trailer.Get("Digest"); digest != "" {
+			cd.serverDigest = digest
+		} else if digest := resp.Header.Get("Digest"); digest != "" {
+			cd.serverDigest = digest
+		}
 	}
 	
 	// 验证下载大小（如果知道内容长度）
@@ -573,60 +1090,123 @@ func (cd *ChunkDownloader) downloadSingle(ctx context.Context, url, outputPath s
 		// 只有当内容未压缩时才验证大小
 		// 如果服务器返回压缩内容，Content-Length是压缩后的大小，但解压后大小不同
 		if copied != contentLength {
-			return fmt.Errorf("下载大小不匹配: 期望 %d, 实际 %d", contentLength, copied)
+			return copied, fmt.Errorf("下载大小不匹配: 期望 %d, 实际 %d", contentLength, copied)
 		}
 	}
-	
-	return nil
+
+	// 服务器未声明大小时无法在传输前检查--expected-size，按实际接收的字节数检查
+	if cd.config.ExpectedSize > 0 && contentLength < 0 && offset+copied != cd.config.ExpectedSize {
+		return copied, fmt.Errorf("文件大小与期望不符: 期望 %d 字节, 实际接收 %d 字节", cd.config.ExpectedSize, offset+copied)
+	}
+	return copied, nil
+}
+
+// setServerTimestamp 将文件的修改时间设置为服务器的Last-Modified，之后的-N才能与远程文件正确比较
+// 设置了--no-use-server-timestamps、服务器没有返回Last-Modified或输出不是普通文件时不修改
+func (cd *ChunkDownloader) setServerTimestamp(outputPath string, lastModified time.Time) {
+	if cd.config.NoUseServerTimestamps || lastModified.IsZero() || !isRegularOutput(outputPath) {
+		return
+	}
+	if err := os.Chtimes(outputPath, time.Now(), lastModified); err != nil && cd.config.Verbose {
+		fmt.Fprintf(cd.out, "设置文件修改时间失败: %v\n", err)
+	}
+}
+
+// downloadIfModified 使用If-Modified-Since条件请求，远程文件比本地文件新时重新下载
+func (cd *ChunkDownloader) downloadIfModified(ctx context.Context, url, outputPath string, since time.Time) error {
+	resp, err := cd.client.GetIfModifiedSince(ctx, url, since)
+	if err != nil {
+		return fmt.Errorf("下载失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusNotModified:
+		// 304不应带有响应体，服务器即使发送了也忽略，保留本地文件
+		fmt.Fprintf(cd.out, "远程文件未修改，跳过下载: %s\n", outputPath)
+		cd.notModified = true
+		return nil
+	case http.StatusOK:
+		// 服务器可能忽略条件请求总是返回完整内容，此时按正常下载保存
+		return cd.saveResponse(ctx, resp, outputPath, 0)
+	default:
+		return &httpCore.HTTPError{StatusCode: resp.StatusCode}
+	}
 }
 
 // reportProgress 报告下载进度
 func (cd *ChunkDownloader) reportProgress(ctx context.Context, totalChunks int, chunks []*types.Chunk, mu *sync.Mutex, startTime time.Time) {
-	ticker := time.NewTicker(1 * time.Second)
+	interval := cd.config.ProgressInterval
+	if interval <= 0 {
+		interval = types.DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
 	defer ticker.Stop()
 
+	// 实时计算所有分片的已下载字节总和，Completed在写入每块数据时更新，未完成的分片也计入
+	sumCompleted := func() int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return calculateDownloaded(chunks)
+	}
+
+	// 速度按最近几秒的下载量计算，断点续传前已下载的部分不计入
+	window := utils.NewSpeedWindow(utils.DefaultSpeedWindow, startTime, sumCompleted())
+
 	for {
 		select {
 		case <-ctx.Done():
 			return
 		case <-cd.stopCh:
 			return
-		case <-ticker.C:
-			// 使用互斥锁保护对chunks的并发访问
-			mu.Lock()
-			
-			// 实时计算所有分片的已下载字节总和
-			var downloaded int64
-			var completedChunks int
-			for _, chunk := range chunks {
-				downloaded += chunk.Completed
-				if chunk.Status == types.TaskCompleted {
-					completedChunks++
-				}
-			}
-			
-			mu.Unlock()
-			
-			elapsed := time.Since(startTime)
-			var speed int64
-			if elapsed.Seconds() > 0 {
-				speed = int64(float64(downloaded) / elapsed.Seconds())
+		case now := <-ticker.C:
+			downloaded := sumCompleted()
+			speed := window.Update(now, downloaded)
+			if cd.limiter != nil {
+				// 限速时显示限速器的当前实际速率
+				speed = cd.limiter.Rate()
 			}
 
-			// 发送进度信息
+			// 发送进度信息，没有消费者时丢弃
 			totalSize := calculateTotalSize(chunks)
-			cd.progressCh <- types.ProgressInfo{
+			select {
+			case cd.progressCh <- types.ProgressInfo{
 				TotalSize:     totalSize,
 				Downloaded:    downloaded,
 				Speed:         speed,
 				Percentage:    float64(downloaded) / float64(totalSize) * 100,
 				RemainingTime: utils.CalculateETA(totalSize, downloaded, speed),
-				ActiveThreads: cd.config.MaxThreads,
+				ActiveThreads: ThreadCount(cd.config, totalSize),
+			}:
+			default:
 			}
 		}
 	}
 }
 
+// isRegularOutput 检查输出路径是否为普通文件（不存在时将创建普通文件），
+// 管道、字符设备等特殊文件不能随机写入，也不能在下载后重新读取
+func isRegularOutput(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	return info.Mode().IsRegular()
+}
+
+// ThreadCount 计算下载一个文件同时使用的连接数，不超过分片数量
+// --max-threads=auto时上限为utils.AutoMaxThreads()，小文件只使用一个连接
+func ThreadCount(config *types.Config, contentLength int64) int {
+	threads := max(config.MaxThreads, 1)
+	if config.AutoThreads {
+		threads = utils.AutoMaxThreads()
+	}
+	if contentLength > 0 {
+		threads = min(threads, calculateNumChunks(contentLength, config.ChunkSize))
+	}
+	return threads
+}
+
 // calculateNumChunks 计算分片数量
 func calculateNumChunks(fileSize, chunkSize int64) int {
 	if chunkSize <= 0 {
@@ -662,6 +1242,15 @@ func calculateTotalSize(chunks []*types.Chunk) int64 {
 	return total
 }
 
+// calculateDownloaded 计算所有分片已下载的字节数，包括正在下载的分片已写入的部分
+func calculateDownloaded(chunks []*types.Chunk) int64 {
+	var downloaded int64
+	for _, chunk := range chunks {
+		downloaded += atomic.LoadInt64(&chunk.Completed)
+	}
+	return downloaded
+}
+
 // GetProgressChannel 获取进度通道
 func (cd *ChunkDownloader) GetProgressChannel() <-chan types.ProgressInfo {
 	return cd.progressCh
@@ -677,39 +1266,76 @@ func (cd *ChunkDownloader) Stop() {
 	close(cd.stopCh)
 }
 
-// createStateFileName 创建状态文件名
-func createStateFileName(outputPath string) string {
-	return outputPath + ".wget2go.state"
+// tempPath 返回分片下载的临时文件路径，设置了--temp-dir时放在该目录中
+// 临时目录中的文件名带有输出路径的哈希，不同目录下的同名文件不会冲突
+func (cd *ChunkDownloader) tempPath(outputPath string) string {
+	if cd.config == nil || cd.config.TempDir == "" {
+		return outputPath + ".tmp"
+	}
+	absPath, err := filepath.Abs(outputPath)
+	if err != nil {
+		absPath = outputPath
+	}
+	sum := sha256.Sum256([]byte(absPath))
+	return filepath.Join(cd.config.TempDir, filepath.Base(outputPath)+"."+hex.EncodeToString(sum[:4])+".tmp")
+}
+
+// createStateFileName 根据临时文件路径创建状态文件名，
+// 没有--temp-dir时为输出文件旁的FILE.wget2go.state
+func createStateFileName(tempPath string) string {
+	return strings.TrimSuffix(tempPath, ".tmp") + ".wget2go.state"
+}
+
+// chunkState 状态文件中单个分片的进度
+type chunkState struct {
+	Index     int   `json:"index"`
+	Start     int64 `json:"start"`
+	End       int64 `json:"end"`
+	Size      int64 `json:"size"`
+	Completed int64 `json:"completed"`
+	Status    int   `json:"status"`
+}
+
+// downloadState 状态文件内容，记录开始下载时远程文件的ETag和Last-Modified，
+// 用于断点续传时检测文件是否已改变
+type downloadState struct {
+	ETag         string       `json:"etag,omitempty"`
+	LastModified string       `json:"last_modified,omitempty"`
+	Chunks       []chunkState `json:"chunks"`
+}
+
+// changedSince 检查远程文件是否与状态文件记录的不同
+func (s *downloadState) changedSince(fileInfo *types.HTTPResponse) bool {
+	if s.ETag != "" && fileInfo.ETag != "" {
+		return s.ETag != fileInfo.ETag
+	}
+	if s.LastModified != "" && !fileInfo.LastModified.IsZero() {
+		return s.LastModified != fileInfo.LastModified.UTC().Format(http.TimeFormat)
+	}
+	return false
 }
 
 // saveDownloadState 保存下载状态
-func saveDownloadState(outputPath string, chunks []*types.Chunk) error {
-	stateFile := createStateFileName(outputPath)
+func saveDownloadState(tempPath string, fileInfo *types.HTTPResponse, chunks []*types.Chunk) error {
+	stateFile := createStateFileName(tempPath)
 	
-	// 创建状态数据结构
-	type ChunkState struct {
-		Index    int   `json:"index"`
-		Start    int64 `json:"start"`
-		End      int64 `json:"end"`
-		Size     int64 `json:"size"`
-		Completed int64 `json:"completed"`
-		Status   int   `json:"status"`
+	state := downloadState{ETag: fileInfo.ETag}
+	if !fileInfo.LastModified.IsZero() {
+		state.LastModified = fileInfo.LastModified.UTC().Format(http.TimeFormat)
 	}
-	
-	var states []ChunkState
 	for _, chunk := range chunks {
-		states = append(states, ChunkState{
+		state.Chunks = append(state.Chunks, chunkState{
 			Index:     chunk.Index,
 			Start:     chunk.Start,
 			End:       chunk.End,
 			Size:      chunk.Size,
-			Completed: chunk.Completed,
+			Completed: atomic.LoadInt64(&chunk.Completed), // 下载中途保存时其他分片可能仍在写入
 			Status:    int(chunk.Status),
 		})
 	}
 	
 	// 序列化为JSON
-	data, err := json.MarshalIndent(states, "", "  ")
+	data, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -717,47 +1343,40 @@ func saveDownloadState(outputPath string, chunks []*types.Chunk) error {
 	return os.WriteFile(stateFile, data, 0644)
 }
 
-// loadDownloadState 加载下载状态
-func loadDownloadState(outputPath string, chunks []*types.Chunk) (bool, error) {
-	stateFile := createStateFileName(outputPath)
+// loadDownloadState 加载下载状态并恢复到chunks，状态文件不存在时返回nil
+func loadDownloadState(tempPath string, chunks []*types.Chunk) (*downloadState, error) {
+	stateFile := createStateFileName(tempPath)
 	
 	if !utils.FileExists(stateFile) {
-		return false, nil
+		return nil, nil
 	}
 	
 	data, err := os.ReadFile(stateFile)
 	if err != nil {
-		return false, err
-	}
-	
-	// 反序列化JSON
-	type ChunkState struct {
-		Index    int   `json:"index"`
-		Start    int64 `json:"start"`
-		End      int64 `json:"end"`
-		Size     int64 `json:"size"`
-		Completed int64 `json:"completed"`
-		Status   int   `json:"status"`
+		return nil, err
 	}
 	
-	var states []ChunkState
-	if err := json.Unmarshal(data, &states); err != nil {
-		return false, err
+	// 反序列化JSON，兼容只有分片数组的旧格式
+	var state downloadState
+	if err := json.Unmarshal(data, &state); err != nil {
+		if err := json.Unmarshal(data, &state.Chunks); err != nil {
+			return nil, err
+		}
 	}
 	
 	// 创建状态映射
-	stateMap := make(map[int]ChunkState)
-	for _, state := range states {
-		stateMap[state.Index] = state
+	stateMap := make(map[int]chunkState)
+	for _, cs := range state.Chunks {
+		stateMap[cs.Index] = cs
 	}
 	
 	// 恢复状态到chunks
 	for _, chunk := range chunks {
-		if state, exists := stateMap[chunk.Index]; exists {
+		if cs, exists := stateMap[chunk.Index]; exists {
 			// 验证分片范围是否匹配
-			if chunk.Start == state.Start && chunk.End == state.End {
-				chunk.Completed = state.Completed
-				chunk.Status = types.TaskStatus(state.Status)
+			if chunk.Start == cs.Start && chunk.End == cs.End {
+				chunk.Completed = cs.Completed
+				chunk.Status = types.TaskStatus(cs.Status)
 			} else {
 				// 分片范围不匹配，重置状态
 				chunk.Completed = 0
@@ -766,12 +1385,12 @@ func loadDownloadState(outputPath string, chunks []*types.Chunk) (bool, error) {
 		}
 	}
 	
-	return true, nil
+	return &state, nil
 }
 
 // deleteStateFile 删除状态文件
-func deleteStateFile(outputPath string) error {
-	stateFile := createStateFileName(outputPath)
+func deleteStateFile(tempPath string) error {
+	stateFile := createStateFileName(tempPath)
 	if utils.FileExists(stateFile) {
 		return os.Remove(stateFile)
 	}
@@ -780,12 +1399,6 @@ func deleteStateFile(outputPath string) error {
 
 // isRangeNotSupportedError 检查是否是服务器不支持范围请求的错误
 func isRangeNotSupportedError(err error) bool {
-	if err == nil {
-		return false
-	}
-	// 检查错误信息是否包含关键词
-	errStr := err.Error()
-	return strings.Contains(errStr, "服务器不支持范围请求") || 
-	       strings.Contains(errStr, "range not supported") ||
-	       strings.Contains(errStr, "不支持范围请求")
+	var rangeErr *httpCore.RangeNotSupportedError
+	return errors.As(err, &rangeErr)
 }
\ No newline at end of file
@@ -0,0 +1,115 @@
+package chunk
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/metalink"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// downloadMetalink 下载Metalink文档并从其中列出的镜像下载所有文件
+func (cd *ChunkDownloader) downloadMetalink(ctx context.Context, url, outputPath string) error {
+	resp, err := cd.client.Get(ctx, url, "")
+	if err != nil {
+		return fmt.Errorf("下载Metalink失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("下载Metalink失败: %w", &httpCore.HTTPError{StatusCode: resp.StatusCode})
+	}
+
+	ml, err := metalink.ParseReader(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	// 用户指定输出文件时仅对单文件Metalink生效，否则保存到输出路径所在目录
+	userOutput := cd.config.OutputFile != "" || cd.config.OutputDocument != ""
+	singleOutput := userOutput && len(ml.Files) == 1 && outputPath != ""
+
+	for _, file := range ml.Files {
+		filePath := outputPath
+		if !singleOutput {
+			name := file.SafeName()
+			if name == "" {
+				return fmt.Errorf("Metalink文件名无效: %s", file.Name)
+			}
+			filePath = filepath.Join(filepath.Dir(outputPath), name)
+		}
+
+		fmt.Fprintf(cd.out, "Metalink文件: %s (%d 个镜像) → %s\n", file.Name, len(file.Mirrors()), filePath)
+		if err := cd.DownloadMetalinkFile(ctx, file, filePath); err != nil {
+			return fmt.Errorf("下载Metalink文件 %s 失败: %w", file.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// DownloadMetalinkFile 从Metalink文件列出的镜像下载文件并校验哈希
+// 支持范围请求时分片分布到各个镜像，单线程下载时依次尝试各镜像
+func (cd *ChunkDownloader) DownloadMetalinkFile(ctx context.Context, file *metalink.File, outputPath string) error {
+	mirrors := file.Mirrors()
+
+	// 从第一个可用镜像获取文件信息
+	var fileInfo *types.HTTPResponse
+	var err error
+	for _, mirror := range mirrors {
+		fileInfo, err = cd.getFileInfo(ctx, mirror)
+		if err == nil {
+			break
+		}
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "镜像不可用: %s - %v\n", mirror, err)
+		}
+	}
+	if fileInfo == nil {
+		return fmt.Errorf("所有镜像均不可用: %w", err)
+	}
+
+	if err := cd.checkExpectedSize(fileInfo); err != nil {
+		return err
+	}
+
+	if file.Size > 0 && fileInfo.ContentLength >= 0 && fileInfo.ContentLength != file.Size {
+		return fmt.Errorf("镜像文件大小与Metalink不一致: 期望 %d 字节, 实际 %d 字节", file.Size, fileInfo.ContentLength)
+	}
+
+	if cd.shouldUseChunks(fileInfo) {
+		err = cd.downloadWithChunks(ctx, mirrors, outputPath, fileInfo)
+	} else {
+		err = cd.downloadSingleFromMirrors(ctx, mirrors, outputPath, fileInfo.ContentLength)
+	}
+	if err != nil {
+		return err
+	}
+
+	// 校验文件哈希
+	if err := file.Verify(outputPath); err != nil {
+		return cd.discardBadFile(outputPath, err)
+	}
+	if cd.config.Verbose {
+		fmt.Fprintf(cd.out, "Metalink哈希校验通过: %s\n", outputPath)
+	}
+
+	return nil
+}
+
+// downloadSingleFromMirrors 单线程下载，失败时依次尝试下一个镜像
+func (cd *ChunkDownloader) downloadSingleFromMirrors(ctx context.Context, mirrors []string, outputPath string, totalSize int64) error {
+	var lastErr error
+	for _, mirror := range mirrors {
+		lastErr = cd.downloadSingle(ctx, mirror, outputPath, totalSize)
+		if lastErr == nil || ctx.Err() != nil {
+			return lastErr
+		}
+		if cd.config.Verbose {
+			fmt.Fprintf(cd.out, "镜像下载失败: %s - %v，尝试下一个镜像\n", mirror, lastErr)
+		}
+	}
+	return lastErr
+}
@@ -0,0 +1,320 @@
+package ftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Conn FTP控制连接
+type Conn struct {
+	conn    net.Conn
+	text    *textproto.Conn
+	host    string
+	timeout time.Duration
+	dialer  *net.Dialer
+	stop    func() bool // 取消ctx与控制连接的关联
+}
+
+// ErrControlChar 命令参数中包含控制字符，发送会被服务器解析为多条命令
+var ErrControlChar = errors.New("FTP命令参数包含控制字符")
+
+// Entry 目录列表中的条目
+type Entry struct {
+	Name  string
+	IsDir bool
+	Size  int64
+}
+
+// Dial 连接FTP服务器并读取欢迎信息，数据连接使用同一个dialer
+// ctx取消时关闭控制连接，中断阻塞在等待响应上的命令
+func Dial(ctx context.Context, addr string, dialer *net.Dialer) (*Conn, error) {
+	nc, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("连接FTP服务器失败: %w", err)
+	}
+
+	host, _, _ := net.SplitHostPort(addr)
+	c := &Conn{
+		conn:    nc,
+		text:    textproto.NewConn(nc),
+		host:    host,
+		timeout: dialer.Timeout,
+		dialer:  dialer,
+		stop:    context.AfterFunc(ctx, func() { nc.Close() }),
+	}
+
+	if _, _, err := c.text.ReadResponse(2); err != nil {
+		c.stop()
+		nc.Close()
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, fmt.Errorf("FTP服务器欢迎信息错误: %w", err)
+	}
+
+	return c, nil
+}
+
+// cmd 发送命令并读取响应，expect为期望的状态码（或其前缀，0表示不检查）
+// 字符串参数中不能有控制字符，否则URL中解码出的CR LF可以注入额外的命令
+func (c *Conn) cmd(expect int, format string, args ...interface{}) (int, string, error) {
+	for _, arg := range args {
+		if s, ok := arg.(string); ok && hasControlChar(s) {
+			return 0, "", ErrControlChar
+		}
+	}
+	if err := c.text.PrintfLine(format, args...); err != nil {
+		return 0, "", err
+	}
+	return c.text.ReadResponse(expect)
+}
+
+// Login 登录FTP服务器
+func (c *Conn) Login(user, password string) error {
+	code, msg, err := c.cmd(0, "USER %s", user)
+	if err != nil {
+		return fmt.Errorf("FTP登录失败: %w", err)
+	}
+
+	switch code {
+	case 230:
+		return nil
+	case 331, 332:
+		if _, _, err := c.cmd(2, "PASS %s", password); err != nil {
+			return fmt.Errorf("FTP登录失败: %w", err)
+		}
+		return nil
+	default:
+		return fmt.Errorf("FTP登录失败: %d %s", code, msg)
+	}
+}
+
+// Binary 切换到二进制传输模式
+func (c *Conn) Binary() error {
+	if _, _, err := c.cmd(2, "TYPE I"); err != nil {
+		return fmt.Errorf("切换二进制模式失败: %w", err)
+	}
+	return nil
+}
+
+// Size 获取文件大小
+func (c *Conn) Size(path string) (int64, error) {
+	_, msg, err := c.cmd(213, "SIZE %s", path)
+	if err != nil {
+		return 0, err
+	}
+
+	size, err := strconv.ParseInt(strings.TrimSpace(msg), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("无效的SIZE响应: %s", msg)
+	}
+	return size, nil
+}
+
+// Rest 设置下一次传输的起始偏移量
+func (c *Conn) Rest(offset int64) error {
+	_, _, err := c.cmd(350, "REST %d", offset)
+	return err
+}
+
+// Retr 下载文件，返回的Reader关闭时完成传输
+func (c *Conn) Retr(ctx context.Context, path string) (io.ReadCloser, error) {
+	data, err := c.openDataConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := c.cmd(1, "RETR %s", path); err != nil {
+		data.Close()
+		return nil, fmt.Errorf("RETR失败: %w", err)
+	}
+
+	return &transfer{data: data, conn: c}, nil
+}
+
+// List 获取目录列表
+func (c *Conn) List(ctx context.Context, path string) ([]Entry, error) {
+	data, err := c.openDataConn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, _, err := c.cmd(1, "LIST %s", path); err != nil {
+		data.Close()
+		return nil, fmt.Errorf("LIST失败: %w", err)
+	}
+
+	t := &transfer{data: data, conn: c}
+	listing, readErr := io.ReadAll(t)
+	if err := t.Close(); err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, fmt.Errorf("读取目录列表失败: %w", readErr)
+	}
+
+	var entries []Entry
+	for _, line := range strings.Split(string(listing), "\n") {
+		if entry, ok := parseListLine(strings.TrimRight(line, "\r")); ok {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+// Quit 退出并关闭连接
+func (c *Conn) Quit() error {
+	c.cmd(0, "QUIT")
+	c.stop()
+	return c.text.Close()
+}
+
+// hasControlChar 检查字符串中是否有ASCII控制字符
+func hasControlChar(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool { return r < 0x20 || r == 0x7f }) != -1
+}
+
+// openDataConn 使用被动模式建立数据连接，优先EPSV，失败时回退到PASV
+// 数据连接始终连接控制连接的主机，忽略PASV响应中的地址
+func (c *Conn) openDataConn(ctx context.Context) (net.Conn, error) {
+	port, err := c.epsv()
+	if err != nil {
+		port, err = c.pasv()
+		if err != nil {
+			return nil, fmt.Errorf("进入被动模式失败: %w", err)
+		}
+	}
+
+	data, err := c.dialer.DialContext(ctx, "tcp", net.JoinHostPort(c.host, strconv.Itoa(port)))
+	if err != nil {
+		return nil, fmt.Errorf("建立数据连接失败: %w", err)
+	}
+	return data, nil
+}
+
+// epsv 发送EPSV命令，响应格式: 229 Entering Extended Passive Mode (|||port|)
+func (c *Conn) epsv() (int, error) {
+	_, msg, err := c.cmd(229, "EPSV")
+	if err != nil {
+		return 0, err
+	}
+
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start == -1 || end <= start {
+		return 0, fmt.Errorf("无效的EPSV响应: %s", msg)
+	}
+
+	fields := strings.Split(msg[start+1:end], "|")
+	if len(fields) != 5 {
+		return 0, fmt.Errorf("无效的EPSV响应: %s", msg)
+	}
+	return strconv.Atoi(fields[3])
+}
+
+// pasv 发送PASV命令，响应格式: 227 Entering Passive Mode (h1,h2,h3,h4,p1,p2)
+func (c *Conn) pasv() (int, error) {
+	_, msg, err := c.cmd(227, "PASV")
+	if err != nil {
+		return 0, err
+	}
+
+	start := strings.Index(msg, "(")
+	end := strings.LastIndex(msg, ")")
+	if start == -1 || end <= start {
+		return 0, fmt.Errorf("无效的PASV响应: %s", msg)
+	}
+
+	fields := strings.Split(msg[start+1:end], ",")
+	if len(fields) != 6 {
+		return 0, fmt.Errorf("无效的PASV响应: %s", msg)
+	}
+
+	p1, err1 := strconv.Atoi(strings.TrimSpace(fields[4]))
+	p2, err2 := strconv.Atoi(strings.TrimSpace(fields[5]))
+	if err1 != nil || err2 != nil {
+		return 0, fmt.Errorf("无效的PASV响应: %s", msg)
+	}
+	return p1*256 + p2, nil
+}
+
+// transfer 数据连接，关闭时读取传输完成的响应
+type transfer struct {
+	data net.Conn
+	conn *Conn
+	once sync.Once
+	err  error
+}
+
+func (t *transfer) Read(p []byte) (int, error) {
+	return t.data.Read(p)
+}
+
+func (t *transfer) Close() error {
+	t.once.Do(func() {
+		t.data.Close()
+		// 避免服务器不发送完成响应时无限等待
+		if t.conn.timeout > 0 {
+			t.conn.conn.SetReadDeadline(time.Now().Add(t.conn.timeout))
+			defer t.conn.conn.SetReadDeadline(time.Time{})
+		}
+		if _, _, err := t.conn.text.ReadResponse(2); err != nil {
+			t.err = fmt.Errorf("FTP传输未完成: %w", err)
+		}
+	})
+	return t.err
+}
+
+// parseListLine 解析LIST输出的一行，支持Unix和MS-DOS格式
+func parseListLine(line string) (Entry, bool) {
+	fields := strings.Fields(line)
+
+	// Unix格式: drwxr-xr-x 2 user group 4096 Jan 01 12:00 name
+	if len(fields) >= 9 && strings.ContainsRune("-dl", rune(line[0])) {
+		name := fieldsFrom(line, 8)
+		if line[0] == 'l' {
+			if idx := strings.Index(name, " -> "); idx != -1 {
+				name = name[:idx]
+			}
+		}
+		size, _ := strconv.ParseInt(fields[4], 10, 64)
+		return Entry{Name: name, IsDir: line[0] == 'd', Size: size}, name != ""
+	}
+
+	// MS-DOS格式: 01-01-20  12:00PM  <DIR>  name 或 01-01-20  12:00PM  1234  name
+	if len(fields) >= 4 && strings.Count(fields[0], "-") == 2 {
+		name := fieldsFrom(line, 3)
+		if fields[2] == "<DIR>" {
+			return Entry{Name: name, IsDir: true}, name != ""
+		}
+		size, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return Entry{}, false
+		}
+		return Entry{Name: name, Size: size}, name != ""
+	}
+
+	return Entry{}, false
+}
+
+// fieldsFrom 返回从第n个字段（从0开始）到行尾的内容，保留文件名中的空格
+func fieldsFrom(line string, n int) string {
+	rest := line
+	for i := 0; i < n; i++ {
+		rest = strings.TrimLeft(rest, " \t")
+		idx := strings.IndexAny(rest, " \t")
+		if idx == -1 {
+			return ""
+		}
+		rest = rest[idx:]
+	}
+	return strings.TrimLeft(rest, " \t")
+}
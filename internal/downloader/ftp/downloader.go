@@ -0,0 +1,398 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/example/wget2go/internal/core/ratelimit"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// anonymousPassword 匿名登录时使用的密码
+const anonymousPassword = "wget2go@"
+
+// Downloader FTP下载器
+type Downloader struct {
+	config     *types.Config
+	progressCh chan types.ProgressInfo
+	errorCh    chan error
+	stopCh     chan struct{}
+	limiter    *ratelimit.Limiter
+	files      int
+	received   atomic.Int64 // 从网络接收的字节数
+	summary    types.DownloadSummary
+}
+
+// NewDownloader 创建FTP下载器
+func NewDownloader(config *types.Config) *Downloader {
+	return &Downloader{
+		config:     config,
+		progressCh: make(chan types.ProgressInfo, 100),
+		errorCh:    make(chan error, 100),
+		stopCh:     make(chan struct{}),
+		limiter:    ratelimit.NewLimiter(config.LimitRate),
+	}
+}
+
+// IsFTPURL 检查URL是否为FTP协议
+func IsFTPURL(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	return err == nil && strings.EqualFold(u.Scheme, "ftp")
+}
+
+// SetLimiter 设置限速器
+func (d *Downloader) SetLimiter(limiter *ratelimit.Limiter) {
+	d.limiter = limiter
+}
+
+// Download 下载单个FTP文件，结果计入GetSummary的汇总
+func (d *Downloader) Download(ctx context.Context, rawURL, outputPath string) error {
+	start := time.Now()
+	received := d.received.Load()
+
+	err := d.download(ctx, rawURL, outputPath)
+
+	if err != nil {
+		d.summary.Failed++
+	} else {
+		d.summary.Files++
+	}
+	d.summary.Bytes += d.received.Load() - received
+	d.summary.Elapsed += time.Since(start)
+	return err
+}
+
+// GetSummary 返回该下载器所有Download调用的汇总
+func (d *Downloader) GetSummary() types.DownloadSummary {
+	return d.summary
+}
+
+// download 连接服务器并下载单个文件
+func (d *Downloader) download(ctx context.Context, rawURL, outputPath string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("无效的URL: %w", err)
+	}
+
+	conn, err := d.connect(ctx, u)
+	if err != nil {
+		return canceled(ctx, err)
+	}
+	defer conn.Quit()
+
+	return canceled(ctx, d.retrieve(ctx, conn, remotePath(u), outputPath))
+}
+
+// DownloadRecursive 递归下载FTP目录，目录列表中的子条目保存到outputDir下
+func (d *Downloader) DownloadRecursive(ctx context.Context, rawURL, outputDir string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return fmt.Errorf("无效的URL: %w", err)
+	}
+
+	conn, err := d.connect(ctx, u)
+	if err != nil {
+		return canceled(ctx, err)
+	}
+	defer conn.Quit()
+
+	dir := remotePath(u)
+	if !strings.HasSuffix(u.Path, "/") && u.Path != "" {
+		// 非目录URL直接下载文件
+		return canceled(ctx, d.retrieve(ctx, conn, dir, filepath.Join(outputDir, path.Base(dir))))
+	}
+
+	return canceled(ctx, d.walk(ctx, conn, dir, outputDir, 1))
+}
+
+// GetDownloadedCount 获取递归下载的文件数
+func (d *Downloader) GetDownloadedCount() int {
+	return d.files
+}
+
+// walk 遍历远程目录并下载其中的文件
+func (d *Downloader) walk(ctx context.Context, conn *Conn, dir, localDir string, level int) error {
+	entries, err := conn.List(ctx, dir)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(localDir, 0755); err != nil {
+		return fmt.Errorf("创建目录失败: %w", err)
+	}
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		// 忽略特殊目录和可能逃出输出目录的名称
+		if entry.Name == "." || entry.Name == ".." || strings.ContainsAny(entry.Name, "/\\") {
+			continue
+		}
+
+		child := path.Join(dir, entry.Name)
+		localPath := filepath.Join(localDir, entry.Name)
+
+		if entry.IsDir {
+			if d.config.RecursiveLevel > 0 && level >= d.config.RecursiveLevel {
+				continue
+			}
+			if err := d.walk(ctx, conn, child, localPath, level+1); err != nil {
+				d.sendError(fmt.Errorf("下载目录 %s 失败: %w", child, err))
+			}
+			continue
+		}
+
+		if err := d.retrieve(ctx, conn, child, localPath); err != nil {
+			d.sendError(fmt.Errorf("下载 %s 失败: %w", child, err))
+			continue
+		}
+		d.files++
+	}
+
+	return nil
+}
+
+// connect 连接并登录FTP服务器
+func (d *Downloader) connect(ctx context.Context, u *url.URL) (*Conn, error) {
+	host := u.Host
+	if u.Port() == "" {
+		host = net.JoinHostPort(u.Hostname(), "21")
+	}
+
+	conn, err := Dial(ctx, host, d.dialer())
+	if err != nil {
+		return nil, err
+	}
+
+	user, password := d.credentials(u)
+	if err := conn.Login(user, password); err != nil {
+		conn.Quit()
+		return nil, err
+	}
+
+	if err := conn.Binary(); err != nil {
+		conn.Quit()
+		return nil, err
+	}
+
+	return conn, nil
+}
+
+// credentials 获取登录凭据，URL中的用户信息优先，其次是--ftp-user/--ftp-password，最后为匿名登录
+func (d *Downloader) credentials(u *url.URL) (string, string) {
+	if u.User != nil {
+		password, _ := u.User.Password()
+		return u.User.Username(), password
+	}
+
+	if d.config.FTPUser != "" {
+		return d.config.FTPUser, d.config.FTPPassword
+	}
+
+	return "anonymous", anonymousPassword
+}
+
+// dialer 创建控制连接和数据连接使用的Dialer
+func (d *Downloader) dialer() *net.Dialer {
+	dialer := &net.Dialer{Timeout: d.config.Timeout}
+	if d.config.ConnectTimeout > 0 {
+		dialer.Timeout = d.config.ConnectTimeout
+	}
+	if d.config.BindAddress != "" {
+		dialer.LocalAddr = &net.TCPAddr{IP: net.ParseIP(d.config.BindAddress)}
+	}
+	return dialer
+}
+
+// retrieve 下载远程文件到本地，设置了--continue且本地文件已存在时使用REST续传
+func (d *Downloader) retrieve(ctx context.Context, conn *Conn, remote, outputPath string) error {
+	size, err := conn.Size(remote)
+	if err != nil {
+		// 服务器不支持SIZE时大小未知
+		size = -1
+	}
+
+	if d.config.ExpectedSize > 0 && size >= 0 && size != d.config.ExpectedSize {
+		return fmt.Errorf("文件大小不符: 期望 %d 字节，服务器报告 %d 字节", d.config.ExpectedSize, size)
+	}
+
+	var offset int64
+	if d.config.Continue && utils.FileExists(outputPath) {
+		if info, err := os.Stat(outputPath); err == nil {
+			offset = info.Size()
+		}
+		if size >= 0 && offset >= size {
+			// 文件已完整下载
+			return nil
+		}
+		if offset > 0 {
+			if err := conn.Rest(offset); err != nil {
+				// 服务器不支持续传，重新下载
+				offset = 0
+			}
+		}
+	}
+
+	reader, err := conn.Retr(ctx, remote)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	if dir := filepath.Dir(outputPath); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("创建目录失败: %w", err)
+		}
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if offset > 0 {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(outputPath, flags, 0644)
+	if err != nil {
+		return fmt.Errorf("创建文件失败: %w", err)
+	}
+	defer file.Close()
+
+	var downloaded atomic.Int64
+	downloaded.Store(offset)
+	defer func() { d.received.Add(downloaded.Load() - offset) }()
+
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	defer cancelProgress()
+	go d.reportProgress(progressCtx, size, &downloaded, time.Now())
+
+	// 取消时关闭数据连接以中断阻塞的读取
+	stop := context.AfterFunc(ctx, func() { reader.Close() })
+	defer stop()
+
+	counter := &countingWriter{w: file, n: &downloaded}
+	if _, err := io.Copy(counter, d.limiter.Reader(ctx, reader)); err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return fmt.Errorf("下载数据失败: %w", err)
+	}
+
+	if err := reader.Close(); err != nil {
+		return err
+	}
+
+	if size >= 0 && downloaded.Load() != size {
+		return fmt.Errorf("下载不完整: 期望 %d 字节，实际 %d 字节", size, downloaded.Load())
+	}
+
+	return nil
+}
+
+// reportProgress 报告下载进度
+func (d *Downloader) reportProgress(ctx context.Context, totalSize int64, downloaded *atomic.Int64, startTime time.Time) {
+	interval := d.config.ProgressInterval
+	if interval <= 0 {
+		interval = types.DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	// 速度按最近几秒的下载量计算，反映当前吞吐量
+	window := utils.NewSpeedWindow(utils.DefaultSpeedWindow, startTime, downloaded.Load())
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.stopCh:
+			return
+		case now := <-ticker.C:
+			current := downloaded.Load()
+
+			speed := window.Update(now, current)
+			if d.limiter != nil {
+				speed = d.limiter.Rate()
+			}
+
+			info := types.ProgressInfo{
+				TotalSize:     totalSize,
+				Downloaded:    current,
+				Speed:         speed,
+				ActiveThreads: 1,
+			}
+			if totalSize > 0 {
+				info.Percentage = float64(current) / float64(totalSize) * 100
+				info.RemainingTime = utils.CalculateETA(totalSize, current, speed)
+			}
+
+			// 没有消费者时丢弃进度信息
+			select {
+			case d.progressCh <- info:
+			default:
+			}
+		}
+	}
+}
+
+// sendError 发送非致命错误
+func (d *Downloader) sendError(err error) {
+	select {
+	case d.errorCh <- err:
+	default:
+	}
+}
+
+// GetProgressChannel 获取进度通道
+func (d *Downloader) GetProgressChannel() <-chan types.ProgressInfo {
+	return d.progressCh
+}
+
+// GetErrorChannel 获取错误通道
+func (d *Downloader) GetErrorChannel() <-chan error {
+	return d.errorCh
+}
+
+// Stop 停止下载
+func (d *Downloader) Stop() {
+	close(d.stopCh)
+}
+
+// canceled ctx取消后控制连接已被关闭，此时的错误报告为ctx的错误
+func canceled(ctx context.Context, err error) error {
+	if err != nil && ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// remotePath 从URL中获取远程路径，按RFC 1738相对于登录目录
+// 路径中解码出的控制字符在发送命令时被拒绝
+func remotePath(u *url.URL) string {
+	p := strings.TrimPrefix(u.Path, "/")
+	if p == "" {
+		return "."
+	}
+	return p
+}
+
+// countingWriter 统计写入字节数
+type countingWriter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err
+}
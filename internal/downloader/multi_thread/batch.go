@@ -0,0 +1,126 @@
+package multi_thread
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
+)
+
+// DefaultBatchStateFile 默认的批量下载状态文件
+const DefaultBatchStateFile = ".wget2go.batch"
+
+// BatchEntry 批量下载中单个URL的状态
+type BatchEntry struct {
+	URL        string           `json:"url"`
+	OutputPath string           `json:"output_path"`
+	Size       int64            `json:"size"`
+	Status     types.TaskStatus `json:"status"`
+}
+
+// BatchState 批量下载状态，记录已完成的URL以便中断后继续
+type BatchState struct {
+	path    string
+	entries map[string]*BatchEntry
+	mu      sync.Mutex
+}
+
+// LoadBatchState 加载批量下载状态，文件不存在时返回空状态
+func LoadBatchState(path string) (*BatchState, error) {
+	bs := &BatchState{
+		path:    path,
+		entries: make(map[string]*BatchEntry),
+	}
+
+	if !utils.FileExists(path) {
+		return bs, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("读取批量状态文件失败: %w", err)
+	}
+
+	var entries []*BatchEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("解析批量状态文件失败: %w", err)
+	}
+
+	for _, entry := range entries {
+		bs.entries[entry.URL] = entry
+	}
+
+	return bs, nil
+}
+
+// IsCompleted 检查URL是否已下载完成（输出文件仍存在且大小一致）
+func (bs *BatchState) IsCompleted(url, outputPath string) (*BatchEntry, bool) {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	entry, exists := bs.entries[url]
+	if !exists || entry.Status != types.TaskCompleted || entry.OutputPath != outputPath {
+		return nil, false
+	}
+
+	size, err := utils.GetFileSize(outputPath)
+	if err != nil || (entry.Size > 0 && size != entry.Size) {
+		return nil, false
+	}
+
+	return entry, true
+}
+
+// MarkStarted 记录URL开始下载
+func (bs *BatchState) MarkStarted(url, outputPath string) error {
+	return bs.update(url, outputPath, 0, types.TaskDownloading)
+}
+
+// MarkCompleted 记录URL下载完成
+func (bs *BatchState) MarkCompleted(url, outputPath string, size int64) error {
+	return bs.update(url, outputPath, size, types.TaskCompleted)
+}
+
+// update 更新条目并立即保存
+func (bs *BatchState) update(url, outputPath string, size int64, status types.TaskStatus) error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	bs.entries[url] = &BatchEntry{
+		URL:        url,
+		OutputPath: outputPath,
+		Size:       size,
+		Status:     status,
+	}
+
+	return bs.save()
+}
+
+// save 保存状态到文件（调用方需持有锁）
+func (bs *BatchState) save() error {
+	entries := make([]*BatchEntry, 0, len(bs.entries))
+	for _, entry := range bs.entries {
+		entries = append(entries, entry)
+	}
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(bs.path, data, 0644)
+}
+
+// Remove 删除状态文件（整个批次完成后调用）
+func (bs *BatchState) Remove() error {
+	bs.mu.Lock()
+	defer bs.mu.Unlock()
+
+	if utils.FileExists(bs.path) {
+		return os.Remove(bs.path)
+	}
+	return nil
+}
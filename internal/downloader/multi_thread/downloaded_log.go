@@ -0,0 +1,72 @@
+package multi_thread
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// DownloadedLog 下载成功的URL日志（纯文本，每行一个URL）
+// 与批量状态不同，日志不依赖输出路径，可以直接编辑或由其他工具生成
+type DownloadedLog struct {
+	file *os.File
+	urls map[string]bool
+	mu   sync.Mutex
+}
+
+// OpenDownloadedLog 打开下载日志并读取其中已记录的URL，新的记录追加到文件末尾
+func OpenDownloadedLog(path string) (*DownloadedLog, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("打开下载日志失败: %w", err)
+	}
+
+	log := &DownloadedLog{
+		file: file,
+		urls: make(map[string]bool),
+	}
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		log.urls[line] = true
+	}
+	if err := scanner.Err(); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("读取下载日志失败: %w", err)
+	}
+
+	return log, nil
+}
+
+// Contains 检查URL是否已记录为下载成功
+func (l *DownloadedLog) Contains(url string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.urls[url]
+}
+
+// Record 记录下载成功的URL
+func (l *DownloadedLog) Record(url string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.urls[url] {
+		return nil
+	}
+	if _, err := fmt.Fprintln(l.file, url); err != nil {
+		return fmt.Errorf("写入下载日志失败: %w", err)
+	}
+	l.urls[url] = true
+	return nil
+}
+
+// Close 关闭下载日志
+func (l *DownloadedLog) Close() error {
+	return l.file.Close()
+}
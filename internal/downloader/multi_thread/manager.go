@@ -3,11 +3,16 @@ package multi_thread
 import (
 	"context"
 	"fmt"
+	"io"
+	"os"
 	"sync"
 	"time"
 
+	"github.com/example/wget2go/internal/core/ratelimit"
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 	"github.com/example/wget2go/internal/downloader/chunk"
+	"github.com/example/wget2go/internal/downloader/ftp"
 	"github.com/example/wget2go/internal/core/http"
 )
 
@@ -15,27 +20,49 @@ import (
 type DownloadManager struct {
 	config      *types.Config
 	httpClient  *http.Client
-	downloader  *chunk.ChunkDownloader
 	progressCh  chan types.ProgressInfo
 	errorCh     chan error
 	stopCh      chan struct{}
 	tasks       map[string]*types.DownloadTask
+	order       []string // 任务添加顺序
+	batchState  *BatchState
+	downloadedLog *DownloadedLog
+	manifest    *chunk.ChecksumManifest // 所有任务共享的校验和清单
+	quota       *ratelimit.Quota // 总下载量配额，nil表示不限制
+	limiter     *ratelimit.Limiter // 所有任务共享的限速器
+	out         io.Writer // 文本输出的目标，默认为标准输出
+	startTime   time.Time
+	summary     types.DownloadSummary // 下载汇总，耗时在Start结束时设置
 	mu          sync.RWMutex
+
+	// 工作池状态，仅在Start运行期间有效
+	queue       chan *types.DownloadTask      // 等待下载的任务
+	queued      map[string]bool               // 已在队列中的任务
+	outstanding int                           // 队列中和正在下载的任务数，降为0时关闭队列
+	runs        map[string]*taskRun           // 正在下载的任务，用于暂停；同一URL同时最多一个
+}
+
+// taskRun 任务的一次下载
+type taskRun struct {
+	cancel context.CancelFunc
+	paused bool // 被PauseTask中断，结束时不记录结果
 }
 
 // NewDownloadManager 创建下载管理器
 func NewDownloadManager(config *types.Config) *DownloadManager {
 	httpClient := http.NewClient(config)
-	downloader := chunk.NewChunkDownloader(httpClient, config)
 
 	return &DownloadManager{
 		config:     config,
 		httpClient: httpClient,
-		downloader: downloader,
 		progressCh: make(chan types.ProgressInfo, 100),
 		errorCh:    make(chan error, 100),
 		stopCh:     make(chan struct{}),
 		tasks:      make(map[string]*types.DownloadTask),
+		limiter:    ratelimit.NewLimiter(config.LimitRate),
+		queued:     make(map[string]bool),
+		out:        os.Stdout,
+		runs:       make(map[string]*taskRun),
 	}
 }
 
@@ -58,30 +85,123 @@ func (dm *DownloadManager) AddTask(url, outputPath string) error {
 	}
 
 	dm.tasks[url] = task
+	dm.order = append(dm.order, url)
+	return nil
+}
+
+// EnableBatchState 启用批量下载状态持久化
+// 断点续传模式下加载已有状态并跳过已完成的URL，否则重新开始记录
+func (dm *DownloadManager) EnableBatchState(path string) error {
+	if !dm.config.Continue {
+		if err := (&BatchState{path: path}).Remove(); err != nil {
+			return fmt.Errorf("删除旧的批量状态文件失败: %w", err)
+		}
+	}
+
+	batchState, err := LoadBatchState(path)
+	if err != nil {
+		return err
+	}
+
+	dm.mu.Lock()
+	dm.batchState = batchState
+	dm.mu.Unlock()
 	return nil
 }
 
-// Start 开始下载所有任务
+// SetDownloadedLog 设置下载日志：下载成功的URL追加到日志中，
+// 启用--input-file-continue时跳过日志中已有的URL
+func (dm *DownloadManager) SetDownloadedLog(log *DownloadedLog) {
+	dm.mu.Lock()
+	dm.downloadedLog = log
+	dm.mu.Unlock()
+}
+
+// SetQuota 设置总下载量配额，超出后不再开始新的任务，未开始的任务保持等待状态
+func (dm *DownloadManager) SetQuota(quota *ratelimit.Quota) {
+	dm.mu.Lock()
+	dm.quota = quota
+	dm.mu.Unlock()
+}
+
+// SetOutput 设置文本输出（包括各任务下载器和HTTP客户端的详细输出）的目标，需在开始下载前设置
+func (dm *DownloadManager) SetOutput(w io.Writer) {
+	dm.mu.Lock()
+	dm.out = w
+	dm.mu.Unlock()
+	dm.httpClient.SetOutput(w)
+}
+
+// SetChecksumManifest 设置校验和清单，下载完成的文件记录到清单中
+func (dm *DownloadManager) SetChecksumManifest(manifest *chunk.ChecksumManifest) {
+	dm.mu.Lock()
+	dm.manifest = manifest
+	dm.mu.Unlock()
+}
+
+// Start 开始下载所有任务，最多同时下载MaxConcurrentDownloads个文件
+// 没有等待中和正在下载的任务时返回，暂停的任务保持暂停状态
 func (dm *DownloadManager) Start(ctx context.Context) error {
 	dm.mu.Lock()
-	
-	// 启动所有任务
-	var wg sync.WaitGroup
-	for url, task := range dm.tasks {
-		if task.Status == types.TaskPending {
-			wg.Add(1)
-			go func(url string, task *types.DownloadTask) {
-				defer wg.Done()
-				dm.downloadTask(ctx, url, task)
-			}(url, task)
+	dm.startTime = time.Now()
+	dm.mu.Unlock()
+
+	// 跳过批量状态中已完成的任务
+	dm.skipCompletedTasks()
+
+	// 预先获取所有任务的文件大小，使汇总进度和ETA覆盖全部剩余文件
+	dm.probeSizes(ctx)
+
+	// 启动汇总进度报告
+	progressCtx, cancelProgress := context.WithCancel(ctx)
+	defer cancelProgress()
+	go dm.reportProgress(progressCtx)
+
+	// 按添加顺序将等待中的任务放入队列，每个任务最多在队列中出现一次
+	dm.mu.Lock()
+	queue := make(chan *types.DownloadTask, len(dm.tasks))
+	dm.queue = queue
+	for _, url := range dm.order {
+		if task := dm.tasks[url]; task.Status == types.TaskPending {
+			dm.enqueueLocked(task)
 		}
 	}
-	
+	if dm.outstanding == 0 {
+		dm.closeQueueLocked()
+	}
 	dm.mu.Unlock()
 
+	// 启动工作池，每个文件各自使用分片并发
+	workers := dm.config.MaxConcurrentDownloads
+	if workers <= 0 {
+		workers = 1
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for task := range queue {
+				dm.runQueuedTask(ctx, task)
+			}
+		}()
+	}
+
 	// 等待所有任务完成
 	wg.Wait()
+
+	dm.mu.Lock()
+	dm.summary.Elapsed = time.Since(dm.startTime)
+	dm.mu.Unlock()
 	
+	// 整个批次完成后删除状态文件
+	if dm.batchState != nil && dm.allCompleted() {
+		if err := dm.batchState.Remove(); err != nil && dm.config.Verbose {
+			fmt.Fprintf(dm.out, "警告: 删除批量状态文件失败: %v\n", err)
+		}
+	}
+
 	// 检查是否有错误
 	select {
 	case err := <-dm.errorCh:
@@ -91,31 +211,333 @@ func (dm *DownloadManager) Start(ctx context.Context) error {
 	}
 }
 
-// downloadTask 下载单个任务
-func (dm *DownloadManager) downloadTask(ctx context.Context, url string, task *types.DownloadTask) {
+// allCompleted 检查是否所有任务都已完成
+func (dm *DownloadManager) allCompleted() bool {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	for _, task := range dm.tasks {
+		if task.Status != types.TaskCompleted {
+			return false
+		}
+	}
+	return true
+}
+
+// skipCompletedTasks 将批量状态或下载日志中已完成的任务标记为完成
+func (dm *DownloadManager) skipCompletedTasks() {
 	dm.mu.Lock()
-	task.Status = types.TaskDownloading
+	defer dm.mu.Unlock()
+
+	useLog := dm.downloadedLog != nil && dm.config.InputFileContinue
+	if dm.batchState == nil && !useLog {
+		return
+	}
+
+	for _, url := range dm.order {
+		task := dm.tasks[url]
+		if task.Status != types.TaskPending {
+			continue
+		}
+		if dm.batchState != nil {
+			if entry, ok := dm.batchState.IsCompleted(url, task.OutputPath); ok {
+				task.Status = types.TaskCompleted
+				task.Size = entry.Size
+				task.Completed = entry.Size
+				dm.summary.Skipped++
+				if !dm.config.Quiet {
+					fmt.Fprintf(dm.out, "跳过已完成的文件: %s\n", url)
+				}
+				continue
+			}
+		}
+		if useLog && dm.downloadedLog.Contains(url) {
+			task.Status = types.TaskCompleted
+			dm.summary.Skipped++
+			if size, err := utils.GetFileSize(task.OutputPath); err == nil {
+				task.Size = size
+				task.Completed = size
+			}
+			if !dm.config.Quiet {
+				fmt.Fprintf(dm.out, "跳过下载日志中已记录的URL: %s\n", url)
+			}
+		}
+	}
+}
+
+// probeSizes 通过HEAD请求获取待下载任务的文件大小
+func (dm *DownloadManager) probeSizes(ctx context.Context) {
+	dm.mu.RLock()
+	var pending []*types.DownloadTask
+	for _, task := range dm.tasks {
+		if task.Status == types.TaskPending && task.Size <= 0 {
+			pending = append(pending, task)
+		}
+	}
+	dm.mu.RUnlock()
+
+	concurrency := dm.config.MaxThreads
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	semaphore := make(chan struct{}, concurrency)
+
+	var wg sync.WaitGroup
+	for _, task := range pending {
+		wg.Add(1)
+		go func(task *types.DownloadTask) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			// 获取失败不影响下载，只是该文件暂不计入总大小
+			resp, err := dm.httpClient.Head(ctx, task.URL)
+			if err != nil || resp.ContentLength <= 0 {
+				return
+			}
+
+			dm.mu.Lock()
+			if task.Size <= 0 {
+				task.Size = resp.ContentLength
+			}
+			dm.mu.Unlock()
+		}(task)
+	}
+	wg.Wait()
+}
+
+// enqueueLocked 将任务放入队列，调用方需持有dm.mu
+func (dm *DownloadManager) enqueueLocked(task *types.DownloadTask) {
+	dm.queued[task.URL] = true
+	dm.outstanding++
+	dm.queue <- task
+}
+
+// closeQueueLocked 关闭队列使工作者退出，调用方需持有dm.mu
+func (dm *DownloadManager) closeQueueLocked() {
+	close(dm.queue)
+	dm.queue = nil
+}
+
+// runQueuedTask 下载从队列取出的任务，任务已被暂停、上下文已取消或超出下载配额时跳过
+func (dm *DownloadManager) runQueuedTask(ctx context.Context, task *types.DownloadTask) {
+	dm.mu.Lock()
+	delete(dm.queued, task.URL)
+	run := task.Status == types.TaskPending && ctx.Err() == nil
+	if run && dm.quota.Exceeded() {
+		run = false
+		dm.summary.Skipped++
+		if !dm.config.Quiet {
+			fmt.Fprintf(dm.out, "已超出下载配额，跳过: %s\n", task.URL)
+		}
+	}
+	var taskCtx context.Context
+	var current *taskRun
+	if run {
+		var cancel context.CancelFunc
+		taskCtx, cancel = context.WithCancel(ctx)
+		defer cancel()
+		current = &taskRun{cancel: cancel}
+		dm.runs[task.URL] = current
+		task.Status = types.TaskDownloading
+		task.StartTime = time.Now()
+	}
+	dm.mu.Unlock()
+
+	if run {
+		dm.downloadTask(taskCtx, task.URL, task, current)
+	}
+
+	dm.mu.Lock()
+	if current != nil && dm.runs[task.URL] == current {
+		delete(dm.runs, task.URL)
+		// 暂停期间已被ResumeTask恢复，本次下载结束后才重新加入队列，避免同一URL同时下载
+		if current.paused && task.Status == types.TaskPending {
+			dm.requeueLocked(task)
+		}
+	}
+	dm.outstanding--
+	if dm.outstanding == 0 {
+		dm.closeQueueLocked()
+	}
 	dm.mu.Unlock()
+}
+
+// downloadTask 下载单个任务，current为本次下载，被暂停时不记录结果
+func (dm *DownloadManager) downloadTask(ctx context.Context, url string, task *types.DownloadTask, current *taskRun) {
+	if dm.batchState != nil {
+		if err := dm.batchState.MarkStarted(url, task.OutputPath); err != nil && dm.config.Verbose {
+			fmt.Fprintf(dm.out, "警告: 保存批量状态失败: %v\n", err)
+		}
+	}
+
+	// 每个任务使用独立的下载器，以便区分各自的进度
+	downloader := dm.newTaskDownloader(url)
+	downloader.SetLimiter(dm.limiter)
+	done := make(chan struct{})
+	go dm.trackTaskProgress(task, downloader, done)
 
 	// 开始下载
-	err := dm.downloader.Download(ctx, url, task.OutputPath)
+	err := downloader.Download(ctx, url, task.OutputPath)
+	downloader.Stop()
+	close(done)
 	
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 	
+	task.EndTime = time.Now()
+	if current.paused {
+		// 下载被PauseTask中断，等待ResumeTask重新加入队列（此时任务可能已被恢复为等待状态）
+		return
+	}
+
+	// 任务并发执行，汇总的耗时按整个批次计算
+	summary := downloader.GetSummary()
+	summary.Elapsed = 0
+	dm.summary.Add(summary)
 	if err != nil {
 		task.Status = types.TaskFailed
 		task.Error = err
-		dm.errorCh <- fmt.Errorf("下载失败 %s: %w", url, err)
+		// 错误通道已满时丢弃，避免大量任务失败时阻塞
+		select {
+		case dm.errorCh <- fmt.Errorf("下载失败 %s: %w", url, err):
+		default:
+		}
 	} else {
 		task.Status = types.TaskCompleted
-		task.EndTime = time.Now()
+		if size, err := utils.GetFileSize(task.OutputPath); err == nil {
+			task.Size = size
+		}
+		task.Completed = task.Size
+		dm.quota.Add(task.Size)
+		if dm.batchState != nil {
+			if err := dm.batchState.MarkCompleted(url, task.OutputPath, task.Size); err != nil && dm.config.Verbose {
+				fmt.Fprintf(dm.out, "警告: 保存批量状态失败: %v\n", err)
+			}
+		}
+		if dm.downloadedLog != nil {
+			if err := dm.downloadedLog.Record(url); err != nil && dm.config.Verbose {
+				fmt.Fprintf(dm.out, "警告: %v\n", err)
+			}
+		}
+	}
+}
+
+// taskDownloader 单个任务使用的下载器
+type taskDownloader interface {
+	Download(ctx context.Context, url, outputPath string) error
+	GetProgressChannel() <-chan types.ProgressInfo
+	SetLimiter(limiter *ratelimit.Limiter)
+	GetSummary() types.DownloadSummary
+	Stop()
+}
+
+// newTaskDownloader 根据URL协议创建下载器
+func (dm *DownloadManager) newTaskDownloader(url string) taskDownloader {
+	if ftp.IsFTPURL(url) {
+		return ftp.NewDownloader(dm.config)
+	}
+	downloader := chunk.NewChunkDownloader(dm.httpClient, dm.config)
+	downloader.SetOutput(dm.out)
+	if dm.manifest != nil {
+		downloader.SetChecksumManifest(dm.manifest)
+	}
+	return downloader
+}
+
+// trackTaskProgress 将下载器的进度同步到任务
+func (dm *DownloadManager) trackTaskProgress(task *types.DownloadTask, downloader taskDownloader, done <-chan struct{}) {
+	progressCh := downloader.GetProgressChannel()
+	for {
+		select {
+		case <-done:
+			return
+		case progress := <-progressCh:
+			dm.mu.Lock()
+			if progress.TotalSize > 0 {
+				task.Size = progress.TotalSize
+			}
+			task.Completed = progress.Downloaded
+			dm.mu.Unlock()
+		}
 	}
 }
 
-// GetProgress 获取进度信息
+// reportProgress 定期发送汇总进度
+func (dm *DownloadManager) reportProgress(ctx context.Context) {
+	interval := dm.config.ProgressInterval
+	if interval <= 0 {
+		interval = types.DefaultProgressInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-dm.stopCh:
+			return
+		case <-ticker.C:
+			// 无人读取时丢弃，避免阻塞
+			select {
+			case dm.progressCh <- dm.GetAggregateProgress():
+			default:
+			}
+		}
+	}
+}
+
+// GetAggregateProgress 获取所有任务的汇总进度
+// 总大小包含尚未开始的任务，ETA按全部剩余字节和本次运行的平均速度计算
+func (dm *DownloadManager) GetAggregateProgress() types.ProgressInfo {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	var total, downloaded int64
+	active := 0
+	for _, task := range dm.tasks {
+		switch task.Status {
+		case types.TaskFailed:
+			// 失败的任务不会再下载剩余部分
+			total += task.Completed
+		default:
+			total += task.Size
+		}
+		downloaded += task.Completed
+		if task.Status == types.TaskDownloading {
+			active++
+		}
+	}
+
+	var speed int64
+	if dm.limiter != nil {
+		// 限速时显示限速器的当前实际速率
+		speed = dm.limiter.Rate()
+	} else if !dm.startTime.IsZero() {
+		if elapsed := time.Since(dm.startTime).Seconds(); elapsed > 0 {
+			speed = int64(float64(downloaded) / elapsed)
+		}
+	}
+
+	var percentage float64
+	if total > 0 {
+		percentage = float64(downloaded) / float64(total) * 100
+	}
+
+	return types.ProgressInfo{
+		TotalSize:     total,
+		Downloaded:    downloaded,
+		Speed:         speed,
+		Percentage:    percentage,
+		RemainingTime: utils.CalculateETA(total, downloaded, speed),
+		ActiveThreads: active,
+	}
+}
+
+// GetProgress 获取汇总进度信息
 func (dm *DownloadManager) GetProgress() <-chan types.ProgressInfo {
-	return dm.downloader.GetProgressChannel()
+	return dm.progressCh
 }
 
 // GetErrors 获取错误信息
@@ -126,7 +548,6 @@ func (dm *DownloadManager) GetErrors() <-chan error {
 // Stop 停止所有下载
 func (dm *DownloadManager) Stop() {
 	close(dm.stopCh)
-	dm.downloader.Stop()
 }
 
 // GetTaskStatus 获取任务状态
@@ -138,19 +559,36 @@ func (dm *DownloadManager) GetTaskStatus(url string) (*types.DownloadTask, bool)
 	return task, exists
 }
 
-// GetAllTasks 获取所有任务
+// GetAllTasks 获取所有任务（按添加顺序）
 func (dm *DownloadManager) GetAllTasks() []*types.DownloadTask {
 	dm.mu.RLock()
 	defer dm.mu.RUnlock()
 	
 	tasks := make([]*types.DownloadTask, 0, len(dm.tasks))
-	for _, task := range dm.tasks {
-		tasks = append(tasks, task)
+	for _, url := range dm.order {
+		if task, exists := dm.tasks[url]; exists {
+			tasks = append(tasks, task)
+		}
 	}
 	
 	return tasks
 }
 
+// GetTaskSnapshots 获取所有任务的状态快照（按添加顺序），可在下载过程中安全读取
+func (dm *DownloadManager) GetTaskSnapshots() []types.DownloadTask {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	snapshots := make([]types.DownloadTask, 0, len(dm.tasks))
+	for _, url := range dm.order {
+		if task, exists := dm.tasks[url]; exists {
+			snapshots = append(snapshots, *task)
+		}
+	}
+
+	return snapshots
+}
+
 // RemoveTask 移除任务
 func (dm *DownloadManager) RemoveTask(url string) bool {
 	dm.mu.Lock()
@@ -158,19 +596,38 @@ func (dm *DownloadManager) RemoveTask(url string) bool {
 	
 	if _, exists := dm.tasks[url]; exists {
 		delete(dm.tasks, url)
+		for i, u := range dm.order {
+			if u == url {
+				dm.order = append(dm.order[:i], dm.order[i+1:]...)
+				break
+			}
+		}
 		return true
 	}
 	
 	return false
 }
 
-// PauseTask 暂停任务
+// PauseTask 暂停任务，正在下载的任务会被中断
 func (dm *DownloadManager) PauseTask(url string) bool {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 	
 	task, exists := dm.tasks[url]
-	if exists && task.Status == types.TaskDownloading {
+	if !exists {
+		return false
+	}
+
+	switch task.Status {
+	case types.TaskDownloading:
+		task.Status = types.TaskPaused
+		if current := dm.runs[url]; current != nil {
+			current.paused = true
+			current.cancel()
+		}
+		return true
+	case types.TaskPending:
+		// 已在队列中的任务被取出时会跳过
 		task.Status = types.TaskPaused
 		return true
 	}
@@ -178,18 +635,30 @@ func (dm *DownloadManager) PauseTask(url string) bool {
 	return false
 }
 
-// ResumeTask 恢复任务
+// ResumeTask 恢复任务，Start运行期间重新加入下载队列，否则在下次Start时下载
+// 续传取决于--continue，否则重新下载
 func (dm *DownloadManager) ResumeTask(url string) bool {
 	dm.mu.Lock()
 	defer dm.mu.Unlock()
 	
 	task, exists := dm.tasks[url]
-	if exists && task.Status == types.TaskPaused {
-		task.Status = types.TaskPending
-		return true
+	if !exists || task.Status != types.TaskPaused {
+		return false
+	}
+
+	task.Status = types.TaskPending
+	// 被暂停的下载尚未退出时，由其结束时重新加入队列
+	if dm.runs[url] == nil {
+		dm.requeueLocked(task)
+	}
+	return true
+}
+
+// requeueLocked Start运行期间将恢复的任务重新加入队列，调用方需持有dm.mu
+func (dm *DownloadManager) requeueLocked(task *types.DownloadTask) {
+	if dm.queue != nil && !dm.queued[task.URL] && len(dm.queue) < cap(dm.queue) {
+		dm.enqueueLocked(task)
 	}
-	
-	return false
 }
 
 // GetStatistics 获取统计信息
@@ -232,6 +701,18 @@ func (dm *DownloadManager) GetStatistics() *Statistics {
 	return stats
 }
 
+// GetSummary 获取下载汇总，Start运行期间耗时为已经过的时间
+func (dm *DownloadManager) GetSummary() types.DownloadSummary {
+	dm.mu.RLock()
+	defer dm.mu.RUnlock()
+
+	summary := dm.summary
+	if summary.Elapsed == 0 && !dm.startTime.IsZero() {
+		summary.Elapsed = time.Since(dm.startTime)
+	}
+	return summary
+}
+
 // Statistics 统计信息
 type Statistics struct {
 	TotalTasks   int
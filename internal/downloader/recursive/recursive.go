@@ -2,69 +2,194 @@ package recursive
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net/http"
 	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"runtime"
+	"sort"
 	"strings"
 	"sync"
+	"time"
 
+	"github.com/example/wget2go/internal/core/cache"
 	"github.com/example/wget2go/internal/core/converter"
 	"github.com/example/wget2go/internal/core/css"
 	"github.com/example/wget2go/internal/core/html"
-	"github.com/example/wget2go/internal/core/http"
+	httpCore "github.com/example/wget2go/internal/core/http"
 	"github.com/example/wget2go/internal/core/queue"
+	"github.com/example/wget2go/internal/core/ratelimit"
 	"github.com/example/wget2go/internal/core/robots"
 	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
 )
 
+// ResponseTransformer 在保存和解析之前转换文本响应（HTML、CSS等）的内容，
+// 如删除镜像页面中的统计脚本；返回错误时该文件不保存
+type ResponseTransformer func(url string, contentType string, body []byte) ([]byte, error)
+
+// ManifestEntry 清单中的一个已下载文件
+type ManifestEntry struct {
+	URL         string `json:"url"`
+	Path        string `json:"path"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
 // RecursiveDownloader 递归下载器
 type RecursiveDownloader struct {
 	config           *types.Config
-	httpClient       *http.Client
+	httpClient       *httpCore.Client
 	queueManager     *queue.Manager
 	htmlParser       *html.Parser
-	cssParser        *css.Parser
 	robotsParser     *robots.Parser
 	linkConverter    *converter.Converter
 	userAgent        string
-	downloadedFiles  map[string]bool
+	downloadedFiles  map[string]ManifestEntry // 按本地路径记录的已下载文件，与lastModified、adjustedPaths一样由mutex保护
+	lastModified     map[string]time.Time // 已下载文件的Last-Modified，用于--dir-timestamps
+	adjustedPaths    map[string]string    // -E时按URL得到的本地路径到追加扩展名后的实际路径
+	failedCount      int                  // 处理失败的URL数
 	mutex            sync.RWMutex
 	jobCounter       uint64
+
+	// 工作池状态：队列为空且没有活动的工作者时结束
+	workMutex        sync.Mutex
+	workCond         *sync.Cond
+	activeWorkers    int
+
+	// 蜘蛛模式下每个URL的状态码
+	linkStatus       map[string]int
+
+	// 详细输出的目标
+	out              io.Writer
+	outMutex         sync.Mutex
+
+	// 每个主机的爬取延迟和下一次允许请求的时间
+	crawlDelays      map[string]time.Duration
+	nextFetch        map[string]time.Time
+	hostMutex        sync.Mutex
+
+	// 每个主机的连接信号量，限制同时访问同一主机的连接数
+	hostSlots        map[string]chan struct{}
+
+	// 总下载量配额，nil表示不限制
+	quota            *ratelimit.Quota
+
+	// --cache的ETag/Last-Modified缓存，nil表示未启用
+	cache            *cache.Cache
+
+	// 文本响应的转换函数，nil表示不转换
+	transformer      ResponseTransformer
 }
 
 // NewRecursiveDownloader 创建递归下载器
-func NewRecursiveDownloader(httpClient *http.Client, config *types.Config) *RecursiveDownloader {
-	return &RecursiveDownloader{
+func NewRecursiveDownloader(httpClient *httpCore.Client, config *types.Config) *RecursiveDownloader {
+	rd := &RecursiveDownloader{
 		config:          config,
 		httpClient:      httpClient,
 		queueManager:    queue.NewManager(),
 		htmlParser:      html.NewParser(),
-		cssParser:       css.NewParser(),
 		robotsParser:    robots.NewParser(),
 		linkConverter:   converter.NewConverter(".", false),
-		downloadedFiles: make(map[string]bool),
+		downloadedFiles: make(map[string]ManifestEntry),
+		lastModified:    make(map[string]time.Time),
+		adjustedPaths:   make(map[string]string),
 		userAgent:       getUserAgent(config),
 		jobCounter:      0,
+		linkStatus:      make(map[string]int),
+		crawlDelays:     make(map[string]time.Duration),
+		nextFetch:       make(map[string]time.Time),
+		hostSlots:       make(map[string]chan struct{}),
+		out:             os.Stdout,
+	}
+	rd.workCond = sync.NewCond(&rd.workMutex)
+	rd.queueManager.SetTraversal(config.Traversal)
+	rd.htmlParser.DataURIs = rd.extractDataURIs()
+	return rd
+}
+
+// SetOutput 设置详细输出的目标，默认为标准输出
+func (rd *RecursiveDownloader) SetOutput(w io.Writer) {
+	rd.out = w
+}
+
+// SetQuota 设置总下载量配额，超出后不再下载和加入新的URL
+func (rd *RecursiveDownloader) SetQuota(quota *ratelimit.Quota) {
+	rd.quota = quota
+}
+
+// SetResponseTransformer 设置文本响应保存前的转换函数，nil表示不转换
+func (rd *RecursiveDownloader) SetResponseTransformer(transformer ResponseTransformer) {
+	rd.transformer = transformer
+}
+
+// logf 在详细模式下输出信息
+func (rd *RecursiveDownloader) logf(format string, args ...interface{}) {
+	if rd.config.Verbose {
+		rd.outMutex.Lock()
+		fmt.Fprintf(rd.out, format, args...)
+		rd.outMutex.Unlock()
 	}
 }
 
 // Download 执行递归下载
 func (rd *RecursiveDownloader) Download(ctx context.Context, startURL string, outputDir string) error {
-	// 创建输出目录
-	if err := os.MkdirAll(outputDir, 0755); err != nil {
-		return fmt.Errorf("创建输出目录失败: %w", err)
+	// 创建输出目录（蜘蛛模式不写入文件）
+	if !rd.config.Spider {
+		if err := os.MkdirAll(outputDir, 0755); err != nil {
+			return fmt.Errorf("创建输出目录失败: %w", err)
+		}
 	}
 
-	// 设置转换器的基础目录
+	// 设置转换器的基础目录，链接按与下载文件相同的目录布局转换
 	rd.linkConverter.SetBaseDir(outputDir)
+	rd.linkConverter.SetPathFunc(func(urlStr string) string {
+		// 与下载时一致，链接的不同写法（如默认端口、主机名大小写）对应同一个文件
+		localPath, err := rd.getOutputPath(rd.canonicalURL(urlStr), outputDir)
+		if err != nil {
+			return ""
+		}
+		// -E追加了扩展名的文件，链接指向实际保存的文件
+		rd.mutex.RLock()
+		defer rd.mutex.RUnlock()
+		if adjusted, ok := rd.adjustedPaths[localPath]; ok {
+			return adjusted
+		}
+		return localPath
+	})
+	// 只有实际下载的文件才转换为相对链接，跳过或被拒绝的URL保持为绝对URL
+	rd.linkConverter.SetDownloadedFunc(func(localPath string) bool {
+		rd.mutex.RLock()
+		defer rd.mutex.RUnlock()
+		_, ok := rd.downloadedFiles[localPath]
+		return ok
+	})
 	rd.linkConverter.SetBackup(rd.config.ConvertLinks)
+	rd.linkConverter.SetRewrites(rd.config.Rewrites)
+	rd.linkConverter.SetExtractDataURIs(rd.extractDataURIs(), rd.config.DataURIMinSize)
+	// --no-parent的根目录为起始URL所在的目录，递归和转换链接使用同一个判断
+	if rd.config.NoParent {
+		rd.linkConverter.SetNoParent(rd.canonicalURL(startURL))
+	}
+
+	// 加载上次运行记录的ETag和Last-Modified
+	if rd.config.Cache && !rd.config.Spider {
+		c, err := cache.Load(outputDir)
+		if err != nil {
+			return err
+		}
+		rd.cache = c
+	}
 
 	// 添加初始URL到队列
 	initialJob := &types.Job{
 		ID:              rd.nextJobID(),
-		URL:             startURL,
+		URL:             rd.canonicalURL(startURL),
 		Level:           0,
 		Flags:           types.URLFlagNone,
 		Status:          types.TaskPending,
@@ -78,64 +203,299 @@ func (rd *RecursiveDownloader) Download(ctx context.Context, startURL string, ou
 	// 下载并处理robots.txt
 	if rd.config.RobotsTxt {
 		if err := rd.downloadRobotsTxt(ctx, startURL); err != nil {
-			if rd.config.Verbose {
-				fmt.Printf("警告: 下载robots.txt失败: %v\n", err)
-			}
+			rd.logf("警告: 下载robots.txt失败: %v\n", err)
 		}
 	}
 
-	// 处理队列中的所有URL
-	for !rd.queueManager.IsEmpty() {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			job := rd.queueManager.Pop()
-			if job == nil {
-				continue
-			}
+	// 取消时唤醒所有等待中的工作者
+	stop := context.AfterFunc(ctx, func() {
+		rd.workMutex.Lock()
+		rd.workCond.Broadcast()
+		rd.workMutex.Unlock()
+	})
+	defer stop()
+
+	// 启动工作池处理队列中的所有URL
+	workers := rd.config.MaxThreads
+	if workers < 1 {
+		workers = 1
+	}
 
-			if err := rd.processJob(ctx, job, outputDir); err != nil {
-				if rd.config.Verbose {
-					fmt.Printf("处理URL失败: %s - %v\n", job.URL, err)
-				}
-			}
-		}
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rd.worker(ctx, outputDir)
+		}()
+	}
+	wg.Wait()
+
+	// 中断时也保存已更新的缓存
+	if err := rd.cache.Save(); err != nil {
+		rd.logf("警告: %v\n", err)
+	}
+
+	if err := ctx.Err(); err != nil {
+		return err
 	}
 
-	// 转换链接
-	if rd.config.ConvertLinks {
+	// 转换链接（蜘蛛模式不保存文件，无需转换）
+	if rd.config.ConvertLinks && !rd.config.Spider {
 		if err := rd.linkConverter.ConvertAll(); err != nil {
 			return fmt.Errorf("转换链接失败: %w", err)
 		}
 	}
 
+	// 在转换链接之后写入清单，路径和大小对应最终的文件
+	if rd.config.Manifest != "" && !rd.config.Spider {
+		if err := rd.WriteManifest(rd.config.Manifest); err != nil {
+			return err
+		}
+	}
+
+	// 在转换链接（可能创建.orig备份）和写入清单之后设置目录时间
+	if rd.config.DirTimestamps && !rd.config.Spider {
+		rd.setDirTimestamps(outputDir)
+	}
+
 	return nil
 }
 
+// setDirTimestamps 将输出目录下每个目录的修改时间设为其中（包括子目录中）最新文件的Last-Modified，
+// 没有Last-Modified的文件不参与计算，输出目录本身不修改
+func (rd *RecursiveDownloader) setDirTimestamps(outputDir string) {
+	root := filepath.Clean(outputDir)
+	newest := make(map[string]time.Time)
+
+	rd.mutex.RLock()
+	for file, modTime := range rd.lastModified {
+		for dir := filepath.Dir(file); dir != root && utils.IsWithinDir(root, dir); dir = filepath.Dir(dir) {
+			if modTime.After(newest[dir]) {
+				newest[dir] = modTime
+			}
+		}
+	}
+	rd.mutex.RUnlock()
+
+	for dir, modTime := range newest {
+		if err := os.Chtimes(dir, modTime, modTime); err != nil {
+			rd.logf("设置目录时间失败: %s: %v\n", dir, err)
+		}
+	}
+}
+
+// setServerTimestamp 将文件的修改时间设置为服务器的Last-Modified，之后的-N才能与远程文件正确比较
+// 设置了--no-use-server-timestamps或服务器没有返回Last-Modified时不修改
+func (rd *RecursiveDownloader) setServerTimestamp(outputPath string, header http.Header) {
+	if rd.config.NoUseServerTimestamps {
+		return
+	}
+	modTime, err := http.ParseTime(header.Get("Last-Modified"))
+	if err != nil {
+		return
+	}
+	if err := os.Chtimes(outputPath, time.Now(), modTime); err != nil {
+		rd.logf("设置文件修改时间失败: %s: %v\n", outputPath, err)
+	}
+}
+
+// recordDownloaded 记录已下载的文件及其Last-Modified，响应没有Content-Type时（如304）使用任务的内容类型
+func (rd *RecursiveDownloader) recordDownloaded(job *types.Job, outputPath string, header http.Header) {
+	contentType := header.Get("Content-Type")
+	if contentType == "" {
+		contentType = job.ContentType
+	}
+
+	rd.mutex.Lock()
+	defer rd.mutex.Unlock()
+	rd.downloadedFiles[outputPath] = ManifestEntry{
+		URL:         job.URL,
+		Path:        outputPath,
+		ContentType: contentType,
+	}
+	if modTime, err := http.ParseTime(header.Get("Last-Modified")); err == nil {
+		rd.lastModified[outputPath] = modTime
+	}
+}
+
+// worker 从队列中取出任务并处理，直到队列为空且所有工作者空闲
+func (rd *RecursiveDownloader) worker(ctx context.Context, outputDir string) {
+	for {
+		job := rd.nextJob(ctx)
+		if job == nil {
+			return
+		}
+
+		if err := rd.processJob(ctx, job, outputDir); err != nil {
+			rd.logf("处理URL失败: %s - %v\n", job.URL, err)
+			// 中断导致的失败不计入汇总
+			if ctx.Err() == nil {
+				rd.mutex.Lock()
+				rd.failedCount++
+				rd.mutex.Unlock()
+			}
+		}
+
+		rd.finishJob()
+	}
+}
+
+// nextJob 获取下一个任务，队列暂时为空时等待其他工作者产生新任务
+// 返回nil表示所有任务已完成或上下文已取消
+func (rd *RecursiveDownloader) nextJob(ctx context.Context) *types.Job {
+	rd.workMutex.Lock()
+	defer rd.workMutex.Unlock()
+
+	for {
+		if ctx.Err() != nil {
+			return nil
+		}
+
+		if job := rd.queueManager.Pop(); job != nil {
+			rd.activeWorkers++
+			return job
+		}
+
+		// 队列为空且没有工作者在处理，不会再有新任务
+		if rd.activeWorkers == 0 {
+			rd.workCond.Broadcast()
+			return nil
+		}
+
+		rd.workCond.Wait()
+	}
+}
+
+// finishJob 标记任务处理完成并唤醒等待的工作者
+func (rd *RecursiveDownloader) finishJob() {
+	rd.workMutex.Lock()
+	rd.activeWorkers--
+	rd.workCond.Broadcast()
+	rd.workMutex.Unlock()
+}
+
+// acquireHost 获取主机的连接槽位，返回的函数用于释放槽位
+// 设置了Crawl-delay的主机只有一个槽位，请求按顺序进行
+func (rd *RecursiveDownloader) acquireHost(ctx context.Context, urlStr string) (func(), error) {
+	host, err := rd.queueManager.GetHost(urlStr)
+	if err != nil {
+		return func() {}, nil
+	}
+
+	rd.hostMutex.Lock()
+	slots, ok := rd.hostSlots[host]
+	if !ok {
+		limit := rd.config.MaxConnectionsPerHost
+		if rd.crawlDelays[host] > 0 {
+			limit = 1
+		}
+		if limit > 0 {
+			slots = make(chan struct{}, limit)
+		}
+		rd.hostSlots[host] = slots
+	}
+	rd.hostMutex.Unlock()
+
+	// 未限制连接数
+	if slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// waitCrawlDelay 按robots.txt的Crawl-delay为同一主机的请求预留时间间隔
+func (rd *RecursiveDownloader) waitCrawlDelay(ctx context.Context, urlStr string) error {
+	host, err := rd.queueManager.GetHost(urlStr)
+	if err != nil {
+		return nil
+	}
+
+	rd.hostMutex.Lock()
+	delay := rd.crawlDelays[host]
+	if delay <= 0 {
+		rd.hostMutex.Unlock()
+		return nil
+	}
+
+	now := time.Now()
+	slot := rd.nextFetch[host]
+	if slot.Before(now) {
+		slot = now
+	}
+	rd.nextFetch[host] = slot.Add(delay)
+	rd.hostMutex.Unlock()
+
+	wait := time.Until(slot)
+	if wait <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // processJob 处理单个下载任务
 func (rd *RecursiveDownloader) processJob(ctx context.Context, job *types.Job, outputDir string) error {
 	// 标记为已访问
 	rd.queueManager.MarkVisited(job.URL)
 
+	// --referer=auto时以链接到该URL的页面作为Referer
+	if job.ParentURL != "" {
+		ctx = httpCore.WithReferer(ctx, job.ParentURL)
+	}
+
+	// 超出下载配额后不再开始新的文件
+	if rd.quota.Exceeded() {
+		rd.logf("已超出下载配额，跳过: %s\n", job.URL)
+		return nil
+	}
+
 	// 检查robots.txt
 	if !rd.queueManager.IsAllowedByRobots(job.URL, rd.userAgent) {
-		if rd.config.Verbose {
-			fmt.Printf("URL被robots.txt禁止: %s\n", job.URL)
-		}
+		rd.logf("URL被robots.txt禁止: %s\n", job.URL)
 		return nil
 	}
 
+	// 限制同一主机的并发连接数
+	release, err := rd.acquireHost(ctx, job.URL)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// 遵守同一主机的爬取延迟
+	if err := rd.waitCrawlDelay(ctx, job.URL); err != nil {
+		return err
+	}
+
 	// 确定输出路径
-	outputPath := rd.getOutputPath(job.URL, outputDir)
+	outputPath, err := rd.getOutputPath(job.URL, outputDir)
+	if err != nil {
+		return err
+	}
 
-	// 下载文件
-	if err := rd.downloadFile(ctx, job, outputPath); err != nil {
+	// 下载文件，-E时实际保存的路径可能追加了扩展名
+	outputPath, err = rd.downloadFile(ctx, job, outputPath)
+	if err != nil {
 		return err
 	}
 
-	// 检查是否需要继续递归
-	if !rd.shouldRecurse(job) {
+	// 检查是否需要继续递归（蜘蛛模式已在内存中解析）
+	if rd.config.Spider || !rd.shouldRecurse(job) {
 		return nil
 	}
 
@@ -147,59 +507,176 @@ func (rd *RecursiveDownloader) processJob(ctx context.Context, job *types.Job, o
 	return nil
 }
 
-// shouldRecurse 检查是否应该继续递归
+// shouldRecurse 检查是否应该解析文件并继续递归
+// 达到递归深度的页面在启用--page-requisites时仍需解析，以下载其必需资源（由queueURL过滤）
 func (rd *RecursiveDownloader) shouldRecurse(job *types.Job) bool {
 	if !rd.config.Recursive {
 		return false
 	}
 
 	// 检查递归深度
-	if rd.config.RecursiveLevel > 0 && job.Level >= rd.config.RecursiveLevel {
-		return false
+	if rd.atMaxDepth(job) {
+		return rd.config.PageRequisites
 	}
 
-	// 检查是否是页面必需资源
-	if job.Flags&types.URLFlagRequisite != 0 && rd.config.PageRequisites {
+	return true
+}
+
+// atMaxDepth 检查任务是否已达到递归深度
+func (rd *RecursiveDownloader) atMaxDepth(job *types.Job) bool {
+	return rd.config.RecursiveLevel > 0 && job.Level >= rd.config.RecursiveLevel
+}
+
+// isRequisite 检查URL是否为页面必需资源（图片、脚本、样式表、框架等内联内容，
+// 以及CSS中@import和url()引用的资源），超链接和引用（a、area、cite等）不是
+func isRequisite(parsedURL *types.ParsedURL) bool {
+	switch parsedURL.Tag {
+	case "css", "@import", "link":
 		return true
 	}
-
-	return true
+	switch parsedURL.Attr {
+	case "src", "srcset", "style", "data", "background", "poster":
+		return true
+	}
+	return false
 }
 
-// downloadFile 下载文件
-func (rd *RecursiveDownloader) downloadFile(ctx context.Context, job *types.Job, outputPath string) error {
+// downloadFile 下载文件，返回实际保存的路径
+func (rd *RecursiveDownloader) downloadFile(ctx context.Context, job *types.Job, outputPath string) (string, error) {
+	// 蜘蛛模式只检查链接，不写入文件
+	if rd.config.Spider {
+		return outputPath, rd.checkLink(ctx, job)
+	}
+
 	// 创建输出目录
 	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
-		return fmt.Errorf("创建目录失败: %w", err)
+		return outputPath, fmt.Errorf("创建目录失败: %w", err)
 	}
 
 	// 获取文件信息
 	resp, err := rd.httpClient.Head(ctx, job.URL)
 	if err != nil {
-		return fmt.Errorf("获取文件信息失败: %w", err)
+		return outputPath, fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	// 检查文件大小上限
+	if rd.config.MaxFileSize > 0 && resp.ContentLength > rd.config.MaxFileSize {
+		return outputPath, fmt.Errorf("%w: 服务器返回 %d 字节, 上限 %d 字节", utils.ErrFileTooLarge, resp.ContentLength, rd.config.MaxFileSize)
+	}
+
+	// -E时按内容类型追加缺少的扩展名，并记录以便转换链接指向实际的文件
+	if rd.config.AdjustExtension {
+		if adjusted := utils.AdjustExtension(outputPath, resp.ContentType); adjusted != outputPath {
+			rd.mutex.Lock()
+			rd.adjustedPaths[outputPath] = adjusted
+			rd.mutex.Unlock()
+			outputPath = adjusted
+		}
 	}
 
+	// 未修改时按HEAD返回的内容类型解析本地文件，下载成功时由GET响应覆盖
+	job.ContentType = resp.ContentType
+
 	// 检查内容类型
 	contentType := strings.ToLower(resp.ContentType)
 	if !strings.HasPrefix(contentType, "text/html") && 
 	   !strings.HasPrefix(contentType, "text/css") &&
 	   !strings.HasPrefix(contentType, "application/xml") {
 		// 非文本文件，直接下载
-		return rd.downloadBinaryFile(ctx, job, outputPath)
+		if err := rd.downloadBinaryFile(ctx, job, outputPath); err != nil {
+			return outputPath, err
+		}
+		rd.logf("%s: 作为二进制文件处理，未提取URL\n", job.URL)
+		return outputPath, nil
 	}
 
 	// 下载文本文件
-	return rd.downloadTextFile(ctx, job, outputPath)
+	return outputPath, rd.downloadTextFile(ctx, job, outputPath)
+}
+
+// checkLink 蜘蛛模式下检查链接状态，HTML和CSS内容在内存中解析以发现更多链接
+func (rd *RecursiveDownloader) checkLink(ctx context.Context, job *types.Job) error {
+	resp, err := rd.httpClient.Head(ctx, job.URL)
+	if err != nil {
+		return fmt.Errorf("获取文件信息失败: %w", err)
+	}
+
+	statusCode := resp.StatusCode
+	contentType := strings.ToLower(resp.ContentType)
+	isText := strings.HasPrefix(contentType, "text/html") || strings.HasPrefix(contentType, "text/css")
+
+	// 服务器不支持HEAD时使用GET
+	headRejected := statusCode == http.StatusMethodNotAllowed || statusCode == http.StatusNotImplemented
+	if !headRejected && (statusCode >= 400 || !isText || !rd.shouldRecurse(job)) {
+		rd.recordLinkStatus(job.URL, statusCode)
+		return nil
+	}
+
+	getResp, err := rd.httpClient.Get(ctx, job.URL, "")
+	if err != nil {
+		return err
+	}
+	defer getResp.Body.Close()
+
+	rd.recordLinkStatus(job.URL, getResp.StatusCode)
+	if getResp.StatusCode >= 400 || !rd.shouldRecurse(job) {
+		return nil
+	}
+
+	job.Encoding = "utf-8"
+	job.ContentType = getResp.Header.Get("Content-Type")
+
+	data, err := io.ReadAll(getResp.Body)
+	if err != nil {
+		return fmt.Errorf("读取数据失败: %w", err)
+	}
+
+	return rd.queueURLsFromData(job, data, "")
+}
+
+// recordLinkStatus 记录蜘蛛模式下的链接状态
+func (rd *RecursiveDownloader) recordLinkStatus(urlStr string, statusCode int) {
+	rd.mutex.Lock()
+	rd.linkStatus[urlStr] = statusCode
+	rd.mutex.Unlock()
+
+	rd.logf("%d %s\n", statusCode, urlStr)
+}
+
+// GetBrokenLinks 获取蜘蛛模式下返回4xx/5xx的链接及其状态码
+func (rd *RecursiveDownloader) GetBrokenLinks() map[string]int {
+	rd.mutex.RLock()
+	defer rd.mutex.RUnlock()
+
+	broken := make(map[string]int)
+	for urlStr, statusCode := range rd.linkStatus {
+		if statusCode >= 400 {
+			broken[urlStr] = statusCode
+		}
+	}
+	return broken
+}
+
+// GetCheckedCount 获取蜘蛛模式下已检查的链接数量
+func (rd *RecursiveDownloader) GetCheckedCount() int {
+	rd.mutex.RLock()
+	defer rd.mutex.RUnlock()
+	return len(rd.linkStatus)
 }
 
 // downloadBinaryFile 下载二进制文件
 func (rd *RecursiveDownloader) downloadBinaryFile(ctx context.Context, job *types.Job, outputPath string) error {
-	resp, err := rd.httpClient.Get(ctx, job.URL, "")
+	resp, err := rd.get(ctx, job, outputPath)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusNotModified {
+		rd.keepCached(job, outputPath)
+		return nil
+	}
+
 	// 创建输出文件
 	file, err := os.Create(outputPath)
 	if err != nil {
@@ -208,28 +685,57 @@ func (rd *RecursiveDownloader) downloadBinaryFile(ctx context.Context, job *type
 	defer file.Close()
 
 	// 复制数据
-	if _, err := io.Copy(file, resp.Body); err != nil {
+	written, err := io.Copy(file, rd.limitSize(resp.Body))
+	rd.quota.Add(written)
+	if errors.Is(err, utils.ErrFileTooLarge) {
+		// 超出大小上限的文件不保留
+		file.Close()
+		os.Remove(outputPath)
+		return fmt.Errorf("%w: 已接收超过 %d 字节", err, rd.config.MaxFileSize)
+	}
+	if err != nil {
 		return fmt.Errorf("写入文件失败: %w", err)
 	}
 
 	// 记录已下载文件
-	rd.mutex.Lock()
-	rd.downloadedFiles[outputPath] = true
-	rd.mutex.Unlock()
+	rd.setServerTimestamp(outputPath, resp.Header)
+	rd.recordDownloaded(job, outputPath, resp.Header)
+	rd.updateCache(job.URL, resp)
 
 	return nil
 }
 
 // downloadTextFile 下载文本文件
 func (rd *RecursiveDownloader) downloadTextFile(ctx context.Context, job *types.Job, outputPath string) error {
-	resp, err := rd.httpClient.Get(ctx, job.URL, "")
+	resp, err := rd.get(ctx, job, outputPath)
 	if err != nil {
 		return err
 	}
 	defer resp.Body.Close()
 
+	// 未修改时保留本地文件，之后照常从本地文件中提取URL
+	if resp.StatusCode == http.StatusNotModified {
+		rd.keepCached(job, outputPath)
+		return nil
+	}
+
+	// 按Content-Encoding解压（即使请求identity，部分代理仍会返回压缩内容），
+	// 保存解压后的内容，解析和链接转换都需要原始文本
+	encodings, err := httpCore.ParseContentEncodings(resp.Header)
+	if err != nil {
+		return err
+	}
+	body, err := httpCore.NewContentDecoder(resp.Body, encodings)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
 	// 读取数据
-	data, err := io.ReadAll(resp.Body)
+	data, err := io.ReadAll(rd.limitSize(body))
+	if errors.Is(err, utils.ErrFileTooLarge) {
+		return fmt.Errorf("%w: 已接收超过 %d 字节", err, rd.config.MaxFileSize)
+	}
 	if err != nil {
 		return fmt.Errorf("读取数据失败: %w", err)
 	}
@@ -238,19 +744,77 @@ func (rd *RecursiveDownloader) downloadTextFile(ctx context.Context, job *types.
 	job.Encoding = "utf-8"
 	job.ContentType = resp.Header.Get("Content-Type")
 
+	// 转换内容，保存和之后的链接提取都使用转换后的内容，配额按转换前的内容计算
+	received := int64(len(data))
+	if rd.transformer != nil {
+		data, err = rd.transformer(job.URL, job.ContentType, data)
+		if err != nil {
+			return fmt.Errorf("转换响应内容失败: %w", err)
+		}
+	}
+
 	// 写入文件
 	if err := os.WriteFile(outputPath, data, 0644); err != nil {
 		return fmt.Errorf("写入文件失败: %w", err)
 	}
+	rd.quota.Add(received)
 
 	// 记录已下载文件
-	rd.mutex.Lock()
-	rd.downloadedFiles[outputPath] = true
-	rd.mutex.Unlock()
+	rd.setServerTimestamp(outputPath, resp.Header)
+	rd.recordDownloaded(job, outputPath, resp.Header)
+	rd.updateCache(job.URL, resp)
 
 	return nil
 }
 
+// limitSize 设置了--max-filesize时限制读取的字节数，服务器未声明大小时在传输中检查上限
+func (rd *RecursiveDownloader) limitSize(r io.Reader) io.Reader {
+	if rd.config.MaxFileSize <= 0 {
+		return r
+	}
+	return utils.NewMaxSizeReader(r, rd.config.MaxFileSize)
+}
+
+// get 下载URL，启用--cache且本地文件存在时按缓存的ETag和Last-Modified发送条件请求，
+// 否则启用-N且本地文件存在时按本地文件的修改时间发送If-Modified-Since
+func (rd *RecursiveDownloader) get(ctx context.Context, job *types.Job, outputPath string) (*http.Response, error) {
+	if conditions := rd.cache.ConditionalHeader(job.URL); conditions != nil && utils.FileExists(outputPath) {
+		return rd.httpClient.GetConditional(ctx, job.URL, conditions)
+	}
+	if rd.config.Timestamping {
+		if info, err := os.Stat(outputPath); err == nil && info.Mode().IsRegular() {
+			return rd.httpClient.GetIfModifiedSince(ctx, job.URL, info.ModTime())
+		}
+	}
+	return rd.httpClient.Get(ctx, job.URL, "")
+}
+
+// keepCached 服务器返回304时保留本地文件，按缓存的信息将其视为已下载
+// 没有缓存信息（-N）时沿用HEAD返回的内容类型，Last-Modified取本地文件的修改时间
+func (rd *RecursiveDownloader) keepCached(job *types.Job, outputPath string) {
+	entry, _ := rd.cache.Get(job.URL)
+	job.Encoding = "utf-8"
+	if entry.ContentType != "" {
+		job.ContentType = entry.ContentType
+	}
+
+	header := make(http.Header)
+	if entry.LastModified != "" {
+		header.Set("Last-Modified", entry.LastModified)
+	} else if info, err := os.Stat(outputPath); err == nil && rd.config.Timestamping {
+		header.Set("Last-Modified", info.ModTime().UTC().Format(http.TimeFormat))
+	}
+	rd.recordDownloaded(job, outputPath, header)
+	rd.logf("%s: 未修改，保留本地文件\n", job.URL)
+}
+
+// updateCache 记录成功下载的URL的ETag和Last-Modified
+func (rd *RecursiveDownloader) updateCache(urlStr string, resp *http.Response) {
+	if resp.StatusCode == http.StatusOK {
+		rd.cache.Update(urlStr, resp.Header)
+	}
+}
+
 // parseAndQueueURLs 解析文件内容并提取URL
 func (rd *RecursiveDownloader) parseAndQueueURLs(ctx context.Context, job *types.Job, outputPath string) error {
 	// 读取文件内容
@@ -259,10 +823,17 @@ func (rd *RecursiveDownloader) parseAndQueueURLs(ctx context.Context, job *types
 		return fmt.Errorf("读取文件失败: %w", err)
 	}
 
+	return rd.queueURLsFromData(job, data, outputPath)
+}
+
+// queueURLsFromData 解析内容并将提取的URL添加到队列
+// outputPath为空表示内容未保存到磁盘，不添加到转换列表
+func (rd *RecursiveDownloader) queueURLsFromData(job *types.Job, data []byte, outputPath string) error {
 	// 根据内容类型选择解析器
 	contentType := strings.ToLower(job.ContentType)
 
 	var result *types.ParsedResult
+	var err error
 
 	if strings.HasPrefix(contentType, "text/html") {
 		result, err = rd.htmlParser.Parse(data, job.URL)
@@ -272,59 +843,138 @@ func (rd *RecursiveDownloader) parseAndQueueURLs(ctx context.Context, job *types
 
 		// 检查META robots标签
 		if rd.config.RobotsTxt && !result.Follow {
+			rd.logf("%s: 按HTML解析，META robots禁止跟踪链接\n", job.URL)
 			return nil
 		}
 
 		// 添加到转换列表
-		if rd.config.ConvertLinks {
+		if rd.config.ConvertLinks && outputPath != "" {
 			rd.linkConverter.AddConversion(outputPath, job.URL, result)
 		}
 
 	} else if strings.HasPrefix(contentType, "text/css") {
-		result, err = rd.cssParser.Parse(data, job.URL)
+		// CSS解析器保存了baseURL状态，每次解析使用独立实例以支持并发
+		cssParser := css.NewParser()
+		cssParser.DataURIs = rd.extractDataURIs()
+		result, err = cssParser.Parse(data, job.URL)
 		if err != nil {
 			return fmt.Errorf("解析CSS失败: %w", err)
 		}
+
+		// 只有需要解码data: URL时才转换CSS文件
+		if rd.extractDataURIs() && outputPath != "" {
+			rd.linkConverter.AddConversion(outputPath, job.URL, result)
+		}
+	}
+
+	// 报告处理该文件的解析器和提取的URL数量
+	if result == nil {
+		rd.logf("%s: 按%s处理，没有可用的解析器，未提取URL\n", job.URL, parserName(contentType))
+		return nil
 	}
+	rd.logf("%s: 按%s解析，提取了%d个URL\n", job.URL, parserName(contentType), len(result.URLs))
 
 	// 将提取的URL添加到队列
-	if result != nil {
-		for _, parsedURL := range result.URLs {
-			rd.queueURL(job, parsedURL)
-		}
+	for _, parsedURL := range result.URLs {
+		rd.queueURL(job, parsedURL)
 	}
 
 	return nil
 }
 
+// extractDataURIs 检查是否在转换链接时将data: URL解码保存为文件（--extract-data-uris，需要--convert-links）
+func (rd *RecursiveDownloader) extractDataURIs() bool {
+	return rd.config.ExtractDataURIs && rd.config.ConvertLinks && !rd.config.Spider
+}
+
+// parserName 根据内容类型获取详细输出中使用的解析器名称
+func parserName(contentType string) string {
+	switch {
+	case strings.HasPrefix(contentType, "text/html"):
+		return "HTML"
+	case strings.HasPrefix(contentType, "text/css"):
+		return "CSS"
+	case strings.HasPrefix(contentType, "application/xml"), strings.HasPrefix(contentType, "text/xml"):
+		return "XML"
+	default:
+		return "文本"
+	}
+}
+
+// acceptURL 按--reject-regex和--accept-regex判断是否下载该URL
+func (rd *RecursiveDownloader) acceptURL(urlStr string) bool {
+	if rd.config.RejectRegex != nil && rd.config.RejectRegex.MatchString(urlStr) {
+		return false
+	}
+	return rd.config.AcceptRegex == nil || rd.config.AcceptRegex.MatchString(urlStr)
+}
+
+// canonicalURL 返回用于去重的规范URL，设置了--no-canonicalize时原样返回
+func (rd *RecursiveDownloader) canonicalURL(urlStr string) string {
+	if rd.config.NoCanonicalize {
+		return urlStr
+	}
+	return utils.CanonicalURL(urlStr)
+}
+
 // queueURL 将URL添加到队列
 func (rd *RecursiveDownloader) queueURL(parentJob *types.Job, parsedURL *types.ParsedURL) error {
+	// 超出下载配额后不再加入新的URL
+	if rd.quota.Exceeded() {
+		return nil
+	}
+
 	// 跳过非HTTP协议的URL
 	if !strings.HasPrefix(parsedURL.URL, "http://") && !strings.HasPrefix(parsedURL.URL, "https://") {
 		return nil
 	}
 
+	// 去重和过滤使用规范化后的URL，队列中的任务也请求规范化后的URL
+	urlStr := rd.canonicalURL(parsedURL.URL)
+
 	// 检查是否已被访问或已在队列中
-	if rd.queueManager.IsVisited(parsedURL.URL) || rd.queueManager.Contains(parsedURL.URL) {
+	if rd.queueManager.IsVisited(urlStr) || rd.queueManager.Contains(urlStr) {
 		return nil
 	}
 
 	// 检查是否在黑名单中
-	if rd.queueManager.IsInBlacklist(parsedURL.URL) {
+	if rd.queueManager.IsInBlacklist(urlStr) {
+		return nil
+	}
+
+	// --no-parent时不进入起始目录的上级目录，其他主机的URL不受限制
+	if rd.config.NoParent && rd.linkConverter.IsAboveParent(urlStr) {
+		return nil
+	}
+
+	// --reject-regex优先于--accept-regex，两者都匹配完整URL（包括查询字符串），对必需资源同样生效
+	if !rd.acceptURL(urlStr) {
 		return nil
 	}
 
 	// 确定URL标志
 	flags := types.URLFlagNone
-	if parsedURL.Attr == "src" || parsedURL.Attr == "href" || parsedURL.Tag == "img" || parsedURL.Tag == "script" {
+	if isRequisite(parsedURL) {
 		flags |= types.URLFlagRequisite
 	}
 
+	// 启用--page-requisites时必需资源不受递归深度限制；其他链接受深度限制，
+	// 且不从必需资源中继续跟随（必需资源只提供其引用的必需资源，如CSS中的图片）
+	if !rd.config.PageRequisites || flags&types.URLFlagRequisite == 0 {
+		if rd.atMaxDepth(parentJob) {
+			return nil
+		}
+		if rd.config.PageRequisites && parentJob.Flags&types.URLFlagRequisite != 0 {
+			return nil
+		}
+	}
+
 	// 创建新任务
 	newJob := &types.Job{
 		ID:         rd.nextJobID(),
 		ParentID:   parentJob.ID,
-		URL:        parsedURL.URL,
+		ParentURL:  parentJob.URL,
+		URL:        urlStr,
 		Level:      parentJob.Level + 1,
 		Flags:      flags,
 		Status:     types.TaskPending,
@@ -347,8 +997,11 @@ func (rd *RecursiveDownloader) downloadRobotsTxt(ctx context.Context, urlStr str
 		return err
 	}
 
-	host := u.Hostname()
-	robotsURL := fmt.Sprintf("%s://%s/robots.txt", u.Scheme, host)
+	host, err := rd.queueManager.GetHost(urlStr)
+	if err != nil {
+		return err
+	}
+	robotsURL := fmt.Sprintf("%s://%s/robots.txt", u.Scheme, u.Host)
 
 	// 下载robots.txt
 	resp, err := rd.httpClient.Get(ctx, robotsURL, "")
@@ -376,42 +1029,85 @@ func (rd *RecursiveDownloader) downloadRobotsTxt(ctx context.Context, urlStr str
 	}
 	rd.queueManager.SetRobotsParser(host, robotsParser)
 
-	if rd.config.Verbose {
-		fmt.Printf("已下载并解析robots.txt: %s\n", robotsURL)
+	// 记录该主机的爬取延迟
+	if delay := rd.robotsParser.GetCrawlDelay(rd.userAgent); delay > 0 {
+		rd.hostMutex.Lock()
+		rd.crawlDelays[host] = time.Duration(delay) * time.Second
+		rd.hostMutex.Unlock()
 	}
 
+	rd.logf("已下载并解析robots.txt: %s\n", robotsURL)
+
 	return nil
 }
 
-// getOutputPath 获取输出路径
-func (rd *RecursiveDownloader) getOutputPath(urlStr, outputDir string) string {
+// getOutputPath 获取输出路径，路径中的重复斜杠和点段会被规范化，
+// 结果不在输出目录内时返回错误
+func (rd *RecursiveDownloader) getOutputPath(urlStr, outputDir string) (string, error) {
 	u, err := url.Parse(urlStr)
 	if err != nil {
-		return filepath.Join(outputDir, "index.html")
+		return filepath.Join(outputDir, "index.html"), nil
 	}
 
-	path := u.Path
-	if path == "" || path == "/" {
-		path = "/index.html"
+	// 规范化路径，如果路径以/结尾，添加index.html
+	urlPath := path.Clean("/" + u.Path)
+	if u.Path == "" || strings.HasSuffix(u.Path, "/") {
+		urlPath = path.Join(urlPath, "index.html")
 	}
 
-	// 移除查询参数和锚点
-	if idx := strings.Index(path, "?"); idx != -1 {
-		path = path[:idx]
+	// 去除前N级目录
+	urlPath = cutDirs(urlPath, rd.config.CutDirs)
+
+	// 按--restrict-file-names转义每个路径分量
+	segments := strings.Split(urlPath, "/")
+	for i, segment := range segments {
+		segments[i] = utils.RestrictFileName(segment, rd.config.RestrictFileNames)
 	}
-	if idx := strings.Index(path, "#"); idx != -1 {
-		path = path[:idx]
+	urlPath = strings.Join(segments, "/")
+
+	// 与wget一致，默认保存到以主机名命名的目录下
+	baseDir := outputDir
+	if !rd.config.NoHostDirectories {
+		baseDir = filepath.Join(outputDir, rd.hostDirName(u))
 	}
 
 	// 转换为本地路径
-	localPath := filepath.Join(outputDir, filepath.FromSlash(path))
+	localPath := filepath.Join(baseDir, filepath.FromSlash(urlPath))
+	if !utils.IsWithinDir(outputDir, localPath) {
+		return "", fmt.Errorf("路径超出输出目录: %s", urlStr)
+	}
+	return localPath, nil
+}
+
+// hostDirName 获取主机目录名，非默认端口以"host:port"形式保留（Windows上使用"+"）
+func (rd *RecursiveDownloader) hostDirName(u *url.URL) string {
+	host := u.Hostname()
+	if !rd.config.NoIRI {
+		// 国际化域名保存为可读形式
+		host = utils.URLHostDir(u.String())
+	}
+	if port := u.Port(); port != "" {
+		separator := ":"
+		if runtime.GOOS == "windows" {
+			separator = "+"
+		}
+		host += separator + port
+	}
+	return host
+}
 
-	// 如果路径以/结尾，添加index.html
-	if strings.HasSuffix(localPath, string(filepath.Separator)) {
-		localPath = filepath.Join(localPath, "index.html")
+// cutDirs 去除路径中前n级目录，文件名始终保留
+func cutDirs(path string, n int) string {
+	if n <= 0 {
+		return path
 	}
 
-	return localPath
+	segments := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	dirs := len(segments) - 1
+	if n > dirs {
+		n = dirs
+	}
+	return "/" + strings.Join(segments[n:], "/")
 }
 
 // nextJobID 生成下一个任务ID
@@ -422,7 +1118,7 @@ func (rd *RecursiveDownloader) nextJobID() uint64 {
 	return rd.jobCounter
 }
 
-// GetDownloadedFiles 获取已下载的文件列表
+// GetDownloadedFiles 获取已下载的文件列表，按路径排序
 func (rd *RecursiveDownloader) GetDownloadedFiles() []string {
 	rd.mutex.RLock()
 	defer rd.mutex.RUnlock()
@@ -431,9 +1127,42 @@ func (rd *RecursiveDownloader) GetDownloadedFiles() []string {
 	for file := range rd.downloadedFiles {
 		files = append(files, file)
 	}
+	sort.Strings(files)
 	return files
 }
 
+// GetManifest 获取已下载文件的清单，按路径排序，大小为调用时磁盘上文件的大小
+func (rd *RecursiveDownloader) GetManifest() []ManifestEntry {
+	rd.mutex.RLock()
+	entries := make([]ManifestEntry, 0, len(rd.downloadedFiles))
+	for _, entry := range rd.downloadedFiles {
+		entries = append(entries, entry)
+	}
+	rd.mutex.RUnlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].Path < entries[j].Path
+	})
+	for i := range entries {
+		if info, err := os.Stat(entries[i].Path); err == nil {
+			entries[i].Size = info.Size()
+		}
+	}
+	return entries
+}
+
+// WriteManifest 将已下载文件的清单以JSON数组写入filename
+func (rd *RecursiveDownloader) WriteManifest(filename string) error {
+	data, err := json.MarshalIndent(rd.GetManifest(), "", "  ")
+	if err != nil {
+		return fmt.Errorf("编码清单失败: %w", err)
+	}
+	if err := os.WriteFile(filename, append(data, '\n'), 0644); err != nil {
+		return fmt.Errorf("写入清单文件失败: %w", err)
+	}
+	return nil
+}
+
 // GetDownloadedCount 获取已下载文件数量
 func (rd *RecursiveDownloader) GetDownloadedCount() int {
 	rd.mutex.RLock()
@@ -441,6 +1170,18 @@ func (rd *RecursiveDownloader) GetDownloadedCount() int {
 	return len(rd.downloadedFiles)
 }
 
+// GetSummary 获取下载汇总：已下载的文件数和总字节数，以及处理失败的URL数
+func (rd *RecursiveDownloader) GetSummary() types.DownloadSummary {
+	summary := types.DownloadSummary{Files: rd.GetDownloadedCount()}
+	for _, entry := range rd.GetManifest() {
+		summary.Bytes += entry.Size
+	}
+	rd.mutex.RLock()
+	summary.Failed = rd.failedCount
+	rd.mutex.RUnlock()
+	return summary
+}
+
 // GetStats 获取下载统计信息
 func (rd *RecursiveDownloader) GetStats() map[string]int {
 	return rd.queueManager.GetStats()
@@ -1,6 +1,8 @@
 package test
 
 import (
+	"fmt"
+	"strings"
 	"testing"
 	"time"
 
@@ -55,6 +57,26 @@ func TestFormatSize(t *testing.T) {
 	}
 }
 
+func TestFormatBitRate(t *testing.T) {
+	tests := []struct {
+		input    int64
+		expected string
+	}{
+		{100, "800 b/s"},
+		{125, "1.0 Kb/s"},
+		{125000, "1.0 Mb/s"},
+		{1250000, "10.0 Mb/s"},
+		{125000000, "1.0 Gb/s"},
+	}
+
+	for _, tt := range tests {
+		result := utils.FormatBitRate(tt.input)
+		if result != tt.expected {
+			t.Errorf("FormatBitRate(%d) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
 func TestCalculateETA(t *testing.T) {
 	tests := []struct {
 		total      int64
@@ -148,6 +170,86 @@ func TestSafeFileName(t *testing.T) {
 	}
 }
 
+func TestRestrictFileNameWindowsReservedNames(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"CON", "CON_"},
+		{"con.txt", "con_.txt"},
+		{"Com1.tar.gz", "Com1_.tar.gz"},
+		{"LPT9", "LPT9_"},
+		{"CONSOLE.txt", "CONSOLE.txt"},
+		{"COM10", "COM10"},
+		{"trailing. .", "trailing%2E%20%2E"},
+		{"a:b?c*.txt", "a%3Ab%3Fc%2A.txt"},
+		{"tab\tname", "tab%09name"},
+	}
+
+	for _, tt := range tests {
+		result := utils.RestrictFileName(tt.input, types.RestrictFileNamesWindows)
+		if result != tt.expected {
+			t.Errorf("RestrictFileName(%q, windows) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestRestrictFileNameUnicode(t *testing.T) {
+	tests := []struct {
+		input    string
+		modes    string
+		expected string
+	}{
+		{"日本語.html", "unix", "日本語.html"},
+		{"日本語.html", "windows", "日本語.html"},
+		{"日本語.html", "unix,ascii", "%E6%97%A5%E6%9C%AC%E8%AA%9E.html"},
+		{"café:menu.txt", "windows,ascii", "caf%C3%A9%3Amenu.txt"},
+		// U+0085是C1控制字符，按字符转义而不是转义UTF-8的每个字节
+		{"a\u0085b", "unix", "a%C2%85b"},
+		{"a\u0085b", "unix,nocontrol", "a\u0085b"},
+		{"a:b", "unix", "a:b"},
+	}
+
+	for _, tt := range tests {
+		result := utils.RestrictFileName(tt.input, tt.modes)
+		if result != tt.expected {
+			t.Errorf("RestrictFileName(%q, %q) = %q, expected %q", tt.input, tt.modes, result, tt.expected)
+		}
+	}
+
+	if err := utils.ValidateRestrictFileNames("unix,windows"); err == nil {
+		t.Error("expected error combining unix and windows")
+	}
+	if err := utils.ValidateRestrictFileNames("lowercase"); err == nil {
+		t.Error("expected error for unknown mode")
+	}
+}
+
+func TestAdjustExtension(t *testing.T) {
+	tests := []struct {
+		input       string
+		contentType string
+		expected    string
+	}{
+		{"page", "text/html; charset=utf-8", "page.html"},
+		{"page.php", "text/html", "page.php.html"},
+		{"index.html", "text/html", "index.html"},
+		{"old.HTM", "TEXT/HTML", "old.HTM"},
+		{"page.xhtml", "application/xhtml+xml", "page.xhtml.html"},
+		{"style", "text/css", "style.css"},
+		{"style.css", "text/css", "style.css"},
+		{"data.json", "application/json", "data.json"},
+		{"image", "", "image"},
+	}
+
+	for _, tt := range tests {
+		result := utils.AdjustExtension(tt.input, tt.contentType)
+		if result != tt.expected {
+			t.Errorf("AdjustExtension(%q, %q) = %q, expected %q", tt.input, tt.contentType, result, tt.expected)
+		}
+	}
+}
+
 func TestHumanReadableTime(t *testing.T) {
 	now := time.Now()
 	
@@ -169,4 +271,90 @@ func TestHumanReadableTime(t *testing.T) {
 			t.Errorf("HumanReadableTime(%v) returned empty string", tt.time)
 		}
 	}
-}
\ No newline at end of file
+}
+
+func TestCanonicalURL(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"http://example.com/page?b=2&a=1", "http://example.com/page?a=1&b=2"},
+		{"http://example.com/page?a=1&b=2#top", "http://example.com/page?a=1&b=2"},
+		{"HTTP://Example.COM:80/Page", "http://example.com/Page"},
+		{"https://example.com:443/", "https://example.com/"},
+		{"https://example.com:8443/x", "https://example.com:8443/x"},
+		{"http://example.com", "http://example.com/"},
+		{"http://example.com/a/./b/../c/", "http://example.com/a/c/"},
+		{"http://example.com/../x", "http://example.com/x"},
+		{"http://example.com/dir/", "http://example.com/dir/"},
+		{"http://example.com/s?tag=b&x=1&tag=a", "http://example.com/s?tag=b&tag=a&x=1"},
+		{"http://example.com/a%20b?q=%2F", "http://example.com/a%20b?q=%2F"},
+		{"http://[::1]:80/", "http://[::1]/"},
+	}
+
+	for _, tt := range tests {
+		if result := utils.CanonicalURL(tt.input); result != tt.expected {
+			t.Errorf("CanonicalURL(%q) = %q, expected %q", tt.input, result, tt.expected)
+		}
+	}
+}
+
+func TestExpandURLs(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{"NumericRange", []string{"http://a/{1..3}.jpg"}, []string{"http://a/1.jpg", "http://a/2.jpg", "http://a/3.jpg"}},
+		{"DescendingRange", []string{"http://a/{3..1}"}, []string{"http://a/3", "http://a/2", "http://a/1"}},
+		{"ZeroPadding", []string{"http://a/{08..11}"}, []string{"http://a/08", "http://a/09", "http://a/10", "http://a/11"}},
+		{"NegativePadding", []string{"http://a/{-01..01}"}, []string{"http://a/-01", "http://a/00", "http://a/01"}},
+		{"Letters", []string{"http://a/{x..z}", "http://b/{B..A}"}, []string{"http://a/x", "http://a/y", "http://a/z", "http://b/B", "http://b/A"}},
+		{"Set", []string{"http://{www,cdn}.a/f"}, []string{"http://www.a/f", "http://cdn.a/f"}},
+		{"CartesianProduct", []string{"http://a/{x,y}/{1..2}"}, []string{"http://a/x/1", "http://a/x/2", "http://a/y/1", "http://a/y/2"}},
+		// 不支持嵌套：只展开内层，外层花括号原样保留
+		{"NestedSet", []string{"http://a/{x,{1..2}}"}, []string{"http://a/{x,1}", "http://a/{x,2}"}},
+		{"NotAnExpression", []string{"http://a/{id}?q={}"}, []string{"http://a/{id}?q={}"}},
+		{"MinInt64", []string{"http://a/{-9223372036854775808..-9223372036854775807}"},
+			[]string{"http://a/-9223372036854775808", "http://a/-9223372036854775807"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := utils.ExpandURLs(tt.input)
+			if err != nil {
+				t.Fatalf("ExpandURLs(%q) failed: %v", tt.input, err)
+			}
+			if strings.Join(result, " ") != strings.Join(tt.expected, " ") {
+				t.Errorf("ExpandURLs(%q) = %q, expected %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestExpandURLsLimit(t *testing.T) {
+	atLimit := fmt.Sprintf("http://a/{1..%d}", utils.MaxExpandedURLs)
+	if result, err := utils.ExpandURLs([]string{atLimit}); err != nil || len(result) != utils.MaxExpandedURLs {
+		t.Errorf("expected exactly %d URLs, got %d (%v)", utils.MaxExpandedURLs, len(result), err)
+	}
+
+	tests := []struct {
+		name  string
+		input []string
+	}{
+		{"RangeOverLimit", []string{fmt.Sprintf("http://a/{0..%d}", utils.MaxExpandedURLs)}},
+		{"ProductOverLimit", []string{"http://a/{1..101}/{1..100}"}},
+		{"TotalOverLimit", []string{atLimit, "http://b/"}},
+		// 跨度超出int64时不能溢出为负数绕过上限
+		{"MaxInt64Range", []string{"http://a/{0..9223372036854775807}"}},
+		{"FullInt64Range", []string{"http://a/{-9223372036854775808..9223372036854775807}"}},
+		{"FullInt64RangeDescending", []string{"http://a/{9223372036854775807..-9223372036854775808}"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result, err := utils.ExpandURLs(tt.input); err == nil {
+				t.Errorf("expected an error for %q, got %d URLs", tt.input, len(result))
+			}
+		})
+	}
+}
@@ -0,0 +1,285 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/core/ratelimit"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/downloader/multi_thread"
+)
+
+func TestBatchStateSkipsCompletedURLs(t *testing.T) {
+	var mu sync.Mutex
+	gets := make(map[string]int)
+	failThird := true
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Method == http.MethodGet {
+			gets[r.URL.Path]++
+		}
+		fail := failThird && r.URL.Path == "/c.txt"
+		mu.Unlock()
+
+		if fail {
+			http.Error(w, "unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	statePath := filepath.Join(dir, multi_thread.DefaultBatchStateFile)
+	names := []string{"a.txt", "b.txt", "c.txt"}
+
+	runBatch := func() error {
+		cfg := newTestConfig()
+		cfg.ChunkSize = 1024 * 1024
+		cfg.Continue = true
+		cfg.Quiet = true
+
+		manager := multi_thread.NewDownloadManager(cfg)
+		defer manager.Stop()
+		if err := manager.EnableBatchState(statePath); err != nil {
+			return err
+		}
+		for _, name := range names {
+			if err := manager.AddTask(server.URL+"/"+name, filepath.Join(dir, name)); err != nil {
+				return err
+			}
+		}
+		return manager.Start(context.Background())
+	}
+
+	// 第一次运行：前两个URL完成，第三个失败
+	if err := runBatch(); err == nil {
+		t.Fatal("expected first run to fail on the third URL")
+	}
+
+	mu.Lock()
+	failThird = false
+	firstA, firstB, firstC := gets["/a.txt"], gets["/b.txt"], gets["/c.txt"]
+	mu.Unlock()
+
+	if firstA == 0 || firstB == 0 {
+		t.Fatalf("expected first two URLs to be downloaded, got a=%d b=%d", firstA, firstB)
+	}
+
+	// 第二次运行：只应下载第三个URL
+	if err := runBatch(); err != nil {
+		t.Fatalf("second run failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if gets["/a.txt"] != firstA || gets["/b.txt"] != firstB {
+		t.Errorf("completed URLs were downloaded again: a=%d->%d b=%d->%d",
+			firstA, gets["/a.txt"], firstB, gets["/b.txt"])
+	}
+	if gets["/c.txt"] <= firstC {
+		t.Errorf("expected third URL to be downloaded on second run")
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("batch state file should be removed after the batch completes")
+	}
+}
+
+func TestDownloadedLogSkipsLoggedURLs(t *testing.T) {
+	var mu sync.Mutex
+	gets := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets[r.URL.Path]++
+			mu.Unlock()
+		}
+		w.Write([]byte("content of " + r.URL.Path))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	logPath := filepath.Join(dir, "downloaded.log")
+
+	// 上一次运行的日志中已记录a.txt
+	if err := os.WriteFile(logPath, []byte(server.URL+"/a.txt\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 1024 * 1024
+	cfg.Quiet = true
+	cfg.DownloadedLog = logPath
+	cfg.InputFileContinue = true
+
+	downloadedLog, err := multi_thread.OpenDownloadedLog(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := multi_thread.NewDownloadManager(cfg)
+	defer manager.Stop()
+	manager.SetDownloadedLog(downloadedLog)
+	for _, name := range []string{"a.txt", "b.txt"} {
+		if err := manager.AddTask(server.URL+"/"+name, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	downloadedLog.Close()
+
+	mu.Lock()
+	if gets["/a.txt"] != 0 {
+		t.Errorf("a.txt is in the prior log and should be skipped, got %d GETs", gets["/a.txt"])
+	}
+	if gets["/b.txt"] != 1 {
+		t.Errorf("b.txt should be downloaded once, got %d GETs", gets["/b.txt"])
+	}
+	mu.Unlock()
+
+	data, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), server.URL+"/b.txt") {
+		t.Errorf("b.txt should be appended to the log, got:\n%s", data)
+	}
+}
+
+func TestPauseResumeDoesNotOverlapRuns(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			// 暂停前一直阻塞，只能由暂停取消
+			select {
+			case <-r.Context().Done():
+				return
+			case <-release:
+			}
+		}
+		w.Write([]byte("content"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 1024 * 1024
+	cfg.MaxConcurrentDownloads = 4
+	cfg.Quiet = true
+
+	manager := multi_thread.NewDownloadManager(cfg)
+	defer manager.Stop()
+	url := server.URL + "/file.txt"
+	outputPath := filepath.Join(t.TempDir(), "file.txt")
+	if err := manager.AddTask(url, outputPath); err != nil {
+		t.Fatalf("AddTask failed: %v", err)
+	}
+
+	done := make(chan error, 1)
+	go func() { done <- manager.Start(context.Background()) }()
+
+	waitDownloading := func() {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for time.Now().Before(deadline) {
+			if manager.GetTaskSnapshots()[0].Status == types.TaskDownloading {
+				return
+			}
+			time.Sleep(time.Millisecond)
+		}
+		t.Fatal("task did not start downloading")
+	}
+
+	// 快速暂停并恢复多次：每次恢复后的下载都必须能再次被暂停
+	for i := 0; i < 5; i++ {
+		waitDownloading()
+		if !manager.PauseTask(url) || !manager.ResumeTask(url) {
+			t.Fatalf("round %d: pause/resume rejected", i)
+		}
+	}
+	waitDownloading()
+	close(release)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("Start failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("Start did not return")
+	}
+
+	task := manager.GetTaskSnapshots()[0]
+	if task.Status != types.TaskCompleted {
+		t.Errorf("expected the task to complete, got status %v (%v)", task.Status, task.Error)
+	}
+	if summary := manager.GetSummary(); summary.Failed != 0 {
+		t.Errorf("cancelled runs must not be counted as failures, got %d", summary.Failed)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil || string(data) != "content" {
+		t.Errorf("unexpected output %q (%v)", data, err)
+	}
+}
+
+func TestBatchStopsAtQuota(t *testing.T) {
+	var mu sync.Mutex
+	gets := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets[r.URL.Path]++
+			mu.Unlock()
+		}
+		w.Write([]byte(strings.Repeat("x", 100)))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 1024 * 1024
+	cfg.Quiet = true
+	cfg.MaxConcurrentDownloads = 1
+
+	// 第二个文件完成后超出配额，之后的文件不再开始
+	quota := ratelimit.NewQuota(150)
+	manager := multi_thread.NewDownloadManager(cfg)
+	defer manager.Stop()
+	manager.SetQuota(quota)
+	dir := t.TempDir()
+	names := []string{"a.txt", "b.txt", "c.txt", "d.txt"}
+	for _, name := range names {
+		if err := manager.AddTask(server.URL+"/"+name, filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := manager.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, name := range names {
+		want := 0
+		if i < 2 {
+			want = 1
+		}
+		if gets["/"+name] != want {
+			t.Errorf("%s: expected %d GETs, got %d", name, want, gets["/"+name])
+		}
+	}
+	if quota.Used() != 200 || !quota.Exceeded() {
+		t.Errorf("expected 200 bytes counted against the quota, got %d", quota.Used())
+	}
+	if summary := manager.GetSummary(); summary.Files != 2 || summary.Skipped != 2 {
+		t.Errorf("expected 2 downloaded and 2 skipped files, got %+v", summary)
+	}
+}
@@ -0,0 +1,179 @@
+package test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/wget2go/internal/cli"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// newFileServer 返回固定内容的测试服务器
+func newFileServer(t *testing.T, body string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestCLIProgressFlag(t *testing.T) {
+	server := newFileServer(t, "content")
+
+	tests := []struct {
+		name     string
+		args     []string
+		expected string
+	}{
+		// 不带值的--progress不能把后面的URL当作进度显示方式
+		{"Bare", []string{"--progress"}, types.ProgressAuto},
+		{"WithValue", []string{"--progress=dot"}, types.ProgressDot},
+		{"Default", nil, types.ProgressAuto},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			args := append(append([]string{"--proxy=false"}, tt.args...), server.URL+"/file.txt", "-O", outputPath)
+
+			app := cli.NewCLI()
+			if err := app.Run(context.Background(), args); err != nil {
+				t.Fatalf("Run(%q) failed: %v", args, err)
+			}
+			if style := app.GetConfig().ProgressStyle; style != tt.expected {
+				t.Errorf("expected progress style %q, got %q", tt.expected, style)
+			}
+			if urls := app.GetURLs(); len(urls) != 1 || urls[0] != server.URL+"/file.txt" {
+				t.Errorf("expected the URL to stay positional, got %q", urls)
+			}
+			if data, err := os.ReadFile(outputPath); err != nil || string(data) != "content" {
+				t.Errorf("unexpected output %q (%v)", data, err)
+			}
+		})
+	}
+}
+
+func TestCLIPrintsSummaryOnFailure(t *testing.T) {
+	// 连接在响应之前被关闭，单文件和递归下载都无法获取文件
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+	t.Cleanup(server.Close)
+
+	tests := []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"Single", []string{"-O", "missing.txt"}, true},
+		// 递归下载中起始URL失败时，下载本身完成但失败计入汇总
+		{"Recursive", []string{"-r", "-o", "out"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for i, arg := range tt.args {
+				if arg == "missing.txt" || arg == "out" {
+					tt.args[i] = filepath.Join(dir, arg)
+				}
+			}
+			args := append([]string{"--proxy=false", "--tries=1", server.URL + "/missing.txt"}, tt.args...)
+
+			var err error
+			output := captureStdout(t, func() {
+				err = cli.NewCLI().Run(context.Background(), args)
+			})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run(%q) error = %v, wantErr %v", args, err, tt.wantErr)
+			}
+			if !strings.Contains(output, "下载汇总: 0 个文件") || !strings.Contains(output, "失败: 1") {
+				t.Errorf("expected a summary counting the failure, got:\n%s", output)
+			}
+		})
+	}
+}
+
+func TestCLIJSONOutputKeepsStdoutForEvents(t *testing.T) {
+	server := newFileServer(t, "json content")
+	outputPath := filepath.Join(t.TempDir(), "file.txt")
+	args := []string{"--proxy=false", "--output-format=json", "-v", server.URL + "/file.txt", "-O", outputPath}
+
+	output := captureStdout(t, func() {
+		stdout := os.Stdout
+		if err := cli.NewCLI().Run(context.Background(), args); err != nil {
+			t.Errorf("Run(%q) failed: %v", args, err)
+		}
+		if os.Stdout != stdout {
+			t.Errorf("os.Stdout must not be reassigned in JSON mode")
+		}
+	})
+
+	// 标准输出只包含JSON事件，文本输出写入标准错误
+	var eventTypes []string
+	for _, line := range strings.Split(strings.TrimSpace(output), "\n") {
+		var event cli.Event
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("stdout line is not a JSON event: %q", line)
+		}
+		eventTypes = append(eventTypes, event.Type)
+	}
+	if len(eventTypes) < 2 || eventTypes[0] != cli.EventStarted || eventTypes[len(eventTypes)-1] != cli.EventCompleted {
+		t.Errorf("expected started ... completed events, got %q", eventTypes)
+	}
+}
+
+func TestCLINoParentShortFlag(t *testing.T) {
+	server := newFileServer(t, "content")
+	fileURL := server.URL + "/file.txt"
+
+	tests := []struct {
+		name      string
+		args      []string
+		noParent  bool
+		userAgent string
+		base      string
+		urls      []string
+	}{
+		{"Rewritten", []string{"-np", fileURL}, true, "", "", []string{fileURL}},
+		// -np作为选项的值时不转换
+		{"LongFlagValue", []string{"--user-agent", "-np", fileURL}, false, "-np", "", []string{fileURL}},
+		{"CombinedShortFlagValue", []string{"-qB", "-np", fileURL}, false, "", "-np", []string{fileURL}},
+		// "--"之后的参数都是URL
+		{"AfterDoubleDash", []string{fileURL, "--", "-np"}, false, "", "", []string{fileURL, "-np"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			args := append([]string{"--proxy=false", "-O", outputPath}, tt.args...)
+
+			app := cli.NewCLI()
+			// "--"之后的"-np"作为URL下载失败，只检查解析结果
+			app.Run(context.Background(), args)
+			config := app.GetConfig()
+			if config == nil {
+				t.Fatalf("Run(%q) did not parse the configuration", args)
+			}
+			if config.NoParent != tt.noParent {
+				t.Errorf("NoParent = %v, want %v", config.NoParent, tt.noParent)
+			}
+			if tt.userAgent != "" && config.UserAgent != tt.userAgent {
+				t.Errorf("UserAgent = %q, want %q", config.UserAgent, tt.userAgent)
+			}
+			if config.Base != tt.base {
+				t.Errorf("Base = %q, want %q", config.Base, tt.base)
+			}
+			if urls := app.GetURLs(); strings.Join(urls, " ") != strings.Join(tt.urls, " ") {
+				t.Errorf("URLs = %q, want %q", urls, tt.urls)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/example/wget2go/internal/config"
+	"github.com/example/wget2go/internal/core/converter"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+func TestConverterNoParentKeepsParentLinksAbsolute(t *testing.T) {
+	dir := t.TempDir()
+	pageDir := filepath.Join(dir, "docs", "guide")
+	if err := os.MkdirAll(pageDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	parent := "http://example.com/docs/index.html"
+	sibling := "http://example.com/docs/guide/page.html"
+	html := `<a href="` + parent + `">up</a> <a href="` + sibling + `">next</a>`
+	filename := filepath.Join(pageDir, "index.html")
+	if err := os.WriteFile(filename, []byte(html), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := converter.NewConverter(dir, false)
+	c.SetNoParent("http://example.com/docs/guide/index.html")
+	c.AddConversion(filename, "http://example.com/docs/guide/index.html", &types.ParsedResult{
+		URLs: []*types.ParsedURL{{URL: parent}, {URL: sibling}},
+	})
+	if err := c.ConvertAll(); err != nil {
+		t.Fatalf("ConvertAll failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted := string(data)
+	if !strings.Contains(converted, `href="`+parent+`"`) {
+		t.Errorf("link above the no-parent root should stay absolute: %s", converted)
+	}
+	if !strings.Contains(converted, `href="page.html"`) {
+		t.Errorf("link under the no-parent root should be relative: %s", converted)
+	}
+}
+
+func TestConverterOnlyRewritesDownloadedLinks(t *testing.T) {
+	dir := t.TempDir()
+	html := `<a href="page.html">a</a> <a href="page.html.bak">b</a> ` +
+		`<a href="skipped.html?x=1&amp;y=2">c</a> <a href="http://other.com/x.html">d</a>`
+	filename := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(filename, []byte(html), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := converter.NewConverter(dir, false)
+	c.SetDownloadedFunc(func(localPath string) bool {
+		return localPath == filepath.Join(dir, "page.html")
+	})
+	c.AddConversion(filename, "http://example.com/index.html", &types.ParsedResult{
+		URLs: []*types.ParsedURL{
+			{URL: "http://example.com/page.html", Raw: "page.html"},
+			{URL: "http://example.com/page.html.bak", Raw: "page.html.bak"},
+			{URL: "http://example.com/skipped.html?x=1&y=2", Raw: "skipped.html?x=1&y=2"},
+			{URL: "http://other.com/x.html", Raw: "http://other.com/x.html"},
+		},
+	})
+	if err := c.ConvertAll(); err != nil {
+		t.Fatalf("ConvertAll failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converted := string(data)
+	for _, want := range []string{
+		`href="page.html"`,
+		// 以已下载URL为前缀的URL不能被部分替换
+		`href="http://example.com/page.html.bak"`,
+		`href="http://example.com/skipped.html?x=1&amp;y=2"`,
+		`href="http://other.com/x.html"`,
+	} {
+		if !strings.Contains(converted, want) {
+			t.Errorf("converted document missing %s: %s", want, converted)
+		}
+	}
+}
+
+func TestConverterRewriteRules(t *testing.T) {
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("convert_links", true)
+	cm.GetViper().Set("rewrite", []string{`^https://cdn\.example\.com/=>/assets/`, `/img/(\w+)\.png$=>/img/$1.webp`})
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	html := `<img src="https://cdn.example.com/img/logo.png"> <script src="https://cdn.example.com/app.js"></script> ` +
+		`<a href="https://cdn.example.com/missing.html">x</a> <a href="page.html">y</a>`
+	filename := filepath.Join(dir, "index.html")
+	if err := os.WriteFile(filename, []byte(html), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	c := converter.NewConverter(dir, false)
+	c.SetRewrites(cfg.Rewrites)
+	c.SetDownloadedFunc(func(localPath string) bool {
+		return !strings.HasSuffix(localPath, "missing.html")
+	})
+	c.AddConversion(filename, "http://example.com/index.html", &types.ParsedResult{
+		URLs: []*types.ParsedURL{
+			{URL: "https://cdn.example.com/img/logo.png"},
+			{URL: "https://cdn.example.com/app.js"},
+			{URL: "https://cdn.example.com/missing.html"},
+			{URL: "http://example.com/page.html", Raw: "page.html"},
+		},
+	})
+	if err := c.ConvertAll(); err != nil {
+		t.Fatalf("ConvertAll failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 规则按顺序应用；未下载的目标保持绝对URL，不匹配规则的链接按原方式转换为相对路径
+	want := `<img src="/assets/img/logo.webp"> <script src="/assets/app.js"></script> ` +
+		`<a href="https://cdn.example.com/missing.html">x</a> <a href="page.html">y</a>`
+	if string(data) != want {
+		t.Errorf("unexpected conversion:\n got: %s\nwant: %s", data, want)
+	}
+
+	for _, rule := range []string{`no-arrow`, `([a-z=>/x`} {
+		cm := config.NewConfigManager()
+		cm.GetViper().Set("convert_links", true)
+		cm.GetViper().Set("rewrite", []string{rule})
+		if _, err := cm.Parse(); err == nil {
+			t.Errorf("expected invalid rewrite rule %q to be rejected", rule)
+		}
+	}
+}
@@ -0,0 +1,66 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/example/wget2go/internal/core/css"
+)
+
+func TestCSSLayeredBackgroundAndImageSet(t *testing.T) {
+	cssData := []byte(`
+.hero {
+	background: url(a.png) , url("b.png") no-repeat;
+	color: red
+}
+.logo {
+	background-image: -webkit-image-set("logo.png" 1x, url('logo@2x.png') 2x);
+}
+.banner { background-image: image-set( "banner.avif" type("image/avif"), 'banner.jpg' type("image/jpeg") ) }
+`)
+	base := "http://example.com/css/site.css"
+
+	expected := []string{
+		"http://example.com/css/a.png",
+		"http://example.com/css/b.png",
+		"http://example.com/css/logo.png",
+		"http://example.com/css/logo@2x.png",
+		"http://example.com/css/banner.avif",
+		"http://example.com/css/banner.jpg",
+	}
+
+	t.Run("Parse", func(t *testing.T) {
+		urls, err := css.NewParser().GetURLs(cssData, base)
+		if err != nil {
+			t.Fatalf("GetURLs failed: %v", err)
+		}
+		assertContainsAll(t, urls, expected)
+	})
+
+	t.Run("ExtractBackgroundURLs", func(t *testing.T) {
+		urls, err := css.NewParser().ExtractBackgroundURLs(cssData, base)
+		if err != nil {
+			t.Fatalf("ExtractBackgroundURLs failed: %v", err)
+		}
+		assertContainsAll(t, urls, expected)
+	})
+}
+
+// assertContainsAll 检查got包含所有期望的URL
+func assertContainsAll(t *testing.T, got, want []string) {
+	t.Helper()
+
+	seen := make(map[string]bool, len(got))
+	for _, u := range got {
+		seen[u] = true
+	}
+	for _, u := range want {
+		if !seen[u] {
+			t.Errorf("missing URL %s in %v", u, got)
+		}
+	}
+	for _, u := range got {
+		if u == "http://example.com/css/image/avif" || u == "http://example.com/css/image/jpeg" {
+			t.Errorf("type() argument extracted as URL: %s", u)
+		}
+	}
+}
@@ -0,0 +1,1622 @@
+package test
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andybalholm/brotli"
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
+	"github.com/example/wget2go/internal/downloader/chunk"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+func TestExpectedSize(t *testing.T) {
+	content := "expected size payload"
+	var gets int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			atomic.AddInt32(&gets, 1)
+		}
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+
+	t.Run("Mismatch", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.ExpectedSize = int64(len(content)) + 1
+
+		outputPath := filepath.Join(dir, "mismatch.txt")
+		err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file", outputPath)
+		if err == nil || !strings.Contains(err.Error(), "文件大小与期望不符") {
+			t.Fatalf("expected size mismatch error, got %v", err)
+		}
+		if n := atomic.LoadInt32(&gets); n != 0 {
+			t.Errorf("expected no GET before aborting, got %d", n)
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Errorf("output file should not be created on mismatch")
+		}
+	})
+
+	t.Run("Match", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.ExpectedSize = int64(len(content))
+
+		outputPath := filepath.Join(dir, "match.txt")
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file", outputPath); err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil || string(data) != content {
+			t.Errorf("downloaded content = %q, %v", data, err)
+		}
+	})
+}
+
+// resumeTestServer 支持范围请求的测试服务器，interrupt非空时在请求偏移量不小于interruptAt的分片时调用它
+type resumeTestServer struct {
+	mu          sync.Mutex
+	content     []byte
+	etag        string
+	interrupt   func()
+	interruptAt int64
+	rangeStarts []int64
+}
+
+func (s *resumeTestServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	content, etag, interrupt := s.content, s.etag, s.interrupt
+	var start int64 = -1
+	if rangeHeader := r.Header.Get("Range"); rangeHeader != "" && r.Method == http.MethodGet {
+		fmt.Sscanf(rangeHeader, "bytes=%d-", &start)
+		s.rangeStarts = append(s.rangeStarts, start)
+	}
+	s.mu.Unlock()
+
+	if interrupt != nil && start >= s.interruptAt {
+		interrupt()
+		<-r.Context().Done()
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+}
+
+func TestResumeDetectsChangedFile(t *testing.T) {
+	const chunkSize = 64 * 1024
+	oldContent := bytes.Repeat([]byte("old-"), chunkSize)
+	newContent := bytes.Repeat([]byte("new-"), chunkSize)
+
+	// interruptedDownload 下载到第三个分片时中断，留下临时文件和状态文件
+	interruptedDownload := func(t *testing.T, server *resumeTestServer, url, outputPath string) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		server.mu.Lock()
+		server.interrupt = cancel
+		server.interruptAt = 2 * chunkSize
+		server.mu.Unlock()
+
+		cfg := newTestConfig()
+		cfg.Continue = true
+		cfg.ChunkSize = chunkSize
+		cfg.MaxThreads = 1
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(ctx, url, outputPath); err == nil {
+			t.Fatal("expected interrupted download to fail")
+		}
+		if _, err := os.Stat(outputPath + ".wget2go.state"); err != nil {
+			t.Fatalf("state file not written: %v", err)
+		}
+
+		server.mu.Lock()
+		server.interrupt = nil
+		server.rangeStarts = nil
+		server.mu.Unlock()
+	}
+
+	resume := func(t *testing.T, url, outputPath string) {
+		cfg := newTestConfig()
+		cfg.Continue = true
+		cfg.ChunkSize = chunkSize
+		cfg.MaxThreads = 1
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), url, outputPath); err != nil {
+			t.Fatalf("resumed download failed: %v", err)
+		}
+	}
+
+	t.Run("Changed", func(t *testing.T) {
+		server := &resumeTestServer{content: oldContent, etag: `"v1"`}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		interruptedDownload(t, server, ts.URL+"/file.bin", outputPath)
+
+		server.mu.Lock()
+		server.content = newContent
+		server.etag = `"v2"`
+		server.mu.Unlock()
+
+		resume(t, ts.URL+"/file.bin", outputPath)
+
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, newContent) {
+			t.Fatalf("resumed file does not match the changed remote file (err=%v)", err)
+		}
+	})
+
+	t.Run("Unchanged", func(t *testing.T) {
+		server := &resumeTestServer{content: oldContent, etag: `"v1"`}
+		ts := httptest.NewServer(server)
+		defer ts.Close()
+
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		interruptedDownload(t, server, ts.URL+"/file.bin", outputPath)
+		resume(t, ts.URL+"/file.bin", outputPath)
+
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, oldContent) {
+			t.Fatalf("resumed file does not match the remote file (err=%v)", err)
+		}
+
+		server.mu.Lock()
+		defer server.mu.Unlock()
+		for _, start := range server.rangeStarts {
+			if start > 0 && start < 2*chunkSize {
+				t.Errorf("completed chunk at offset %d was downloaded again", start)
+			}
+		}
+	})
+}
+
+func TestHTTP10ServerUsesSingleThread(t *testing.T) {
+	content := bytes.Repeat([]byte("http/1.0 "), 50000)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	var mu sync.Mutex
+	var requests []string
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				req, err := http.ReadRequest(bufio.NewReader(conn))
+				if err != nil {
+					return
+				}
+				mu.Lock()
+				requests = append(requests, req.Method+" "+req.Header.Get("Range"))
+				mu.Unlock()
+
+				// HTTP/1.0服务器：声明支持范围请求但忽略Range，总是返回完整内容
+				fmt.Fprintf(conn, "HTTP/1.0 200 OK\r\nContent-Length: %d\r\nAccept-Ranges: bytes\r\n\r\n", len(content))
+				if req.Method != http.MethodHead {
+					conn.Write(content)
+				}
+			}(conn)
+		}
+	}()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 64 * 1024
+
+	outputPath := filepath.Join(t.TempDir(), "file.bin")
+	url := "http://" + listener.Addr().String() + "/file.bin"
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), url, outputPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("downloaded content mismatch (len %d, err %v)", len(data), err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	gets := 0
+	for _, request := range requests {
+		method, rangeHeader, _ := strings.Cut(request, " ")
+		if rangeHeader != "" {
+			t.Errorf("unexpected Range request to HTTP/1.0 server: %s", rangeHeader)
+		}
+		if method == http.MethodGet {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("expected a single GET, got %d: %v", gets, requests)
+	}
+}
+
+func TestTimestampingServerIgnoresIfModifiedSince(t *testing.T) {
+	content := "fresh content from a server that ignores conditions"
+	var ifModifiedSince string
+	var mu sync.Mutex
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		ifModifiedSince = r.Header.Get("If-Modified-Since")
+		mu.Unlock()
+		// 错误的服务器：忽略If-Modified-Since，总是返回200和完整内容
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(outputPath, []byte("stale"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTestConfig()
+	cfg.Timestamping = true
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	if ifModifiedSince == "" {
+		t.Error("expected a conditional request with If-Modified-Since")
+	}
+	mu.Unlock()
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil || string(data) != content {
+		t.Fatalf("200 response to a conditional request should be saved, got %q (err %v)", data, err)
+	}
+}
+
+func TestTimestampingNotModifiedWithBody(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+				if _, err := http.ReadRequest(bufio.NewReader(conn)); err != nil {
+					return
+				}
+				// 错误的服务器：304响应附带了响应体
+				body := "this body must be ignored"
+				fmt.Fprintf(conn, "HTTP/1.1 304 Not Modified\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+			}(conn)
+		}
+	}()
+
+	local := "local copy"
+	outputPath := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(outputPath, []byte(local), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := newTestConfig()
+	cfg.Timestamping = true
+	url := "http://" + listener.Addr().String() + "/file.txt"
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), url, outputPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil || string(data) != local {
+		t.Fatalf("304 should leave the local file untouched, got %q (err %v)", data, err)
+	}
+}
+
+func TestServerTimestampsRestored(t *testing.T) {
+	content := strings.Repeat("timestamp", 1000)
+	modTime := time.Date(2020, 5, 17, 8, 30, 0, 0, time.UTC)
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			gets.Add(1)
+		}
+		http.ServeContent(w, r, "file.txt", modTime, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	download := func(t *testing.T, cfg *types.Config, outputPath string) {
+		t.Helper()
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+	}
+	modTimeOf := func(t *testing.T, path string) time.Time {
+		t.Helper()
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.ModTime()
+	}
+
+	for _, tc := range []struct {
+		name      string
+		chunkSize int64
+	}{
+		{"Single", 0},
+		{"Chunked", 2048},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			cfg := newTestConfig()
+			cfg.ChunkSize = tc.chunkSize
+			download(t, cfg, outputPath)
+			if got := modTimeOf(t, outputPath); !got.Equal(modTime) {
+				t.Fatalf("expected mtime %v from Last-Modified, got %v", modTime, got)
+			}
+
+			// 之后的-N运行应收到304，不再下载
+			before := gets.Load()
+			cfg.Timestamping = true
+			download(t, cfg, outputPath)
+			if gets.Load() != before+1 {
+				t.Fatalf("expected one conditional GET, got %d", gets.Load()-before)
+			}
+			if got := modTimeOf(t, outputPath); !got.Equal(modTime) {
+				t.Errorf("304 should keep mtime %v, got %v", modTime, got)
+			}
+		})
+	}
+
+	t.Run("Disabled", func(t *testing.T) {
+		outputPath := filepath.Join(t.TempDir(), "file.txt")
+		cfg := newTestConfig()
+		cfg.NoUseServerTimestamps = true
+		download(t, cfg, outputPath)
+		if got := modTimeOf(t, outputPath); got.Equal(modTime) {
+			t.Errorf("--no-use-server-timestamps should leave the local mtime, got %v", got)
+		}
+	})
+}
+
+func TestTrustServerNames(t *testing.T) {
+	content := "app binary"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/latest":
+			http.Redirect(w, r, "/app-1.2.3.dmg", http.StatusFound)
+		case "/named":
+			http.Redirect(w, r, "/app-1.2.3.dmg?disposition=1", http.StatusFound)
+		case "/app-1.2.3.dmg":
+			if r.URL.Query().Get("disposition") != "" {
+				w.Header().Set("Content-Disposition", `attachment; filename="app.dmg"`)
+			}
+			w.Write([]byte(content))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name, path         string
+		trust, disposition bool
+		want               string
+	}{
+		{"Default", "/latest", false, false, "latest"},
+		{"Trust", "/latest", true, false, "app-1.2.3.dmg"},
+		{"ContentDispositionWins", "/named", true, true, "app.dmg"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cfg := newTestConfig()
+			cfg.TrustServerNames = tc.trust
+			cfg.ContentDisposition = tc.disposition
+			outputPath := filepath.Join(dir, strings.TrimPrefix(tc.path, "/"))
+			if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+tc.path, outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			entries, err := os.ReadDir(dir)
+			if err != nil || len(entries) != 1 || entries[0].Name() != tc.want {
+				t.Fatalf("expected only %s to be saved, got %v (%v)", tc.want, entries, err)
+			}
+			if data, _ := os.ReadFile(filepath.Join(dir, tc.want)); string(data) != content {
+				t.Errorf("unexpected content %q", data)
+			}
+		})
+	}
+}
+
+func TestDownloadSummary(t *testing.T) {
+	content := strings.Repeat("summary", 1000)
+	modTime := time.Date(2021, 3, 4, 5, 6, 7, 0, time.UTC)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/file.txt" {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeContent(w, r, "file.txt", modTime, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	cfg := newTestConfig()
+	cfg.Timestamping = true
+	downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+
+	outputPath := filepath.Join(dir, "file.txt")
+	if err := downloader.Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	// 本地文件的时间与Last-Modified相同，第二次下载得到304
+	if err := downloader.Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	if err := downloader.Download(context.Background(), server.URL+"/missing", filepath.Join(dir, "missing")); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	summary := downloader.GetSummary()
+	if summary.Files != 1 || summary.Skipped != 1 || summary.Failed != 1 {
+		t.Errorf("expected 1 file, 1 skipped and 1 failed, got %+v", summary)
+	}
+	if summary.Bytes != int64(len(content)) {
+		t.Errorf("expected %d bytes, got %d", len(content), summary.Bytes)
+	}
+	if summary.Elapsed <= 0 || summary.AverageSpeed() <= 0 {
+		t.Errorf("expected a positive elapsed time and speed, got %+v", summary)
+	}
+}
+
+// countingReader 统计读取的字节数
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestChecksumAndManifestShareOneHashPass(t *testing.T) {
+	content := strings.Repeat("checksum and manifest payload\n", 1000)
+	sum := sha256.Sum256([]byte(content))
+	want := hex.EncodeToString(sum[:])
+
+	t.Run("HashReader", func(t *testing.T) {
+		reader := &countingReader{r: strings.NewReader(content)}
+		sums, err := utils.HashReader(reader, "sha256", "sha-256", "md5", "sha1")
+		if err != nil {
+			t.Fatalf("HashReader failed: %v", err)
+		}
+		if reader.n != int64(len(content)) {
+			t.Errorf("content read %d bytes, want a single pass of %d", reader.n, len(content))
+		}
+		if sums["sha256"] != want {
+			t.Errorf("sha256 = %s, want %s", sums["sha256"], want)
+		}
+		if len(sums) != 3 {
+			t.Errorf("expected 3 digests, got %v", sums)
+		}
+	})
+
+	md5Sum := md5.Sum([]byte(content))
+	for _, tc := range []struct {
+		name   string
+		ranges bool
+	}{
+		// 单线程下载在写入的同时计算哈希
+		{"SingleStream", false},
+		// 分片乱序写入，下载完成后读取一遍文件计算哈希
+		{"Chunked", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Digest", "md5="+base64.StdEncoding.EncodeToString(md5Sum[:]))
+				if tc.ranges {
+					http.ServeContent(w, r, "file.txt", time.Time{}, strings.NewReader(content))
+					return
+				}
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				w.Write([]byte(content))
+			}))
+			defer server.Close()
+
+			dir := t.TempDir()
+			manifest, err := chunk.OpenChecksumManifest(filepath.Join(dir, "SHA256SUMS"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer manifest.Close()
+
+			cfg := newTestConfig()
+			cfg.ChunkSize = 4096
+			cfg.Checksum = "sha256:" + want
+			cfg.VerifyDigest = true
+			downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+			downloader.SetChecksumManifest(manifest)
+
+			outputPath := filepath.Join(dir, "file.txt")
+			if err := downloader.Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			// 校验和、服务器Digest和清单使用同一组哈希
+			digests := downloader.Digests()
+			if digests["sha256"] != want {
+				t.Errorf("sha256 = %s, want %s", digests["sha256"], want)
+			}
+			if wantMD5 := hex.EncodeToString(md5Sum[:]); digests["md5"] != wantMD5 {
+				t.Errorf("md5 = %s, want %s", digests["md5"], wantMD5)
+			}
+			data, err := os.ReadFile(filepath.Join(dir, "SHA256SUMS"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if line := want + "  " + outputPath + "\n"; string(data) != line {
+				t.Errorf("manifest = %q, want %q", data, line)
+			}
+		})
+	}
+}
+
+// captureStdout 捕获fn执行期间写入标准输出的内容
+func captureStdout(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		var buf bytes.Buffer
+		io.Copy(&buf, r)
+		done <- buf.String()
+	}()
+
+	fn()
+	w.Close()
+	return <-done
+}
+
+func TestChainedContentEncoding(t *testing.T) {
+	content := strings.Repeat("chained content encoding\n", 200)
+
+	// 先br再gzip编码，对应Content-Encoding: br, gzip
+	var brBuf bytes.Buffer
+	brWriter := brotli.NewWriter(&brBuf)
+	brWriter.Write([]byte(content))
+	brWriter.Close()
+	var gzBuf bytes.Buffer
+	gzWriter := gzip.NewWriter(&gzBuf)
+	gzWriter.Write(brBuf.Bytes())
+	gzWriter.Close()
+	encoded := gzBuf.Bytes()
+
+	newServer := func(contentEncoding string) *httptest.Server {
+		return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", contentEncoding)
+			w.Header().Set("Content-Length", fmt.Sprint(len(encoded)))
+			w.Write(encoded)
+		}))
+	}
+	dir := t.TempDir()
+
+	t.Run("BrThenGzip", func(t *testing.T) {
+		server := newServer("br, gzip")
+		defer server.Close()
+
+		cfg := newTestConfig()
+		outputPath := filepath.Join(dir, "chained.txt")
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file", outputPath); err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != content {
+			t.Errorf("decoded content mismatch: got %d bytes, want %d", len(data), len(content))
+		}
+	})
+
+	t.Run("Unsupported", func(t *testing.T) {
+		server := newServer("compress, gzip")
+		defer server.Close()
+
+		cfg := newTestConfig()
+		outputPath := filepath.Join(dir, "unsupported.txt")
+		err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file", outputPath)
+		if err == nil || !strings.Contains(err.Error(), "compress") {
+			t.Fatalf("expected unsupported encoding error naming compress, got %v", err)
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Errorf("output file should not be created for an unsupported encoding")
+		}
+	})
+}
+
+func TestVerifyChecksumManifestReportsModifiedFile(t *testing.T) {
+	dir := t.TempDir()
+	var manifest strings.Builder
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		path := filepath.Join(dir, name)
+		content := []byte("content of " + name)
+		if err := os.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+		sum := sha256.Sum256(content)
+		fmt.Fprintf(&manifest, "%s  %s\n", hex.EncodeToString(sum[:]), path)
+	}
+	manifestPath := filepath.Join(dir, "SHA256SUMS")
+	if err := os.WriteFile(manifestPath, []byte(manifest.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// 修改其中一个文件
+	modified := filepath.Join(dir, "b.txt")
+	if err := os.WriteFile(modified, []byte("tampered"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	results, err := utils.VerifyChecksumManifest(manifestPath)
+	if err != nil {
+		t.Fatalf("VerifyChecksumManifest failed: %v", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("expected 3 results, got %d", len(results))
+	}
+	for _, result := range results {
+		if result.Path == modified {
+			if result.OK() || result.Missing() {
+				t.Errorf("modified file should be reported as a mismatch: %+v", result)
+			}
+		} else if !result.OK() {
+			t.Errorf("unmodified file reported as failing: %+v", result)
+		}
+	}
+}
+
+func TestAutoThreadCount(t *testing.T) {
+	cfg := newTestConfig()
+	cfg.ChunkSize = 1024 * 1024
+	cfg.MaxThreads = utils.AutoMaxThreads()
+	cfg.AutoThreads = true
+
+	if got := chunk.ThreadCount(cfg, 2048); got != 1 {
+		t.Errorf("tiny file: expected 1 thread, got %d", got)
+	}
+
+	// 分片数量多于上限时使用上限
+	want := min(max(2*runtime.NumCPU(), 2), 16)
+	if got := chunk.ThreadCount(cfg, 100*cfg.ChunkSize); got != want {
+		t.Errorf("large file: expected %d threads, got %d", want, got)
+	}
+
+	// 分片数量少于上限时每个分片一个连接
+	if got := chunk.ThreadCount(cfg, 2*cfg.ChunkSize); got != min(2, want) {
+		t.Errorf("two chunks: expected %d threads, got %d", min(2, want), got)
+	}
+}
+
+func TestVerifyDigestHeader(t *testing.T) {
+	content := strings.Repeat("digest payload\n", 100)
+	sum := sha256.Sum256([]byte(content))
+	goodDigest := "sha-256=" + base64.StdEncoding.EncodeToString(sum[:])
+	badSum := sha256.Sum256([]byte("something else"))
+	badDigest := "sha-256=" + base64.StdEncoding.EncodeToString(badSum[:])
+
+	tests := []struct {
+		name    string
+		digest  string
+		wantErr bool
+	}{
+		{"Correct", goodDigest, false},
+		{"Incorrect", badDigest, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Header.Get("Want-Digest") == "" {
+					t.Errorf("request missing Want-Digest header")
+				}
+				w.Header().Set("Digest", tt.digest)
+				w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+				w.Write([]byte(content))
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig()
+			cfg.VerifyDigest = true
+			downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			err := downloader.Download(context.Background(), server.URL+"/file.txt", outputPath)
+			if tt.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "Digest校验失败") {
+					t.Fatalf("expected digest mismatch error, got %v", err)
+				}
+				if _, statErr := os.Stat(outputPath); !os.IsNotExist(statErr) {
+					t.Errorf("file failing digest verification should be removed")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryOnEmptyBody(t *testing.T) {
+	content := "content that should not be empty"
+	var gets atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodHead {
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			return
+		}
+		// 第一次GET返回空内容（后端暂时错误），之后返回正常内容
+		if gets.Add(1) == 1 {
+			w.Header().Set("Content-Length", "0")
+			return
+		}
+		w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.RetryOnEmpty = 2
+	downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+
+	outputPath := filepath.Join(t.TempDir(), "file.txt")
+	captureStdout(t, func() {
+		if err := downloader.Download(context.Background(), server.URL+"/file.txt", outputPath); err != nil {
+			t.Errorf("Download failed: %v", err)
+		}
+	})
+
+	data, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != content {
+		t.Errorf("content = %q, want %q", data, content)
+	}
+	if n := gets.Load(); n != 2 {
+		t.Errorf("expected 2 GET requests, got %d", n)
+	}
+}
+
+func TestResumeAfterInterruptMidChunk(t *testing.T) {
+	const chunkSize = 64 * 1024
+	const numChunks = 4
+	content := make([]byte, numChunks*chunkSize)
+	for i := range content {
+		content[i] = byte(i*31 + i/7)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var mu sync.Mutex
+	interrupting := true
+	var rangeStarts []int64
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var start, end int64 = -1, -1
+		if r.Method == http.MethodGet {
+			fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-%d", &start, &end)
+		}
+
+		mu.Lock()
+		blocking := interrupting && end > 0
+		if end > 0 {
+			rangeStarts = append(rangeStarts, start)
+		}
+		mu.Unlock()
+
+		if !blocking {
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+			return
+		}
+
+		// 每个分片只发送一半数据，然后等待中断
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(content)))
+		w.Header().Set("Content-Length", fmt.Sprint(end-start+1))
+		w.WriteHeader(http.StatusPartialContent)
+		w.Write(content[start : start+(end-start+1)/2])
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Continue = true
+	cfg.ChunkSize = chunkSize
+	cfg.MaxThreads = numChunks
+	cfg.ProgressInterval = 10 * time.Millisecond
+
+	// 所有分片都写入一半数据后模拟Ctrl-C
+	downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+	go func() {
+		for progress := range downloader.GetProgressChannel() {
+			if progress.Downloaded >= numChunks*chunkSize/2 {
+				cancel()
+			}
+		}
+	}()
+	defer downloader.Stop()
+
+	outputPath := filepath.Join(t.TempDir(), "file.bin")
+	err := downloader.Download(ctx, server.URL+"/file.bin", outputPath)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected interrupted download to return context.Canceled, got %v", err)
+	}
+	if _, err := os.Stat(outputPath + ".wget2go.state"); err != nil {
+		t.Fatalf("state file not written: %v", err)
+	}
+
+	mu.Lock()
+	interrupting = false
+	rangeStarts = nil
+	mu.Unlock()
+
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+		t.Fatalf("resumed download failed: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("resumed file is not byte-identical to the remote file (err=%v)", err)
+	}
+
+	// 中断前写入的数据已记录在状态文件中，续传从每个分片的中间开始
+	mu.Lock()
+	defer mu.Unlock()
+	for _, start := range rangeStarts {
+		if start%chunkSize != chunkSize/2 {
+			t.Errorf("resumed range starts at %d, expected the middle of a chunk", start)
+		}
+	}
+}
+
+func TestTempDirHoldsPartialAndStateFiles(t *testing.T) {
+	const chunkSize = 4 * 1024
+	content := bytes.Repeat([]byte("temp-dir"), 2*chunkSize)
+
+	var failing atomic.Bool
+	failing.Store(true)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 第一次下载时最后一个分片只发送一半数据就断开，留下临时文件和状态文件
+		var start int64
+		if r.Method == http.MethodGet && failing.Load() {
+			if fmt.Sscanf(r.Header.Get("Range"), "bytes=%d-", &start); start >= int64(len(content))-chunkSize {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, len(content)-1, len(content)))
+				w.Header().Set("Content-Length", fmt.Sprint(chunkSize))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[start : start+chunkSize/2])
+				panic(http.ErrAbortHandler)
+			}
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	outputDir := t.TempDir()
+	tempDir := filepath.Join(t.TempDir(), "partial")
+	outputPath := filepath.Join(outputDir, "file.bin")
+
+	cfg := newTestConfig()
+	cfg.Continue = true
+	cfg.ChunkSize = chunkSize
+	cfg.TempDir = tempDir
+
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err == nil {
+		t.Fatal("expected the first download to fail")
+	}
+	if entries, _ := os.ReadDir(outputDir); len(entries) != 0 {
+		t.Errorf("output directory should stay empty while downloading, got %v", entries)
+	}
+	var names []string
+	entries, _ := os.ReadDir(tempDir)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	if len(names) != 2 || !strings.HasSuffix(names[0], ".tmp") && !strings.HasSuffix(names[1], ".tmp") {
+		t.Fatalf("expected the .tmp and .wget2go.state files in the temp dir, got %v", names)
+	}
+
+	failing.Store(false)
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+		t.Fatalf("resumed download failed: %v", err)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("resumed file is not byte-identical to the remote file (err=%v)", err)
+	}
+	if entries, _ := os.ReadDir(tempDir); len(entries) != 0 {
+		t.Errorf("temp dir should be empty after the download, got %v", entries)
+	}
+}
+
+func TestChunkedDownloadProtocols(t *testing.T) {
+	const chunkSize = 16 * 1024
+	content := bytes.Repeat([]byte("0123456789abcdef"), 8*chunkSize/16)
+
+	// newHandler 返回记录每个范围请求所用协议的处理器
+	newHandler := func(mu *sync.Mutex, protos map[int]int) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Range") != "" {
+				mu.Lock()
+				protos[r.ProtoMajor]++
+				mu.Unlock()
+			}
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		})
+	}
+
+	tests := []struct {
+		name      string
+		tls       bool
+		h2c       bool
+		configure func(cfg *types.Config)
+		wantMajor int
+	}{
+		{name: "HTTP2OverTLS", tls: true, configure: func(cfg *types.Config) {}, wantMajor: 2},
+		{name: "HTTP11Only", tls: true, configure: func(cfg *types.Config) { cfg.HTTP11Only = true }, wantMajor: 1},
+		{name: "H2C", h2c: true, configure: func(cfg *types.Config) { cfg.HTTP2 = true }, wantMajor: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			protos := make(map[int]int)
+			handler := newHandler(&mu, protos)
+
+			var server *httptest.Server
+			switch {
+			case tt.tls:
+				server = httptest.NewUnstartedServer(handler)
+				server.EnableHTTP2 = true
+				server.StartTLS()
+			case tt.h2c:
+				server = httptest.NewServer(h2c.NewHandler(handler, &http2.Server{}))
+			}
+			defer server.Close()
+
+			cfg := newTestConfig()
+			cfg.Insecure = true
+			cfg.ChunkSize = chunkSize
+			cfg.MaxThreads = 4
+			tt.configure(cfg)
+
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			data, err := os.ReadFile(outputPath)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Fatalf("downloaded file does not match (err=%v)", err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if protos[tt.wantMajor] == 0 || len(protos) != 1 {
+				t.Errorf("expected all range requests over HTTP/%d, got %v", tt.wantMajor, protos)
+			}
+		})
+	}
+}
+
+// memoryWriterAt 支持随机写入的内存缓冲区
+type memoryWriterAt struct {
+	mu   sync.Mutex
+	data []byte
+}
+
+func (m *memoryWriterAt) WriteAt(p []byte, off int64) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if end := int(off) + len(p); end > len(m.data) {
+		m.data = append(m.data, make([]byte, end-len(m.data))...)
+	}
+	return copy(m.data[off:], p), nil
+}
+
+func (m *memoryWriterAt) Write(p []byte) (int, error) {
+	return m.WriteAt(p, int64(len(m.data)))
+}
+
+func TestDownloadToWriter(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789abcdef"), 4096)
+	var rangeRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 8 * 1024
+
+	t.Run("WriterAtUsesChunks", func(t *testing.T) {
+		rangeRequests.Store(0)
+		var out memoryWriterAt
+		n, err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).DownloadTo(context.Background(), server.URL+"/file.bin", &out)
+		if err != nil {
+			t.Fatalf("DownloadTo failed: %v", err)
+		}
+		if n != int64(len(content)) || !bytes.Equal(out.data, content) {
+			t.Fatalf("expected %d bytes matching the origin, got %d (%d buffered)", len(content), n, len(out.data))
+		}
+		// 1个范围测试请求加上8个分片
+		if got := rangeRequests.Load(); got < 2 {
+			t.Errorf("expected parallel range requests for an io.WriterAt, got %d", got)
+		}
+	})
+
+	t.Run("ProgressStopsOnReturn", func(t *testing.T) {
+		slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(5 * time.Millisecond)
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+		defer slow.Close()
+
+		progressCfg := *cfg
+		progressCfg.ProgressInterval = time.Millisecond
+		downloader := chunk.NewChunkDownloader(httpCore.NewClient(&progressCfg), &progressCfg)
+		var out memoryWriterAt
+		if _, err := downloader.DownloadTo(context.Background(), slow.URL+"/file.bin", &out); err != nil {
+			t.Fatalf("DownloadTo failed: %v", err)
+		}
+
+		// 不读取进度通道也不调用Stop，返回后进度报告不能继续发送
+		progress := downloader.GetProgressChannel()
+		time.Sleep(20 * time.Millisecond)
+		for len(progress) > 0 {
+			<-progress
+		}
+		time.Sleep(50 * time.Millisecond)
+		if n := len(progress); n != 0 {
+			t.Errorf("expected no progress after DownloadTo returned, got %d updates", n)
+		}
+	})
+
+	t.Run("PlainWriterStreams", func(t *testing.T) {
+		rangeRequests.Store(0)
+		var out bytes.Buffer
+		n, err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).DownloadTo(context.Background(), server.URL+"/file.bin", &out)
+		if err != nil {
+			t.Fatalf("DownloadTo failed: %v", err)
+		}
+		if n != int64(len(content)) || !bytes.Equal(out.Bytes(), content) {
+			t.Fatalf("expected %d bytes matching the origin, got %d", len(content), n)
+		}
+		if got := rangeRequests.Load(); got != 0 {
+			t.Errorf("expected a single ordered stream for a plain io.Writer, got %d range requests", got)
+		}
+	})
+
+	t.Run("Decompresses", func(t *testing.T) {
+		var gzBuf bytes.Buffer
+		gz := gzip.NewWriter(&gzBuf)
+		gz.Write(content)
+		gz.Close()
+		gzServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(gzBuf.Bytes())
+		}))
+		defer gzServer.Close()
+
+		var out bytes.Buffer
+		n, err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).DownloadTo(context.Background(), gzServer.URL, &out)
+		if err != nil {
+			t.Fatalf("DownloadTo failed: %v", err)
+		}
+		if n != int64(len(content)) || !bytes.Equal(out.Bytes(), content) {
+			t.Fatalf("expected the decoded content (%d bytes), got %d bytes", len(content), n)
+		}
+	})
+}
+
+func TestPreallocateReservesFullSize(t *testing.T) {
+	content := bytes.Repeat([]byte("preallocate"), 8192)
+	outputPath := filepath.Join(t.TempDir(), "file.bin")
+
+	// 分片请求到达时临时文件应已是完整大小
+	var sizeDuringDownload atomic.Int64
+	sizeDuringDownload.Store(-1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Range") != "" && r.Header.Get("Range") != "bytes=0-0" {
+			if info, err := os.Stat(outputPath + ".tmp"); err == nil {
+				sizeDuringDownload.CompareAndSwap(-1, info.Size())
+			}
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 16 * 1024
+	cfg.MaxThreads = 1
+	cfg.Preallocate = true
+
+	if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if got := sizeDuringDownload.Load(); got != int64(len(content)) {
+		t.Errorf("expected the temp file to be preallocated to %d bytes before chunks were written, got %d", len(content), got)
+	}
+	data, err := os.ReadFile(outputPath)
+	if err != nil || !bytes.Equal(data, content) {
+		t.Fatalf("downloaded file differs from the origin (err %v)", err)
+	}
+}
+
+func TestWaitRetryResumesInterruptedChunk(t *testing.T) {
+	content := bytes.Repeat([]byte("resume-me "), 4096)
+	const chunkSize = 8 * 1024
+
+	var dropped atomic.Bool
+	var resumedAt atomic.Int64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rangeHeader := r.Header.Get("Range")
+		// 第二个分片第一次只发送一半后断开连接
+		if rangeHeader == fmt.Sprintf("bytes=%d-%d", chunkSize, 2*chunkSize-1) && dropped.CompareAndSwap(false, true) {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", chunkSize, 2*chunkSize-1, len(content)))
+			w.Header().Set("Content-Length", fmt.Sprint(chunkSize))
+			w.WriteHeader(http.StatusPartialContent)
+			w.Write(content[chunkSize : chunkSize+chunkSize/2])
+			w.(http.Flusher).Flush()
+			panic(http.ErrAbortHandler)
+		}
+		if dropped.Load() && strings.HasPrefix(rangeHeader, fmt.Sprintf("bytes=%d-", chunkSize+chunkSize/2)) {
+			resumedAt.Store(chunkSize + chunkSize/2)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	download := func(t *testing.T, waitRetry time.Duration) (string, error) {
+		t.Helper()
+		dropped.Store(false)
+		resumedAt.Store(0)
+		cfg := newTestConfig()
+		cfg.ChunkSize = chunkSize
+		cfg.MaxThreads = 1
+		cfg.MaxRetryWait = time.Minute
+		cfg.WaitRetry = waitRetry
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		return outputPath, chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath)
+	}
+
+	t.Run("Resumes", func(t *testing.T) {
+		outputPath, err := download(t, 10*time.Millisecond)
+		if err != nil {
+			t.Fatalf("expected the interrupted chunk to be retried: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("downloaded file differs from the origin (err %v)", err)
+		}
+		if resumedAt.Load() == 0 {
+			t.Error("expected the retry to request only the missing part of the chunk")
+		}
+	})
+
+	t.Run("FailsWithoutWaitRetry", func(t *testing.T) {
+		_, err := download(t, 0)
+		var reqErr *httpCore.RequestError
+		if !errors.As(err, &reqErr) || reqErr.Phase != httpCore.PhaseBody {
+			t.Fatalf("expected a body-phase error without --wait-retry, got %v", err)
+		}
+	})
+}
+
+func TestHTTPErrorIsTyped(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	cfg := newTestConfig()
+	err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/missing", filepath.Join(t.TempDir(), "missing"))
+	var httpErr *httpCore.HTTPError
+	if !errors.As(err, &httpErr) || httpErr.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected an HTTPError with status 404, got %v", err)
+	}
+	if httpCore.IsRetryable(err) {
+		t.Error("a 404 must not be retryable")
+	}
+}
+
+func TestContinueSingleChecksRemoteLength(t *testing.T) {
+	content := bytes.Repeat([]byte("remote "), 1024)
+
+	var mu sync.Mutex
+	var gets []string // 每个GET请求的Range头
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			gets = append(gets, r.Header.Get("Range"))
+			mu.Unlock()
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name      string
+		local     []byte
+		wantGets  []string
+		wantSkips int
+	}{
+		{"Complete", content, nil, 1},
+		{"LargerThanRemote", append(append([]byte{}, content...), "stale tail"...), []string{""}, 0},
+		{"Partial", content[:1000], []string{"bytes=1000-"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mu.Lock()
+			gets = nil
+			mu.Unlock()
+
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			if err := os.WriteFile(outputPath, tt.local, 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := newTestConfig()
+			cfg.Continue = true
+			downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+			if err := downloader.Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+				t.Fatalf("download failed: %v", err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil || !bytes.Equal(data, content) {
+				t.Fatalf("expected the local file to match the remote file (%d bytes), got %d bytes (err %v)", len(content), len(data), err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if fmt.Sprint(gets) != fmt.Sprint(tt.wantGets) {
+				t.Errorf("GET Range headers = %q, want %q", gets, tt.wantGets)
+			}
+			if skipped := downloader.GetSummary().Skipped; skipped != tt.wantSkips {
+				t.Errorf("summary counted %d skipped files, want %d", skipped, tt.wantSkips)
+			}
+		})
+	}
+}
+
+func TestTriesRefetchesBadChunk(t *testing.T) {
+	content := bytes.Repeat([]byte("chunk-data "), 4096)
+	const chunkSize = 8 * 1024
+
+	var shortLength, truncated atomic.Bool
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Range") {
+		case fmt.Sprintf("bytes=%d-%d", chunkSize, 2*chunkSize-1):
+			// 第二个分片第一次返回的Content-Length比请求的范围短
+			if shortLength.CompareAndSwap(false, true) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", chunkSize, chunkSize+99, len(content)))
+				w.Header().Set("Content-Length", "100")
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[chunkSize : chunkSize+100])
+				return
+			}
+		case fmt.Sprintf("bytes=%d-%d", 2*chunkSize, 3*chunkSize-1):
+			// 第三个分片第一次在Content-Length之前结束
+			if truncated.CompareAndSwap(false, true) {
+				w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", 2*chunkSize, 3*chunkSize-1, len(content)))
+				w.Header().Set("Content-Length", fmt.Sprint(chunkSize))
+				w.WriteHeader(http.StatusPartialContent)
+				w.Write(content[2*chunkSize : 2*chunkSize+chunkSize/4])
+				w.(http.Flusher).Flush()
+				panic(http.ErrAbortHandler)
+			}
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer server.Close()
+
+	download := func(t *testing.T, tries int) (string, error) {
+		t.Helper()
+		shortLength.Store(false)
+		truncated.Store(false)
+		cfg := newTestConfig()
+		cfg.ChunkSize = chunkSize
+		cfg.MaxThreads = 2
+		cfg.Tries = tries
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		return outputPath, chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath)
+	}
+
+	t.Run("Refetches", func(t *testing.T) {
+		outputPath, err := download(t, 3)
+		if err != nil {
+			t.Fatalf("expected the bad chunks to be fetched again: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("downloaded file differs from the origin (err %v)", err)
+		}
+	})
+
+	t.Run("FailsWithOneTry", func(t *testing.T) {
+		if _, err := download(t, 1); err == nil {
+			t.Fatal("expected the download to fail when --tries=1")
+		}
+	})
+}
+
+func TestPostDownload(t *testing.T) {
+	content := strings.Repeat("response body ", 1000)
+
+	type request struct {
+		method, path, contentType, body string
+		hasRange                        bool
+	}
+	var mu sync.Mutex
+	var requests []request
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		requests = append(requests, request{r.Method, r.URL.Path, r.Header.Get("Content-Type"), string(body), r.Header.Get("Range") != ""})
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/see-other":
+			http.Redirect(w, r, "/result", http.StatusSeeOther)
+		case "/temporary":
+			http.Redirect(w, r, "/result", http.StatusTemporaryRedirect)
+		case "/permanent":
+			http.Redirect(w, r, "/result", http.StatusPermanentRedirect)
+		default:
+			w.Header().Set("Accept-Ranges", "bytes")
+			w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+			w.Write([]byte(content))
+		}
+	}))
+	defer server.Close()
+
+	postFile := filepath.Join(t.TempDir(), "form.txt")
+	if err := os.WriteFile(postFile, []byte("from=file&x=1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name     string
+		path     string
+		postData string
+		postFile string
+		want     []request // 服务器依次收到的请求
+	}{
+		// 分片下载被禁用：只有一个POST请求，没有HEAD和范围请求
+		{"PostData", "/submit", "a=1&b=2", "", []request{
+			{http.MethodPost, "/submit", "application/x-www-form-urlencoded", "a=1&b=2", false},
+		}},
+		{"PostFile", "/submit", "", postFile, []request{
+			{http.MethodPost, "/submit", "application/x-www-form-urlencoded", "from=file&x=1", false},
+		}},
+		{"SeeOtherSwitchesToGET", "/see-other", "a=1", "", []request{
+			{http.MethodPost, "/see-other", "application/x-www-form-urlencoded", "a=1", false},
+			{http.MethodGet, "/result", "", "", false},
+		}},
+		{"TemporaryRedirectResendsBody", "/temporary", "a=1", "", []request{
+			{http.MethodPost, "/temporary", "application/x-www-form-urlencoded", "a=1", false},
+			{http.MethodPost, "/result", "application/x-www-form-urlencoded", "a=1", false},
+		}},
+		{"PermanentRedirectResendsBody", "/permanent", "a=1", "", []request{
+			{http.MethodPost, "/permanent", "application/x-www-form-urlencoded", "a=1", false},
+			{http.MethodPost, "/result", "application/x-www-form-urlencoded", "a=1", false},
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			requests = nil
+			mu.Unlock()
+
+			cfg := newTestConfig()
+			cfg.ChunkSize = 1024
+			cfg.PostData = tc.postData
+			cfg.PostFile = tc.postFile
+			outputPath := filepath.Join(t.TempDir(), "out")
+			if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+tc.path, outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+
+			data, err := os.ReadFile(outputPath)
+			if err != nil || string(data) != content {
+				t.Errorf("unexpected output (%d bytes, %v)", len(data), err)
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			if len(requests) != len(tc.want) {
+				t.Fatalf("expected requests %+v, got %+v", tc.want, requests)
+			}
+			for i, want := range tc.want {
+				if requests[i] != want {
+					t.Errorf("request %d: expected %+v, got %+v", i, want, requests[i])
+				}
+			}
+		})
+	}
+}
+
+func TestMaxFileSize(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	tests := []struct {
+		name          string
+		knownLength   bool
+		maxSize       int64
+		wantErr       bool
+		wantRequested bool // 是否发送了下载内容的GET请求
+	}{
+		// HEAD返回的Content-Length超过上限时不开始传输
+		{"ContentLength", true, 10, true, false},
+		{"ContentLengthWithinLimit", true, int64(len(content)), false, true},
+		// 服务器未声明大小时在传输中检查
+		{"UnknownLength", false, 10, true, true},
+		{"UnknownLengthWithinLimit", false, int64(len(content)), false, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gets atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method != http.MethodGet {
+					if tt.knownLength {
+						w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+					}
+					return
+				}
+				if r.Header.Get("Range") == "" {
+					gets.Add(1)
+				}
+				if tt.knownLength {
+					w.Header().Set("Content-Length", fmt.Sprint(len(content)))
+					w.Write([]byte(content))
+					return
+				}
+				// 先发送一部分并刷新，响应使用分块编码，没有Content-Length
+				io.WriteString(w, content[:5])
+				w.(http.Flusher).Flush()
+				io.WriteString(w, content[5:])
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig()
+			cfg.MaxFileSize = tt.maxSize
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.txt", outputPath)
+
+			if tt.wantErr {
+				if !errors.Is(err, utils.ErrFileTooLarge) {
+					t.Fatalf("expected ErrFileTooLarge, got %v", err)
+				}
+				if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+					t.Errorf("a file exceeding the limit must not be kept")
+				}
+			} else if data, readErr := os.ReadFile(outputPath); err != nil || string(data) != content {
+				t.Fatalf("expected a complete download, got %q (%v, %v)", data, err, readErr)
+			}
+			if requested := gets.Load() > 0; requested != tt.wantRequested {
+				t.Errorf("content requested = %v, want %v", requested, tt.wantRequested)
+			}
+		})
+	}
+}
+
+func TestUnknownSizeFallbacks(t *testing.T) {
+	content := bytes.Repeat([]byte("probe-size "), 2048)
+
+	t.Run("ProbedSizeEnablesChunks", func(t *testing.T) {
+		// HEAD没有Content-Length，范围请求的Content-Range提供总大小
+		var ranged atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodHead {
+				return
+			}
+			if r.Header.Get("Range") != "" && r.Header.Get("Range") != "bytes=0-0" {
+				ranged.Add(1)
+			}
+			http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+		}))
+		defer server.Close()
+
+		cfg := newTestConfig()
+		cfg.ChunkSize = 4096
+		cfg.ExpectedSize = int64(len(content))
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		if err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath); err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+		if data, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("downloaded file differs from the origin (err %v)", err)
+		}
+		if ranged.Load() < 2 {
+			t.Errorf("expected a chunked download once the size was probed, got %d range requests", ranged.Load())
+		}
+	})
+
+	// 大小无法获取时单线程下载，--expected-size按实际接收的字节数检查
+	for _, tc := range []struct {
+		name     string
+		expected int64
+		wantErr  bool
+	}{
+		{"ExpectedSizeMatches", int64(len(content)), false},
+		{"ExpectedSizeMismatch", int64(len(content)) + 1, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.Method == http.MethodHead {
+					return
+				}
+				// 忽略Range，分块编码发送，没有Content-Length
+				w.Write(content[:10])
+				w.(http.Flusher).Flush()
+				w.Write(content[10:])
+			}))
+			defer server.Close()
+
+			cfg := newTestConfig()
+			cfg.ChunkSize = 4096
+			cfg.ExpectedSize = tc.expected
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), server.URL+"/file.bin", outputPath)
+			if tc.wantErr {
+				if err == nil || !strings.Contains(err.Error(), "文件大小与期望不符") {
+					t.Fatalf("expected an expected-size error, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			if data, err := os.ReadFile(outputPath); err != nil || !bytes.Equal(data, content) {
+				t.Fatalf("downloaded file differs from the origin (err %v)", err)
+			}
+		})
+	}
+}
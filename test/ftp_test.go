@@ -0,0 +1,445 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/downloader/ftp"
+)
+
+// fakeFTPServer 测试用的最小FTP服务器，支持被动模式下的RETR、LIST和REST
+type fakeFTPServer struct {
+	t        *testing.T
+	ln       net.Listener
+	files    map[string]string // 相对登录目录的路径到文件内容
+	listings map[string]string // 目录到LIST输出
+
+	password      string // 非空时PASS必须与之相同
+	noEPSV        bool   // EPSV返回500，客户端应回退到PASV
+	malformedPASV bool   // PASV返回无法解析的响应
+	noREST        bool   // REST返回502
+	abortTransfer bool   // RETR只发送一半数据后返回426
+	stall         string // 收到该命令后不再响应
+
+	mu       sync.Mutex
+	commands []string
+}
+
+func newFakeFTPServer(t *testing.T) *fakeFTPServer {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &fakeFTPServer{
+		t:        t,
+		ln:       ln,
+		files:    make(map[string]string),
+		listings: make(map[string]string),
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { ln.Close() })
+	return s
+}
+
+// URL 返回服务器上路径的ftp URL
+func (s *fakeFTPServer) URL(path string) string {
+	return "ftp://" + s.ln.Addr().String() + path
+}
+
+// received 返回服务器收到的命令
+func (s *fakeFTPServer) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.commands...)
+}
+
+func (s *fakeFTPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	text := textproto.NewConn(conn)
+	reply := func(format string, args ...interface{}) {
+		text.PrintfLine(format, args...)
+	}
+
+	var data net.Listener
+	var rest int64
+	defer func() {
+		if data != nil {
+			data.Close()
+		}
+	}()
+
+	// openData 为EPSV/PASV打开数据端口
+	openData := func() (int, bool) {
+		if data != nil {
+			data.Close()
+		}
+		var err error
+		data, err = net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			reply("425 Can't open data connection")
+			return 0, false
+		}
+		return data.Addr().(*net.TCPAddr).Port, true
+	}
+	// acceptData 接受客户端的数据连接
+	acceptData := func() net.Conn {
+		if data == nil {
+			reply("425 Use PASV first")
+			return nil
+		}
+		data.(*net.TCPListener).SetDeadline(time.Now().Add(5 * time.Second))
+		dc, err := data.Accept()
+		data.Close()
+		data = nil
+		if err != nil {
+			reply("425 Can't open data connection")
+			return nil
+		}
+		return dc
+	}
+
+	reply("220 fake FTP server ready")
+	for {
+		line, err := text.ReadLine()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, line)
+		s.mu.Unlock()
+
+		cmd, arg, _ := strings.Cut(line, " ")
+		if strings.EqualFold(cmd, s.stall) {
+			continue
+		}
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			reply("331 Password required")
+		case "PASS":
+			if s.password != "" && arg != s.password {
+				reply("530 Login incorrect")
+				continue
+			}
+			reply("230 Logged in")
+		case "TYPE":
+			reply("200 Type set")
+		case "SIZE":
+			content, ok := s.files[arg]
+			if !ok {
+				reply("550 No such file")
+				continue
+			}
+			reply("213 %d", len(content))
+		case "REST":
+			if s.noREST {
+				reply("502 REST not implemented")
+				continue
+			}
+			rest, _ = strconv.ParseInt(arg, 10, 64)
+			reply("350 Restarting at %d", rest)
+		case "EPSV":
+			if s.noEPSV {
+				reply("500 EPSV not understood")
+				continue
+			}
+			if port, ok := openData(); ok {
+				reply("229 Entering Extended Passive Mode (|||%d|)", port)
+			}
+		case "PASV":
+			if s.malformedPASV {
+				reply("227 Entering Passive Mode")
+				continue
+			}
+			// 响应中的地址不可达，客户端应连接控制连接的主机
+			if port, ok := openData(); ok {
+				reply("227 Entering Passive Mode (10,255,255,1,%d,%d)", port/256, port%256)
+			}
+		case "RETR":
+			content, ok := s.files[arg]
+			if !ok {
+				if data != nil {
+					data.Close()
+					data = nil
+				}
+				reply("550 No such file")
+				continue
+			}
+			reply("150 Opening data connection")
+			dc := acceptData()
+			if dc == nil {
+				continue
+			}
+			body := content[min(rest, int64(len(content))):]
+			rest = 0
+			if s.abortTransfer {
+				io.WriteString(dc, body[:len(body)/2])
+				dc.Close()
+				reply("426 Connection closed; transfer aborted")
+				continue
+			}
+			io.WriteString(dc, body)
+			dc.Close()
+			reply("226 Transfer complete")
+		case "LIST":
+			reply("150 Here comes the listing")
+			dc := acceptData()
+			if dc == nil {
+				continue
+			}
+			io.WriteString(dc, s.listings[arg])
+			dc.Close()
+			reply("226 Directory send OK")
+		case "QUIT":
+			reply("221 Goodbye")
+			return
+		default:
+			reply("502 Command not implemented")
+		}
+	}
+}
+
+// hasCommand 检查服务器是否收到以prefix开头的命令
+func hasCommand(commands []string, prefix string) bool {
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFTPPassiveModes(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		noEPSV bool
+	}{
+		{"EPSV", false},
+		// PASV响应中的地址被忽略，数据连接仍然连接控制连接的主机
+		{"PASVFallback", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeFTPServer(t)
+			server.noEPSV = tc.noEPSV
+			server.files["pub/file.bin"] = "ftp file content"
+
+			outputPath := filepath.Join(t.TempDir(), "file.bin")
+			downloader := ftp.NewDownloader(newTestConfig())
+			if err := downloader.Download(context.Background(), server.URL("/pub/file.bin"), outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			data, err := os.ReadFile(outputPath)
+			if err != nil || string(data) != "ftp file content" {
+				t.Errorf("unexpected output %q (%v)", data, err)
+			}
+
+			commands := server.received()
+			if !hasCommand(commands, "EPSV") {
+				t.Errorf("expected EPSV to be tried first, got %q", commands)
+			}
+			if hasCommand(commands, "PASV") != tc.noEPSV {
+				t.Errorf("PASV sent = %v, want %v (commands %q)", !tc.noEPSV, tc.noEPSV, commands)
+			}
+		})
+	}
+}
+
+func TestFTPErrorReplies(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		setup   func(s *fakeFTPServer)
+		path    string
+		wantErr string
+	}{
+		{"MalformedPASV", func(s *fakeFTPServer) { s.noEPSV = true; s.malformedPASV = true }, "/file", "被动模式"},
+		{"LoginRejected", func(s *fakeFTPServer) { s.password = "secret" }, "/file", "530"},
+		{"FileNotFound", func(s *fakeFTPServer) {}, "/missing", "550"},
+		{"TransferAborted", func(s *fakeFTPServer) { s.abortTransfer = true }, "/file", "426"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeFTPServer(t)
+			server.files["file"] = "0123456789"
+			tc.setup(server)
+
+			downloader := ftp.NewDownloader(newTestConfig())
+			err := downloader.Download(context.Background(), server.URL(tc.path), filepath.Join(t.TempDir(), "file"))
+			if err == nil || !strings.Contains(err.Error(), tc.wantErr) {
+				t.Errorf("expected error containing %q, got %v", tc.wantErr, err)
+			}
+			if summary := downloader.GetSummary(); summary.Failed != 1 {
+				t.Errorf("expected the failure to be counted, got %+v", summary)
+			}
+		})
+	}
+}
+
+func TestFTPRestResume(t *testing.T) {
+	const content = "0123456789abcdefghij"
+	for _, tc := range []struct {
+		name   string
+		noREST bool
+	}{
+		{"Resumed", false},
+		// 服务器不支持REST时重新下载整个文件
+		{"RestUnsupported", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeFTPServer(t)
+			server.noREST = tc.noREST
+			server.files["file.txt"] = content
+
+			outputPath := filepath.Join(t.TempDir(), "file.txt")
+			if err := os.WriteFile(outputPath, []byte(content[:8]), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			cfg := newTestConfig()
+			cfg.Continue = true
+			if err := ftp.NewDownloader(cfg).Download(context.Background(), server.URL("/file.txt"), outputPath); err != nil {
+				t.Fatalf("Download failed: %v", err)
+			}
+			data, err := os.ReadFile(outputPath)
+			if err != nil || string(data) != content {
+				t.Errorf("expected the complete file, got %q (%v)", data, err)
+			}
+			if !hasCommand(server.received(), "REST 8") {
+				t.Errorf("expected REST 8, got %q", server.received())
+			}
+		})
+	}
+}
+
+func TestFTPRecursiveListParsing(t *testing.T) {
+	server := newFakeFTPServer(t)
+	server.listings["pub/"] = strings.Join([]string{
+		"total 12",
+		"drwxr-xr-x   2 ftp      ftp          4096 Jan 01 12:00 .",
+		"drwxr-xr-x   2 ftp      ftp          4096 Jan 01 12:00 ..",
+		"-rw-r--r--   1 ftp      ftp            11 Jan 01 12:00 unix.txt",
+		"-rw-r--r--   1 ftp      ftp             9 Mar 15  2023 with  spaces.txt",
+		"lrwxrwxrwx   1 ftp      ftp             8 Jan 01 12:00 link.txt -> unix.txt",
+		"drwxr-xr-x   2 ftp      ftp          4096 Jan 01 12:00 sub",
+		"-rw-r--r--   1 ftp      ftp             4 Jan 01 12:00 ../escape.txt",
+		"garbage line",
+		"",
+	}, "\r\n")
+	server.listings["pub/sub"] = strings.Join([]string{
+		"01-02-24  10:30AM       <DIR>          nested",
+		"01-02-24  10:31AM                    3 dos.txt",
+	}, "\r\n")
+	server.listings["pub/sub/nested"] = ""
+	server.files["pub/unix.txt"] = "unix file\r\n"
+	server.files["pub/with  spaces.txt"] = "spaces!!\n"
+	server.files["pub/link.txt"] = "linked\r\n"
+	server.files["pub/sub/dos.txt"] = "dos"
+
+	cfg := newTestConfig()
+	cfg.Quiet = true
+	outputDir := t.TempDir()
+	downloader := ftp.NewDownloader(cfg)
+	if err := downloader.DownloadRecursive(context.Background(), server.URL("/pub/"), outputDir); err != nil {
+		t.Fatalf("DownloadRecursive failed: %v", err)
+	}
+
+	for name, content := range map[string]string{
+		"unix.txt":         "unix file\r\n",
+		"with  spaces.txt": "spaces!!\n",
+		"link.txt":         "linked\r\n",
+		"sub/dos.txt":      "dos",
+	} {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(name)))
+		if err != nil || string(data) != content {
+			t.Errorf("%s: expected %q, got %q (%v)", name, content, data, err)
+		}
+	}
+	if info, err := os.Stat(filepath.Join(outputDir, "sub", "nested")); err != nil || !info.IsDir() {
+		t.Errorf("expected the MS-DOS <DIR> entry to be created as a directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(outputDir), "escape.txt")); !os.IsNotExist(err) {
+		t.Errorf("entries with path separators must be skipped")
+	}
+	if n := downloader.GetDownloadedCount(); n != 4 {
+		t.Errorf("expected 4 downloaded files, got %d", n)
+	}
+	if hasCommand(server.received(), "RETR pub/.") {
+		t.Errorf("special directory entries must not be retrieved: %q", server.received())
+	}
+}
+
+func TestFTPRejectsControlCharacters(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		userinfo string
+		path     string
+	}{
+		// 路径、用户名和密码中解码出的CR LF不能注入额外的命令
+		{"Path", "", "/a%0d%0aDELE%20file"},
+		{"User", "evil%0d%0aDELE%20file:secret@", "/file"},
+		{"Password", "user:secret%0aDELE%20file@", "/file"},
+		{"OtherControl", "", "/a%00b"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := newFakeFTPServer(t)
+			server.files["file"] = "content"
+
+			rawURL := strings.Replace(server.URL(tc.path), "ftp://", "ftp://"+tc.userinfo, 1)
+			err := ftp.NewDownloader(newTestConfig()).Download(context.Background(), rawURL, filepath.Join(t.TempDir(), "file"))
+			if !errors.Is(err, ftp.ErrControlChar) {
+				t.Errorf("expected ErrControlChar, got %v", err)
+			}
+			if hasCommand(server.received(), "DELE") {
+				t.Errorf("injected command reached the server: %q", server.received())
+			}
+		})
+	}
+}
+
+func TestFTPCancelWhileWaitingForReply(t *testing.T) {
+	for _, command := range []string{"USER", "SIZE", "RETR"} {
+		t.Run(command, func(t *testing.T) {
+			server := newFakeFTPServer(t)
+			server.files["file"] = "content"
+			server.stall = command
+
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan error, 1)
+			go func() {
+				done <- ftp.NewDownloader(newTestConfig()).Download(ctx, server.URL("/file"), filepath.Join(t.TempDir(), "file"))
+			}()
+
+			// 等服务器收到命令后取消
+			deadline := time.Now().Add(5 * time.Second)
+			for !hasCommand(server.received(), command) && time.Now().Before(deadline) {
+				time.Sleep(time.Millisecond)
+			}
+			cancel()
+
+			select {
+			case err := <-done:
+				if !errors.Is(err, context.Canceled) {
+					t.Errorf("expected context.Canceled, got %v", err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Download did not return after the context was cancelled")
+			}
+		})
+	}
+}
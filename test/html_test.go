@@ -0,0 +1,86 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/example/wget2go/internal/core/html"
+)
+
+func TestHTMLParserUsesBaseHref(t *testing.T) {
+	page := []byte(`<html><head>` +
+		`<link rel="stylesheet" href="before.css">` +
+		`<base href="/static/">` +
+		`<base href="/ignored/">` +
+		`</head><body><a href="page.html">page</a><img src="img/logo.png"></body></html>`)
+
+	result, err := html.NewParser().Parse(page, "http://example.com/dir/index.html")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	got := make(map[string]string)
+	for _, u := range result.URLs {
+		got[u.Raw] = u.URL
+	}
+
+	// <base>之前的URL仍按文档URL解析，之后的按第一个<base href>解析
+	want := map[string]string{
+		"before.css":   "http://example.com/dir/before.css",
+		"/static/":     "http://example.com/static/",
+		"page.html":    "http://example.com/static/page.html",
+		"img/logo.png": "http://example.com/static/img/logo.png",
+	}
+	for raw, expected := range want {
+		if got[raw] != expected {
+			t.Errorf("expected %s to resolve to %s, got %q", raw, expected, got[raw])
+		}
+	}
+}
+
+func TestHTMLParserExtractsMediaElements(t *testing.T) {
+	page := []byte(`<html><body>
+<picture>
+  <source srcset="hero.avif 1x, hero@2x.avif 2x" type="image/avif">
+  <source srcset="hero.webp" media="(min-width: 800px)" type="image/webp">
+  <img src="hero.jpg" srcset="hero-small.jpg 480w, hero-large.jpg 1080w,">
+</picture>
+<video src="clip.mp4" poster="poster.jpg">
+  <source src="clip.webm" type="video/webm">
+</video>
+<audio src="sound.mp3"><source src="sound.ogg" type="audio/ogg"></audio>
+</body></html>`)
+
+	result, err := html.NewParser().Parse(page, "http://example.com/media/")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	type link struct{ tag, attr string }
+	got := make(map[string]link)
+	for _, u := range result.URLs {
+		got[u.URL] = link{u.Tag, u.Attr}
+	}
+
+	want := map[string]link{
+		"hero.avif":      {"source", "srcset"},
+		"hero@2x.avif":   {"source", "srcset"},
+		"hero.webp":      {"source", "srcset"},
+		"hero.jpg":       {"img", "src"},
+		"hero-small.jpg": {"img", "srcset"},
+		"hero-large.jpg": {"img", "srcset"},
+		"clip.mp4":       {"video", "src"},
+		"poster.jpg":     {"video", "poster"},
+		"clip.webm":      {"source", "src"},
+		"sound.mp3":      {"audio", "src"},
+		"sound.ogg":      {"source", "src"},
+	}
+	for name, expected := range want {
+		url := "http://example.com/media/" + name
+		if l, ok := got[url]; !ok || l != expected {
+			t.Errorf("expected %s from <%s %s>, got %+v (found %v)", url, expected.tag, expected.attr, l, ok)
+		}
+	}
+	if len(result.URLs) != len(want) {
+		t.Errorf("expected %d URLs, got %d", len(want), len(result.URLs))
+	}
+}
@@ -0,0 +1,857 @@
+package test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/config"
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/core/utils"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// newTestConfig 创建测试用的最小配置
+func newTestConfig() *types.Config {
+	return &types.Config{
+		MaxThreads:      5,
+		Timeout:         10 * time.Second,
+		MaxRedirects:    10,
+		FollowRedirects: true,
+		Cookies:         make(map[string]string),
+	}
+}
+
+func TestRedirectWithoutLocation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusFound)
+		w.Write([]byte("<html>moved</html>"))
+	}))
+	defer server.Close()
+
+	client := httpCore.NewClient(newTestConfig())
+
+	resp, err := client.Get(context.Background(), server.URL+"/file.zip", "")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected error for 302 without Location, got nil")
+	}
+	if !strings.Contains(err.Error(), "302") || !strings.Contains(err.Error(), "Location") {
+		t.Errorf("error should mention status and missing Location, got: %v", err)
+	}
+
+	if _, err := client.Head(context.Background(), server.URL+"/file.zip"); err == nil {
+		t.Error("expected HEAD error for 302 without Location, got nil")
+	}
+}
+
+func TestRepeatedHeaders(t *testing.T) {
+	var got []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Values("X-Tag")
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("header", []string{"X-Tag: a", "X-Tag: b"})
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cfg.ProxyEnabled = false
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if len(got) != 2 || got[0] != "a" || got[1] != "b" {
+		t.Errorf("X-Tag headers = %v, expected [a b]", got)
+	}
+}
+
+func TestRedirectStripsAuthAcrossOrigins(t *testing.T) {
+	var otherAuth, sameAuth string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		otherAuth = r.Header.Get("Authorization")
+		w.Write([]byte("other"))
+	}))
+	defer other.Close()
+
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/cross":
+			http.Redirect(w, r, other.URL+"/target", http.StatusFound)
+		case "/same":
+			http.Redirect(w, r, "/target", http.StatusFound)
+		default:
+			sameAuth = r.Header.Get("Authorization")
+			w.Write([]byte("same"))
+		}
+	}))
+	defer origin.Close()
+
+	cfg := newTestConfig()
+	cfg.Headers = []types.HeaderField{{Key: "Authorization", Value: "Bearer secret"}}
+	client := httpCore.NewClient(cfg)
+
+	resp, err := client.Get(context.Background(), origin.URL+"/cross", "")
+	if err != nil {
+		t.Fatalf("cross-origin Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if otherAuth != "" {
+		t.Errorf("Authorization forwarded to a different origin: %q", otherAuth)
+	}
+
+	resp, err = client.Get(context.Background(), origin.URL+"/same", "")
+	if err != nil {
+		t.Fatalf("same-origin Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if sameAuth != "Bearer secret" {
+		t.Errorf("Authorization on same-origin redirect = %q, expected %q", sameAuth, "Bearer secret")
+	}
+}
+
+func TestIDNHostConvertedToPunycode(t *testing.T) {
+	var gotHost string
+	// 作为代理服务器接收请求，记录实际发出的主机名
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.URL.Hostname()
+		w.Write([]byte("ok"))
+	}))
+	defer proxy.Close()
+
+	cfg := newTestConfig()
+	cfg.ProxyEnabled = true
+	cfg.HTTPProxy = proxy.URL
+
+	const idnURL = "http://例え.jp/index.html"
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), idnURL, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if gotHost != "xn--r8jz45g.jp" {
+		t.Errorf("outgoing host = %q, expected xn--r8jz45g.jp", gotHost)
+	}
+
+	// 本地保存路径保持可读形式
+	if dir := utils.URLHostDir(idnURL); dir != "例え.jp" {
+		t.Errorf("URLHostDir(%q) = %q, expected 例え.jp", idnURL, dir)
+	}
+	if dir := utils.URLHostDir("http://xn--r8jz45g.jp/"); dir != "例え.jp" {
+		t.Errorf("URLHostDir(punycode) = %q, expected 例え.jp", dir)
+	}
+}
+
+func TestOversizedResponseHeadersRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Padding", strings.Repeat("a", 64*1024))
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxResponseHeaderBytes = 4 * 1024
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+	if err == nil {
+		resp.Body.Close()
+		t.Fatal("expected error for oversized response headers, got nil")
+	}
+	var limitErr *httpCore.HeaderLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 4*1024 {
+		t.Errorf("expected a HeaderLimitError for the size limit, got %v", err)
+	}
+	if httpCore.IsRetryable(err) {
+		t.Errorf("header limit errors must not be retried")
+	}
+
+	// 足够大的限制下请求正常完成
+	cfg.MaxResponseHeaderBytes = 1024 * 1024
+	resp, err = httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Get with larger limit failed: %v", err)
+	}
+	resp.Body.Close()
+}
+
+func TestTooManyResponseHeadersRejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 50; i++ {
+			w.Header().Add("X-Repeat", "v")
+		}
+		w.Write([]byte("body"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxResponseHeaders = 20
+
+	_, err := httpCore.NewClient(cfg).Head(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("expected error for too many response headers, got nil")
+	}
+	var limitErr *httpCore.HeaderLimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != 20 || limitErr.Count < 50 {
+		t.Errorf("expected a HeaderLimitError for the count limit, got %v", err)
+	}
+}
+
+func TestRefererSelf(t *testing.T) {
+	var mu sync.Mutex
+	referers := make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		referers[r.URL.Path] = r.Header.Get("Referer")
+		mu.Unlock()
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new?x=1", http.StatusFound)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Referer = types.RefererSelf
+	client := httpCore.NewClient(cfg)
+
+	resp, err := client.Get(context.Background(), server.URL+"/page.html", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = client.Get(context.Background(), server.URL+"/old", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	expected := map[string]string{
+		"/page.html": server.URL + "/page.html",
+		"/old":       server.URL + "/old",
+		"/new":       server.URL + "/new?x=1",
+	}
+	for path, want := range expected {
+		if got := referers[path]; got != want {
+			t.Errorf("Referer for %s = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestBindAddress(t *testing.T) {
+	// 127.0.0.2在Linux上属于回环网段，其他系统可能未配置该地址
+	probe, err := net.Listen("tcp", "127.0.0.2:0")
+	if err != nil {
+		t.Skipf("127.0.0.2 not available: %v", err)
+	}
+	probe.Close()
+
+	remoteCh := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case remoteCh <- r.RemoteAddr:
+		default:
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.BindAddress = "127.0.0.2"
+	client := httpCore.NewClient(cfg)
+
+	resp, err := client.Get(context.Background(), server.URL+"/file", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	host, _, err := net.SplitHostPort(<-remoteCh)
+	if err != nil {
+		t.Fatalf("invalid remote addr: %v", err)
+	}
+	if host != "127.0.0.2" {
+		t.Errorf("connection originated from %s, want 127.0.0.2", host)
+	}
+}
+
+func TestMaxRetriesTotal(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+
+		// /first前两次返回503，/second始终返回503
+		if r.URL.Path == "/second" || n <= 2 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxRetryWait = time.Minute
+	cfg.MaxRetriesTotal = 2
+	// Retry-After: 0按指数退避等待，缩短退避时间
+	cfg.WaitRetry = 10 * time.Millisecond
+	client := httpCore.NewClient(cfg)
+
+	resp, err := client.Get(context.Background(), server.URL+"/first", "")
+	if err != nil {
+		t.Fatalf("first download should succeed after two retries: %v", err)
+	}
+	resp.Body.Close()
+
+	resp, err = client.Get(context.Background(), server.URL+"/second", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the 503 to be returned once the retry budget is exhausted, got %d", resp.StatusCode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/first"] != 3 {
+		t.Errorf("/first requested %d times, want 3", requests["/first"])
+	}
+	if requests["/second"] != 1 {
+		t.Errorf("/second requested %d times, want 1 (no retries left)", requests["/second"])
+	}
+}
+
+func TestRetryAfterZeroBacksOff(t *testing.T) {
+	var mu sync.Mutex
+	var times []time.Time
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		times = append(times, time.Now())
+		mu.Unlock()
+		w.Header().Set("Retry-After", "0")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.MaxRetryWait = time.Hour
+	cfg.WaitRetry = 20 * time.Millisecond
+	cfg.Tries = 4
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL+"/", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("expected the last 503 to be returned, got %d", resp.StatusCode)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 尝试次数受--tries限制，且Retry-After: 0不会立即重试
+	if len(times) != cfg.Tries {
+		t.Fatalf("expected %d attempts, got %d", cfg.Tries, len(times))
+	}
+	for i := 1; i < len(times); i++ {
+		if gap := times[i].Sub(times[i-1]); gap < 15*time.Millisecond {
+			t.Errorf("retry %d was sent after %v, expected a backoff", i, gap)
+		}
+	}
+}
+
+func TestWaitRetry(t *testing.T) {
+	var mu sync.Mutex
+	requests := make(map[string]int)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests[r.URL.Path]++
+		n := requests[r.URL.Path]
+		mu.Unlock()
+
+		switch {
+		case r.URL.Path == "/missing":
+			http.NotFound(w, r)
+		case n <= 2:
+			// 前两次请求返回500，第二次直接断开连接
+			if n == 2 {
+				panic(http.ErrAbortHandler)
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.Write([]byte("ok"))
+		}
+	}))
+	defer server.Close()
+
+	get := func(t *testing.T, waitRetry time.Duration, path string) (*http.Response, error) {
+		t.Helper()
+		cfg := newTestConfig()
+		cfg.MaxRetryWait = time.Minute
+		cfg.WaitRetry = waitRetry
+		return httpCore.NewClient(cfg).Get(context.Background(), server.URL+path, "")
+	}
+
+	t.Run("RetriesTransientErrors", func(t *testing.T) {
+		resp, err := get(t, 10*time.Millisecond, "/flaky")
+		if err != nil {
+			t.Fatalf("expected the request to succeed after retrying a 500 and a dropped connection: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			t.Fatalf("expected 200 after retries, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("DisabledByDefault", func(t *testing.T) {
+		resp, err := get(t, 0, "/flaky-default")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusInternalServerError {
+			t.Errorf("expected the 500 to be returned without --wait-retry, got %d", resp.StatusCode)
+		}
+	})
+
+	t.Run("ClientErrorsAreFatal", func(t *testing.T) {
+		resp, err := get(t, 10*time.Millisecond, "/missing")
+		if err != nil {
+			t.Fatalf("Get failed: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("expected 404, got %d", resp.StatusCode)
+		}
+	})
+
+	mu.Lock()
+	defer mu.Unlock()
+	if requests["/flaky"] != 3 {
+		t.Errorf("/flaky requested %d times, want 3", requests["/flaky"])
+	}
+	if requests["/flaky-default"] != 1 {
+		t.Errorf("/flaky-default requested %d times, want 1", requests["/flaky-default"])
+	}
+	if requests["/missing"] != 1 {
+		t.Errorf("/missing requested %d times, want 1 (404 is not retried)", requests["/missing"])
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"ServerError", &httpCore.HTTPError{StatusCode: http.StatusBadGateway}, true},
+		{"RequestTimeout", &httpCore.HTTPError{StatusCode: http.StatusRequestTimeout}, true},
+		{"TooManyRequests", &httpCore.HTTPError{StatusCode: http.StatusTooManyRequests}, true},
+		{"NotFound", &httpCore.HTTPError{StatusCode: http.StatusNotFound}, false},
+		{"Forbidden", &httpCore.HTTPError{StatusCode: http.StatusForbidden}, false},
+		{"Wrapped", fmt.Errorf("获取文件信息失败: %w", &httpCore.HTTPError{StatusCode: http.StatusServiceUnavailable}), true},
+		{"RangeNotSupported", &httpCore.RangeNotSupportedError{StatusCode: http.StatusOK}, false},
+		{"ConnectionReset", &httpCore.RequestError{Phase: httpCore.PhaseBody, Err: syscall.ECONNRESET}, true},
+		{"Canceled", &httpCore.RequestError{Phase: httpCore.PhaseHeaders, Err: context.Canceled}, false},
+		{"RemoteFileChanged", httpCore.ErrRemoteFileChanged, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := httpCore.IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHeaderWithEmptyValueRemovesHeader(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("header", []string{
+		"Accept: text/html",
+		"Accept: application/json",
+		"X-Debug: 1",
+		"X-Debug:",
+		"User-Agent:",
+		"Accept-Encoding:",
+	})
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cfg.ProxyEnabled = false
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if accept := got.Values("Accept"); len(accept) != 2 || accept[0] != "text/html" || accept[1] != "application/json" {
+		t.Errorf("Accept headers = %v, expected [text/html application/json]", accept)
+	}
+	for _, key := range []string{"X-Debug", "User-Agent", "Accept-Encoding"} {
+		if values, ok := got[key]; ok {
+			t.Errorf("%s should be removed, got %v", key, values)
+		}
+	}
+}
+
+func TestDialErrorIncludesHostAndProxy(t *testing.T) {
+	// 获取一个没有监听的端口
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := listener.Addr().String()
+	listener.Close()
+
+	cfg := newTestConfig()
+	client := httpCore.NewClient(cfg)
+	_, err = client.Get(context.Background(), "http://"+host+"/file", "")
+	if err == nil {
+		t.Fatal("expected dial error")
+	}
+
+	var reqErr *httpCore.RequestError
+	if !errors.As(err, &reqErr) {
+		t.Fatalf("expected *RequestError, got %T: %v", err, err)
+	}
+	if reqErr.Host != host || reqErr.Proxy != "" || reqErr.Phase != httpCore.PhaseDial {
+		t.Errorf("unexpected error context: host=%q proxy=%q phase=%q", reqErr.Host, reqErr.Proxy, reqErr.Phase)
+	}
+	for _, want := range []string{host, "代理: 无", "阶段: dial"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q does not mention %q", err, want)
+		}
+	}
+}
+
+// startTestDNSServer 启动只返回127.0.0.1的A记录的UDP DNS服务器，返回地址和已收到的A查询数
+func startTestDNSServer(t *testing.T) (string, *atomic.Int32) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	var queries atomic.Int32
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var req dnsmessage.Message
+			if err := req.Unpack(buf[:n]); err != nil || len(req.Questions) == 0 {
+				continue
+			}
+			q := req.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: req.ID, Response: true, Authoritative: true},
+				Questions: req.Questions,
+			}
+			if q.Type == dnsmessage.TypeA {
+				queries.Add(1)
+				resp.Answers = []dnsmessage.Resource{{
+					Header: dnsmessage.ResourceHeader{Name: q.Name, Type: dnsmessage.TypeA, Class: dnsmessage.ClassINET, TTL: 60},
+					Body:   &dnsmessage.AResource{A: [4]byte{127, 0, 0, 1}},
+				}}
+			}
+			packed, err := resp.Pack()
+			if err == nil {
+				conn.WriteTo(packed, addr)
+			}
+		}
+	}()
+	return conn.LocalAddr().String(), &queries
+}
+
+func TestDNSServersAndCache(t *testing.T) {
+	dnsAddr, queries := startTestDNSServer(t)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+	// 每个请求使用新连接，确保每次都需要解析主机名
+	server.Config.SetKeepAlivesEnabled(false)
+	_, port, _ := net.SplitHostPort(server.Listener.Addr().String())
+	url := "http://mirror.wget2go.test:" + port + "/"
+
+	cfg := newTestConfig()
+	cfg.DNSServers = []string{dnsAddr}
+	cfg.DNSCache = true
+	cfg.DNSCacheTTL = time.Minute
+	client := httpCore.NewClient(cfg)
+
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), url, "")
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i+1, err)
+		}
+		resp.Body.Close()
+	}
+
+	// 主机名只通过指定的DNS服务器解析一次，之后使用缓存
+	if got := queries.Load(); got != 1 {
+		t.Errorf("expected 1 A query to the configured DNS server, got %d", got)
+	}
+}
+
+func TestHostSettingsOverrideGlobalConfig(t *testing.T) {
+	var got http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.Header.Clone()
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	newConfig := func(cliKeys ...string) *types.Config {
+		cm := config.NewConfigManager()
+		cm.GetViper().Set("user_agent", "global-agent")
+		cm.GetViper().Set("header", []string{"X-Token: global", "X-Global: 1"})
+		cm.GetViper().Set("hosts", map[string]interface{}{
+			"127.0.0.1": map[string]interface{}{
+				"user_agent": "host-agent",
+				"header":     []interface{}{"X-Token: host", "X-Host: 1"},
+				"limit_rate": "1M",
+			},
+		})
+		cm.SetCommandLineKeys(cliKeys)
+		cfg, err := cm.Parse()
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		cfg.ProxyEnabled = false
+		return cfg
+	}
+
+	client := httpCore.NewClient(newConfig())
+	resp, err := client.Get(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if ua := got.Get("User-Agent"); ua != "host-agent" {
+		t.Errorf("User-Agent = %q, expected host-agent", ua)
+	}
+	if token := got.Values("X-Token"); len(token) != 1 || token[0] != "host" {
+		t.Errorf("X-Token = %v, expected [host]", token)
+	}
+	if got.Get("X-Global") != "1" || got.Get("X-Host") != "1" {
+		t.Errorf("expected both X-Global and X-Host, got %v", got)
+	}
+	if limiter, ok := client.HostLimiter(server.URL); !ok || limiter == nil {
+		t.Error("expected a host limiter for limit_rate")
+	}
+	if _, ok := client.HostLimiter("http://other.example/"); ok {
+		t.Error("unexpected host limiter for a host without settings")
+	}
+
+	// 命令行中显式指定的选项优先于主机设置
+	resp, err = httpCore.NewClient(newConfig("user_agent", "header")).Get(context.Background(), server.URL, "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	resp.Body.Close()
+	if ua := got.Get("User-Agent"); ua != "global-agent" {
+		t.Errorf("User-Agent = %q, expected global-agent from the command line", ua)
+	}
+	if token := got.Values("X-Token"); len(token) != 1 || token[0] != "global" {
+		t.Errorf("X-Token = %v, expected [global] from the command line", token)
+	}
+	if got.Get("X-Host") != "1" {
+		t.Error("host header not set on the command line should still be sent")
+	}
+}
+
+func TestHostConfigFor(t *testing.T) {
+	exact := &types.HostConfig{}
+	suffix := &types.HostConfig{}
+	cfg := &types.Config{Hosts: map[string]*types.HostConfig{
+		"cdn.example.com": exact,
+		".example.com":    suffix,
+	}}
+
+	tests := []struct {
+		host     string
+		expected *types.HostConfig
+	}{
+		{"cdn.example.com", exact},
+		{"CDN.Example.com.", exact},
+		{"img.cdn.example.com", suffix},
+		{"www.example.com", suffix},
+		{"example.com", nil},
+		{"example.org", nil},
+	}
+	for _, tt := range tests {
+		if got := cfg.HostConfigFor(tt.host); got != tt.expected {
+			t.Errorf("HostConfigFor(%q) returned the wrong settings", tt.host)
+		}
+	}
+}
+
+// roundTripFunc 用函数实现的http.RoundTripper
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNewClientWithTransport(t *testing.T) {
+	var ranges []string
+	transport := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		ranges = append(ranges, req.Header.Get("Range"))
+		status := http.StatusPartialContent
+		if req.Header.Get("Range") == "bytes=100-199" {
+			status = http.StatusRequestedRangeNotSatisfiable
+		}
+		return &http.Response{
+			StatusCode:    status,
+			Header:        http.Header{"Content-Range": {"bytes 0-3/4"}},
+			Body:          io.NopCloser(strings.NewReader("data")),
+			ContentLength: 4,
+			Request:       req,
+		}, nil
+	})
+
+	client := httpCore.NewClientWithTransport(newTestConfig(), transport)
+	body, length, err := client.DownloadRange(context.Background(), "http://example.invalid/file", 0, 3)
+	if err != nil {
+		t.Fatalf("DownloadRange failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "data" || length != 4 {
+		t.Errorf("got %q (%d bytes), expected \"data\" (4 bytes)", data, length)
+	}
+
+	_, _, err = client.DownloadRange(context.Background(), "http://example.invalid/file", 100, 199)
+	var rangeErr *httpCore.RangeNotSupportedError
+	if !errors.As(err, &rangeErr) || rangeErr.StatusCode != http.StatusRequestedRangeNotSatisfiable {
+		t.Errorf("expected RangeNotSupportedError for 416, got %v", err)
+	}
+	if len(ranges) != 2 || ranges[0] != "bytes=0-3" || ranges[1] != "bytes=100-199" {
+		t.Errorf("Range headers = %v", ranges)
+	}
+}
+
+func TestUnixSocket(t *testing.T) {
+	// Unix域套接字路径长度有限，不使用较长的t.TempDir()
+	dir, err := os.MkdirTemp("", "wget2go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	socketPath := filepath.Join(dir, "http.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("Unix域套接字不可用: %v", err)
+	}
+	var gotHost string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotHost = r.Host
+		w.Write([]byte("from socket"))
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.UnixSocket = socketPath
+	cfg.ProxyEnabled = true
+	cfg.HTTPProxy = "http://127.0.0.1:1"
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), "http://daemon.local/v1/info", "")
+	if err != nil {
+		t.Fatalf("Get failed: %v", err)
+	}
+	data, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(data) != "from socket" {
+		t.Errorf("body = %q, expected the response from the socket", data)
+	}
+	if gotHost != "daemon.local" {
+		t.Errorf("Host = %q, expected daemon.local", gotHost)
+	}
+}
+
+func TestProbeSize(t *testing.T) {
+	tests := []struct {
+		name         string
+		status       int
+		contentRange string
+		expected     int64
+		wantErr      bool
+	}{
+		{"Total", http.StatusPartialContent, "bytes 0-0/12345", 12345, false},
+		{"CaseInsensitiveUnit", http.StatusPartialContent, "BYTES 0-0/42", 42, false},
+		{"UnknownTotal", http.StatusPartialContent, "bytes 0-0/*", 0, true},
+		{"MissingUnit", http.StatusPartialContent, "0-0/100", 0, true},
+		{"OtherUnit", http.StatusPartialContent, "items 0-0/100", 0, true},
+		{"ZeroTotal", http.StatusPartialContent, "bytes 0-0/0", 0, true},
+		{"RangeIgnored", http.StatusOK, "", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotRange string
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				gotRange = r.Header.Get("Range")
+				if tt.contentRange != "" {
+					w.Header().Set("Content-Range", tt.contentRange)
+				}
+				w.WriteHeader(tt.status)
+				w.Write([]byte("x"))
+			}))
+			defer server.Close()
+
+			total, err := httpCore.NewClient(newTestConfig()).ProbeSize(context.Background(), server.URL+"/file")
+			if gotRange != "bytes=0-0" {
+				t.Errorf("expected a Range: bytes=0-0 probe, got %q", gotRange)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ProbeSize() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if total != tt.expected {
+				t.Errorf("ProbeSize() = %d, expected %d", total, tt.expected)
+			}
+		})
+	}
+}
@@ -0,0 +1,64 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/metalink"
+	"github.com/example/wget2go/internal/downloader/chunk"
+)
+
+func TestKeepBadHash(t *testing.T) {
+	content := "corrupted payload"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(content))
+	}))
+	defer server.Close()
+
+	file := &metalink.File{
+		Name:   "data.bin",
+		Size:   int64(len(content)),
+		Hashes: []metalink.Hash{{Type: "sha-256", Value: strings.Repeat("0", 64)}},
+		URLs:   []metalink.URL{{Value: server.URL + "/data.bin"}},
+	}
+
+	t.Run("Default", func(t *testing.T) {
+		cfg := newTestConfig()
+		outputPath := filepath.Join(t.TempDir(), "data.bin")
+
+		err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).DownloadMetalinkFile(context.Background(), file, outputPath)
+		if err == nil {
+			t.Fatal("expected hash mismatch error")
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Errorf("file failing checksum should be removed")
+		}
+		if _, err := os.Stat(outputPath + ".bad"); !os.IsNotExist(err) {
+			t.Errorf(".bad file should not be created without --keep-bad-hash")
+		}
+	})
+
+	t.Run("KeepBadHash", func(t *testing.T) {
+		cfg := newTestConfig()
+		cfg.KeepBadHash = true
+		outputPath := filepath.Join(t.TempDir(), "data.bin")
+
+		err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).DownloadMetalinkFile(context.Background(), file, outputPath)
+		if err == nil {
+			t.Fatal("expected hash mismatch error")
+		}
+		if _, err := os.Stat(outputPath); !os.IsNotExist(err) {
+			t.Errorf("original file name should not remain after mismatch")
+		}
+		data, err := os.ReadFile(outputPath + ".bad")
+		if err != nil || string(data) != content {
+			t.Errorf(".bad file content = %q, %v", data, err)
+		}
+	})
+}
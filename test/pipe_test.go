@@ -0,0 +1,72 @@
+//go:build unix
+
+package test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/downloader/chunk"
+)
+
+func TestDownloadToPipeUsesSingleThread(t *testing.T) {
+	content := strings.Repeat("0123456789abcdef", 4096)
+	var rangeRequests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, strings.NewReader(content))
+	}))
+	defer server.Close()
+
+	fifo := filepath.Join(t.TempDir(), "out.fifo")
+	if err := syscall.Mkfifo(fifo, 0644); err != nil {
+		t.Skipf("mkfifo not supported: %v", err)
+	}
+
+	done := make(chan []byte, 1)
+	go func() {
+		f, err := os.Open(fifo)
+		if err != nil {
+			done <- nil
+			return
+		}
+		defer f.Close()
+		data, _ := io.ReadAll(f)
+		done <- data
+	}()
+
+	cfg := newTestConfig()
+	cfg.ChunkSize = 8 * 1024
+	downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/file.bin", fifo); err != nil {
+		t.Fatalf("Download to pipe failed: %v", err)
+	}
+
+	select {
+	case data := <-done:
+		if !bytes.Equal(data, []byte(content)) {
+			t.Errorf("pipe received %d bytes, want %d", len(data), len(content))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out reading from pipe")
+	}
+	if n := rangeRequests.Load(); n != 0 {
+		t.Errorf("expected a single sequential download, got %d range requests", n)
+	}
+	if info, err := os.Stat(fifo); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Errorf("output pipe was replaced: %v", err)
+	}
+}
@@ -0,0 +1,120 @@
+package test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/config"
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/utils"
+	"github.com/example/wget2go/internal/downloader/chunk"
+)
+
+func TestProgressInterval(t *testing.T) {
+	const parts = 9
+	const partSize = 1024
+
+	// 服务器约4.5秒内缓慢发送数据
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Length", strconv.Itoa(parts*partSize))
+		if r.Method == http.MethodHead {
+			return
+		}
+		flusher := w.(http.Flusher)
+		for i := 0; i < parts; i++ {
+			w.Write(make([]byte, partSize))
+			flusher.Flush()
+			time.Sleep(500 * time.Millisecond)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.ProgressInterval = 2 * time.Second
+
+	downloader := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg)
+	defer downloader.Stop()
+
+	var mu sync.Mutex
+	var updates []time.Time
+	go func() {
+		for range downloader.GetProgressChannel() {
+			mu.Lock()
+			updates = append(updates, time.Now())
+			mu.Unlock()
+		}
+	}()
+
+	start := time.Now()
+	if err := downloader.Download(context.Background(), server.URL+"/slow.bin", filepath.Join(t.TempDir(), "slow.bin")); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	// 500ms间隔会产生约9次更新，2s间隔最多约2次
+	if len(updates) == 0 || len(updates) > int(elapsed/(2*time.Second))+1 {
+		t.Fatalf("got %d progress updates in %v, expected about one every 2s", len(updates), elapsed)
+	}
+	prev := start
+	for i, at := range updates {
+		if gap := at.Sub(prev); gap < 1500*time.Millisecond {
+			t.Errorf("progress update %d came %v after the previous one, expected about 2s", i, gap)
+		}
+		prev = at
+	}
+}
+
+func TestSpeedWindowReflectsCurrentThroughput(t *testing.T) {
+	start := time.Unix(1000, 0)
+	// 续传时已有的1MB不计入速度
+	window := utils.NewSpeedWindow(5*time.Second, start, 1<<20)
+
+	// 前10秒每秒100KB
+	downloaded := int64(1 << 20)
+	for i := 1; i <= 10; i++ {
+		downloaded += 100 * 1024
+		if speed := window.Update(start.Add(time.Duration(i)*time.Second), downloaded); speed != 100*1024 {
+			t.Fatalf("second %d: expected 102400 B/s, got %d", i, speed)
+		}
+	}
+
+	// 之后降到每秒10KB，5秒后速度只反映新的吞吐量，而不是整体平均值
+	var speed int64
+	for i := 11; i <= 15; i++ {
+		downloaded += 10 * 1024
+		speed = window.Update(start.Add(time.Duration(i)*time.Second), downloaded)
+	}
+	if speed != 10*1024 {
+		t.Errorf("expected 10240 B/s after the slowdown, got %d", speed)
+	}
+}
+
+func TestReportSpeedConfig(t *testing.T) {
+	for _, value := range []string{"bits", "BYTES"} {
+		cm := config.NewConfigManager()
+		cm.GetViper().Set("report_speed", value)
+		cfg, err := cm.Parse()
+		if err != nil {
+			t.Fatalf("report_speed=%s rejected: %v", value, err)
+		}
+		if want := strings.ToLower(value); cfg.ReportSpeed != want {
+			t.Errorf("report_speed=%s parsed as %q, want %q", value, cfg.ReportSpeed, want)
+		}
+	}
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("report_speed", "bauds")
+	if _, err := cm.Parse(); err == nil {
+		t.Error("expected an invalid report_speed to be rejected")
+	}
+}
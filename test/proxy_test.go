@@ -0,0 +1,299 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/downloader/chunk"
+)
+
+// connectProxy 测试用的HTTP代理，支持CONNECT隧道和普通HTTP转发，
+// 设置了用户名时要求Basic代理认证
+type connectProxy struct {
+	*httptest.Server
+	connects atomic.Int32 // 成功建立的CONNECT隧道数
+	rejected atomic.Int32 // 因认证失败返回407的请求数
+}
+
+func newConnectProxy(t *testing.T, username, password string) *connectProxy {
+	t.Helper()
+	p := &connectProxy{}
+	wantAuth := ""
+	if username != "" {
+		wantAuth = "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+	}
+
+	p.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wantAuth != "" && r.Header.Get("Proxy-Authorization") != wantAuth {
+			p.rejected.Add(1)
+			w.Header().Set("Proxy-Authenticate", `Basic realm="test proxy"`)
+			w.WriteHeader(http.StatusProxyAuthRequired)
+			return
+		}
+
+		if r.Method != http.MethodConnect {
+			// 普通HTTP请求转发给目标服务器，不转发代理认证头
+			outReq := r.Clone(r.Context())
+			outReq.RequestURI = ""
+			outReq.Header.Del("Proxy-Authorization")
+			resp, err := http.DefaultTransport.RoundTrip(outReq)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadGateway)
+				return
+			}
+			defer resp.Body.Close()
+			for key, values := range resp.Header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(resp.StatusCode)
+			io.Copy(w, resp.Body)
+			return
+		}
+
+		target, err := net.DialTimeout("tcp", r.Host, 5*time.Second)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		conn, buf, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			target.Close()
+			return
+		}
+		p.connects.Add(1)
+		conn.Write([]byte("HTTP/1.1 200 Connection established\r\n\r\n"))
+
+		done := make(chan struct{}, 2)
+		go func() {
+			io.Copy(target, buf)
+			done <- struct{}{}
+		}()
+		go func() {
+			io.Copy(conn, target)
+			done <- struct{}{}
+		}()
+		<-done
+		conn.Close()
+		target.Close()
+	}))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func TestChunkedHTTPSDownloadThroughAuthenticatedConnectProxy(t *testing.T) {
+	content := bytes.Repeat([]byte("tunnelled "), 4096)
+	var leakedAuth atomic.Bool
+	origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Proxy-Authorization") != "" {
+			leakedAuth.Store(true)
+		}
+		http.ServeContent(w, r, "file.bin", time.Time{}, bytes.NewReader(content))
+	}))
+	defer origin.Close()
+
+	proxy := newConnectProxy(t, "alice", "s3cret")
+
+	download := func(t *testing.T, password string) (string, error) {
+		t.Helper()
+		cfg := newTestConfig()
+		cfg.Insecure = true
+		cfg.ProxyEnabled = true
+		cfg.HTTPSProxy = proxy.URL
+		cfg.ProxyUsername = "alice"
+		cfg.ProxyPassword = password
+		cfg.ChunkSize = 8 * 1024
+
+		outputPath := filepath.Join(t.TempDir(), "file.bin")
+		err := chunk.NewChunkDownloader(httpCore.NewClient(cfg), cfg).Download(context.Background(), origin.URL+"/file.bin", outputPath)
+		return outputPath, err
+	}
+
+	t.Run("Authenticated", func(t *testing.T) {
+		outputPath, err := download(t, "s3cret")
+		if err != nil {
+			t.Fatalf("download through the proxy failed: %v", err)
+		}
+		data, err := os.ReadFile(outputPath)
+		if err != nil || !bytes.Equal(data, content) {
+			t.Fatalf("downloaded file differs from the origin (err %v)", err)
+		}
+		if proxy.connects.Load() == 0 {
+			t.Error("expected the download to go through a CONNECT tunnel")
+		}
+		if leakedAuth.Load() {
+			t.Error("Proxy-Authorization must not be sent to the origin server")
+		}
+	})
+
+	t.Run("WrongPassword", func(t *testing.T) {
+		_, err := download(t, "wrong")
+		if err == nil || !strings.Contains(err.Error(), http.StatusText(http.StatusProxyAuthRequired)) {
+			t.Fatalf("expected a 407 error from the proxy, got %v", err)
+		}
+		if proxy.rejected.Load() == 0 {
+			t.Error("expected the proxy to reject the CONNECT request")
+		}
+	})
+}
+
+func TestPlainHTTPProxyAuthOnlySentToProxy(t *testing.T) {
+	var originAuth atomic.Value
+	origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		originAuth.Store(r.Header.Get("Proxy-Authorization"))
+		w.Write([]byte("ok"))
+	}))
+	defer origin.Close()
+
+	proxy := newConnectProxy(t, "alice", "s3cret")
+	cfg := newTestConfig()
+	cfg.ProxyEnabled = true
+	cfg.HTTPProxy = proxy.URL
+	cfg.ProxyUsername = "alice"
+	cfg.ProxyPassword = "s3cret"
+
+	resp, err := httpCore.NewClient(cfg).Get(context.Background(), origin.URL, "")
+	if err != nil {
+		t.Fatalf("request through the proxy failed: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("expected 200 through the authenticated proxy, got %d", resp.StatusCode)
+	}
+	if auth, ok := originAuth.Load().(string); !ok || auth != "" {
+		t.Errorf("expected the request to reach the origin without Proxy-Authorization, got %q (reached: %v)", auth, ok)
+	}
+}
+
+// newFailingProxy 接受连接后立即关闭的代理，返回代理地址和收到的连接数
+func newFailingProxy(t *testing.T) (string, *atomic.Int32) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	var accepted atomic.Int32
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			accepted.Add(1)
+			conn.Close()
+		}
+	}()
+	return "http://" + ln.Addr().String(), &accepted
+}
+
+func TestProxyFailover(t *testing.T) {
+	content := []byte("through the next proxy")
+
+	t.Run("CONNECTFailure", func(t *testing.T) {
+		origin := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		defer origin.Close()
+
+		deadProxy, accepted := newFailingProxy(t)
+		liveProxy := newConnectProxy(t, "", "")
+
+		cfg := newTestConfig()
+		cfg.Insecure = true
+		cfg.HTTPSProxy = deadProxy + "," + liveProxy.URL
+		cfg.ProxyRotation = types.ProxyRotationRoundRobin
+		client := httpCore.NewClient(cfg)
+
+		// 轮换模式下请求交替分配给两个代理，失败的代理连续失败3次后被暂停使用
+		for i := 0; i < 8; i++ {
+			resp, err := client.Get(context.Background(), origin.URL, "")
+			if err != nil {
+				t.Fatalf("request %d did not fail over to the live proxy: %v", i, err)
+			}
+			body, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if !bytes.Equal(body, content) {
+				t.Fatalf("request %d: unexpected body %q", i, body)
+			}
+		}
+		if got := accepted.Load(); got != 3 {
+			t.Errorf("expected the failing proxy to be tried 3 times before being skipped, got %d", got)
+		}
+		if liveProxy.connects.Load() == 0 {
+			t.Error("expected requests to go through the live proxy")
+		}
+	})
+
+	t.Run("BadGateway", func(t *testing.T) {
+		origin := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write(content)
+		}))
+		defer origin.Close()
+
+		var gatewayHits atomic.Int32
+		badGateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			gatewayHits.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer badGateway.Close()
+		liveProxy := newConnectProxy(t, "", "")
+
+		cfg := newTestConfig()
+		cfg.HTTPProxy = badGateway.URL + "," + liveProxy.URL
+		cfg.ProxyRotation = types.ProxyRotationRoundRobin
+
+		resp, err := httpCore.NewClient(cfg).Get(context.Background(), origin.URL, "")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusOK || !bytes.Equal(body, content) {
+			t.Fatalf("expected the request to succeed through the live proxy, got %d %q", resp.StatusCode, body)
+		}
+		if gatewayHits.Load() != 1 {
+			t.Errorf("expected the 502 proxy to be tried once, got %d", gatewayHits.Load())
+		}
+	})
+
+	t.Run("AllProxiesFail", func(t *testing.T) {
+		// 关闭监听后连接代理会被拒绝
+		var proxies []string
+		for i := 0; i < 2; i++ {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				t.Fatal(err)
+			}
+			proxies = append(proxies, "http://"+ln.Addr().String())
+			ln.Close()
+		}
+
+		cfg := newTestConfig()
+		cfg.HTTPProxy = strings.Join(proxies, ",")
+		cfg.ProxyRotation = types.ProxyRotationRoundRobin
+
+		_, err := httpCore.NewClient(cfg).Get(context.Background(), "http://example.invalid/", "")
+		var reqErr *httpCore.RequestError
+		if !errors.As(err, &reqErr) || reqErr.Phase != httpCore.PhaseDial {
+			t.Fatalf("expected a dial error once every proxy failed, got %v", err)
+		}
+		if reqErr.Proxy != proxies[1] {
+			t.Errorf("expected the error to report the last proxy tried (%s), got %s", proxies[1], reqErr.Proxy)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/example/wget2go/internal/core/queue"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+// 使用go test -race运行以检查队列的并发访问
+func TestQueueManagerConcurrentAccess(t *testing.T) {
+	const producers, perProducer = 4, 200
+
+	m := queue.NewManager()
+	var popped atomic.Int64
+	var wg sync.WaitGroup
+
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				job := &types.Job{URL: fmt.Sprintf("http://example.com/%d/%d", p, i)}
+				if err := m.Add(job); err != nil {
+					t.Errorf("Add failed: %v", err)
+				}
+			}
+		}(p)
+	}
+
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				if job := m.Peek(); job != nil {
+					m.Contains(job.URL)
+				}
+				m.Size()
+				m.IsEmpty()
+				m.GetPendingJobs()
+				if m.Pop() != nil {
+					popped.Add(1)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	for m.Pop() != nil {
+		popped.Add(1)
+	}
+	close(done)
+	readers.Wait()
+	for m.Pop() != nil {
+		popped.Add(1)
+	}
+
+	if n := popped.Load(); n != producers*perProducer {
+		t.Errorf("popped %d jobs, want %d", n, producers*perProducer)
+	}
+}
+
+func TestQueueManagerTraversalOrder(t *testing.T) {
+	for _, tt := range []struct {
+		traversal string
+		want      []string
+	}{
+		// 移除中间的URL不打乱其余URL的顺序
+		{types.TraversalBFS, []string{"a", "c", "d"}},
+		{types.TraversalDFS, []string{"d", "c", "a"}},
+	} {
+		m := queue.NewManager()
+		m.SetTraversal(tt.traversal)
+		for _, u := range []string{"a", "b", "c", "d"} {
+			m.Add(&types.Job{URL: u})
+		}
+		if !m.Remove("b") {
+			t.Errorf("%s: Remove(b) = false", tt.traversal)
+		}
+		if peek := m.Peek(); peek == nil || peek.URL != tt.want[0] {
+			t.Errorf("%s: Peek = %v, want %s", tt.traversal, peek, tt.want[0])
+		}
+		for _, want := range tt.want {
+			if job := m.Pop(); job == nil || job.URL != want {
+				t.Errorf("%s: Pop = %v, want %s", tt.traversal, job, want)
+			}
+		}
+		if job := m.Pop(); job != nil {
+			t.Errorf("%s: expected an empty queue, got %v", tt.traversal, job)
+		}
+	}
+}
@@ -0,0 +1,1046 @@
+package test
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/config"
+	"github.com/example/wget2go/internal/core/cache"
+	"github.com/example/wget2go/internal/core/converter"
+	httpCore "github.com/example/wget2go/internal/core/http"
+	"github.com/example/wget2go/internal/core/types"
+	"github.com/example/wget2go/internal/downloader/recursive"
+)
+
+func TestRecursiveLinkWithSpaceIsEncoded(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.RequestURI] = true
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="my file.html">file</a> <a href="search?q=a b">search</a></body></html>`))
+		case "/my file.html", "/search":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>ok</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, uri := range []string{"/my%20file.html", "/search?q=a%20b"} {
+		if !requested[uri] {
+			t.Errorf("expected request for %s, got %v", uri, requested)
+		}
+	}
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	data, err := os.ReadFile(filepath.Join(outputDir, host, "my file.html"))
+	if err != nil || len(data) == 0 {
+		t.Errorf("linked file was not saved: %v", err)
+	}
+}
+
+func TestRecursivePathTraversal(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("root:x:0:0"))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.Quiet = true
+	cfg.NoHostDirectories = true
+
+	parentDir := t.TempDir()
+	outputDir := filepath.Join(parentDir, "out")
+
+	for _, rawPath := range []string{"/a/../../etc/passwd", "/a/%2e%2e/%2e%2e/etc/passwd", "//a//..//..//..//etc/passwd"} {
+		downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+		if err := downloader.Download(context.Background(), server.URL+rawPath, outputDir); err != nil {
+			t.Fatalf("Download %s failed: %v", rawPath, err)
+		}
+
+		for _, file := range downloader.GetDownloadedFiles() {
+			rel, err := filepath.Rel(outputDir, file)
+			if err != nil || strings.HasPrefix(rel, "..") {
+				t.Errorf("%s was saved outside the output directory: %s", rawPath, file)
+			}
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(parentDir, "etc", "passwd")); !os.IsNotExist(err) {
+		t.Errorf("file escaped the output directory")
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "etc", "passwd")); err != nil {
+		t.Errorf("expected file to be saved inside the output directory: %v", err)
+	}
+}
+
+// syncBuffer 可并发写入的缓冲区
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestRecursiveVerboseReportsParser(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="a.html">a</a> <a href="b.html">b</a> <img src="logo.png"></body></html>`))
+		case "/a.html", "/b.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>ok</body></html>"))
+		case "/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("\x89PNG"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.Verbose = true
+
+	var out syncBuffer
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	downloader.SetOutput(&out)
+	if err := downloader.Download(context.Background(), server.URL+"/", t.TempDir()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	log := out.String()
+	if want := server.URL + "/: 按HTML解析，提取了3个URL"; !strings.Contains(log, want) {
+		t.Errorf("verbose log missing %q, got:\n%s", want, log)
+	}
+	if want := server.URL + "/logo.png: 作为二进制文件处理"; !strings.Contains(log, want) {
+		t.Errorf("verbose log missing %q, got:\n%s", want, log)
+	}
+}
+
+func TestRecursiveRestrictFileNames(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="/文档/CON.txt">con</a> <a href="/a:b.html">colon</a></body></html>`))
+		case "/文档/CON.txt", "/a:b.html":
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("ok"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.Quiet = true
+	cfg.NoHostDirectories = true
+	cfg.RestrictFileNames = "windows"
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	for _, name := range []string{filepath.Join("文档", "CON_.txt"), "a%3Ab.html"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+}
+
+func TestRecursivePageRequisitesIgnoreDepth(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="page.html">page</a></body></html>`))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="style.css"></head>` +
+				`<body><img src="pic.png"><a href="deeper.html">deeper</a></body></html>`))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`@import "extra.css"; body { background: url(bg.png) }`))
+		case "/extra.css":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`p { color: red }`))
+		case "/pic.png", "/bg.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		case "/deeper.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>too deep</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.PageRequisites = true
+	cfg.Quiet = true
+
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", t.TempDir()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 最后一层页面的必需资源（包括CSS引用的资源）不受深度限制
+	for _, path := range []string{"/page.html", "/style.css", "/extra.css", "/pic.png", "/bg.png"} {
+		if !requested[path] {
+			t.Errorf("expected requisite %s to be fetched, got %v", path, requested)
+		}
+	}
+	if requested["/deeper.html"] {
+		t.Errorf("link beyond the maximum depth should not be followed")
+	}
+}
+
+func TestPrivacyReportListsThirdPartyHosts(t *testing.T) {
+	thirdParty := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("png"))
+	}))
+	defer thirdParty.Close()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><body><img src="` + thirdParty.URL + `/tracker.png"></body></html>`))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.Quiet = true
+	cfg.Cookies = map[string]string{"session": "secret"}
+
+	client := httpCore.NewClient(cfg)
+	report := httpCore.NewPrivacyReport()
+	client.SetPrivacyReport(report)
+
+	downloader := recursive.NewRecursiveDownloader(client, cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", t.TempDir()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	firstParty := strings.TrimPrefix(server.URL, "http://")
+	thirdPartyHost := strings.TrimPrefix(thirdParty.URL, "http://")
+	hosts := report.ThirdParty(firstParty)
+	if len(hosts) != 1 || hosts[0].Host != thirdPartyHost {
+		t.Fatalf("expected third-party host %s, got %+v", thirdPartyHost, hosts)
+	}
+	if hosts[0].Requests == 0 || hosts[0].Cookies != hosts[0].Requests {
+		t.Errorf("expected every third-party request to be reported with its cookie, got %+v", hosts[0])
+	}
+
+	var out bytes.Buffer
+	report.Write(&out, firstParty)
+	if !strings.Contains(out.String(), thirdPartyHost) {
+		t.Errorf("report does not list %s:\n%s", thirdPartyHost, out.String())
+	}
+}
+
+func TestDirTimestampsUseNewestFile(t *testing.T) {
+	older := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	newer := time.Date(2021, 6, 7, 8, 9, 10, 0, time.UTC)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="dir/a.txt">a</a> <a href="dir/sub/b.txt">b</a></body></html>`))
+		case "/dir/a.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Last-Modified", older.Format(http.TimeFormat))
+			w.Write([]byte("a"))
+		case "/dir/sub/b.txt":
+			w.Header().Set("Content-Type", "text/plain")
+			w.Header().Set("Last-Modified", newer.Format(http.TimeFormat))
+			w.Write([]byte("b"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.NoHostDirectories = true
+	cfg.DirTimestamps = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// 目录的时间取其中（包括子目录中）最新文件的Last-Modified
+	for dir, want := range map[string]time.Time{"dir": newer, filepath.Join("dir", "sub"): newer} {
+		info, err := os.Stat(filepath.Join(outputDir, dir))
+		if err != nil {
+			t.Fatalf("stat %s: %v", dir, err)
+		}
+		if !info.ModTime().Equal(want) {
+			t.Errorf("expected %s mtime %v, got %v", dir, want, info.ModTime().UTC())
+		}
+	}
+}
+
+func TestRecursiveCacheSkipsUnchangedFiles(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]int)
+	conditional := 0
+
+	pages := map[string]string{
+		"/":          `<html><body><a href="page.html">page</a></body></html>`,
+		"/page.html": `<html><body>page</body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		etag := `"v1` + r.URL.Path + `"`
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("ETag", etag)
+		if r.Method != http.MethodGet {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if r.Header.Get("If-None-Match") == etag {
+			conditional++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		bodies[r.URL.Path]++
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.NoHostDirectories = true
+	cfg.Cache = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	for run := 0; run < 2; run++ {
+		downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+		if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+			t.Fatalf("run %d: Download failed: %v", run+1, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 第二次运行时两个页面都返回304，page.html仍从本地的index.html中发现
+	if bodies["/"] != 1 || bodies["/page.html"] != 1 {
+		t.Errorf("expected each page body to be sent once, got %v", bodies)
+	}
+	if conditional != 2 {
+		t.Errorf("expected 2 conditional requests on the second run, got %d", conditional)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, cache.FileName)); err != nil {
+		t.Errorf("expected cache file in output directory: %v", err)
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "page.html"))
+	if err != nil || string(data) != pages["/page.html"] {
+		t.Errorf("expected page.html to be kept, got %q (%v)", data, err)
+	}
+}
+
+func TestResponseTransformerAppliesBeforeSaveAndParse(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><script src="analytics.js"></script></head>` +
+				`<body><a href="page.html">page</a></body></html>`))
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>page</body></html>"))
+		case "/analytics.js":
+			w.Header().Set("Content-Type", "application/javascript")
+			w.Write([]byte("track()"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.NoHostDirectories = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	downloader.SetResponseTransformer(func(url, contentType string, body []byte) ([]byte, error) {
+		if !strings.HasPrefix(contentType, "text/html") {
+			return body, nil
+		}
+		return bytes.ReplaceAll(body, []byte(`<script src="analytics.js"></script>`), nil), nil
+	})
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.html"))
+	if err != nil {
+		t.Fatalf("read index.html: %v", err)
+	}
+	if strings.Contains(string(data), "<script") {
+		t.Errorf("expected script tag to be removed from saved file, got %s", data)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 链接提取使用转换后的内容：删除的脚本不再下载，其余链接照常跟随
+	if requested["/analytics.js"] {
+		t.Errorf("removed script should not be fetched")
+	}
+	if !requested["/page.html"] {
+		t.Errorf("expected page.html to be followed, got %v", requested)
+	}
+}
+
+func TestRecursiveDecompressesTextFiles(t *testing.T) {
+	const page = `<html><body><a href="page.html">page</a></body></html>`
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		switch r.URL.Path {
+		case "/":
+			// 不理会请求的identity，像某些代理一样返回gzip压缩的内容
+			var buf bytes.Buffer
+			gz := gzip.NewWriter(&buf)
+			gz.Write([]byte(page))
+			gz.Close()
+			w.Header().Set("Content-Type", "text/html")
+			w.Header().Set("Content-Encoding", "gzip")
+			w.Write(buf.Bytes())
+		case "/page.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte("<html><body>page</body></html>"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 1
+	cfg.NoHostDirectories = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.html"))
+	if err != nil || string(data) != page {
+		t.Errorf("expected decompressed index.html, got %q (%v)", data, err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !requested["/page.html"] {
+		t.Errorf("expected links in the compressed page to be followed, got %v", requested)
+	}
+}
+
+func TestRefererAutoUsesParentPage(t *testing.T) {
+	var mu sync.Mutex
+	referers := make(map[string]string)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			mu.Lock()
+			referers[r.URL.Path] = r.Header.Get("Referer")
+			mu.Unlock()
+		}
+
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="gallery/">gallery</a></body></html>`))
+		case "/gallery/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><img src="photo.png"></body></html>`))
+		case "/gallery/photo.png":
+			// 防盗链：只允许从图库页面引用
+			if r.Header.Get("Referer") != server.URL+"/gallery/" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.NoHostDirectories = true
+	cfg.Referer = types.RefererAuto
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := map[string]string{
+		"/":                  "",
+		"/gallery/":          server.URL + "/",
+		"/gallery/photo.png": server.URL + "/gallery/",
+	}
+	for path, referer := range want {
+		if referers[path] != referer {
+			t.Errorf("expected Referer %q for %s, got %q", referer, path, referers[path])
+		}
+	}
+	data, err := os.ReadFile(filepath.Join(outputDir, "gallery", "photo.png"))
+	if err != nil || string(data) != "png" {
+		t.Errorf("expected hotlink-protected image to be saved, got %q (%v)", data, err)
+	}
+}
+
+func TestRecursiveExtractDataURIs(t *testing.T) {
+	large := bytes.Repeat([]byte("PNG data "), 10)
+	tiny := []byte("GIF")
+	cssImage := bytes.Repeat([]byte("css image "), 10)
+	dataURI := func(mediaType string, data []byte) string {
+		return "data:" + mediaType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<html><head><link rel="stylesheet" href="style.css"></head><body>`+
+				`<img src="%s"><img src="%s"></body></html>`, dataURI("image/png", large), dataURI("image/gif", tiny))
+		case "/style.css":
+			w.Header().Set("Content-Type", "text/css")
+			fmt.Fprintf(w, `body { background: url("%s") }`, dataURI("image/png", cssImage))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.NoHostDirectories = true
+	cfg.ConvertLinks = true
+	cfg.ExtractDataURIs = true
+	cfg.DataURIMinSize = 16
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	// 文件按内容的哈希命名
+	extracted := func(data []byte, ext string) string {
+		sum := sha256.Sum256(data)
+		return converter.DataURIDir + "/" + hex.EncodeToString(sum[:8]) + ext
+	}
+
+	for file, want := range map[string][]string{
+		"index.html": {`src="` + extracted(large, ".png") + `"`, dataURI("image/gif", tiny)},
+		"style.css":  {`url("` + extracted(cssImage, ".png") + `")`},
+	} {
+		data, err := os.ReadFile(filepath.Join(outputDir, file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range want {
+			if !strings.Contains(string(data), s) {
+				t.Errorf("%s should contain %q, got %s", file, s, data)
+			}
+		}
+	}
+
+	for rel, want := range map[string][]byte{
+		extracted(large, ".png"):    large,
+		extracted(cssImage, ".png"): cssImage,
+	} {
+		data, err := os.ReadFile(filepath.Join(outputDir, filepath.FromSlash(rel)))
+		if err != nil || !bytes.Equal(data, want) {
+			t.Errorf("%s: expected decoded content %q, got %q (%v)", rel, want, data, err)
+		}
+	}
+	if entries, _ := os.ReadDir(filepath.Join(outputDir, converter.DataURIDir)); len(entries) != 2 {
+		t.Errorf("tiny data URI should stay inline, got %d extracted files", len(entries))
+	}
+}
+
+func TestRecursiveNoParent(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.Path] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/docs/guide/page.html":
+			w.Write([]byte(`<html><body><a href="next.html">next</a> <a href="sub/deep.html">deep</a>` +
+				`<a href="../index.html">up</a> <a href="/">home</a> <a href="/docs/guide">dir</a></body></html>`))
+		case "/docs/guide/next.html", "/docs/guide/sub/deep.html", "/docs/guide":
+			w.Write([]byte("<html><body>in scope</body></html>"))
+		case "/docs/index.html", "/":
+			w.Write([]byte(`<html><body><a href="/other.html">other</a></body></html>`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 3
+	cfg.NoParent = true
+	cfg.Quiet = true
+
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/docs/guide/page.html", t.TempDir()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for _, path := range []string{"/docs/guide/next.html", "/docs/guide/sub/deep.html", "/docs/guide"} {
+		if !requested[path] {
+			t.Errorf("expected %s under the start directory to be fetched, got %v", path, requested)
+		}
+	}
+	for _, path := range []string{"/docs/index.html", "/", "/other.html"} {
+		if requested[path] {
+			t.Errorf("--no-parent should not ascend to %s", path)
+		}
+	}
+}
+
+func TestRecursiveAdjustExtension(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><head><link rel="stylesheet" href="/theme"></head><body>` +
+				`<a href="/about">about</a> <a href="/old.htm">old</a> <img src="/logo"></body></html>`))
+		case "/about":
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			w.Write([]byte(`<html><body><a href="/">home</a></body></html>`))
+		case "/old.htm":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body>old</body></html>`))
+		case "/theme":
+			w.Header().Set("Content-Type", "text/css")
+			w.Write([]byte(`body { color: red }`))
+		case "/logo":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.NoHostDirectories = true
+	cfg.AdjustExtension = true
+	cfg.ConvertLinks = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	for _, name := range []string{"index.html", "about.html", "old.htm", "theme.css", "logo"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err != nil {
+			t.Errorf("expected %s to be saved: %v", name, err)
+		}
+	}
+	for _, name := range []string{"about", "theme", "old.htm.html", "logo.html"} {
+		if _, err := os.Stat(filepath.Join(outputDir, name)); err == nil {
+			t.Errorf("%s should not be saved", name)
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(outputDir, "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, link := range []string{`href="theme.css"`, `href="about.html"`, `href="old.htm"`, `src="logo"`} {
+		if !strings.Contains(string(data), link) {
+			t.Errorf("converted page should contain %s, got %s", link, data)
+		}
+	}
+}
+
+func TestRecursiveAcceptRejectRegex(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]bool)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requested[r.URL.RequestURI()] = true
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/index.html" {
+			w.Write([]byte(`<html><body><a href="/docs/a.html">a</a> <a href="/docs/b.html?print=1">b</a>` +
+				`<a href="/blog/c.html">c</a> <a href="/docs/private/d.html">d</a></body></html>`))
+			return
+		}
+		w.Write([]byte("<html><body>page</body></html>"))
+	}))
+	defer server.Close()
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("accept_regex", `/docs/`)
+	cm.GetViper().Set("reject_regex", `(\?print=|/private/)`)
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.RobotsTxt = false
+	cfg.ProxyEnabled = false
+	cfg.Quiet = true
+
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/index.html", t.TempDir()); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if !requested["/docs/a.html"] {
+		t.Errorf("expected /docs/a.html matching --accept-regex to be fetched, got %v", requested)
+	}
+	for _, uri := range []string{"/docs/b.html?print=1", "/blog/c.html", "/docs/private/d.html"} {
+		if requested[uri] {
+			t.Errorf("%s should be filtered out", uri)
+		}
+	}
+
+	cm = config.NewConfigManager()
+	cm.GetViper().Set("reject_regex", `(unclosed`)
+	if _, err := cm.Parse(); err == nil || !strings.Contains(err.Error(), "reject_regex") {
+		t.Errorf("expected reject_regex syntax error, got %v", err)
+	}
+}
+
+func TestRecursiveCanonicalizesURLs(t *testing.T) {
+	var mu sync.Mutex
+	requested := make(map[string]int)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		if r.Method == http.MethodGet {
+			requested[r.URL.Path]++
+		}
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "text/html")
+		if r.URL.Path == "/index.html" {
+			w.Write([]byte(`<html><body><a href="/page?a=1&amp;b=2">1</a> <a href="/page?b=2&amp;a=1">2</a>` +
+				`<a href="/page?a=1&amp;b=2#section">3</a> <a href="/docs/../page?a=1&amp;b=2">4</a></body></html>`))
+			return
+		}
+		w.Write([]byte("<html><body>page</body></html>"))
+	}))
+	defer server.Close()
+
+	download := func(t *testing.T, noCanonicalize bool) int {
+		t.Helper()
+		mu.Lock()
+		clear(requested)
+		mu.Unlock()
+
+		cfg := newTestConfig()
+		cfg.Recursive = true
+		cfg.RecursiveLevel = 2
+		cfg.NoCanonicalize = noCanonicalize
+		cfg.Quiet = true
+		downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+		if err := downloader.Download(context.Background(), server.URL+"/index.html", t.TempDir()); err != nil {
+			t.Fatalf("Download failed: %v", err)
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		return requested["/page"]
+	}
+
+	if n := download(t, false); n != 1 {
+		t.Errorf("equivalent URLs were fetched %d times, expected once", n)
+	}
+	if n := download(t, true); n < 2 {
+		t.Errorf("with --no-canonicalize, query order variants should be fetched separately, got %d requests", n)
+	}
+}
+
+func TestRecursiveMirror(t *testing.T) {
+	var mu sync.Mutex
+	bodies := make(map[string]int)
+	notModified := 0
+	lastModified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	pages := map[string]string{
+		"/":              `<html><body><a href="a/">a</a></body></html>`,
+		"/a/":            `<html><body><a href="b/">b</a></body></html>`,
+		"/a/b/":          `<html><body><a href="page.html">page</a></body></html>`,
+		"/a/b/page.html": `<html><body>page</body></html>`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		if r.Method != http.MethodGet {
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+		if since, err := http.ParseTime(r.Header.Get("If-Modified-Since")); err == nil && !lastModified.After(since) {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		bodies[r.URL.Path]++
+		w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	newConfig := func(cliKeys ...string) *types.Config {
+		cm := config.NewConfigManager()
+		cm.GetViper().Set("mirror", true)
+		cm.GetViper().Set("recursive_level", 1)
+		cm.GetViper().Set("no_use_server_timestamps", true)
+		cm.SetCommandLineKeys(cliKeys)
+		cfg, err := cm.Parse()
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		cfg.NoHostDirectories = true
+		cfg.RobotsTxt = false
+		cfg.ProxyEnabled = false
+		cfg.Quiet = true
+		return cfg
+	}
+
+	cfg := newConfig()
+	if !cfg.Recursive || !cfg.Timestamping || cfg.RecursiveLevel != 0 || cfg.NoUseServerTimestamps {
+		t.Fatalf("--mirror should expand to -r -N -l 0 with server timestamps, got recursive=%v timestamping=%v level=%d no-use-server-timestamps=%v",
+			cfg.Recursive, cfg.Timestamping, cfg.RecursiveLevel, cfg.NoUseServerTimestamps)
+	}
+	if explicit := newConfig("recursive_level"); explicit.RecursiveLevel != 1 {
+		t.Errorf("explicit -l should override --mirror, got level %d", explicit.RecursiveLevel)
+	}
+
+	outputDir := t.TempDir()
+	for run := 0; run < 2; run++ {
+		downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+		if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+			t.Fatalf("run %d: Download failed: %v", run+1, err)
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	// 不限深度时第一次运行下载所有页面，第二次运行全部返回304，仍从本地文件中发现更深的链接
+	for path := range pages {
+		if bodies[path] != 1 {
+			t.Errorf("expected %s to be downloaded once, got %d", path, bodies[path])
+		}
+	}
+	if notModified != len(pages) {
+		t.Errorf("expected %d not-modified responses on the second run, got %d", len(pages), notModified)
+	}
+	info, err := os.Stat(filepath.Join(outputDir, "a", "b", "page.html"))
+	if err != nil {
+		t.Fatalf("expected page.html to be saved: %v", err)
+	}
+	if !info.ModTime().Equal(lastModified) {
+		t.Errorf("expected modification time %v from Last-Modified, got %v", lastModified, info.ModTime())
+	}
+}
+
+func TestRecursiveManifest(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body><a href="` + "http://" + r.Host + `/b.html">b</a><img src="a.png"></body></html>`))
+		case "/b.html":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<html><body>b</body></html>`))
+		case "/a.png":
+			w.Header().Set("Content-Type", "image/png")
+			w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	cfg := newTestConfig()
+	cfg.Recursive = true
+	cfg.RecursiveLevel = 2
+	cfg.NoHostDirectories = true
+	cfg.ConvertLinks = true
+	cfg.Quiet = true
+
+	outputDir := t.TempDir()
+	cfg.Manifest = filepath.Join(t.TempDir(), "manifest.json")
+	downloader := recursive.NewRecursiveDownloader(httpCore.NewClient(cfg), cfg)
+	if err := downloader.Download(context.Background(), server.URL+"/", outputDir); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	data, err := os.ReadFile(cfg.Manifest)
+	if err != nil {
+		t.Fatalf("expected manifest to be written: %v", err)
+	}
+	var entries []recursive.ManifestEntry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		t.Fatalf("invalid manifest: %v", err)
+	}
+
+	want := []recursive.ManifestEntry{
+		{URL: server.URL + "/a.png", Path: filepath.Join(outputDir, "a.png"), ContentType: "image/png"},
+		{URL: server.URL + "/b.html", Path: filepath.Join(outputDir, "b.html"), ContentType: "text/html"},
+		{URL: server.URL + "/", Path: filepath.Join(outputDir, "index.html"), ContentType: "text/html"},
+	}
+	if len(entries) != len(want) {
+		t.Fatalf("expected %d manifest entries, got %+v", len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.URL != want[i].URL || entry.Path != want[i].Path || entry.ContentType != want[i].ContentType {
+			t.Errorf("entry %d: expected %+v, got %+v", i, want[i], entry)
+		}
+		// 大小为转换链接之后的文件大小
+		info, err := os.Stat(entry.Path)
+		if err != nil || info.Size() != entry.Size {
+			t.Errorf("entry %d: size %d does not match file on disk (%v)", i, entry.Size, err)
+		}
+	}
+	if files := downloader.GetDownloadedFiles(); len(files) != 3 || files[0] != want[0].Path || files[2] != want[2].Path {
+		t.Errorf("expected downloaded files sorted by path, got %v", files)
+	}
+}
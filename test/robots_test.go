@@ -0,0 +1,121 @@
+package test
+
+import (
+	"testing"
+
+	"github.com/example/wget2go/internal/core/queue"
+	"github.com/example/wget2go/internal/core/robots"
+	"github.com/example/wget2go/internal/core/types"
+)
+
+func TestRobotsLongestMatchWins(t *testing.T) {
+	robotsTxt := `User-agent: *
+Allow: /private/public
+Disallow: /private
+Disallow: /*.php$
+Allow: /shop/*.php$
+Disallow: /tmp/
+Allow: /tmp/
+Disallow: /search?q=
+`
+	parser := robots.NewParser()
+	if err := parser.ParseString(robotsTxt, "wget2go"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		url     string
+		allowed bool
+	}{
+		{"http://example.com/private/secret.html", false},
+		{"http://example.com/private/public/page.html", true}, // Allow比Disallow更具体
+		{"http://example.com/index.php", false},
+		{"http://example.com/index.php?x=1", true}, // $要求路径在此结束
+		{"http://example.com/shop/cart.php", true},
+		{"http://example.com/tmp/file", true}, // 长度相同时Allow优先
+		{"http://example.com/search?q=go", false},
+		{"http://example.com/searchXq=go", true}, // ?按字面匹配
+		{"http://example.com/", true},
+	}
+
+	manager := queue.NewManager()
+	manager.SetRobotsParser("example.com", &types.RobotsParser{Rules: parser.GetRules()})
+
+	for _, c := range cases {
+		if got := parser.IsAllowed(c.url, "wget2go"); got != c.allowed {
+			t.Errorf("Parser.IsAllowed(%s) = %v, want %v", c.url, got, c.allowed)
+		}
+		if got := manager.IsAllowedByRobots(c.url, "wget2go"); got != c.allowed {
+			t.Errorf("Manager.IsAllowedByRobots(%s) = %v, want %v", c.url, got, c.allowed)
+		}
+	}
+}
+
+func TestRobotsSelectsMostSpecificUserAgentGroup(t *testing.T) {
+	robotsTxt := `User-agent: *
+Disallow: /all
+
+User-agent: bot
+Disallow: /bot
+
+User-agent: Bot-News
+Disallow: /news
+
+User-agent: otherbot
+Disallow: /other
+`
+	parser := robots.NewParser()
+	if err := parser.ParseString(robotsTxt, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		userAgent string
+		path      string // 该user-agent唯一被禁止的路径
+	}{
+		{"bot-news/2.0 (+https://example.com)", "/news"}, // 完全匹配优先于前缀bot
+		{"BOT-images/1.0", "/bot"},                       // 没有完全匹配时使用最长的前缀
+		{"Bot", "/bot"},
+		{"mybot/1.0", "/all"}, // 不按子串匹配，回退到*
+		{"wget2go", "/all"},
+	}
+
+	for _, c := range cases {
+		for _, path := range []string{"/all", "/bot", "/news", "/other"} {
+			want := path != c.path
+			if got := parser.IsPathAllowed(path, c.userAgent); got != want {
+				t.Errorf("IsPathAllowed(%s, %q) = %v, want %v", path, c.userAgent, got, want)
+			}
+		}
+	}
+}
+
+func TestRobotsMultiAgentRecord(t *testing.T) {
+	robotsTxt := `User-agent: alpha
+User-agent: beta
+Disallow: /x
+Crawl-delay: 3
+
+User-agent: gamma
+Disallow: /y
+`
+	parser := robots.NewParser()
+	if err := parser.ParseString(robotsTxt, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, agent := range []string{"alpha", "beta"} {
+		if parser.IsPathAllowed("/x", agent) {
+			t.Errorf("%s should be disallowed from /x", agent)
+		}
+		if !parser.IsPathAllowed("/y", agent) {
+			t.Errorf("%s should not get gamma's rules", agent)
+		}
+		if delay := parser.GetCrawlDelay(agent); delay != 3 {
+			t.Errorf("%s crawl delay = %d, want 3", agent, delay)
+		}
+	}
+	if parser.IsPathAllowed("/y", "gamma") || !parser.IsPathAllowed("/x", "gamma") {
+		t.Error("gamma should only be disallowed from /y")
+	}
+}
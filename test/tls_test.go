@@ -0,0 +1,604 @@
+package test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/example/wget2go/internal/config"
+	httpCore "github.com/example/wget2go/internal/core/http"
+	tlsCore "github.com/example/wget2go/internal/core/tls"
+	"github.com/example/wget2go/internal/core/types"
+	"golang.org/x/crypto/ocsp"
+)
+
+// writeClientCertificate 生成自签名的客户端证书，将证书和私钥分别写入PEM文件
+func writeClientCertificate(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "wget2go client"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = filepath.Join(dir, "client.crt")
+	keyFile = filepath.Join(dir, "client.key")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, cert
+}
+
+// writePEM 将DER数据以PEM格式写入文件
+func writePEM(t *testing.T, path, blockType string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClientCertificateAndCACertificate(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCertificate(t, dir)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.TLS.PeerCertificates[0].Subject.CommonName))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	// 服务器的自签名证书作为--ca-certificate
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", server.Certificate().Raw)
+
+	get := func(t *testing.T, settings map[string]string) (string, error) {
+		t.Helper()
+		cm := config.NewConfigManager()
+		for key, value := range settings {
+			cm.GetViper().Set(key, value)
+		}
+		cfg, err := cm.Parse()
+		if err != nil {
+			t.Fatalf("Parse failed: %v", err)
+		}
+		resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+		if err != nil {
+			return "", err
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		return string(body), err
+	}
+
+	t.Run("WithCertificate", func(t *testing.T) {
+		body, err := get(t, map[string]string{"certificate": certFile, "private_key": keyFile, "ca_certificate": caFile})
+		if err != nil {
+			t.Fatalf("request with client certificate failed: %v", err)
+		}
+		if body != "wget2go client" {
+			t.Errorf("server saw client certificate %q", body)
+		}
+	})
+
+	t.Run("CombinedPEM", func(t *testing.T) {
+		// 未指定--private-key时从证书文件中读取私钥
+		certPEM, _ := os.ReadFile(certFile)
+		keyPEM, _ := os.ReadFile(keyFile)
+		combined := filepath.Join(dir, "combined.pem")
+		if err := os.WriteFile(combined, append(certPEM, keyPEM...), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := get(t, map[string]string{"certificate": combined, "ca_certificate": caFile}); err != nil {
+			t.Fatalf("request with combined certificate file failed: %v", err)
+		}
+	})
+
+	t.Run("WithoutCertificate", func(t *testing.T) {
+		if _, err := get(t, map[string]string{"ca_certificate": caFile}); err == nil {
+			t.Error("expected the handshake to fail without a client certificate")
+		}
+	})
+
+	t.Run("WithoutCACertificate", func(t *testing.T) {
+		if _, err := get(t, map[string]string{"certificate": certFile, "private_key": keyFile}); err == nil {
+			t.Error("expected certificate verification to fail without --ca-certificate")
+		}
+	})
+}
+
+func TestClientUsesCertManagerTLSSettings(t *testing.T) {
+	for _, tc := range []struct {
+		name      string
+		server    *tls.Config
+		handshake bool
+	}{
+		{"TLS13", &tls.Config{}, true},
+		{"AllowedCipherSuite", &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256}}, true},
+		// Go默认启用CBC模式的加密套件，证书管理器的列表只包含AEAD套件
+		{"CBCCipherSuite", &tls.Config{MaxVersion: tls.VersionTLS12, CipherSuites: []uint16{tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA}}, false},
+		// 最低协议版本为TLS 1.2
+		{"TLS11", &tls.Config{MaxVersion: tls.VersionTLS11}, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+			server.TLS = tc.server
+			server.Config.ErrorLog = log.New(io.Discard, "", 0)
+			server.StartTLS()
+			defer server.Close()
+
+			cfg := newTestConfig()
+			cfg.Insecure = true
+			resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if ok := err == nil; ok != tc.handshake {
+				t.Errorf("expected handshake success %v, got error %v", tc.handshake, err)
+			}
+		})
+	}
+}
+
+func TestPinnedPubKey(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	// 自签名证书的公钥哈希
+	pin := "sha256//" + tlsCore.PublicKeyPin(server.Certificate())
+	otherPin := "sha256//" + base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))
+
+	for _, tc := range []struct {
+		name  string
+		pins  string
+		allow bool
+	}{
+		{"Match", pin, true},
+		{"OneOfSeveral", otherPin + ";" + pin, true},
+		{"Mismatch", otherPin, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := config.NewConfigManager()
+			cm.GetViper().Set("insecure", true)
+			cm.GetViper().Set("pinnedpubkey", tc.pins)
+			cfg, err := cm.Parse()
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tc.allow && err != nil {
+				t.Errorf("expected the pinned key to be accepted, got %v", err)
+			}
+			if !tc.allow && (err == nil || !strings.Contains(err.Error(), "pinnedpubkey")) {
+				t.Errorf("expected a pinnedpubkey mismatch error, got %v", err)
+			}
+		})
+	}
+
+	for _, invalid := range []string{"sha1//" + tlsCore.PublicKeyPin(server.Certificate()), "sha256//not-base64", "sha256//AAAA"} {
+		cm := config.NewConfigManager()
+		cm.GetViper().Set("pinnedpubkey", invalid)
+		if _, err := cm.Parse(); err == nil {
+			t.Errorf("expected Parse to reject pinnedpubkey %q", invalid)
+		}
+	}
+}
+
+func TestPinnedPubKeyMismatchNotRetried(t *testing.T) {
+	var connections atomic.Int32
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ConnState = func(_ net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			connections.Add(1)
+		}
+	}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("insecure", true)
+	cm.GetViper().Set("pinnedpubkey", "sha256//"+base64.StdEncoding.EncodeToString(make([]byte, sha256.Size)))
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	// 公钥不匹配不是暂时性错误，--wait-retry下也不重试
+	cfg.WaitRetry = 10 * time.Millisecond
+
+	_, err = httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+	var verifyErr *tlsCore.VerificationError
+	if !errors.As(err, &verifyErr) {
+		t.Fatalf("expected a VerificationError, got %v", err)
+	}
+	if httpCore.IsRetryable(err) {
+		t.Errorf("a pinnedpubkey mismatch must not be retryable")
+	}
+	if n := connections.Load(); n != 1 {
+		t.Errorf("expected exactly one attempt, got %d connections", n)
+	}
+}
+
+// ocspTestPKI 测试用的CA和由它签发的服务器证书，服务器证书的OCSP响应服务器为ocspURL
+type ocspTestPKI struct {
+	ca     *x509.Certificate
+	caKey  *ecdsa.PrivateKey
+	leaf   tls.Certificate
+	caFile string
+}
+
+func newOCSPTestPKI(t *testing.T, ocspURL string) *ocspTestPKI {
+	t.Helper()
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	caTemplate := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "wget2go test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageCertSign | x509.KeyUsageDigitalSignature,
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTemplate, caTemplate, &caKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ca, _ := x509.ParseCertificate(caDER)
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		OCSPServer:   []string{ocspURL},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, ca, &leafKey.PublicKey, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", caDER)
+	return &ocspTestPKI{
+		ca:     ca,
+		caKey:  caKey,
+		leaf:   tls.Certificate{Certificate: [][]byte{leafDER, caDER}, PrivateKey: leafKey},
+		caFile: caFile,
+	}
+}
+
+// response 生成由CA签名的服务器证书OCSP响应
+func (p *ocspTestPKI) response(t *testing.T, status int) []byte {
+	t.Helper()
+	resp, err := ocsp.CreateResponse(p.ca, p.ca, ocsp.Response{
+		Status:       status,
+		SerialNumber: big.NewInt(2),
+		ThisUpdate:   time.Now().Add(-time.Minute),
+		NextUpdate:   time.Now().Add(time.Hour),
+		RevokedAt:    time.Now().Add(-time.Minute),
+	}, p.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestCheckOCSP(t *testing.T) {
+	var responderStatus atomic.Int32
+	var responderUp atomic.Bool
+	var pki *ocspTestPKI
+	responder := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !responderUp.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(pki.response(t, int(responderStatus.Load())))
+	}))
+	defer responder.Close()
+	pki = newOCSPTestPKI(t, responder.URL)
+
+	for _, tc := range []struct {
+		name      string
+		responder int // OCSP响应服务器返回的状态，-1表示不可达
+		stapled   int // 服务器装订的状态，-1表示不装订
+		softFail  bool
+		allow     bool
+	}{
+		{"Good", ocsp.Good, -1, false, true},
+		{"Revoked", ocsp.Revoked, -1, false, false},
+		{"RevokedSoftFail", ocsp.Revoked, -1, true, false},
+		{"Unreachable", -1, -1, false, false},
+		{"UnreachableSoftFail", -1, -1, true, true},
+		{"StapledRevoked", ocsp.Good, ocsp.Revoked, false, false},
+		{"StapledGood", -1, ocsp.Good, false, true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			responderUp.Store(tc.responder >= 0)
+			responderStatus.Store(int32(tc.responder))
+
+			leaf := pki.leaf
+			if tc.stapled >= 0 {
+				leaf.OCSPStaple = pki.response(t, tc.stapled)
+			}
+			server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("ok"))
+			}))
+			server.TLS = &tls.Config{Certificates: []tls.Certificate{leaf}}
+			server.Config.ErrorLog = log.New(io.Discard, "", 0)
+			server.StartTLS()
+			defer server.Close()
+
+			cm := config.NewConfigManager()
+			cm.GetViper().Set("ca_certificate", pki.caFile)
+			cm.GetViper().Set("check_ocsp", true)
+			cm.GetViper().Set("ocsp_soft_fail", tc.softFail)
+			cfg, err := cm.Parse()
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if (err == nil) != tc.allow {
+				t.Errorf("expected connection allowed %v, got error %v", tc.allow, err)
+			}
+		})
+	}
+}
+
+func TestCertificateConfigErrors(t *testing.T) {
+	dir := t.TempDir()
+	certFile, _, _ := writeClientCertificate(t, dir)
+
+	for name, settings := range map[string]map[string]string{
+		"KeyWithoutCertificate": {"private_key": filepath.Join(dir, "client.key")},
+		"MissingKey":            {"certificate": certFile}, // 证书文件中没有私钥
+		"MissingCertificate":    {"certificate": filepath.Join(dir, "missing.crt")},
+		"InvalidCACertificate":  {"ca_certificate": filepath.Join(dir, "client.key")},
+	} {
+		t.Run(name, func(t *testing.T) {
+			cm := config.NewConfigManager()
+			for key, value := range settings {
+				cm.GetViper().Set(key, value)
+			}
+			if _, err := cm.Parse(); err == nil {
+				t.Error("expected Parse to fail")
+			}
+		})
+	}
+}
+
+func TestInvalidTLSConfigFailsClosed(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	defer server.Close()
+
+	for _, tc := range []struct {
+		name  string
+		hosts map[string]*types.HostConfig
+	}{
+		{"Client", nil},
+		// 配置文件hosts中主机的客户端由同一配置创建
+		{"HostClient", map[string]*types.HostConfig{"127.0.0.1": {}}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// 未经Parse检查的配置：客户端证书无法加载时不能退回到不检查公钥固定的默认设置
+			cfg := newTestConfig()
+			cfg.Insecure = true
+			cfg.Certificate = filepath.Join(t.TempDir(), "missing.crt")
+			cfg.PinnedPubKeys = []string{base64.StdEncoding.EncodeToString(make([]byte, sha256.Size))}
+			cfg.Hosts = tc.hosts
+
+			resp, err := httpCore.NewClient(cfg).Get(context.Background(), server.URL, "")
+			if err == nil {
+				resp.Body.Close()
+			}
+			var configErr *httpCore.TLSConfigError
+			if !errors.As(err, &configErr) {
+				t.Fatalf("expected a TLSConfigError, got %v", err)
+			}
+			if httpCore.IsRetryable(err) {
+				t.Errorf("an invalid TLS configuration must not be retryable")
+			}
+		})
+	}
+}
+
+// newCertTestServer 启动使用测试CA签发的服务器证书的HTTPS服务器，证书名称为dnsName，有效期截止到notAfter
+func newCertTestServer(t *testing.T, dnsName string, notAfter time.Time) (serverURL, caFile string) {
+	t.Helper()
+	pki := newOCSPTestPKI(t, "")
+
+	leafKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	leafTemplate := &x509.Certificate{
+		SerialNumber: big.NewInt(3),
+		Subject:      pkix.Name{CommonName: dnsName},
+		DNSNames:     []string{dnsName},
+		NotBefore:    notAfter.Add(-2 * time.Hour),
+		NotAfter:     notAfter,
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	leafDER, err := x509.CreateCertificate(rand.Reader, leafTemplate, pki.ca, &leafKey.PublicKey, pki.caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{leafDER, pki.ca.Raw}, PrivateKey: leafKey}}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	// 通过localhost访问，握手时发送SNI
+	return strings.Replace(server.URL, "127.0.0.1", "localhost", 1), pki.caFile
+}
+
+func TestNoCheckCertificate(t *testing.T) {
+	expiredURL, expiredCA := newCertTestServer(t, "localhost", time.Now().Add(-time.Hour))
+	wrongNameURL, wrongNameCA := newCertTestServer(t, "other.example", time.Now().Add(time.Hour))
+
+	for _, tc := range []struct {
+		name    string
+		url     string
+		caFile  string
+		checks  string
+		success bool
+	}{
+		{"ExpiredDefault", expiredURL, expiredCA, "", false},
+		{"ExpiredSkipExpiry", expiredURL, expiredCA, "expiry", true},
+		{"ExpiredSkipHostname", expiredURL, expiredCA, "hostname", false},
+		{"WrongNameDefault", wrongNameURL, wrongNameCA, "", false},
+		{"WrongNameSkipHostname", wrongNameURL, wrongNameCA, "hostname", true},
+		{"WrongNameSkipExpiry", wrongNameURL, wrongNameCA, "expiry", false},
+		{"UntrustedCA", expiredURL, "", "expiry,hostname", false},
+		{"All", expiredURL, "", "all", true},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cm := config.NewConfigManager()
+			cm.GetViper().Set("no_check_certificate", tc.checks)
+			cm.GetViper().Set("ca_certificate", tc.caFile)
+			cfg, err := cm.Parse()
+			if err != nil {
+				t.Fatalf("Parse failed: %v", err)
+			}
+			cfg.ProxyEnabled = false
+
+			resp, err := httpCore.NewClient(cfg).Get(context.Background(), tc.url, "")
+			if err == nil {
+				resp.Body.Close()
+			}
+			if tc.success && err != nil {
+				t.Errorf("expected success with --no-check-certificate=%s, got %v", tc.checks, err)
+			}
+			if !tc.success && err == nil {
+				t.Errorf("expected certificate verification to fail with --no-check-certificate=%s", tc.checks)
+			}
+		})
+	}
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("no_check_certificate", "revocation")
+	if _, err := cm.Parse(); err == nil {
+		t.Error("expected an error for an unknown certificate check")
+	}
+}
+
+func TestOCSPQueryUsesProxyAndCache(t *testing.T) {
+	// 响应服务器的主机名无法解析，只能经--http-proxy访问
+	var queries atomic.Int32
+	var pki *ocspTestPKI
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "ocsp.invalid" {
+			http.Error(w, "unexpected target", http.StatusBadGateway)
+			return
+		}
+		queries.Add(1)
+		w.Header().Set("Content-Type", "application/ocsp-response")
+		w.Write(pki.response(t, ocsp.Good))
+	}))
+	defer proxy.Close()
+	pki = newOCSPTestPKI(t, "http://ocsp.invalid/")
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	server.TLS = &tls.Config{Certificates: []tls.Certificate{pki.leaf}}
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+	// 每个请求使用新连接，每次握手都要检查OCSP
+	server.Config.SetKeepAlivesEnabled(false)
+	server.StartTLS()
+	defer server.Close()
+
+	cm := config.NewConfigManager()
+	cm.GetViper().Set("ca_certificate", pki.caFile)
+	cm.GetViper().Set("check_ocsp", true)
+	cm.GetViper().Set("http_proxy", proxy.URL)
+	cm.GetViper().Set("no_proxy", "127.0.0.1")
+	cfg, err := cm.Parse()
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	client := httpCore.NewClient(cfg)
+	for i := 0; i < 3; i++ {
+		resp, err := client.Get(context.Background(), server.URL, "")
+		if err != nil {
+			t.Fatalf("request %d failed: %v", i+1, err)
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+	if n := queries.Load(); n != 1 {
+		t.Errorf("expected one OCSP query through the proxy for three connections, got %d", n)
+	}
+}